@@ -0,0 +1,136 @@
+package apikey
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"github.com/rjansen/haki"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	//Header is the default request header of the API keys
+	Header = "X-Api-Key"
+	//Query is the default query parameter of the API keys
+	Query = "api_key"
+	//TokenPrefix prefixes the prefix of the key in the identity token
+	TokenPrefix = "apikey:"
+
+	prefixSize = 6
+	secretSize = 32
+	separator  = "_"
+)
+
+var (
+	//ErrInvalidKey is returned when the API key is malformed, unknown, disabled or expired and rendered as a 401 response
+	ErrInvalidKey = haki.NewStatusError(http.StatusUnauthorized, "Invalid API key")
+)
+
+//Key is a stored API key, only the hash of the key is kept
+type Key struct {
+	//Prefix is the public part of the key that identifies it in the store and in the logs
+	Prefix string `json:"prefix"`
+	//Hash is the hex SHA-256 of the whole key, see Hash
+	Hash     string            `json:"hash"`
+	Name     string            `json:"name"`
+	Scopes   []string          `json:"scopes,omitempty"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+	//Expires is the key expiration, zero means never
+	Expires  time.Time `json:"expires,omitempty"`
+	Disabled bool      `json:"disabled,omitempty"`
+}
+
+//Token returns the identity token of the key, built from its prefix
+func (k *Key) Token() string {
+	return TokenPrefix + k.Prefix
+}
+
+//Identity returns the identity value of the key, with the scopes read by the authz policies
+func (k *Key) Identity() map[string]interface{} {
+	return map[string]interface{}{
+		"name":     k.Name,
+		"prefix":   k.Prefix,
+		"scopes":   k.Scopes,
+		"metadata": k.Metadata,
+	}
+}
+
+//KeyStore finds the stored keys by their prefix, FindKey returns nil when the key is not found
+type KeyStore interface {
+	FindKey(prefix string) (*Key, error)
+}
+
+//Generate creates a new API key, to be handed to the client, and its Key with the hash to be stored
+func Generate(name string, scopes ...string) (string, *Key, error) {
+	raw := make([]byte, prefixSize+secretSize)
+	if _, err := rand.Read(raw); err != nil {
+		return "", nil, err
+	}
+	prefix := hex.EncodeToString(raw[:prefixSize])
+	key := prefix + separator + base64.RawURLEncoding.EncodeToString(raw[prefixSize:])
+	return key, &Key{Prefix: prefix, Hash: Hash(key), Name: name, Scopes: scopes}, nil
+}
+
+//Hash returns the hex SHA-256 of the key.
+//The generated keys are long random values, so a fast hash is enough to not keep them in the store
+func Hash(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+//Prefix returns the public prefix of the key, false when the key is malformed
+func Prefix(key string) (string, bool) {
+	i := strings.Index(key, separator)
+	if i <= 0 || i == len(key)-1 {
+		return "", false
+	}
+	return key[:i], true
+}
+
+//Redact returns the key without its secret part, safe to be logged
+func Redact(key string) string {
+	if prefix, ok := Prefix(key); ok {
+		return prefix + separator + "***"
+	}
+	return "***"
+}
+
+//Resolver resolves the API keys of the requests against a KeyStore
+type Resolver struct {
+	store KeyStore
+	now   func() time.Time
+	//Header and Query are where the key is read from, the header is checked first. An empty Query disables it
+	Header string
+	Query  string
+}
+
+//NewResolver creates a Resolver of the KeyStore that reads the keys from the Header header and the Query parameter
+func NewResolver(store KeyStore) *Resolver {
+	return &Resolver{store: store, now: time.Now, Header: Header, Query: Query}
+}
+
+//Resolve returns the stored Key of the API key or ErrInvalidKey
+func (r *Resolver) Resolve(key string) (*Key, error) {
+	prefix, ok := Prefix(key)
+	if !ok {
+		return nil, ErrInvalidKey
+	}
+	stored, err := r.store.FindKey(prefix)
+	if err != nil {
+		return nil, err
+	}
+	if stored == nil {
+		return nil, ErrInvalidKey
+	}
+	if subtle.ConstantTimeCompare([]byte(Hash(key)), []byte(strings.ToLower(stored.Hash))) != 1 {
+		return nil, ErrInvalidKey
+	}
+	if stored.Disabled || (!stored.Expires.IsZero() && !r.now().Before(stored.Expires)) {
+		return nil, ErrInvalidKey
+	}
+	return stored, nil
+}
@@ -0,0 +1,81 @@
+package apikey
+
+import (
+	"github.com/rjansen/l"
+	"github.com/rjansen/l/zap"
+	"github.com/stretchr/testify/assert"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func init() {
+	if setupErr := zap.Setup(new(l.Configuration)); setupErr != nil {
+		panic(setupErr)
+	}
+	l.Info("context.apikey_test.init")
+}
+
+func TestGenerate(t *testing.T) {
+	key, stored, err := Generate("billing", "invoices:read")
+	assert.Nil(t, err)
+	prefix, ok := Prefix(key)
+	assert.True(t, ok)
+	assert.Equal(t, stored.Prefix, prefix)
+	assert.Equal(t, Hash(key), stored.Hash)
+	assert.NotContains(t, stored.Hash, key)
+	assert.Equal(t, "apikey:"+prefix, stored.Token())
+	assert.Equal(t, []string{"invoices:read"}, stored.Identity()["scopes"])
+
+	assert.Equal(t, prefix+"_***", Redact(key))
+	assert.False(t, strings.Contains(Redact(key), key[len(prefix)+1:]))
+	assert.Equal(t, "***", Redact("secret"))
+	for _, malformed := range []string{"", "secret", "_secret", "prefix_"} {
+		_, ok = Prefix(malformed)
+		assert.False(t, ok, malformed)
+	}
+}
+
+func TestResolve(t *testing.T) {
+	key, stored, err := Generate("billing")
+	assert.Nil(t, err)
+	expiredKey, expired, err := Generate("expired")
+	assert.Nil(t, err)
+	expired.Expires = time.Unix(1500000000, 0)
+	disabledKey, disabled, err := Generate("disabled")
+	assert.Nil(t, err)
+	disabled.Disabled = true
+	stored.Hash = strings.ToUpper(stored.Hash)
+	stored.Metadata = map[string]string{"team": "finance"}
+
+	path := filepath.Join(t.TempDir(), "keys.json")
+	assert.Nil(t, Save(path, stored, expired, disabled))
+	store, err := NewFileStore(path)
+	assert.Nil(t, err)
+	resolver := NewResolver(store)
+	resolver.now = func() time.Time { return time.Unix(1500000000, 0) }
+
+	resolved, err := resolver.Resolve(key)
+	assert.Nil(t, err)
+	assert.Equal(t, "billing", resolved.Name)
+	assert.Equal(t, "finance", resolved.Metadata["team"])
+
+	prefix, _ := Prefix(key)
+	for _, invalid := range []string{"", key + "x", prefix + "_forged", "unknown_" + key[len(prefix)+1:], expiredKey, disabledKey} {
+		_, err = resolver.Resolve(invalid)
+		assert.Equal(t, ErrInvalidKey, err, invalid)
+	}
+
+	newKey, newStored, err := Generate("new")
+	assert.Nil(t, err)
+	assert.Nil(t, Save(path, newStored))
+	assert.Nil(t, store.Reload())
+	_, err = resolver.Resolve(newKey)
+	assert.Nil(t, err)
+	_, err = resolver.Resolve(key)
+	assert.Equal(t, ErrInvalidKey, err)
+
+	_, err = NewFileStore(filepath.Join(t.TempDir(), "missing.json"))
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,59 @@
+package apikey
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"sync"
+)
+
+//FileStore is a KeyStore of a json file with an array of Keys, like the ones returned by Generate
+type FileStore struct {
+	path  string
+	mutex sync.RWMutex
+	keys  map[string]*Key
+}
+
+//NewFileStore creates a FileStore with the keys of the file
+func NewFileStore(path string) (*FileStore, error) {
+	store := &FileStore{path: path}
+	if err := store.Reload(); err != nil {
+		return nil, err
+	}
+	return store, nil
+}
+
+//Reload reads the file again, keeping the current keys when it fails
+func (s *FileStore) Reload() error {
+	data, err := ioutil.ReadFile(s.path)
+	if err != nil {
+		return err
+	}
+	var list []*Key
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	keys := make(map[string]*Key, len(list))
+	for _, key := range list {
+		keys[key.Prefix] = key
+	}
+	s.mutex.Lock()
+	s.keys = keys
+	s.mutex.Unlock()
+	return nil
+}
+
+//FindKey returns the key of the prefix, nil when not found
+func (s *FileStore) FindKey(prefix string) (*Key, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.keys[prefix], nil
+}
+
+//Save writes the keys into a file readable by NewFileStore
+func Save(path string, keys ...*Key) error {
+	data, err := json.MarshalIndent(keys, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0600)
+}
@@ -0,0 +1,113 @@
+package auth
+
+import (
+	"github.com/rjansen/haki"
+	"github.com/rjansen/l"
+	"golang.org/x/crypto/bcrypt"
+	"net/http"
+	"sync"
+)
+
+var (
+	//ErrInvalidCredentials is returned when the user is not found or the password does not match, rendered as a 401 response
+	ErrInvalidCredentials = haki.NewStatusError(http.StatusUnauthorized, "Invalid username or password")
+	//ErrMissingCredentials is returned when the username or password is empty, rendered as a 400 response
+	ErrMissingCredentials = haki.NewStatusError(http.StatusBadRequest, "Username and password are required")
+)
+
+//User is a user of a UserStore
+type User struct {
+	Username string
+	//PasswordHash is the bcrypt hash of the password, see HashPassword
+	PasswordHash []byte
+	//Token and Value are the identity stored in the session of the logged user
+	Token string
+	Value interface{}
+}
+
+//UserStore finds the users to authenticate, FindUser returns nil when the user is not found
+type UserStore interface {
+	FindUser(username string) (*User, error)
+}
+
+//PasswordUpdater is implemented by the UserStores that keep the hashes rehashed when the configured cost changes
+type PasswordUpdater interface {
+	UpdatePassword(username string, hash []byte) error
+}
+
+//HashPassword returns the bcrypt hash of the password, cost zero uses bcrypt.DefaultCost
+func HashPassword(password string, cost int) ([]byte, error) {
+	if cost == 0 {
+		cost = bcrypt.DefaultCost
+	}
+	return bcrypt.GenerateFromPassword([]byte(password), cost)
+}
+
+//Authenticator verifies the credentials against a UserStore
+type Authenticator struct {
+	store     UserStore
+	cost      int
+	dummyOnce sync.Once
+	dummy     []byte
+}
+
+//NewAuthenticator creates an Authenticator hashing with the provided bcrypt cost, like the security.encrypt_cost key of haki.yaml
+func NewAuthenticator(store UserStore, cost int) *Authenticator {
+	if cost == 0 {
+		cost = bcrypt.DefaultCost
+	}
+	return &Authenticator{store: store, cost: cost}
+}
+
+//NewAuthenticatorWithConfig creates an Authenticator with the haki.yaml security section cost
+func NewAuthenticatorWithConfig(store UserStore, config Configuration) *Authenticator {
+	return NewAuthenticator(store, config.EncryptCost)
+}
+
+//compareDummy spends the time of a password comparison when the user is not found, to not reveal the existing usernames
+func (a *Authenticator) compareDummy(password string) {
+	a.dummyOnce.Do(func() {
+		a.dummy, _ = bcrypt.GenerateFromPassword([]byte("dummy password"), a.cost)
+	})
+	bcrypt.CompareHashAndPassword(a.dummy, []byte(password))
+}
+
+//Authenticate returns the user of the credentials or ErrInvalidCredentials.
+//The hashes of other cost are rehashed when the UserStore is a PasswordUpdater
+func (a *Authenticator) Authenticate(username string, password string) (*User, error) {
+	if username == "" || password == "" {
+		return nil, ErrMissingCredentials
+	}
+	user, err := a.store.FindUser(username)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		a.compareDummy(password)
+		return nil, ErrInvalidCredentials
+	}
+	if err := bcrypt.CompareHashAndPassword(user.PasswordHash, []byte(password)); err != nil {
+		return nil, ErrInvalidCredentials
+	}
+	if updater, ok := a.store.(PasswordUpdater); ok {
+		if cost, err := bcrypt.Cost(user.PasswordHash); err == nil && cost != a.cost {
+			a.rehash(updater, user, password)
+		}
+	}
+	return user, nil
+}
+
+func (a *Authenticator) rehash(updater PasswordUpdater, user *User, password string) {
+	hash, err := HashPassword(password, a.cost)
+	if err == nil {
+		err = updater.UpdatePassword(user.Username, hash)
+	}
+	if err != nil {
+		l.Warn("haki.auth.RehashErr",
+			l.String("username", user.Username),
+			l.Err(err),
+		)
+		return
+	}
+	user.PasswordHash = hash
+}
@@ -0,0 +1,94 @@
+package auth
+
+import (
+	"errors"
+	"github.com/rjansen/l"
+	"github.com/rjansen/l/zap"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
+	"testing"
+)
+
+func init() {
+	if setupErr := zap.Setup(new(l.Configuration)); setupErr != nil {
+		panic(setupErr)
+	}
+	l.Info("context.auth_test.init")
+}
+
+type mockStore struct {
+	users   map[string]*User
+	updated map[string][]byte
+	err     error
+}
+
+func (s *mockStore) FindUser(username string) (*User, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+	return s.users[username], nil
+}
+
+func (s *mockStore) UpdatePassword(username string, hash []byte) error {
+	s.updated[username] = hash
+	return nil
+}
+
+func TestAuthenticate(t *testing.T) {
+	hash, err := HashPassword("secret", bcrypt.MinCost)
+	assert.Nil(t, err)
+	store := &mockStore{
+		users:   map[string]*User{"user": {Username: "user", PasswordHash: hash, Token: "user_token"}},
+		updated: make(map[string][]byte),
+	}
+	authenticator := NewAuthenticatorWithConfig(store, Configuration{EncryptCost: bcrypt.MinCost})
+
+	user, err := authenticator.Authenticate("user", "secret")
+	assert.Nil(t, err)
+	assert.Equal(t, "user_token", user.Token)
+	assert.Empty(t, store.updated)
+
+	_, err = authenticator.Authenticate("user", "wrong")
+	assert.Equal(t, ErrInvalidCredentials, err)
+	_, err = authenticator.Authenticate("unknown", "secret")
+	assert.Equal(t, ErrInvalidCredentials, err)
+	_, err = authenticator.Authenticate("user", "")
+	assert.Equal(t, ErrMissingCredentials, err)
+
+	store.err = errors.New("store down")
+	_, err = authenticator.Authenticate("user", "secret")
+	assert.Equal(t, store.err, err)
+}
+
+func TestAuthenticateRehash(t *testing.T) {
+	hash, err := HashPassword("secret", bcrypt.MinCost)
+	assert.Nil(t, err)
+	store := &mockStore{
+		users:   map[string]*User{"user": {Username: "user", PasswordHash: hash}},
+		updated: make(map[string][]byte),
+	}
+	authenticator := NewAuthenticator(store, bcrypt.MinCost+1)
+	user, err := authenticator.Authenticate("user", "secret")
+	assert.Nil(t, err)
+	cost, err := bcrypt.Cost(store.updated["user"])
+	assert.Nil(t, err)
+	assert.Equal(t, bcrypt.MinCost+1, cost)
+	assert.Equal(t, store.updated["user"], user.PasswordHash)
+}
+
+func TestLoginOptions(t *testing.T) {
+	config := FormConfiguration{
+		FormUsernameField: "fivecolors_username",
+		FormPasswordField: "fivecolors_password",
+		RedirectURL:       "http://localhost:7080/web/",
+		LoginCallbackURL:  "http://127.0.0.1:4000/player/",
+	}
+	options := NewLoginOptions(config)
+	assert.Equal(t, "fivecolors_username", options.UsernameField)
+	assert.Equal(t, "http://localhost:7080/web/", options.RedirectURL)
+	config.UseLoginCallback = true
+	assert.Equal(t, "http://127.0.0.1:4000/player/", NewLoginOptions(config).RedirectURL)
+
+	options = LoginOptions{}.WithDefaults()
+	assert.Equal(t, LoginOptions{UsernameField: "username", PasswordField: "password", RedirectURL: "/"}, options)
+}
@@ -0,0 +1,63 @@
+package auth
+
+//Configuration maps the security section of the haki.yaml file
+type Configuration struct {
+	//EncryptCost is the bcrypt cost of the password hashes
+	EncryptCost int `json:"encrypt_cost" yaml:"encrypt_cost" mapstructure:"encrypt_cost"`
+}
+
+//FormConfiguration maps the form login keys of the proxy section of the haki.yaml file
+type FormConfiguration struct {
+	//FormURI is the path of the login handler
+	FormURI string `json:"form_uri" yaml:"form_uri" mapstructure:"form_uri"`
+	//FormUsernameField and FormPasswordField are the names of the login form fields
+	FormUsernameField string `json:"form_username_field" yaml:"form_username_field" mapstructure:"form_username_field"`
+	FormPasswordField string `json:"form_password_field" yaml:"form_password_field" mapstructure:"form_password_field"`
+	//RedirectURL is where the logged users are sent
+	RedirectURL string `json:"redirect_url" yaml:"redirect_url" mapstructure:"redirect_url"`
+	//UseLoginCallback sends the logged users to the LoginCallbackURL instead of the RedirectURL
+	UseLoginCallback bool   `json:"use_login_callback" yaml:"use_login_callback" mapstructure:"use_login_callback"`
+	LoginCallbackURL string `json:"login_callback_url" yaml:"login_callback_url" mapstructure:"login_callback_url"`
+}
+
+//Redirect returns the url where the logged users are sent
+func (c FormConfiguration) Redirect() string {
+	if c.UseLoginCallback && c.LoginCallbackURL != "" {
+		return c.LoginCallbackURL
+	}
+	return c.RedirectURL
+}
+
+//LoginOptions holds the login form handlers settings
+type LoginOptions struct {
+	//UsernameField and PasswordField are the names of the login form fields, username and password when empty
+	UsernameField string
+	PasswordField string
+	//RedirectURL is where the logged users are sent, / when empty
+	RedirectURL string
+	//FailureURL is where the failed logins are sent, empty returns the authentication error instead
+	FailureURL string
+}
+
+//NewLoginOptions creates the LoginOptions of the haki.yaml proxy section
+func NewLoginOptions(config FormConfiguration) LoginOptions {
+	return LoginOptions{
+		UsernameField: config.FormUsernameField,
+		PasswordField: config.FormPasswordField,
+		RedirectURL:   config.Redirect(),
+	}
+}
+
+//WithDefaults returns the options with the empty fields set to the defaults
+func (o LoginOptions) WithDefaults() LoginOptions {
+	if o.UsernameField == "" {
+		o.UsernameField = "username"
+	}
+	if o.PasswordField == "" {
+		o.PasswordField = "password"
+	}
+	if o.RedirectURL == "" {
+		o.RedirectURL = "/"
+	}
+	return o
+}
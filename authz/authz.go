@@ -0,0 +1,183 @@
+package authz
+
+import (
+	"github.com/rjansen/haki"
+	"net/http"
+	"strings"
+)
+
+var (
+	//ErrUnauthenticated is returned when an anonymous request is denied and rendered as a 401 response
+	ErrUnauthenticated = haki.NewStatusError(http.StatusUnauthorized, "Authentication required")
+	//ErrForbidden is returned when an authenticated request is denied and rendered as a 403 response
+	ErrForbidden = haki.NewStatusError(http.StatusForbidden, "Permission denied")
+)
+
+//Subject is the request identity evaluated by the policies
+type Subject struct {
+	Token string
+	//Value is the identity value, the roles and scopes are read from it by RolesOf and ScopesOf
+	Value         interface{}
+	Authenticated bool
+}
+
+//Request is the transport agnostic view of the request evaluated by the policies
+type Request struct {
+	Method string
+	Path   string
+	//Header returns the request header value
+	Header func(name string) string
+}
+
+//RolesHolder is implemented by the identity values that carry roles
+type RolesHolder interface {
+	Roles() []string
+}
+
+//ScopesHolder is implemented by the identity values that carry OAuth scopes
+type ScopesHolder interface {
+	Scopes() []string
+}
+
+//Policy is a named authorization rule, the name is recorded with the allow and deny decisions
+type Policy struct {
+	Name  string
+	Allow func(subject Subject, request Request) bool
+}
+
+//Func creates a Policy of a custom predicate over the identity and the request
+func Func(name string, allow func(subject Subject, request Request) bool) Policy {
+	return Policy{Name: name, Allow: allow}
+}
+
+//Authenticated allows any authenticated subject
+func Authenticated() Policy {
+	return Func("authenticated", func(subject Subject, request Request) bool {
+		return subject.Authenticated
+	})
+}
+
+//Roles allows the authenticated subjects with any of the roles
+func Roles(roles ...string) Policy {
+	return Func("roles("+strings.Join(roles, ",")+")", func(subject Subject, request Request) bool {
+		return subject.Authenticated && containsAny(RolesOf(subject.Value), roles)
+	})
+}
+
+//Scopes allows the authenticated subjects granted all the scopes
+func Scopes(scopes ...string) Policy {
+	return Func("scopes("+strings.Join(scopes, ",")+")", func(subject Subject, request Request) bool {
+		return subject.Authenticated && containsAll(ScopesOf(subject.Value), scopes)
+	})
+}
+
+//All allows the requests allowed by all the policies
+func All(policies ...Policy) Policy {
+	return Func("all("+names(policies)+")", func(subject Subject, request Request) bool {
+		for _, policy := range policies {
+			if !policy.Allow(subject, request) {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+//Any allows the requests allowed by any of the policies
+func Any(policies ...Policy) Policy {
+	return Func("any("+names(policies)+")", func(subject Subject, request Request) bool {
+		for _, policy := range policies {
+			if policy.Allow(subject, request) {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+func names(policies []Policy) string {
+	names := make([]string, len(policies))
+	for i, policy := range policies {
+		names[i] = policy.Name
+	}
+	return strings.Join(names, ",")
+}
+
+//Evaluate returns nil when the policy allows the request, ErrUnauthenticated when it denies an anonymous subject
+//and ErrForbidden when it denies an authenticated one
+func Evaluate(policy Policy, subject Subject, request Request) error {
+	if policy.Allow(subject, request) {
+		return nil
+	}
+	if !subject.Authenticated {
+		return ErrUnauthenticated
+	}
+	return ErrForbidden
+}
+
+//RolesOf returns the roles of a RolesHolder or of the roles key of a map value
+func RolesOf(value interface{}) []string {
+	if holder, ok := value.(RolesHolder); ok {
+		return holder.Roles()
+	}
+	return valuesOf(value, "roles")
+}
+
+//ScopesOf returns the scopes of a ScopesHolder or of the scope or scopes keys of a map value,
+//the scope key being a space delimited string like the OAuth token responses
+func ScopesOf(value interface{}) []string {
+	if holder, ok := value.(ScopesHolder); ok {
+		return holder.Scopes()
+	}
+	if scopes := valuesOf(value, "scopes"); scopes != nil {
+		return scopes
+	}
+	return valuesOf(value, "scope")
+}
+
+func valuesOf(value interface{}, key string) []string {
+	var raw interface{}
+	switch values := value.(type) {
+	case map[string]interface{}:
+		raw = values[key]
+	case map[string][]string:
+		raw = values[key]
+	case map[string]string:
+		raw = values[key]
+	}
+	switch values := raw.(type) {
+	case []string:
+		return values
+	case string:
+		return strings.Fields(values)
+	case []interface{}:
+		result := make([]string, 0, len(values))
+		for _, v := range values {
+			if s, ok := v.(string); ok {
+				result = append(result, s)
+			}
+		}
+		return result
+	}
+	return nil
+}
+
+func containsAny(values []string, expected []string) bool {
+	for _, e := range expected {
+		for _, v := range values {
+			if v == e {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func containsAll(values []string, expected []string) bool {
+	for _, e := range expected {
+		if !containsAny(values, []string{e}) {
+			return false
+		}
+	}
+	return true
+}
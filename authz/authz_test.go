@@ -0,0 +1,64 @@
+package authz
+
+import (
+	"github.com/rjansen/l"
+	"github.com/rjansen/l/zap"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func init() {
+	if setupErr := zap.Setup(new(l.Configuration)); setupErr != nil {
+		panic(setupErr)
+	}
+	l.Info("context.authz_test.init")
+}
+
+type mockUser struct {
+	roles []string
+}
+
+func (u mockUser) Roles() []string {
+	return u.roles
+}
+
+func TestValuesOf(t *testing.T) {
+	assert.Equal(t, []string{"admin"}, RolesOf(mockUser{roles: []string{"admin"}}))
+	assert.Equal(t, []string{"admin", "editor"}, RolesOf(map[string]interface{}{"roles": []interface{}{"admin", 1, "editor"}}))
+	assert.Equal(t, []string{"admin"}, RolesOf(map[string][]string{"roles": {"admin"}}))
+	assert.Equal(t, []string{"read", "write"}, ScopesOf(map[string]interface{}{"scope": "read  write"}))
+	assert.Equal(t, []string{"read"}, ScopesOf(map[string]string{"scopes": "read"}))
+	assert.Nil(t, RolesOf("user"))
+	assert.Nil(t, ScopesOf(nil))
+}
+
+func TestEvaluate(t *testing.T) {
+	request := Request{Method: "DELETE", Path: "/users/1", Header: func(name string) string { return "" }}
+	anonymous := Subject{}
+	user := Subject{Token: "user", Authenticated: true, Value: map[string]interface{}{"roles": []string{"editor"}, "scope": "users:read"}}
+	admin := Subject{Token: "admin", Authenticated: true, Value: mockUser{roles: []string{"admin"}}}
+
+	assert.Equal(t, ErrUnauthenticated, Evaluate(Authenticated(), anonymous, request))
+	assert.Nil(t, Evaluate(Authenticated(), user, request))
+
+	roles := Roles("admin", "owner")
+	assert.Equal(t, "roles(admin,owner)", roles.Name)
+	assert.Equal(t, ErrUnauthenticated, Evaluate(roles, anonymous, request))
+	assert.Equal(t, ErrForbidden, Evaluate(roles, user, request))
+	assert.Nil(t, Evaluate(roles, admin, request))
+
+	scopes := Scopes("users:read", "users:write")
+	assert.Equal(t, ErrForbidden, Evaluate(scopes, user, request))
+	assert.Nil(t, Evaluate(Scopes("users:read"), user, request))
+
+	owner := Func("owner", func(subject Subject, request Request) bool {
+		return request.Path == "/users/"+subject.Token
+	})
+	policy := Any(Roles("admin"), All(Scopes("users:read"), owner))
+	assert.Equal(t, "any(roles(admin),all(scopes(users:read),owner))", policy.Name)
+	assert.Nil(t, Evaluate(policy, admin, request))
+	assert.Equal(t, ErrForbidden, Evaluate(policy, user, request))
+	request.Path = "/users/user"
+	assert.Nil(t, Evaluate(policy, user, request))
+	assert.Equal(t, ErrUnauthenticated, Evaluate(policy, anonymous, request))
+}
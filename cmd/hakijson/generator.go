@@ -0,0 +1,460 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+const (
+	//Annotation is the comment that marks a struct for generation
+	Annotation = "//haki:json"
+	//ImportPath is the import path of the runtime helpers used by the generated code
+	ImportPath = "github.com/rjansen/haki/media/json"
+)
+
+var (
+	//ErrEmbeddedField is returned when an annotated struct has an embedded field
+	ErrEmbeddedField = errors.New("Embedded fields are not supported")
+	//ErrStringOption is returned when an annotated struct field uses the json string tag option
+	ErrStringOption = errors.New("The json string tag option is not supported")
+)
+
+type kind int
+
+const (
+	kindOther kind = iota
+	kindString
+	kindBool
+	kindInt
+	kindUint
+	kindFloat
+	kindBytes
+	kindTime
+	kindStruct
+	kindPtr
+	kindSlice
+)
+
+//typeInfo is the generation model of a field type
+type typeInfo struct {
+	kind kind
+	bits int
+	name string
+	elem *typeInfo
+}
+
+//field is the generation model of an exported struct field
+type field struct {
+	name      string
+	key       string
+	omitEmpty bool
+	typ       *typeInfo
+}
+
+var basicTypes = map[string]typeInfo{
+	"string":  {kind: kindString},
+	"bool":    {kind: kindBool},
+	"int":     {kind: kindInt},
+	"int8":    {kind: kindInt, bits: 8},
+	"int16":   {kind: kindInt, bits: 16},
+	"int32":   {kind: kindInt, bits: 32},
+	"rune":    {kind: kindInt, bits: 32},
+	"int64":   {kind: kindInt, bits: 64},
+	"uint":    {kind: kindUint},
+	"uint8":   {kind: kindUint, bits: 8},
+	"byte":    {kind: kindUint, bits: 8},
+	"uint16":  {kind: kindUint, bits: 16},
+	"uint32":  {kind: kindUint, bits: 32},
+	"uint64":  {kind: kindUint, bits: 64},
+	"float32": {kind: kindFloat, bits: 32},
+	"float64": {kind: kindFloat, bits: 64},
+}
+
+func isAnnotated(doc *ast.CommentGroup) bool {
+	if doc == nil {
+		return false
+	}
+	for _, c := range doc.List {
+		if strings.TrimSpace(c.Text) == Annotation {
+			return true
+		}
+	}
+	return false
+}
+
+//annotatedSpecs returns the annotated struct types declared in the file
+func annotatedSpecs(f *ast.File) []*ast.TypeSpec {
+	var specs []*ast.TypeSpec
+	for _, decl := range f.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.TYPE {
+			continue
+		}
+		for _, spec := range gen.Specs {
+			ts := spec.(*ast.TypeSpec)
+			if _, isStruct := ts.Type.(*ast.StructType); !isStruct {
+				continue
+			}
+			if isAnnotated(ts.Doc) || (len(gen.Specs) == 1 && isAnnotated(gen.Doc)) {
+				specs = append(specs, ts)
+			}
+		}
+	}
+	return specs
+}
+
+//annotatedStructs returns the names of the annotated structs of the package that declares file
+func annotatedStructs(dir string, file string) (map[string]bool, error) {
+	fset := token.NewFileSet()
+	target, err := parser.ParseFile(fset, dir+string(os.PathSeparator)+file, nil, parser.PackageClauseOnly)
+	if err != nil {
+		return nil, err
+	}
+	pkgs, err := parser.ParseDir(fset, dir, nil, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+	annotated := make(map[string]bool)
+	if pkg, found := pkgs[target.Name.Name]; found {
+		for _, f := range pkg.Files {
+			for _, ts := range annotatedSpecs(f) {
+				annotated[ts.Name.Name] = true
+			}
+		}
+	}
+	return annotated, nil
+}
+
+func newTypeInfo(expr ast.Expr, annotated map[string]bool) *typeInfo {
+	info := &typeInfo{name: types.ExprString(expr)}
+	switch t := expr.(type) {
+	case *ast.Ident:
+		if basic, found := basicTypes[t.Name]; found {
+			info.kind, info.bits = basic.kind, basic.bits
+		} else if annotated[t.Name] {
+			info.kind = kindStruct
+		}
+	case *ast.SelectorExpr:
+		if pkg, ok := t.X.(*ast.Ident); ok && pkg.Name == "time" && t.Sel.Name == "Time" {
+			info.kind = kindTime
+		}
+	case *ast.StarExpr:
+		//Pointers and slices of time.Time are left to encoding/json, the generated file does not import time
+		if elem := newTypeInfo(t.X, annotated); elem.kind != kindOther && elem.kind != kindTime {
+			info.kind, info.elem = kindPtr, elem
+		}
+	case *ast.ArrayType:
+		if t.Len != nil {
+			break
+		}
+		if ident, ok := t.Elt.(*ast.Ident); ok && (ident.Name == "byte" || ident.Name == "uint8") {
+			info.kind = kindBytes
+		} else if elem := newTypeInfo(t.Elt, annotated); elem.kind != kindOther && elem.kind != kindTime {
+			info.kind, info.elem = kindSlice, elem
+		}
+	}
+	return info
+}
+
+func structFields(st *ast.StructType, annotated map[string]bool) ([]field, error) {
+	var fields []field
+	for _, f := range st.Fields.List {
+		if len(f.Names) == 0 {
+			return nil, ErrEmbeddedField
+		}
+		var tag reflect.StructTag
+		if f.Tag != nil {
+			unquoted, err := strconv.Unquote(f.Tag.Value)
+			if err != nil {
+				return nil, err
+			}
+			tag = reflect.StructTag(unquoted)
+		}
+		jsonTag := tag.Get("json")
+		if jsonTag == "-" {
+			continue
+		}
+		options := strings.Split(jsonTag, ",")
+		key, omitEmpty := options[0], false
+		for _, option := range options[1:] {
+			switch option {
+			case "omitempty":
+				omitEmpty = true
+			case "string":
+				return nil, ErrStringOption
+			}
+		}
+		typ := newTypeInfo(f.Type, annotated)
+		for _, name := range f.Names {
+			if !name.IsExported() {
+				continue
+			}
+			fieldKey := key
+			if fieldKey == "" {
+				fieldKey = name.Name
+			}
+			fields = append(fields, field{name: name.Name, key: fieldKey, omitEmpty: omitEmpty, typ: typ})
+		}
+	}
+	return fields, nil
+}
+
+//Generate returns the formatted source with the json methods of the annotated structs in src,
+//or nil when src does not have annotated structs. Fields typed by a struct in annotated use its generated methods
+func Generate(filename string, src []byte, annotated map[string]bool) ([]byte, error) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, filename, src, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+	specs := annotatedSpecs(f)
+	if len(specs) == 0 {
+		return nil, nil
+	}
+	known := make(map[string]bool, len(annotated)+len(specs))
+	for name := range annotated {
+		known[name] = true
+	}
+	for _, ts := range specs {
+		known[ts.Name.Name] = true
+	}
+	g := &generator{}
+	g.printf("// Code generated by hakijson from %s. DO NOT EDIT.\n\n", filename)
+	g.printf("package %s\n\nimport hakijson %q\n", f.Name.Name, ImportPath)
+	for _, ts := range specs {
+		fields, err := structFields(ts.Type.(*ast.StructType), known)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", ts.Name.Name, err.Error())
+		}
+		g.marshalMethod(ts.Name.Name, fields)
+		g.unmarshalMethod(ts.Name.Name, fields)
+	}
+	return format.Source(g.buf.Bytes())
+}
+
+type generator struct {
+	buf bytes.Buffer
+	//fallible is set when the generated code assigns the err var
+	fallible bool
+}
+
+func (g *generator) printf(format string, args ...interface{}) {
+	fmt.Fprintf(&g.buf, format, args...)
+}
+
+//body generates into a separate buffer, so the caller knows if the err var is needed
+func (g *generator) body(gen func(*generator)) (string, bool) {
+	inner := &generator{}
+	gen(inner)
+	return inner.buf.String(), inner.fallible
+}
+
+func (g *generator) marshalMethod(name string, fields []field) {
+	body, fallible := g.body(func(b *generator) {
+		for _, f := range fields {
+			b.marshalField(f)
+		}
+	})
+	g.printf("\n//MarshalJSONTo appends the json representation of %s to buf\n", name)
+	g.printf("func (m %s) MarshalJSONTo(buf []byte) ([]byte, error) {\n", name)
+	if fallible {
+		g.printf("var err error\n")
+	}
+	g.printf("start := len(buf)\n")
+	g.buf.WriteString(body)
+	g.printf("if len(buf) == start {\nreturn append(buf, \"{}\"...), nil\n}\n")
+	g.printf("buf[start] = '{'\nreturn append(buf, '}'), nil\n}\n")
+}
+
+func omitEmptyCondition(t *typeInfo, expr string) string {
+	switch t.kind {
+	case kindString:
+		return expr + ` != ""`
+	case kindBool:
+		return expr
+	case kindInt, kindUint, kindFloat:
+		return expr + " != 0"
+	case kindBytes, kindSlice:
+		return "len(" + expr + ") != 0"
+	case kindPtr:
+		return expr + " != nil"
+	case kindOther:
+		return "!hakijson.IsEmptyValue(" + expr + ")"
+	}
+	return ""
+}
+
+func (g *generator) marshalField(f field) {
+	expr := "m." + f.name
+	condition := ""
+	if f.omitEmpty {
+		condition = omitEmptyCondition(f.typ, expr)
+	}
+	if condition != "" {
+		g.printf("if %s {\n", condition)
+	}
+	//Every member starts with a comma, the first one is replaced by the object start
+	g.printf("buf = append(buf, %s...)\n", strconv.Quote(","+string(keyLiteral(f.key))+":"))
+	if condition != "" && f.typ.kind == kindPtr {
+		//The omitempty condition already skips nil pointers
+		g.marshalValue(f.typ.elem, "(*"+expr+")", 0)
+	} else {
+		g.marshalValue(f.typ, expr, 0)
+	}
+	if condition != "" {
+		g.printf("}\n")
+	}
+}
+
+func keyLiteral(key string) []byte {
+	var buf bytes.Buffer
+	buf.WriteByte('"')
+	for _, r := range key {
+		switch {
+		case r == '"' || r == '\\':
+			buf.WriteByte('\\')
+			buf.WriteRune(r)
+		case r < 0x20 || r == '<' || r == '>' || r == '&':
+			fmt.Fprintf(&buf, "\\u%04x", r)
+		default:
+			buf.WriteRune(r)
+		}
+	}
+	buf.WriteByte('"')
+	return buf.Bytes()
+}
+
+//convert returns expr converted to the type name, unless it already has that type
+func convert(name string, t *typeInfo, expr string) string {
+	if t.name == name {
+		return expr
+	}
+	return name + "(" + expr + ")"
+}
+
+func (g *generator) marshalValue(t *typeInfo, expr string, depth int) {
+	switch t.kind {
+	case kindString:
+		g.printf("buf = hakijson.AppendString(buf, %s)\n", expr)
+	case kindBool:
+		g.printf("buf = hakijson.AppendBool(buf, %s)\n", expr)
+	case kindInt:
+		g.printf("buf = hakijson.AppendInt(buf, %s)\n", convert("int64", t, expr))
+	case kindUint:
+		g.printf("buf = hakijson.AppendUint(buf, %s)\n", convert("uint64", t, expr))
+	case kindFloat:
+		g.fallible = true
+		g.printf("if buf, err = hakijson.AppendFloat(buf, %s, %d); err != nil {\nreturn buf, err\n}\n", convert("float64", t, expr), t.bits)
+	case kindBytes:
+		g.printf("buf = hakijson.AppendBytes(buf, %s)\n", expr)
+	case kindTime:
+		g.fallible = true
+		g.printf("if buf, err = hakijson.AppendTime(buf, %s); err != nil {\nreturn buf, err\n}\n", expr)
+	case kindStruct:
+		g.fallible = true
+		g.printf("if buf, err = %s.MarshalJSONTo(buf); err != nil {\nreturn buf, err\n}\n", expr)
+	case kindPtr:
+		g.printf("if %s == nil {\nbuf = append(buf, \"null\"...)\n} else {\n", expr)
+		g.marshalValue(t.elem, "(*"+expr+")", depth)
+		g.printf("}\n")
+	case kindSlice:
+		i := fmt.Sprintf("i%d", depth)
+		g.printf("if %s == nil {\nbuf = append(buf, \"null\"...)\n} else {\n", expr)
+		g.printf("buf = append(buf, '[')\nfor %s := range %s {\n", i, expr)
+		g.printf("if %s > 0 {\nbuf = append(buf, ',')\n}\n", i)
+		g.marshalValue(t.elem, expr+"["+i+"]", depth+1)
+		g.printf("}\nbuf = append(buf, ']')\n}\n")
+	default:
+		g.fallible = true
+		g.printf("if buf, err = hakijson.AppendValue(buf, %s); err != nil {\nreturn buf, err\n}\n", expr)
+	}
+}
+
+func (g *generator) unmarshalMethod(name string, fields []field) {
+	g.printf("\n//UnmarshalJSONFrom reads the json representation in raw into %s\n", name)
+	g.printf("func (m *%s) UnmarshalJSONFrom(raw []byte) error {\n", name)
+	g.printf("var scanner hakijson.ObjectScanner\nscanner.Reset(raw)\n")
+	if len(fields) == 0 {
+		g.printf("for scanner.Next() {\n}\nreturn scanner.Err()\n}\n")
+		return
+	}
+	keys := make([]string, len(fields))
+	for i, f := range fields {
+		keys[i] = strconv.Quote(f.key)
+	}
+	//Like encoding/json, a key without an exact match matches a field key under case folding
+	g.printf("for scanner.Next() {\nvalue := scanner.Value()\nvar err error\nswitch hakijson.MatchKey(scanner.Key(), %s) {\n", strings.Join(keys, ", "))
+	for _, f := range fields {
+		g.printf("case %s:\n", strconv.Quote(f.key))
+		g.unmarshalValue(f.typ, "m."+f.name, "value", 0)
+	}
+	g.printf("}\nif err != nil {\nreturn err\n}\n}\nreturn scanner.Err()\n}\n")
+}
+
+func (g *generator) unmarshalValue(t *typeInfo, target string, value string, depth int) {
+	switch t.kind {
+	case kindStruct, kindOther:
+		//Generated and encoding/json unmarshalers handle null by themselves
+		g.decodeValue(t, target, value, depth)
+		return
+	case kindBytes, kindPtr, kindSlice:
+		//Like encoding/json, null sets nil to nillable types and is ignored by the others
+		g.printf("if hakijson.IsNull(%s) {\n%s = nil\n} else {\n", value, target)
+	default:
+		g.printf("if !hakijson.IsNull(%s) {\n", value)
+	}
+	g.decodeValue(t, target, value, depth)
+	g.printf("}\n")
+}
+
+//decodeValue reads the not null json value into target
+func (g *generator) decodeValue(t *typeInfo, target string, value string, depth int) {
+	switch t.kind {
+	case kindStruct:
+		g.printf("err = %s.UnmarshalJSONFrom(%s)\n", target, value)
+	case kindString:
+		g.printf("%s, err = hakijson.ParseString(%s)\n", target, value)
+	case kindBool:
+		g.printf("%s, err = hakijson.ParseBool(%s)\n", target, value)
+	case kindInt:
+		g.printf("var n%d int64\nif n%d, err = hakijson.ParseInt(%s, %d); err == nil {\n%s = %s\n}\n",
+			depth, depth, value, t.bits, target, convert(t.name, &typeInfo{name: "int64"}, fmt.Sprintf("n%d", depth)))
+	case kindUint:
+		g.printf("var n%d uint64\nif n%d, err = hakijson.ParseUint(%s, %d); err == nil {\n%s = %s\n}\n",
+			depth, depth, value, t.bits, target, convert(t.name, &typeInfo{name: "uint64"}, fmt.Sprintf("n%d", depth)))
+	case kindFloat:
+		g.printf("var f%d float64\nif f%d, err = hakijson.ParseFloat(%s, %d); err == nil {\n%s = %s\n}\n",
+			depth, depth, value, t.bits, target, convert(t.name, &typeInfo{name: "float64"}, fmt.Sprintf("f%d", depth)))
+	case kindBytes:
+		g.printf("%s, err = hakijson.ParseBytes(%s)\n", target, value)
+	case kindTime:
+		g.printf("%s, err = hakijson.ParseTime(%s)\n", target, value)
+	case kindPtr:
+		g.printf("if %s == nil {\n%s = new(%s)\n}\n", target, target, t.elem.name)
+		if t.elem.kind == kindStruct {
+			g.printf("err = %s.UnmarshalJSONFrom(%s)\n", target, value)
+		} else {
+			g.decodeValue(t.elem, "*"+target, value, depth+1)
+		}
+	case kindSlice:
+		a, e := fmt.Sprintf("a%d", depth), fmt.Sprintf("e%d", depth)
+		//Like encoding/json, the slice is reused and an empty array is decoded as an empty slice
+		g.printf("if cap(%s) == 0 {\n%s = make(%s, 0, 4)\n} else {\n%s = %s[:0]\n}\n", target, target, t.name, target, target)
+		g.printf("var %s hakijson.ArrayScanner\n%s.Reset(%s)\n", a, a, value)
+		g.printf("for %s.Next() {\nvar %s %s\n%s = append(%s, %s)\n", a, e, t.elem.name, target, target, e)
+		g.unmarshalValue(t.elem, target+"[len("+target+")-1]", a+".Value()", depth+1)
+		g.printf("if err != nil {\nreturn err\n}\n}\nerr = %s.Err()\n", a)
+	default:
+		g.printf("err = hakijson.UnmarshalValue(%s, &%s)\n", value, target)
+	}
+}
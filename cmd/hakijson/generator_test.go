@@ -0,0 +1,92 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestOutputName(t *testing.T) {
+	assert.Equal(t, "dir/model_json.go", outputName("dir/model.go"))
+	assert.Equal(t, "model_json_test.go", outputName("model_test.go"))
+}
+
+func TestGenerateUpToDate(t *testing.T) {
+	dir := "../../media/json"
+	src, err := ioutil.ReadFile(dir + "/mock_test.go")
+	assert.Nil(t, err)
+	annotated, err := annotatedStructs(dir, "mock_test.go")
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]bool{"mockAddress": true, "mockUser": true}, annotated)
+
+	generated, err := Generate("mock_test.go", src, annotated)
+	assert.Nil(t, err)
+	committed, err := ioutil.ReadFile(dir + "/mock_json_test.go")
+	assert.Nil(t, err)
+	assert.Equal(t, string(committed), string(generated), "media/json/mock_json_test.go is outdated, run go generate")
+}
+
+func TestGenerate(t *testing.T) {
+	src := `package model
+
+import "time"
+
+//Ignored is not annotated
+type Ignored struct {
+	Name string
+}
+
+//haki:json
+type Model struct {
+	ID      int64 ` + "`json:\"id\"`" + `
+	Name    string
+	Skipped string ` + "`json:\"-\"`" + `
+	hidden  string
+	Nested  []*Nested ` + "`json:\"nested,omitempty\"`" + `
+	Other   *Other
+	Times   []time.Time
+}
+
+type (
+	//Nested is annotated in a grouped declaration
+	//haki:json
+	Nested struct {
+		Values []int8 ` + "`json:\"values\"`" + `
+	}
+)
+`
+	generated, err := Generate("model.go", []byte(src), map[string]bool{"Other": true})
+	assert.Nil(t, err)
+	code := string(generated)
+	assert.True(t, strings.HasPrefix(code, "// Code generated by hakijson from model.go. DO NOT EDIT."))
+	assert.Contains(t, code, "func (m Model) MarshalJSONTo(buf []byte) ([]byte, error) {")
+	assert.Contains(t, code, "func (m *Model) UnmarshalJSONFrom(raw []byte) error {")
+	assert.Contains(t, code, "func (m Nested) MarshalJSONTo(buf []byte) ([]byte, error) {")
+	assert.Contains(t, code, "func (m *Nested) UnmarshalJSONFrom(raw []byte) error {")
+	assert.NotContains(t, code, "Ignored")
+	assert.NotContains(t, code, "Skipped")
+	assert.NotContains(t, code, "hidden")
+	assert.Contains(t, code, `case "id":`)
+	assert.Contains(t, code, `case "Name":`)
+	assert.Contains(t, code, "m.Other.UnmarshalJSONFrom(value)")
+	assert.Contains(t, code, "hakijson.UnmarshalValue(value, &m.Times)")
+	assert.Contains(t, code, "m.Values = append(m.Values, e0)")
+
+	generated, err = Generate("model.go", []byte("package model\n\ntype Model struct {\n}\n"), nil)
+	assert.Nil(t, err)
+	assert.Nil(t, generated)
+}
+
+func TestGenerateErr(t *testing.T) {
+	_, err := Generate("model.go", []byte("package model\n\n//haki:json\ntype Model struct {\n\tOther\n}\n"), nil)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), ErrEmbeddedField.Error())
+
+	_, err = Generate("model.go", []byte("package model\n\n//haki:json\ntype Model struct {\n\tID int `json:\",string\"`\n}\n"), nil)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), ErrStringOption.Error())
+
+	_, err = Generate("model.go", []byte("package model\n\ntype Model struct {"), nil)
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,62 @@
+//hakijson generates the MarshalJSONTo and UnmarshalJSONFrom methods used by the
+//github.com/rjansen/haki/media/json fast path for the structs annotated with a //haki:json comment.
+//
+//Usage:
+//	//go:generate hakijson $GOFILE
+//
+//The methods of the structs declared in file.go are written to file_json.go, and file_json_test.go for test files.
+//Fields of unsupported types, like maps, interfaces and types from other packages, are handled by encoding/json
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+func outputName(file string) string {
+	if strings.HasSuffix(file, "_test.go") {
+		return strings.TrimSuffix(file, "_test.go") + "_json_test.go"
+	}
+	return strings.TrimSuffix(file, ".go") + "_json.go"
+}
+
+func run(file string) error {
+	src, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	annotated, err := annotatedStructs(filepath.Dir(file), filepath.Base(file))
+	if err != nil {
+		return err
+	}
+	generated, err := Generate(filepath.Base(file), src, annotated)
+	if err != nil {
+		return err
+	}
+	if generated == nil {
+		return nil
+	}
+	return ioutil.WriteFile(outputName(file), generated, 0644)
+}
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: hakijson file.go [file.go...]\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	for _, file := range flag.Args() {
+		if err := run(file); err != nil {
+			fmt.Fprintf(os.Stderr, "hakijson: %s: %s\n", file, err.Error())
+			os.Exit(1)
+		}
+	}
+}
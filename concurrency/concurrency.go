@@ -0,0 +1,223 @@
+package concurrency
+
+import (
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+//Mode is the algorithm that adjusts the Limiter limit
+type Mode int
+
+const (
+	//Static keeps the limit fixed at Options.Limit
+	Static Mode = iota
+	//AIMD increases the limit by one for each fast request and multiplies it by Options.Backoff for each slow or failed request
+	AIMD
+	//Gradient moves the limit by the ratio between the long term average latency and the sampled latency
+	Gradient
+)
+
+//Options holds the Limiter settings
+type Options struct {
+	//Mode is the algorithm that adjusts the limit
+	Mode Mode
+	//Limit is the static limit or the initial adaptive limit of requests in flight
+	Limit int
+	//MinLimit and MaxLimit are the bounds of the adaptive limit
+	MinLimit int
+	MaxLimit int
+	//QueueSize is the max number of requests waiting for a slot, zero sheds as soon as the limit is reached
+	QueueSize int
+	//QueueTimeout is the max wait of a queued request
+	QueueTimeout time.Duration
+	//RetryAfter is the wait suggested to the shed requests
+	RetryAfter time.Duration
+	//Latency is the AIMD latency above which a request is considered slow
+	Latency time.Duration
+	//Backoff is the AIMD multiplicative decrease factor, between 0 and 1
+	Backoff float64
+	//Smoothing is the Gradient weight, between 0 and 1, of a new limit and of a latency sample in the long term average
+	Smoothing float64
+}
+
+var (
+	//DefaultOptions are the base values of the Options fields left as zero by New
+	DefaultOptions = Options{
+		Limit:        100,
+		MinLimit:     1,
+		MaxLimit:     1000,
+		QueueTimeout: 50 * time.Millisecond,
+		RetryAfter:   time.Second,
+		Latency:      time.Second,
+		Backoff:      0.9,
+		Smoothing:    0.2,
+	}
+)
+
+//Stats is a snapshot of the Limiter counters
+type Stats struct {
+	Limit    int
+	InFlight int
+	Queued   int
+	Rejected uint64
+}
+
+//Limiter bounds the requests in flight, queues the exceeding ones briefly and sheds them when the queue is full or the wait expires
+type Limiter struct {
+	options  Options
+	mutex    sync.Mutex
+	limit    float64
+	inFlight int
+	queue    []*waiter
+	rejected uint64
+	//longLatency is the Gradient long term average latency in nanoseconds
+	longLatency float64
+}
+
+type waiter struct {
+	ready   chan struct{}
+	granted bool
+}
+
+//New creates a Limiter, the zero Options fields are set with the DefaultOptions values
+func New(options Options) *Limiter {
+	if options.Limit <= 0 {
+		options.Limit = DefaultOptions.Limit
+	}
+	if options.MinLimit <= 0 {
+		options.MinLimit = DefaultOptions.MinLimit
+	}
+	if options.MaxLimit <= 0 {
+		options.MaxLimit = DefaultOptions.MaxLimit
+	}
+	if options.MaxLimit < options.Limit {
+		options.MaxLimit = options.Limit
+	}
+	if options.QueueTimeout <= 0 {
+		options.QueueTimeout = DefaultOptions.QueueTimeout
+	}
+	if options.RetryAfter <= 0 {
+		options.RetryAfter = DefaultOptions.RetryAfter
+	}
+	if options.Latency <= 0 {
+		options.Latency = DefaultOptions.Latency
+	}
+	if options.Backoff <= 0 || options.Backoff >= 1 {
+		options.Backoff = DefaultOptions.Backoff
+	}
+	if options.Smoothing <= 0 || options.Smoothing > 1 {
+		options.Smoothing = DefaultOptions.Smoothing
+	}
+	return &Limiter{options: options, limit: float64(options.Limit)}
+}
+
+//RetryAfter returns the wait suggested to the shed requests
+func (l *Limiter) RetryAfter() time.Duration {
+	return l.options.RetryAfter
+}
+
+//Acquire takes a slot, waiting in the queue when the limit is reached.
+//It returns false when the request must be shed, otherwise the slot must be returned with Release
+func (l *Limiter) Acquire(done <-chan struct{}) bool {
+	l.mutex.Lock()
+	if l.inFlight < int(l.limit) {
+		l.inFlight++
+		l.mutex.Unlock()
+		return true
+	}
+	if len(l.queue) >= l.options.QueueSize {
+		l.mutex.Unlock()
+		atomic.AddUint64(&l.rejected, 1)
+		return false
+	}
+	w := &waiter{ready: make(chan struct{})}
+	l.queue = append(l.queue, w)
+	l.mutex.Unlock()
+
+	timer := time.NewTimer(l.options.QueueTimeout)
+	defer timer.Stop()
+	select {
+	case <-w.ready:
+		return true
+	case <-timer.C:
+	case <-done:
+	}
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if w.granted {
+		return true
+	}
+	for i, queued := range l.queue {
+		if queued == w {
+			l.queue = append(l.queue[:i], l.queue[i+1:]...)
+			break
+		}
+	}
+	atomic.AddUint64(&l.rejected, 1)
+	return false
+}
+
+//Release returns a slot with the request latency, failed requests are handled as slow ones by the adaptive modes
+func (l *Limiter) Release(latency time.Duration, failed bool) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.inFlight--
+	switch l.options.Mode {
+	case AIMD:
+		l.aimd(latency, failed)
+	case Gradient:
+		l.gradient(latency, failed)
+	}
+	for l.inFlight < int(l.limit) && len(l.queue) > 0 {
+		w := l.queue[0]
+		l.queue[0] = nil
+		l.queue = l.queue[1:]
+		l.inFlight++
+		w.granted = true
+		close(w.ready)
+	}
+}
+
+func (l *Limiter) aimd(latency time.Duration, failed bool) {
+	if failed || latency > l.options.Latency {
+		l.setLimit(l.limit * l.options.Backoff)
+	} else if float64(l.inFlight+1)*2 >= l.limit {
+		//Only grows when the limit is in use, otherwise an idle service would raise it without bound
+		l.setLimit(l.limit + 1)
+	}
+}
+
+func (l *Limiter) gradient(latency time.Duration, failed bool) {
+	sample := float64(latency)
+	if sample <= 0 {
+		sample = 1
+	}
+	if l.longLatency == 0 {
+		l.longLatency = sample
+	}
+	gradient := math.Max(0.5, math.Min(1, l.longLatency/sample))
+	if failed {
+		gradient = 0.5
+	}
+	l.longLatency = l.longLatency*(1-l.options.Smoothing) + sample*l.options.Smoothing
+	newLimit := l.limit*gradient + math.Sqrt(l.limit)
+	l.setLimit(l.limit*(1-l.options.Smoothing) + newLimit*l.options.Smoothing)
+}
+
+func (l *Limiter) setLimit(limit float64) {
+	l.limit = math.Max(float64(l.options.MinLimit), math.Min(float64(l.options.MaxLimit), limit))
+}
+
+//Stats returns the current limit, in flight, queued and rejected counts
+func (l *Limiter) Stats() Stats {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return Stats{
+		Limit:    int(l.limit),
+		InFlight: l.inFlight,
+		Queued:   len(l.queue),
+		Rejected: atomic.LoadUint64(&l.rejected),
+	}
+}
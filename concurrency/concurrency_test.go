@@ -0,0 +1,143 @@
+package concurrency
+
+import (
+	"github.com/rjansen/l"
+	"github.com/rjansen/l/zap"
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"testing"
+	"time"
+)
+
+func init() {
+	if setupErr := zap.Setup(new(l.Configuration)); setupErr != nil {
+		panic(setupErr)
+	}
+	l.Info("context.concurrency_test.init")
+}
+
+func TestLimiterStatic(t *testing.T) {
+	limiter := New(Options{Limit: 2})
+	assert.True(t, limiter.Acquire(nil))
+	assert.True(t, limiter.Acquire(nil))
+	assert.False(t, limiter.Acquire(nil))
+	assert.Equal(t, Stats{Limit: 2, InFlight: 2, Rejected: 1}, limiter.Stats())
+
+	limiter.Release(time.Hour, true)
+	assert.True(t, limiter.Acquire(nil))
+	assert.Equal(t, Stats{Limit: 2, InFlight: 2, Rejected: 1}, limiter.Stats())
+	assert.Equal(t, DefaultOptions.RetryAfter, limiter.RetryAfter())
+}
+
+func TestLimiterQueue(t *testing.T) {
+	limiter := New(Options{Limit: 1, QueueSize: 1, QueueTimeout: time.Second})
+	assert.True(t, limiter.Acquire(nil))
+
+	acquired := make(chan bool)
+	go func() {
+		acquired <- limiter.Acquire(nil)
+	}()
+	for limiter.Stats().Queued == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	assert.False(t, limiter.Acquire(nil))
+	limiter.Release(time.Millisecond, false)
+	assert.True(t, <-acquired)
+	assert.Equal(t, Stats{Limit: 1, InFlight: 1, Rejected: 1}, limiter.Stats())
+
+	done := make(chan struct{})
+	go func() {
+		acquired <- limiter.Acquire(done)
+	}()
+	for limiter.Stats().Queued == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	close(done)
+	assert.False(t, <-acquired)
+	assert.Equal(t, Stats{Limit: 1, InFlight: 1, Rejected: 2}, limiter.Stats())
+
+	limiter = New(Options{Limit: 1, QueueSize: 1, QueueTimeout: 5 * time.Millisecond})
+	assert.True(t, limiter.Acquire(nil))
+	assert.False(t, limiter.Acquire(nil))
+	assert.Equal(t, Stats{Limit: 1, InFlight: 1, Rejected: 1}, limiter.Stats())
+}
+
+func TestLimiterAIMD(t *testing.T) {
+	limiter := New(Options{Mode: AIMD, Limit: 10, MinLimit: 2, MaxLimit: 12, Latency: 10 * time.Millisecond, Backoff: 0.5})
+	for i := 0; i < 5; i++ {
+		assert.True(t, limiter.Acquire(nil))
+	}
+	limiter.Release(time.Millisecond, false)
+	assert.Equal(t, 11, limiter.Stats().Limit)
+	limiter.Release(time.Millisecond, false)
+	assert.Equal(t, 11, limiter.Stats().Limit, "Grows only when the limit is in use")
+	limiter.Release(time.Second, false)
+	assert.Equal(t, 5, limiter.Stats().Limit)
+	limiter.Release(time.Millisecond, true)
+	assert.Equal(t, 2, limiter.Stats().Limit)
+	limiter.Release(time.Millisecond, true)
+	assert.Equal(t, 2, limiter.Stats().Limit)
+
+	assert.Equal(t, 0, limiter.Stats().InFlight)
+	for i := 0; i < 20; i++ {
+		inUse := limiter.Stats().Limit
+		for j := 0; j < inUse; j++ {
+			assert.True(t, limiter.Acquire(nil))
+		}
+		for j := 0; j < inUse; j++ {
+			limiter.Release(time.Millisecond, false)
+		}
+	}
+	assert.Equal(t, 12, limiter.Stats().Limit)
+}
+
+func TestLimiterGradient(t *testing.T) {
+	limiter := New(Options{Mode: Gradient, Limit: 50, MinLimit: 5, MaxLimit: 100})
+	for i := 0; i < 50; i++ {
+		assert.True(t, limiter.Acquire(nil))
+		limiter.Release(10*time.Millisecond, false)
+	}
+	steady := limiter.Stats().Limit
+	assert.True(t, steady > 50, "Stable latency grows the limit")
+
+	for i := 0; i < 10; i++ {
+		assert.True(t, limiter.Acquire(nil))
+		limiter.Release(100*time.Millisecond, false)
+	}
+	assert.True(t, limiter.Stats().Limit < steady, "Latency increase reduces the limit")
+	for i := 0; i < 100; i++ {
+		assert.True(t, limiter.Acquire(nil))
+		limiter.Release(time.Millisecond, true)
+	}
+	assert.Equal(t, 5, limiter.Stats().Limit)
+}
+
+func TestLimiterConcurrent(t *testing.T) {
+	limiter := New(Options{Limit: 4, QueueSize: 100, QueueTimeout: time.Second})
+	var wg sync.WaitGroup
+	var mutex sync.Mutex
+	var inFlight, maxInFlight int
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if !limiter.Acquire(nil) {
+				return
+			}
+			mutex.Lock()
+			inFlight++
+			if inFlight > maxInFlight {
+				maxInFlight = inFlight
+			}
+			mutex.Unlock()
+			time.Sleep(time.Millisecond)
+			mutex.Lock()
+			inFlight--
+			mutex.Unlock()
+			limiter.Release(time.Millisecond, false)
+		}()
+	}
+	wg.Wait()
+	assert.True(t, maxInFlight <= 4)
+	assert.Equal(t, Stats{Limit: 4}, limiter.Stats())
+}
@@ -1,51 +1,134 @@
 package haki
 
 import (
+	"context"
 	"errors"
 	"github.com/rjansen/l"
 )
 
 const (
-	ContentTypeHeader    = "Content-Type"
-	ContentLengthHeader  = "Content-Length"
-	AcceptHeader         = "Accept"
-	RequestContextHeader = "X-Request-Context"
-	RequestIDHeader      = "X-Request-Id"
-	AuthorizationHeader  = "Authorization"
+	ContentTypeHeader     = "Content-Type"
+	ContentLengthHeader   = "Content-Length"
+	AcceptHeader          = "Accept"
+	RequestContextHeader  = "X-Request-Context"
+	RequestIDHeader       = "X-Request-Id"
+	AuthorizationHeader   = "Authorization"
+	ContentEncodingHeader = "Content-Encoding"
+	AcceptEncodingHeader  = "Accept-Encoding"
+	VaryHeader            = "Vary"
+	TraceParentHeader     = "Traceparent"
+	RetryAfterHeader      = "Retry-After"
+	RateLimitHeader       = "RateLimit-Limit"
+	RateLimitRemainHeader = "RateLimit-Remaining"
+	RateLimitResetHeader  = "RateLimit-Reset"
+	IdentityHeader        = "X-Identity-Token"
 )
 
 var (
-	ErrInvalidContentType = errors.New("Invalid ContentType. Only: aplication/json, application/octet-stream are valid")
-	ErrInvalidAccept      = errors.New("Invalid Accept. Only: aplication/json, application/octet-stream are valid")
+	ErrInvalidContentType = errors.New("Invalid ContentType. Only: aplication/json, application/octet-stream, application/msgpack, application/cbor, application/xml, text/plain, application/x-www-form-urlencoded, multipart/form-data are valid")
+	ErrInvalidAccept      = errors.New("Invalid Accept. Only: aplication/json, application/octet-stream, application/msgpack, application/cbor, application/xml, text/plain are valid")
 )
 
-//SetupAll calls all provided setup functions and return all raised errors
-func SetupAll(setupFuncs ...SetupFunc) []error {
-	var errs []error
+//LogContextKey is the context key of the logger returned by the ContextLogger
+const LogContextKey = "log"
+
+//WithLogger returns a copy of the ctx with the logger, so the SetupContextFunc log with the configured logger
+func WithLogger(ctx context.Context, logger l.Logger) context.Context {
+	return context.WithValue(ctx, LogContextKey, logger)
+}
+
+//ContextLogger returns the logger of the ctx or the root logger when there is none
+func ContextLogger(ctx context.Context) l.Logger {
+	if logger, ok := ctx.Value(LogContextKey).(l.Logger); ok {
+		return logger
+	}
+	return l.WithFields()
+}
+
+//stepContext returns a copy of the ctx with the logger of the named step
+func stepContext(ctx context.Context, name string) context.Context {
+	return WithLogger(ctx, ContextLogger(ctx).WithFields(l.String("step", name)))
+}
+
+//SetupAll calls all provided setup functions, recovering their panics, and returns a SetupError with all raised errors
+func SetupAll(setupFuncs ...SetupFunc) error {
+	names, contextFuncs := adaptSetupFuncs(setupFuncs)
+	return setupAll(context.Background(), names, contextFuncs)
+}
+
+//SetupAllContext calls all provided setup functions with the ctx, recovering their panics, and returns a SetupError with all raised errors.
+//The functions not called yet when the ctx is done fail with the ctx error
+func SetupAllContext(ctx context.Context, setupFuncs ...SetupContextFunc) error {
+	return setupAll(ctx, contextFuncNames(setupFuncs), setupFuncs)
+}
+
+func setupAll(ctx context.Context, names []string, setupFuncs []SetupContextFunc) error {
+	var setupErr SetupError
 	for i, v := range setupFuncs {
-		if err := v(); err != nil {
+		err := ctx.Err()
+		if err == nil {
+			err = safeSetup(stepContext(ctx, names[i]), v)
+		}
+		if err != nil {
 			l.Warn("contex.SetupSilent",
 				l.Int("index", i),
-				l.Struct("func", v),
+				l.String("func", names[i]),
 				l.Err(err),
 			)
-			errs = append(errs, err)
+			setupErr.Steps = append(setupErr.Steps, &StepError{Step: names[i], Err: err})
 		}
 	}
-	return errs
+	if len(setupErr.Steps) == 0 {
+		return nil
+	}
+	return &setupErr
 }
 
-//Setup calls the provided setup functions and return at the first raised error
+//Setup calls the provided setup functions, recovering their panics, and returns a SetupError at the first raised error
 func Setup(setupFuncs ...SetupFunc) error {
+	names, contextFuncs := adaptSetupFuncs(setupFuncs)
+	return setup(context.Background(), names, contextFuncs)
+}
+
+//SetupContext calls the provided setup functions with the ctx, recovering their panics, and returns a SetupError at the first raised error.
+//Use a ctx cancelled by the SIGTERM, like the signal.NotifyContext, or with a deadline to abort a long initialization
+func SetupContext(ctx context.Context, setupFuncs ...SetupContextFunc) error {
+	return setup(ctx, contextFuncNames(setupFuncs), setupFuncs)
+}
+
+func setup(ctx context.Context, names []string, setupFuncs []SetupContextFunc) error {
 	for i, v := range setupFuncs {
-		if err := v(); err != nil {
+		err := ctx.Err()
+		if err == nil {
+			err = safeSetup(stepContext(ctx, names[i]), v)
+		}
+		if err != nil {
 			l.Error("contex.Setup",
 				l.Int("index", i),
-				l.Struct("func", v),
+				l.String("func", names[i]),
 				l.Err(err),
 			)
-			return err
+			return &SetupError{Steps: []*StepError{{Step: names[i], Err: err}}}
 		}
 	}
 	return nil
 }
+
+//adaptSetupFuncs returns the names of the setup functions and their SetupContextFunc adapters
+func adaptSetupFuncs(setupFuncs []SetupFunc) ([]string, []SetupContextFunc) {
+	names := make([]string, len(setupFuncs))
+	contextFuncs := make([]SetupContextFunc, len(setupFuncs))
+	for i, v := range setupFuncs {
+		names[i] = funcName(v)
+		contextFuncs[i] = v.WithContext()
+	}
+	return names, contextFuncs
+}
+
+func contextFuncNames(setupFuncs []SetupContextFunc) []string {
+	names := make([]string, len(setupFuncs))
+	for i, v := range setupFuncs {
+		names[i] = funcName(v)
+	}
+	return names
+}
@@ -1,12 +1,20 @@
 package haki
 
 import (
+	"bytes"
+	"context"
 	"errors"
+	"fmt"
+	"github.com/klauspost/compress/gzip"
 	"github.com/rjansen/l"
 	"github.com/rjansen/l/zap"
 	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
 	// "os"
+	"sync"
 	"testing"
+	"time"
 )
 
 func init() {
@@ -18,51 +26,59 @@ func init() {
 }
 
 func TestSetupAll(t *testing.T) {
-	errs := SetupAll(
+	err := SetupAll(
 		func() error { return nil },
 		func() error { return nil },
 		func() error { return nil },
 		func() error { return nil },
 	)
 
-	assert.Nil(t, errs)
-	assert.Empty(t, errs)
+	assert.Nil(t, err)
 }
 
 func TestSetupAllErr(t *testing.T) {
-	var errs []error
+	firstErr := errors.New("context_test.TestSetupErrMock1")
+	var err error
 	assert.NotPanics(t, func() {
-		errs = SetupAll(
-			func() error { return errors.New("context_test.TestSetupErrMock1") },
+		err = SetupAll(
+			func() error { return firstErr },
 			func() error { return errors.New("context_test.TestSetupErrMock2") },
-			func() error { return errors.New("context_test.TestSetupErrMock3") },
+			func() error { panic("context_test.TestSetupErrMock3") },
 			func() error { return errors.New("context_test.TestSetupErrMock4") },
 		)
 	})
 
-	assert.NotNil(t, errs)
-	assert.NotEmpty(t, errs)
-	assert.Equal(t, 4, len(errs))
+	assert.NotNil(t, err)
+	var setupErr *SetupError
+	assert.True(t, errors.As(err, &setupErr))
+	assert.Equal(t, 4, len(setupErr.Steps))
+	assert.Equal(t, "github.com/rjansen/haki.TestSetupAllErr.func1.1", setupErr.Failed()[0])
+	assert.True(t, errors.Is(err, firstErr))
+
+	var panicErr *PanicError
+	assert.True(t, errors.As(err, &panicErr))
+	assert.Equal(t, "context_test.TestSetupErrMock3", panicErr.Value)
+	assert.Contains(t, string(panicErr.Stack), "TestSetupAllErr")
+	assert.Contains(t, err.Error(), "Setup panic: context_test.TestSetupErrMock3")
 }
 
 func TestSetup(t *testing.T) {
-	errs := Setup(
+	err := Setup(
 		func() error { return nil },
 		func() error { return nil },
 		func() error { return nil },
 		func() error { return nil },
 	)
 
-	assert.Nil(t, errs)
-	assert.Empty(t, errs)
+	assert.Nil(t, err)
 }
 
 func TestSetupErr(t *testing.T) {
-	firstErrMsg := "context_test.TestSetupErrMock1"
+	firstErr := errors.New("context_test.TestSetupErrMock1")
 	var err error
 	assert.NotPanics(t, func() {
 		err = Setup(
-			func() error { return errors.New(firstErrMsg) },
+			func() error { return firstErr },
 			func() error { return errors.New("context_test.TestSetupErrMock2") },
 			func() error { return errors.New("context_test.TestSetupErrMock3") },
 			func() error { return errors.New("context_test.TestSetupErrMock4") },
@@ -70,5 +86,287 @@ func TestSetupErr(t *testing.T) {
 	})
 
 	assert.NotNil(t, err)
-	assert.Equal(t, firstErrMsg, err.Error())
+	assert.True(t, errors.Is(err, firstErr))
+	var stepErr *StepError
+	assert.True(t, errors.As(err, &stepErr))
+	assert.Equal(t, "github.com/rjansen/haki.TestSetupErr.func1.1", stepErr.Step)
+	assert.Equal(t, stepErr.Step+": "+firstErr.Error(), err.Error())
+
+	panicErr := errors.New("context_test.TestSetupPanic")
+	assert.NotPanics(t, func() {
+		err = Setup(
+			func() error { return nil },
+			func() error { panic(panicErr) },
+		)
+	})
+	assert.True(t, errors.Is(err, panicErr))
+}
+
+func TestSetupSteps(t *testing.T) {
+	var mutex sync.Mutex
+	var order []string
+	started := make(chan string, 2)
+	release := make(chan struct{})
+	step := func(name string, dependsOn ...string) Step {
+		return Step{Name: name, DependsOn: dependsOn, Setup: func() error {
+			if name == "db" || name == "cache" {
+				started <- name
+				<-release
+			}
+			mutex.Lock()
+			order = append(order, name)
+			mutex.Unlock()
+			return nil
+		}}
+	}
+	go func() {
+		<-started
+		<-started
+		close(release)
+	}()
+	report, err := SetupSteps(context.Background(),
+		step("api", "db", "cache"),
+		step("db", "config"),
+		step("cache", "config"),
+		step("config"),
+	)
+	assert.Nil(t, err)
+	assert.Len(t, order, 4)
+	assert.Equal(t, "config", order[0])
+	assert.Equal(t, "api", order[3], "db and cache run in parallel after config")
+	assert.Equal(t, []string{"api", "db", "cache", "config"}, []string{report.Steps[0].Name, report.Steps[1].Name, report.Steps[2].Name, report.Steps[3].Name})
+	for _, result := range report.Steps {
+		assert.Equal(t, 1, result.Attempts)
+		assert.Nil(t, result.Err)
+	}
+}
+
+func TestSetupStepsErr(t *testing.T) {
+	dbErr := errors.New("context_test.TestSetupStepsErrDB")
+	var apiCalled bool
+	report, err := SetupSteps(context.Background(),
+		Step{Name: "db", Setup: func() error { return dbErr }},
+		Step{Name: "api", DependsOn: []string{"db"}, Setup: func() error {
+			apiCalled = true
+			return nil
+		}},
+		Step{Name: "metrics", Setup: func() error { return nil }},
+	)
+	assert.False(t, apiCalled)
+	assert.True(t, errors.Is(err, dbErr))
+	assert.True(t, errors.Is(err, ErrSetupSkipped))
+	var stepErr *StepError
+	assert.True(t, errors.As(err, &stepErr))
+	assert.Equal(t, "db", stepErr.Step)
+	assert.Equal(t, "db: context_test.TestSetupStepsErrDB\napi: "+ErrSetupSkipped.Error(), err.Error())
+	assert.Nil(t, report.Steps[2].Err)
+
+	noop := SetupFunc(func() error { return nil })
+	_, err = SetupSteps(context.Background(), Step{Name: "db", Setup: noop}, Step{Name: "db", Setup: noop})
+	assert.True(t, errors.Is(err, ErrSetupDuplicate))
+	_, err = SetupSteps(context.Background(), Step{Name: "api", DependsOn: []string{"db"}, Setup: noop})
+	assert.True(t, errors.Is(err, ErrSetupDependency))
+	_, err = SetupSteps(context.Background(), Step{Name: "db", Setup: noop}, Step{Name: "api"})
+	assert.True(t, errors.Is(err, ErrSetupNoFunc))
+	assert.True(t, errors.As(err, &stepErr))
+	assert.Equal(t, "api", stepErr.Step)
+	_, err = SetupSteps(context.Background(),
+		Step{Name: "a", DependsOn: []string{"b"}, Setup: noop}, Step{Name: "b", DependsOn: []string{"a"}, Setup: noop}, Step{Name: "c", Setup: noop},
+	)
+	assert.True(t, errors.Is(err, ErrSetupCycle))
+
+	report, err = SetupSteps(context.Background(),
+		Step{Name: "db", Setup: func() error { panic("context_test.TestSetupStepsPanic") }},
+		Step{Name: "cache", Timeout: time.Second, Setup: func() error { panic("context_test.TestSetupStepsPanic") }},
+	)
+	var setupErr *SetupError
+	assert.True(t, errors.As(err, &setupErr))
+	assert.Equal(t, []string{"db", "cache"}, setupErr.Failed())
+	var panicErr *PanicError
+	assert.True(t, errors.As(report.Steps[1].Err, &panicErr))
+}
+
+func TestSetupStepsRetryAndTimeout(t *testing.T) {
+	var attempts int
+	report, err := SetupSteps(context.Background(), Step{Name: "db", Retries: 2, RetryDelay: time.Millisecond, Setup: func() error {
+		if attempts++; attempts < 3 {
+			return errors.New("context_test.TestSetupStepsRetry")
+		}
+		return nil
+	}})
+	assert.Nil(t, err)
+	assert.Equal(t, 3, report.Steps[0].Attempts)
+
+	var mutex sync.Mutex
+	var calls, inFlight, maxInFlight int
+	slow := func(err error) SetupFunc {
+		return func() error {
+			mutex.Lock()
+			calls++
+			if inFlight++; inFlight > maxInFlight {
+				maxInFlight = inFlight
+			}
+			mutex.Unlock()
+			time.Sleep(30 * time.Millisecond)
+			mutex.Lock()
+			inFlight--
+			mutex.Unlock()
+			return err
+		}
+	}
+	report, err = SetupSteps(context.Background(), Step{Name: "db", Timeout: 5 * time.Millisecond, Retries: 2,
+		Setup: slow(errors.New("context_test.TestSetupStepsTimeout")),
+	})
+	assert.True(t, errors.Is(err, ErrSetupTimeout))
+	assert.Equal(t, 3, report.Steps[0].Attempts)
+	mutex.Lock()
+	assert.Equal(t, 3, calls)
+	assert.Equal(t, 1, maxInFlight, "A retry waits for the timed out attempt")
+	mutex.Unlock()
+
+	report, err = SetupSteps(context.Background(), Step{Name: "db", Timeout: 5 * time.Millisecond, Retries: 2, Setup: slow(nil)})
+	assert.Nil(t, err, "The timed out attempt finished the setup")
+	assert.Equal(t, 1, report.Steps[0].Attempts)
+	mutex.Lock()
+	assert.Equal(t, 4, calls)
+	mutex.Unlock()
+}
+
+func TestSetupStepsCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	block := make(chan struct{})
+	defer close(block)
+	var apiCalled bool
+	report, err := SetupSteps(ctx,
+		Step{Name: "db", Setup: func() error {
+			cancel()
+			<-block
+			return nil
+		}},
+		Step{Name: "api", DependsOn: []string{"db"}, Setup: func() error {
+			apiCalled = true
+			return nil
+		}},
+	)
+	assert.False(t, apiCalled)
+	assert.True(t, errors.Is(err, context.Canceled))
+	assert.Equal(t, context.Canceled, report.Steps[0].Err)
+	assert.Equal(t, ErrSetupSkipped, report.Steps[1].Err)
+
+	report, err = SetupSteps(ctx, Step{Name: "db", Setup: func() error { return nil }})
+	assert.Equal(t, context.Canceled, report.Steps[0].Err)
+	assert.Equal(t, 0, report.Steps[0].Attempts)
+}
+
+func TestSetupContext(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Millisecond)
+	defer cancel()
+	var logger l.Logger
+	err := SetupContext(WithLogger(ctx, l.WithFields(l.String("app", "haki"))),
+		func(ctx context.Context) error {
+			logger = ContextLogger(ctx)
+			return nil
+		},
+		func(ctx context.Context) error {
+			<-ctx.Done()
+			return ctx.Err()
+		},
+		func(ctx context.Context) error { return errors.New("context_test.TestSetupContextMock3") },
+	)
+	assert.NotNil(t, logger)
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+	var setupErr *SetupError
+	assert.True(t, errors.As(err, &setupErr))
+	assert.Equal(t, []string{"github.com/rjansen/haki.TestSetupContext.func2"}, setupErr.Failed())
+
+	err = SetupAllContext(ctx,
+		SetupFunc(func() error { return nil }).WithContext(),
+		SetupContextFunc(ErrorFunc(func() error { return nil }).WithContext()),
+	)
+	assert.True(t, errors.As(err, &setupErr))
+	assert.Len(t, setupErr.Steps, 2)
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+
+	assert.Nil(t, SetupAllContext(context.Background(), func(ctx context.Context) error { return nil }))
+}
+
+func TestSetupStepsContext(t *testing.T) {
+	stepErr := make(chan error, 1)
+	report, err := SetupSteps(context.Background(), Step{Name: "db", Timeout: 5 * time.Millisecond, SetupContext: func(ctx context.Context) error {
+		<-ctx.Done()
+		stepErr <- ctx.Err()
+		return ctx.Err()
+	}})
+	assert.True(t, errors.Is(err, ErrSetupTimeout))
+	assert.Equal(t, context.DeadlineExceeded, <-stepErr, "The attempt context is done at the Timeout")
+	assert.Equal(t, 1, report.Steps[0].Attempts)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	report, err = SetupSteps(ctx, Step{Name: "db", SetupContext: func(ctx context.Context) error {
+		cancel()
+		<-ctx.Done()
+		return ctx.Err()
+	}})
+	assert.True(t, errors.Is(err, context.Canceled))
+	assert.Equal(t, context.Canceled, report.Steps[0].Err)
+}
+
+func TestContentDecoder(t *testing.T) {
+	content := []byte("context_test.TestContentDecoder")
+	var body bytes.Buffer
+	writer := gzip.NewWriter(&body)
+	_, err := writer.Write(content)
+	assert.Nil(t, err)
+	assert.Nil(t, writer.Close())
+
+	for _, encoding := range []string{"gzip", "x-gzip", " GZIP "} {
+		reader, err := ContentDecoder(encoding, bytes.NewReader(body.Bytes()))
+		assert.Nil(t, err)
+		decoded, err := ioutil.ReadAll(reader)
+		assert.Nil(t, err)
+		assert.Equal(t, content, decoded)
+		assert.Nil(t, reader.Close())
+	}
+
+	reader, err := ContentDecoder("identity", bytes.NewReader(content))
+	assert.Nil(t, err)
+	decoded, err := ioutil.ReadAll(reader)
+	assert.Nil(t, err)
+	assert.Equal(t, content, decoded)
+}
+
+func TestContentDecoderErr(t *testing.T) {
+	_, err := ContentDecoder("compress", bytes.NewReader([]byte{}))
+	assert.Equal(t, ErrInvalidContentEncoding, err)
+
+	_, err = ContentDecoder("gzip", bytes.NewReader([]byte("invalid gzip body")))
+	assert.NotNil(t, err)
+
+	var body bytes.Buffer
+	writer := gzip.NewWriter(&body)
+	_, err = writer.Write(bytes.Repeat([]byte{0}, 1024))
+	assert.Nil(t, err)
+	assert.Nil(t, writer.Close())
+
+	maxSize := MaxDecodedBodySize
+	defer func() { MaxDecodedBodySize = maxSize }()
+	MaxDecodedBodySize = 512
+	reader, err := ContentDecoder("gzip", bytes.NewReader(body.Bytes()))
+	assert.Nil(t, err)
+	_, err = ioutil.ReadAll(reader)
+	assert.Equal(t, ErrBodyTooLarge, err)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, ErrStatus(err))
+}
+
+func TestStatusError(t *testing.T) {
+	err := NewStatusError(429, "")
+	assert.Equal(t, "Too Many Requests", err.Error())
+	assert.Equal(t, 429, ErrStatus(err))
+	assert.Equal(t, 429, ErrStatus(fmt.Errorf("wrapped: %w", ErrTooManyRequests)))
+	assert.Equal(t, 500, ErrStatus(errors.New("MockErr")))
+
+	assert.Equal(t, int64(0), Seconds(0))
+	assert.Equal(t, int64(1), Seconds(time.Millisecond))
+	assert.Equal(t, int64(1), Seconds(time.Second))
+	assert.Equal(t, int64(2), Seconds(time.Second+time.Nanosecond))
 }
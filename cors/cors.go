@@ -0,0 +1,224 @@
+package cors
+
+import (
+	"errors"
+	"github.com/rjansen/haki"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	OriginHeader           = "Origin"
+	RequestMethodHeader    = "Access-Control-Request-Method"
+	RequestHeadersHeader   = "Access-Control-Request-Headers"
+	AllowOriginHeader      = "Access-Control-Allow-Origin"
+	AllowMethodsHeader     = "Access-Control-Allow-Methods"
+	AllowHeadersHeader     = "Access-Control-Allow-Headers"
+	AllowCredentialsHeader = "Access-Control-Allow-Credentials"
+	ExposeHeadersHeader    = "Access-Control-Expose-Headers"
+	MaxAgeHeader           = "Access-Control-Max-Age"
+
+	wildcard          = "*"
+	subdomainWildcard = "*."
+)
+
+var (
+	//ErrWildcardCredentials is returned by New when the * origin is allowed with credentials, which would let any site send credentialed requests
+	ErrWildcardCredentials = errors.New("Invalid cors options. The * origin can not be allowed with credentials")
+	//DefaultOptions are the base values of the Options fields left empty by New
+	DefaultOptions = Options{
+		AllowedMethods: []string{
+			http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete,
+		},
+		AllowedHeaders: []string{
+			haki.ContentTypeHeader, haki.AcceptHeader, haki.AuthorizationHeader,
+			haki.RequestIDHeader, haki.RequestContextHeader, haki.TraceParentHeader,
+		},
+		ExposedHeaders: []string{haki.RequestIDHeader, haki.RequestContextHeader},
+	}
+)
+
+//Options holds the cross origin resource sharing settings
+type Options struct {
+	//AllowedOrigins are exact origins, like https://web.example.com, wildcard subdomains, like https://*.example.com, or * for any origin
+	AllowedOrigins []string
+	//AllowedOriginPatterns are regular expressions matched against the whole origin
+	AllowedOriginPatterns []string
+	//AllowedMethods are the methods allowed in the preflight requests
+	AllowedMethods []string
+	//AllowedHeaders are the request headers allowed in the preflight requests, * allows any header
+	AllowedHeaders []string
+	//ExposedHeaders are the response headers readable by the browser scripts
+	ExposedHeaders []string
+	//AllowCredentials allows cookies and authorization headers, it can not be used with the * origin
+	AllowCredentials bool
+	//MaxAge is how long the browser caches the preflight response, zero omits the header
+	MaxAge time.Duration
+}
+
+//Header is the response header contract shared by the http.Header and the fasthttp.ResponseHeader
+type Header interface {
+	Set(key string, value string)
+	Add(key string, value string)
+}
+
+//Policy is the compiled form of the Options that writes the CORS response headers
+type Policy struct {
+	allowAllOrigins  bool
+	origins          map[string]bool
+	subdomains       []subdomain
+	patterns         []*regexp.Regexp
+	methods          map[string]bool
+	allowAllHeaders  bool
+	headers          map[string]bool
+	allowMethods     string
+	allowHeaders     string
+	exposeHeaders    string
+	allowCredentials bool
+	maxAge           string
+}
+
+type subdomain struct {
+	prefix string
+	suffix string
+}
+
+//New compiles the Options into a Policy, the empty method and header lists are set with the DefaultOptions values.
+//The * origin with AllowCredentials returns ErrWildcardCredentials
+func New(options Options) (*Policy, error) {
+	if len(options.AllowedMethods) == 0 {
+		options.AllowedMethods = DefaultOptions.AllowedMethods
+	}
+	if len(options.AllowedHeaders) == 0 {
+		options.AllowedHeaders = DefaultOptions.AllowedHeaders
+	}
+	if options.ExposedHeaders == nil {
+		options.ExposedHeaders = DefaultOptions.ExposedHeaders
+	}
+	p := &Policy{
+		origins:          make(map[string]bool),
+		methods:          make(map[string]bool),
+		headers:          make(map[string]bool),
+		allowMethods:     strings.Join(options.AllowedMethods, ", "),
+		exposeHeaders:    strings.Join(options.ExposedHeaders, ", "),
+		allowCredentials: options.AllowCredentials,
+	}
+	for _, origin := range options.AllowedOrigins {
+		origin = strings.ToLower(origin)
+		switch {
+		case origin == wildcard:
+			if options.AllowCredentials {
+				return nil, ErrWildcardCredentials
+			}
+			p.allowAllOrigins = true
+		case strings.Contains(origin, subdomainWildcard):
+			i := strings.Index(origin, subdomainWildcard)
+			p.subdomains = append(p.subdomains, subdomain{prefix: origin[:i], suffix: origin[i+1:]})
+		default:
+			p.origins[origin] = true
+		}
+	}
+	for _, pattern := range options.AllowedOriginPatterns {
+		re, err := regexp.Compile("^(?:" + pattern + ")$")
+		if err != nil {
+			return nil, err
+		}
+		p.patterns = append(p.patterns, re)
+	}
+	for _, method := range options.AllowedMethods {
+		p.methods[strings.ToUpper(method)] = true
+	}
+	var allowHeaders []string
+	for _, header := range options.AllowedHeaders {
+		if header == wildcard {
+			p.allowAllHeaders = true
+			continue
+		}
+		p.headers[strings.ToLower(header)] = true
+		allowHeaders = append(allowHeaders, header)
+	}
+	p.allowHeaders = strings.Join(allowHeaders, ", ")
+	if options.MaxAge > 0 {
+		p.maxAge = strconv.FormatInt(haki.Seconds(options.MaxAge), 10)
+	}
+	return p, nil
+}
+
+//AllowOrigin returns true when the origin is allowed by the policy
+func (p *Policy) AllowOrigin(origin string) bool {
+	if p.allowAllOrigins {
+		return true
+	}
+	origin = strings.ToLower(origin)
+	if p.origins[origin] {
+		return true
+	}
+	for _, s := range p.subdomains {
+		if len(origin) > len(s.prefix)+len(s.suffix) && strings.HasPrefix(origin, s.prefix) && strings.HasSuffix(origin, s.suffix) {
+			return true
+		}
+	}
+	for _, re := range p.patterns {
+		if re.MatchString(origin) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *Policy) allowHeadersOf(requestHeaders string) (string, bool) {
+	if p.allowAllHeaders {
+		return requestHeaders, true
+	}
+	for _, header := range strings.Split(requestHeaders, ",") {
+		header = strings.ToLower(strings.TrimSpace(header))
+		if header != "" && !p.headers[header] {
+			return "", false
+		}
+	}
+	return p.allowHeaders, true
+}
+
+//Handle writes the CORS response headers of a request with the provided method and Origin,
+//Access-Control-Request-Method and Access-Control-Request-Headers values.
+//It returns true for the preflight requests, that must be answered without calling the handler
+func (p *Policy) Handle(header Header, method string, origin string, requestMethod string, requestHeaders string) bool {
+	preflight := method == http.MethodOptions && requestMethod != ""
+	header.Add(haki.VaryHeader, OriginHeader)
+	if preflight {
+		header.Add(haki.VaryHeader, RequestMethodHeader+", "+RequestHeadersHeader)
+	}
+	if origin == "" || !p.AllowOrigin(origin) {
+		return preflight && origin != ""
+	}
+	if preflight {
+		if !p.methods[strings.ToUpper(requestMethod)] {
+			return true
+		}
+		allowHeaders, allowed := p.allowHeadersOf(requestHeaders)
+		if !allowed {
+			return true
+		}
+		header.Set(AllowMethodsHeader, p.allowMethods)
+		if allowHeaders != "" {
+			header.Set(AllowHeadersHeader, allowHeaders)
+		}
+		if p.maxAge != "" {
+			header.Set(MaxAgeHeader, p.maxAge)
+		}
+	} else if p.exposeHeaders != "" {
+		header.Set(ExposeHeadersHeader, p.exposeHeaders)
+	}
+	if p.allowAllOrigins {
+		header.Set(AllowOriginHeader, wildcard)
+	} else {
+		header.Set(AllowOriginHeader, origin)
+	}
+	if p.allowCredentials {
+		header.Set(AllowCredentialsHeader, "true")
+	}
+	return preflight
+}
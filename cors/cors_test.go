@@ -0,0 +1,116 @@
+package cors
+
+import (
+	"github.com/rjansen/l"
+	"github.com/rjansen/l/zap"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func init() {
+	if setupErr := zap.Setup(new(l.Configuration)); setupErr != nil {
+		panic(setupErr)
+	}
+	l.Info("context.cors_test.init")
+}
+
+func TestAllowOrigin(t *testing.T) {
+	policy, err := New(Options{
+		AllowedOrigins:        []string{"http://127.0.0.1:3000", "https://*.Example.com"},
+		AllowedOriginPatterns: []string{`https://web-[0-9]+\.haki\.io`},
+	})
+	assert.Nil(t, err)
+	for _, origin := range []string{
+		"http://127.0.0.1:3000",
+		"https://web.example.com",
+		"https://a.b.EXAMPLE.com",
+		"https://web-42.haki.io",
+	} {
+		assert.True(t, policy.AllowOrigin(origin), origin)
+	}
+	for _, origin := range []string{
+		"",
+		"http://127.0.0.1:4000",
+		"https://example.com",
+		"https://.example.com",
+		"http://web.example.com",
+		"https://web.example.com.evil.io",
+		"https://web-42.haki.io.evil.io",
+		"https://web-x.haki.io",
+	} {
+		assert.False(t, policy.AllowOrigin(origin), origin)
+	}
+
+	_, err = New(Options{AllowedOriginPatterns: []string{"("}})
+	assert.NotNil(t, err)
+}
+
+func TestHandle(t *testing.T) {
+	policy, err := New(Options{AllowedOrigins: []string{"http://127.0.0.1:3000"}, MaxAge: 10 * time.Minute})
+	assert.Nil(t, err)
+
+	header := make(http.Header)
+	assert.False(t, policy.Handle(header, "GET", "http://127.0.0.1:3000", "", ""))
+	assert.Equal(t, "http://127.0.0.1:3000", header.Get(AllowOriginHeader))
+	assert.Equal(t, "X-Request-Id, X-Request-Context", header.Get(ExposeHeadersHeader))
+	assert.Equal(t, []string{"Origin"}, header["Vary"])
+	assert.Equal(t, "", header.Get(AllowCredentialsHeader))
+	assert.Equal(t, "", header.Get(AllowMethodsHeader))
+
+	header = make(http.Header)
+	assert.True(t, policy.Handle(header, "OPTIONS", "http://127.0.0.1:3000", "PUT", "content-type, x-request-id"))
+	assert.Equal(t, "http://127.0.0.1:3000", header.Get(AllowOriginHeader))
+	assert.Equal(t, "GET, HEAD, POST, PUT, PATCH, DELETE", header.Get(AllowMethodsHeader))
+	assert.Equal(t, "Content-Type, Accept, Authorization, X-Request-Id, X-Request-Context, Traceparent", header.Get(AllowHeadersHeader))
+	assert.Equal(t, "600", header.Get(MaxAgeHeader))
+	assert.Equal(t, []string{"Origin", "Access-Control-Request-Method, Access-Control-Request-Headers"}, header["Vary"])
+	assert.Equal(t, "", header.Get(ExposeHeadersHeader))
+
+	for _, request := range [][]string{
+		{"http://127.0.0.1:4000", "GET", ""},
+		{"http://127.0.0.1:3000", "TRACE", ""},
+		{"http://127.0.0.1:3000", "GET", "X-Custom"},
+	} {
+		header = make(http.Header)
+		assert.True(t, policy.Handle(header, "OPTIONS", request[0], request[1], request[2]), request)
+		assert.Equal(t, "", header.Get(AllowOriginHeader), request)
+		assert.Equal(t, "", header.Get(AllowMethodsHeader), request)
+	}
+
+	header = make(http.Header)
+	assert.False(t, policy.Handle(header, "GET", "http://127.0.0.1:4000", "", ""))
+	assert.Equal(t, "", header.Get(AllowOriginHeader))
+	assert.Equal(t, "Origin", header.Get("Vary"))
+
+	header = make(http.Header)
+	assert.False(t, policy.Handle(header, "OPTIONS", "", "GET", ""))
+	assert.False(t, policy.Handle(header, "OPTIONS", "http://127.0.0.1:3000", "", ""))
+}
+
+func TestHandleWildcard(t *testing.T) {
+	policy, err := New(Options{AllowedOrigins: []string{"*"}, AllowedHeaders: []string{"*"}, ExposedHeaders: []string{}})
+	assert.Nil(t, err)
+	header := make(http.Header)
+	assert.False(t, policy.Handle(header, "GET", "http://any.io", "", ""))
+	assert.Equal(t, "*", header.Get(AllowOriginHeader))
+	assert.Equal(t, "", header.Get(ExposeHeadersHeader))
+
+	header = make(http.Header)
+	assert.True(t, policy.Handle(header, "OPTIONS", "http://any.io", "GET", "X-Custom, X-Other"))
+	assert.Equal(t, "X-Custom, X-Other", header.Get(AllowHeadersHeader))
+	assert.Equal(t, "", header.Get(MaxAgeHeader))
+
+	policy, err = New(Options{AllowedOrigins: []string{"*"}, AllowCredentials: true})
+	assert.Nil(t, policy)
+	assert.Equal(t, ErrWildcardCredentials, err)
+
+	policy, err = New(Options{AllowedOrigins: []string{"http://any.io"}, AllowCredentials: true, AllowedMethods: []string{"get"}})
+	assert.Nil(t, err)
+	header = make(http.Header)
+	assert.True(t, policy.Handle(header, "OPTIONS", "http://any.io", "GET", ""))
+	assert.Equal(t, "http://any.io", header.Get(AllowOriginHeader))
+	assert.Equal(t, "true", header.Get(AllowCredentialsHeader))
+	assert.Equal(t, "get", header.Get(AllowMethodsHeader))
+}
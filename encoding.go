@@ -0,0 +1,71 @@
+package haki
+
+import (
+	"errors"
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zlib"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+var (
+	ErrInvalidContentEncoding = errors.New("Invalid Content-Encoding. Only: gzip, deflate, identity are valid")
+	//ErrBodyTooLarge is returned by the reads past MaxDecodedBodySize and rendered as a 413 response
+	ErrBodyTooLarge = NewStatusError(http.StatusRequestEntityTooLarge, "The decoded body exceeds the max decoded body size")
+
+	//MaxDecodedBodySize is the max size in bytes of a request body after its Content-Encoding is decoded
+	MaxDecodedBodySize int64 = 32 << 20
+)
+
+type decodedBody struct {
+	io.Reader
+	decoder io.Closer
+	body    io.Closer
+	read    int64
+}
+
+func (b *decodedBody) Read(p []byte) (int, error) {
+	n, err := b.Reader.Read(p)
+	b.read += int64(n)
+	if MaxDecodedBodySize > 0 && b.read > MaxDecodedBodySize {
+		return n, ErrBodyTooLarge
+	}
+	return n, err
+}
+
+func (b *decodedBody) Close() error {
+	err := b.decoder.Close()
+	if b.body != nil {
+		if closeErr := b.body.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
+
+//ContentDecoder returns a reader of the body decoded by the provided Content-Encoding header value.
+//Decoded reads fail with ErrBodyTooLarge past MaxDecodedBodySize and, if body is an io.Closer, it is closed with the returned reader
+func ContentDecoder(contentEncoding string, body io.Reader) (io.ReadCloser, error) {
+	var decoder io.ReadCloser
+	var err error
+	switch strings.ToLower(strings.TrimSpace(contentEncoding)) {
+	case "", "identity":
+		if rc, ok := body.(io.ReadCloser); ok {
+			return rc, nil
+		}
+		return ioutil.NopCloser(body), nil
+	case "gzip", "x-gzip":
+		decoder, err = gzip.NewReader(body)
+	case "deflate":
+		decoder, err = zlib.NewReader(body)
+	default:
+		return nil, ErrInvalidContentEncoding
+	}
+	if err != nil {
+		return nil, err
+	}
+	closer, _ := body.(io.Closer)
+	return &decodedBody{Reader: decoder, decoder: decoder, body: closer}, nil
+}
@@ -0,0 +1,52 @@
+package haki
+
+import (
+	"errors"
+	"net/http"
+	"time"
+)
+
+var (
+	//ErrTooManyRequests is returned by the rate limit wrappers and rendered as a 429 response
+	ErrTooManyRequests = NewStatusError(http.StatusTooManyRequests, "Too many requests. Retry later")
+	//ErrServiceUnavailable is returned by the concurrency limit wrappers when a request is shed and rendered as a 503 response
+	ErrServiceUnavailable = NewStatusError(http.StatusServiceUnavailable, "Service overloaded. Retry later")
+	//ErrMethodNotAllowed is returned by the handlers that accept only some methods and rendered as a 405 response
+	ErrMethodNotAllowed = NewStatusError(http.StatusMethodNotAllowed, "")
+	//ErrBadGateway is returned by the proxy handlers when the upstream fails and rendered as a 502 response
+	ErrBadGateway = NewStatusError(http.StatusBadGateway, "")
+	//ErrGatewayTimeout is returned by the proxy handlers when the upstream times out and rendered as a 504 response
+	ErrGatewayTimeout = NewStatusError(http.StatusGatewayTimeout, "")
+)
+
+//StatusError is an error rendered by the http and fast Error wrappers with its own status code
+type StatusError struct {
+	Code    int
+	Message string
+}
+
+//NewStatusError creates a StatusError, the status text is used when message is empty
+func NewStatusError(code int, message string) *StatusError {
+	if message == "" {
+		message = http.StatusText(code)
+	}
+	return &StatusError{Code: code, Message: message}
+}
+
+func (e *StatusError) Error() string {
+	return e.Message
+}
+
+//ErrStatus returns the status code of a StatusError in the err chain or 500 for other errors
+func ErrStatus(err error) int {
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.Code
+	}
+	return http.StatusInternalServerError
+}
+
+//Seconds returns the duration rounded up to whole seconds, the unit of the Retry-After and RateLimit-Reset headers
+func Seconds(d time.Duration) int64 {
+	return int64((d + time.Second - 1) / time.Second)
+}
@@ -0,0 +1,44 @@
+package fast
+
+import (
+	"context"
+	"github.com/rjansen/haki/apikey"
+	"github.com/rjansen/l"
+	"github.com/valyala/fasthttp"
+)
+
+func apiKeyHandle(resolver *apikey.Resolver, handler HTTPHandlerFunc, c context.Context, fc *fasthttp.RequestCtx) error {
+	key := string(fc.Request.Header.Peek(resolver.Header))
+	if key == "" && resolver.Query != "" {
+		key = string(fc.QueryArgs().Peek(resolver.Query))
+	}
+	if key == "" {
+		return handler(c, fc)
+	}
+	logger := contextLogger(c, fc)
+	stored, err := resolver.Resolve(key)
+	if err != nil {
+		logger.Warn("haki.fast.APIKeyErr",
+			l.String("key", apikey.Redact(key)),
+			l.Err(err),
+		)
+		return err
+	}
+	c = context.WithValue(c, TokenContextKey, stored.Token())
+	c = context.WithValue(c, IdentityContextKey, stored.Identity())
+	logger.Info("haki.fast.APIKey",
+		l.String("prefix", stored.Prefix),
+		l.String("name", stored.Name),
+	)
+	return handler(c, fc)
+}
+
+//APIKey creates a wrapper that resolves the request API key into the context identity, see TokenContextKey and IdentityContextKey.
+//Requests without a key are kept anonymous and the invalid keys return a 401 apikey.ErrInvalidKey
+func APIKey(resolver *apikey.Resolver) HTTPHandlerWrapper {
+	return func(handler HTTPHandlerFunc) HTTPHandlerFunc {
+		return func(c context.Context, fc *fasthttp.RequestCtx) error {
+			return apiKeyHandle(resolver, handler, c, fc)
+		}
+	}
+}
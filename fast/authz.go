@@ -0,0 +1,57 @@
+package fast
+
+import (
+	"context"
+	"github.com/rjansen/haki/authz"
+	"github.com/rjansen/l"
+	"github.com/valyala/fasthttp"
+)
+
+//IdentityContextKey is the context key of the identity value evaluated by the Require policies
+const IdentityContextKey = "identity"
+
+//Subject returns the authz.Subject of the identity stored under TokenContextKey and IdentityContextKey
+func Subject(c context.Context) authz.Subject {
+	token, _ := c.Value(TokenContextKey).(string)
+	return authz.Subject{
+		Token:         token,
+		Value:         c.Value(IdentityContextKey),
+		Authenticated: token != "",
+	}
+}
+
+func requireHandle(policy authz.Policy, handler HTTPHandlerFunc, c context.Context, fc *fasthttp.RequestCtx) error {
+	subject := Subject(c)
+	request := authz.Request{
+		Method: string(fc.Method()),
+		Path:   string(fc.Path()),
+		Header: func(name string) string {
+			return string(fc.Request.Header.Peek(name))
+		},
+	}
+	err := authz.Evaluate(policy, subject, request)
+	logger := contextLogger(c, fc)
+	if err != nil {
+		logger.Warn("haki.fast.AccessDenied",
+			l.String("policy", policy.Name),
+			l.String("token", subject.Token),
+			l.Bool("authenticated", subject.Authenticated),
+		)
+		return err
+	}
+	logger.Info("haki.fast.AccessAllowed",
+		l.String("policy", policy.Name),
+		l.String("token", subject.Token),
+	)
+	return handler(c, fc)
+}
+
+//Require creates a wrapper that calls the handler only when the policy allows the context identity.
+//Denied requests return a 401 authz.ErrUnauthenticated without identity and a 403 authz.ErrForbidden otherwise
+func Require(policy authz.Policy) HTTPHandlerWrapper {
+	return func(handler HTTPHandlerFunc) HTTPHandlerFunc {
+		return func(c context.Context, fc *fasthttp.RequestCtx) error {
+			return requireHandle(policy, handler, c, fc)
+		}
+	}
+}
@@ -0,0 +1,228 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"github.com/rjansen/haki"
+	hakiclient "github.com/rjansen/haki/http/client"
+	"github.com/rjansen/haki/media"
+	"github.com/rjansen/l"
+	"github.com/valyala/fasthttp"
+	"io"
+	"io/ioutil"
+	"time"
+)
+
+//forwardHeaders are the incoming request headers forwarded by Forward
+var forwardHeaders = []string{
+	haki.RequestIDHeader,
+	haki.RequestContextHeader,
+	haki.TraceParentHeader,
+	haki.AuthorizationHeader,
+}
+
+//Client is a fasthttp client that handles the request and response medias like the haki fast helpers
+type Client struct {
+	//HTTPClient sends the requests, a zero fasthttp.Client is used when nil
+	HTTPClient *fasthttp.Client
+	//BaseURL is the prefix of the request paths
+	BaseURL string
+	//Codec encodes the request bodies
+	Codec media.ContentCodec
+	//Accept is the Accept header value, the Codec content type when empty
+	Accept string
+	//Timeout is the max duration of each request attempt, zero means no timeout
+	Timeout time.Duration
+	//Retry is the policy to resend the idempotent requests, nil disables the retries
+	Retry *hakiclient.Retry
+	//Breaker rejects the requests to the hosts that are failing, nil disables the circuit breaking
+	Breaker *hakiclient.Breaker
+}
+
+//New creates a Client of the provided base url that sends and accepts json
+func New(baseURL string) *Client {
+	return &Client{
+		HTTPClient: &fasthttp.Client{},
+		BaseURL:    baseURL,
+		Codec:      media.JSON,
+	}
+}
+
+//NewWithConfig creates a json Client of the provided base url with the DefaultRetry policy and a per host Breaker
+func NewWithConfig(baseURL string, config hakiclient.Configuration) *Client {
+	retry := hakiclient.DefaultRetry
+	client := New(baseURL)
+	client.HTTPClient.MaxConnsPerHost = config.MaxConnsPerHost
+	client.Timeout = config.Timeout()
+	client.Retry = &retry
+	client.Breaker = hakiclient.NewBreaker(hakiclient.DefaultBreakerThreshold, hakiclient.DefaultBreakerTimeout)
+	return client
+}
+
+//Forward sets the request headers with the tid, cid, trace parent and authorization of the incoming request
+func Forward(in *fasthttp.RequestCtx, req *fasthttp.Request) {
+	if in == nil {
+		return
+	}
+	for _, header := range forwardHeaders {
+		if val := in.Request.Header.Peek(header); len(val) > 0 && len(req.Header.Peek(header)) == 0 {
+			req.Header.SetBytesV(header, val)
+		}
+	}
+}
+
+//Do sends a request with the encoded body, if not nil, and decodes the response into result, if not nil.
+//The headers of the incoming request, if not nil, are forwarded and non 2xx responses are returned as *client.Error.
+//Idempotent requests are retried by the Retry policy while the ctx is not done and its deadline allows,
+//and the Breaker rejects the requests to failing hosts with client.ErrCircuitOpen
+func (c *Client) Do(ctx context.Context, in *fasthttp.RequestCtx, method string, path string, body interface{}, result interface{}) error {
+	start := time.Now()
+	req := fasthttp.AcquireRequest()
+	defer fasthttp.ReleaseRequest(req)
+	resp := fasthttp.AcquireResponse()
+	defer fasthttp.ReleaseResponse(resp)
+
+	req.Header.SetMethod(method)
+	req.SetRequestURI(c.BaseURL + path)
+	if body != nil {
+		bodyBytes, err := c.Codec.Codec.MarshalBytes(body)
+		if err != nil {
+			return err
+		}
+		req.SetBody(bodyBytes)
+		req.Header.SetContentType(c.Codec.ContentType)
+	}
+	accept := c.Accept
+	if accept == "" {
+		accept = c.Codec.ContentType
+	}
+	req.Header.Set(haki.AcceptHeader, accept)
+	Forward(in, req)
+
+	attempts := 1
+	if c.Retry.Retryable(method) {
+		attempts = c.Retry.Attempts
+	}
+	for attempt := 1; ; attempt++ {
+		retry, err := c.do(ctx, req, resp, result, attempt < attempts)
+		if !retry {
+			l.Debug("haki.fast.client.Response",
+				l.String("method", method),
+				l.String("url", c.BaseURL+path),
+				l.Int("status", resp.StatusCode()),
+				l.Int("attempts", attempt),
+				l.Duration("requestTime", time.Since(start)),
+				l.Err(err),
+			)
+			return err
+		}
+		wait, ok := c.Retry.Wait(attempt-1, string(resp.Header.Peek(haki.RetryAfterHeader)))
+		l.Warn("haki.fast.client.Retry",
+			l.String("method", method),
+			l.String("url", c.BaseURL+path),
+			l.Int("attempt", attempt),
+			l.Duration("wait", wait),
+			l.Bool("retry", ok),
+			l.Err(err),
+		)
+		//A Retry-After past the MaxBackoff or the ctx deadline ends the retries with the last failure
+		if !ok || !hakiclient.Sleep(ctx, wait) {
+			return err
+		}
+		resp.Reset()
+	}
+}
+
+//do sends one attempt of the request, bounded by the Timeout and the ctx deadline,
+//and returns true, when retryable is true and the attempt failed temporarily
+func (c *Client) do(ctx context.Context, req *fasthttp.Request, resp *fasthttp.Response, result interface{}, retryable bool) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	host := string(req.Host())
+	if c.Breaker != nil {
+		if err := c.Breaker.Allow(host); err != nil {
+			return false, err
+		}
+	}
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = &fasthttp.Client{}
+	}
+	deadline, hasDeadline := ctx.Deadline()
+	if c.Timeout > 0 {
+		if timeout := time.Now().Add(c.Timeout); !hasDeadline || timeout.Before(deadline) {
+			deadline, hasDeadline = timeout, true
+		}
+	}
+	var err error
+	if hasDeadline {
+		err = httpClient.DoDeadline(req, resp, deadline)
+	} else {
+		err = httpClient.Do(req, resp)
+	}
+	if c.Breaker != nil {
+		c.Breaker.Done(host, err != nil || resp.StatusCode() >= fasthttp.StatusInternalServerError)
+	}
+	if err != nil {
+		l.Error("haki.fast.client.RequestErr",
+			l.String("method", string(req.Header.Method())),
+			l.String("url", req.URI().String()),
+			l.Err(err),
+		)
+		return retryable, err
+	}
+	err = ReadResponse(resp, result)
+	return retryable && hakiclient.RetryStatus(resp.StatusCode()), err
+}
+
+//Get sends a GET request and decodes the response into result
+func (c *Client) Get(ctx context.Context, in *fasthttp.RequestCtx, path string, result interface{}) error {
+	return c.Do(ctx, in, "GET", path, nil, result)
+}
+
+//Post sends a POST request with the encoded body and decodes the response into result
+func (c *Client) Post(ctx context.Context, in *fasthttp.RequestCtx, path string, body interface{}, result interface{}) error {
+	return c.Do(ctx, in, "POST", path, body, result)
+}
+
+//Put sends a PUT request with the encoded body and decodes the response into result
+func (c *Client) Put(ctx context.Context, in *fasthttp.RequestCtx, path string, body interface{}, result interface{}) error {
+	return c.Do(ctx, in, "PUT", path, body, result)
+}
+
+//Patch sends a PATCH request with the encoded body and decodes the response into result
+func (c *Client) Patch(ctx context.Context, in *fasthttp.RequestCtx, path string, body interface{}, result interface{}) error {
+	return c.Do(ctx, in, "PATCH", path, body, result)
+}
+
+//Delete sends a DELETE request and decodes the response into result
+func (c *Client) Delete(ctx context.Context, in *fasthttp.RequestCtx, path string, result interface{}) error {
+	return c.Do(ctx, in, "DELETE", path, nil, result)
+}
+
+//ReadResponse decodes a 2xx response body into result by its Content-Type and Content-Encoding.
+//Other responses are returned as *client.Error
+func ReadResponse(resp *fasthttp.Response, result interface{}) error {
+	body, err := haki.ContentDecoder(string(resp.Header.Peek(haki.ContentEncodingHeader)), bytes.NewReader(resp.Body()))
+	if err != nil {
+		return err
+	}
+	contentType := string(resp.Header.ContentType())
+	status := resp.StatusCode()
+	if status < 200 || status > 299 {
+		errBody, err := ioutil.ReadAll(io.LimitReader(body, hakiclient.MaxErrorBodySize))
+		if err != nil {
+			return err
+		}
+		return hakiclient.NewError(status, contentType, errBody)
+	}
+	if result == nil || status == fasthttp.StatusNoContent {
+		return nil
+	}
+	codec, found := media.ForContentType(contentType)
+	if !found {
+		return hakiclient.ErrInvalidResponseContentType
+	}
+	return codec.Unmarshal(body, result)
+}
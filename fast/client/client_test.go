@@ -0,0 +1,230 @@
+package client
+
+import (
+	"context"
+	"github.com/rjansen/haki"
+	hakiclient "github.com/rjansen/haki/http/client"
+	"github.com/rjansen/haki/media"
+	"github.com/rjansen/l"
+	"github.com/rjansen/l/zap"
+	"github.com/stretchr/testify/assert"
+	"github.com/valyala/fasthttp"
+	"github.com/valyala/fasthttp/fasthttputil"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func init() {
+	if setupErr := zap.Setup(new(l.Configuration)); setupErr != nil {
+		panic(setupErr)
+	}
+	l.Info("context.fast.client_test.init")
+}
+
+type mockUser struct {
+	Username string `json:"username" codec:"username"`
+	Name     string `json:"name" codec:"name"`
+}
+
+//serve starts the handler in an in memory listener and returns a Client connected to it
+func serve(t *testing.T, handler fasthttp.RequestHandler) (*Client, func()) {
+	ln := fasthttputil.NewInmemoryListener()
+	go fasthttp.Serve(ln, handler)
+	client := New("http://mock.haki")
+	client.HTTPClient.Dial = func(addr string) (net.Conn, error) {
+		return ln.Dial()
+	}
+	return client, func() { ln.Close() }
+}
+
+func echoHandler(t *testing.T) fasthttp.RequestHandler {
+	return func(ctx *fasthttp.RequestCtx) {
+		for _, header := range forwardHeaders {
+			ctx.Response.Header.SetBytesV("Echo-"+header, ctx.Request.Header.Peek(header))
+		}
+		var user mockUser
+		if len(ctx.PostBody()) > 0 {
+			codec, found := media.ForContentType(string(ctx.Request.Header.ContentType()))
+			assert.True(t, found)
+			assert.Nil(t, codec.UnmarshalBytes(ctx.PostBody(), &user))
+		}
+		user.Name = string(ctx.Method()) + " " + user.Name
+		accept := string(ctx.Request.Header.Peek(haki.AcceptHeader))
+		codec, found := media.ForContentType(accept)
+		assert.True(t, found)
+		ctx.SetContentType(accept)
+		assert.Nil(t, codec.Marshal(ctx, &user))
+	}
+}
+
+func TestClientDo(t *testing.T) {
+	client, closer := serve(t, echoHandler(t))
+	defer closer()
+
+	for _, codec := range []media.ContentCodec{media.JSON, media.MsgPack, media.CBOR} {
+		client.Codec = codec
+		var result mockUser
+		err := client.Post(context.Background(), nil, "/users", &mockUser{Username: "mock", Name: "Mock User"}, &result)
+		assert.Nil(t, err, codec.ContentType)
+		assert.Equal(t, mockUser{Username: "mock", Name: "POST Mock User"}, result, codec.ContentType)
+	}
+	client.Codec = media.JSON
+	client.Timeout = time.Second
+	var result mockUser
+	assert.Nil(t, client.Get(context.Background(), nil, "/users", &result))
+	assert.Equal(t, "GET ", result.Name)
+	assert.Nil(t, client.Delete(context.Background(), nil, "/users", nil))
+}
+
+func TestClientForward(t *testing.T) {
+	var echo fasthttp.RequestHeader
+	client, closer := serve(t, func(ctx *fasthttp.RequestCtx) {
+		ctx.Request.Header.CopyTo(&echo)
+		ctx.SetStatusCode(fasthttp.StatusNoContent)
+	})
+	defer closer()
+
+	var in fasthttp.RequestCtx
+	in.Request.Header.Set(haki.RequestIDHeader, "mock-tid")
+	in.Request.Header.Set(haki.RequestContextHeader, "mock-cid")
+	in.Request.Header.Set(haki.TraceParentHeader, "00-mock-trace-01")
+	in.Request.Header.Set(haki.AuthorizationHeader, "Bearer mock")
+
+	assert.Nil(t, client.Put(context.Background(), &in, "/users", &mockUser{Username: "mock"}, &mockUser{}))
+	assert.Equal(t, "mock-tid", string(echo.Peek(haki.RequestIDHeader)))
+	assert.Equal(t, "mock-cid", string(echo.Peek(haki.RequestContextHeader)))
+	assert.Equal(t, "00-mock-trace-01", string(echo.Peek(haki.TraceParentHeader)))
+	assert.Equal(t, "Bearer mock", string(echo.Peek(haki.AuthorizationHeader)))
+	assert.Equal(t, media.JSON.ContentType, string(echo.ContentType()))
+	assert.Equal(t, media.JSON.ContentType, string(echo.Peek(haki.AcceptHeader)))
+
+	assert.Nil(t, client.Get(context.Background(), nil, "/users", nil))
+	assert.Equal(t, "", string(echo.Peek(haki.RequestIDHeader)))
+	assert.Equal(t, "", string(echo.Peek(haki.AuthorizationHeader)))
+}
+
+func TestClientErr(t *testing.T) {
+	client, closer := serve(t, func(ctx *fasthttp.RequestCtx) {
+		switch string(ctx.Path()) {
+		case "/text":
+			ctx.Error("Invalid mock request", fasthttp.StatusBadRequest)
+		case "/json":
+			ctx.SetStatusCode(fasthttp.StatusConflict)
+			ctx.SetContentType(media.JSON.ContentType)
+			ctx.SetBodyString(`{"username": "conflict"}`)
+		case "/unknown":
+			ctx.SetContentType("image/png")
+			ctx.SetBody([]byte{1, 2, 3})
+		}
+	})
+	defer closer()
+
+	err := client.Get(context.Background(), nil, "/text", &mockUser{})
+	assert.IsType(t, &hakiclient.Error{}, err)
+	assert.Equal(t, fasthttp.StatusBadRequest, err.(*hakiclient.Error).StatusCode)
+	assert.Equal(t, "Invalid mock request", err.(*hakiclient.Error).Message)
+
+	err = client.Get(context.Background(), nil, "/json", &mockUser{})
+	assert.IsType(t, &hakiclient.Error{}, err)
+	var errBody mockUser
+	assert.Nil(t, err.(*hakiclient.Error).Decode(&errBody))
+	assert.Equal(t, "conflict", errBody.Username)
+
+	err = client.Get(context.Background(), nil, "/unknown", &mockUser{})
+	assert.Equal(t, hakiclient.ErrInvalidResponseContentType, err)
+
+	err = client.Post(context.Background(), nil, "/json", make(chan int), nil)
+	assert.NotNil(t, err)
+}
+
+func TestClientRetry(t *testing.T) {
+	var calls int32
+	client, closer := serve(t, func(ctx *fasthttp.RequestCtx) {
+		if atomic.AddInt32(&calls, 1)%2 != 0 {
+			ctx.Response.Header.Set(haki.RetryAfterHeader, "0")
+			ctx.SetStatusCode(fasthttp.StatusBadGateway)
+			return
+		}
+		ctx.SetContentType(media.JSON.ContentType)
+		ctx.SetBodyString(`{"username": "mock"}`)
+	})
+	defer closer()
+
+	client.Retry = &hakiclient.Retry{Attempts: 2, Backoff: time.Millisecond}
+	var result mockUser
+	assert.Nil(t, client.Get(context.Background(), nil, "/users", &result))
+	assert.Equal(t, "mock", result.Username)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+
+	atomic.StoreInt32(&calls, 0)
+	err := client.Post(context.Background(), nil, "/users", &mockUser{}, nil)
+	assert.IsType(t, &hakiclient.Error{}, err)
+	assert.Equal(t, fasthttp.StatusBadGateway, err.(*hakiclient.Error).StatusCode)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+}
+
+func TestClientRetryContext(t *testing.T) {
+	var calls int32
+	client, closer := serve(t, func(ctx *fasthttp.RequestCtx) {
+		atomic.AddInt32(&calls, 1)
+		if string(ctx.Path()) == "/long" {
+			ctx.Response.Header.Set(haki.RetryAfterHeader, "30")
+		} else {
+			ctx.Response.Header.Set(haki.RetryAfterHeader, "1")
+		}
+		ctx.SetStatusCode(fasthttp.StatusServiceUnavailable)
+	})
+	defer closer()
+
+	client.Retry = &hakiclient.Retry{Attempts: 3, Backoff: time.Millisecond, MaxBackoff: 2 * time.Second}
+	start := time.Now()
+	err := client.Get(context.Background(), nil, "/long", nil)
+	assert.IsType(t, &hakiclient.Error{}, err)
+	assert.Equal(t, fasthttp.StatusServiceUnavailable, err.(*hakiclient.Error).StatusCode)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls), "No retry before the Retry-After")
+	assert.True(t, time.Since(start) < time.Second)
+
+	atomic.StoreInt32(&calls, 0)
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	start = time.Now()
+	err = client.Get(ctx, nil, "/users", nil)
+	assert.IsType(t, &hakiclient.Error{}, err)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls), "The Retry-After passes the deadline")
+	assert.True(t, time.Since(start) < 500*time.Millisecond)
+
+	atomic.StoreInt32(&calls, 0)
+	ctx, cancel = context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+	start = time.Now()
+	err = client.Get(ctx, nil, "/users", nil)
+	assert.IsType(t, &hakiclient.Error{}, err)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+	assert.True(t, time.Since(start) < time.Second, "The cancel stops the retry wait")
+
+	assert.Equal(t, context.Canceled, client.Get(ctx, nil, "/users", nil))
+}
+
+func TestClientBreaker(t *testing.T) {
+	var calls int32
+	client, closer := serve(t, func(ctx *fasthttp.RequestCtx) {
+		atomic.AddInt32(&calls, 1)
+		ctx.SetStatusCode(fasthttp.StatusInternalServerError)
+	})
+	defer closer()
+
+	configured := NewWithConfig("http://mock.haki", hakiclient.Configuration{RequestTimeout: 500, MaxConnsPerHost: 250})
+	assert.Equal(t, 500*time.Millisecond, configured.Timeout)
+	assert.Equal(t, 250, configured.HTTPClient.MaxConnsPerHost)
+	assert.NotNil(t, configured.Retry)
+
+	client.Breaker = hakiclient.NewBreaker(2, time.Minute)
+	for i := 0; i < 2; i++ {
+		assert.IsType(t, &hakiclient.Error{}, client.Get(context.Background(), nil, "/users", nil))
+	}
+	assert.Equal(t, hakiclient.ErrCircuitOpen, client.Get(context.Background(), nil, "/users", nil))
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+	assert.Equal(t, hakiclient.StateOpen, client.Breaker.State("mock.haki"))
+}
@@ -0,0 +1,46 @@
+package fast
+
+import (
+	"context"
+	"errors"
+	"github.com/rjansen/haki"
+	"github.com/rjansen/haki/concurrency"
+	"github.com/rjansen/l"
+	"github.com/valyala/fasthttp"
+	"strconv"
+	"time"
+)
+
+func concurrencyLimitHandle(limiter *concurrency.Limiter, handler HTTPHandlerFunc, c context.Context, fc *fasthttp.RequestCtx) error {
+	if !limiter.Acquire(c.Done()) {
+		stats := limiter.Stats()
+		l.Warn("haki.fast.RequestShed",
+			l.Bytes("path", fc.Path()),
+			l.Int("limit", stats.Limit),
+			l.Int("inFlight", stats.InFlight),
+			l.Uint64("rejected", stats.Rejected),
+		)
+		fc.Response.Header.Set(haki.RetryAfterHeader, strconv.FormatInt(haki.Seconds(limiter.RetryAfter()), 10))
+		return haki.ErrServiceUnavailable
+	}
+	//The same request time reported by the Log wrapper feeds the adaptive limit
+	start := time.Now()
+	failed := true
+	defer func() {
+		limiter.Release(time.Since(start), failed)
+	}()
+	err := handler(c, fc)
+	//Client errors say nothing about the service health and the shed of a nested limiter is not a slow request
+	failed = err != nil && haki.ErrStatus(err) >= fasthttp.StatusInternalServerError && !errors.Is(err, haki.ErrServiceUnavailable)
+	return err
+}
+
+//ConcurrencyLimit creates a wrapper that bounds the requests in flight with the provided Limiter.
+//Shed requests return haki.ErrServiceUnavailable that the Error wrapper renders as a 503 response
+func ConcurrencyLimit(limiter *concurrency.Limiter) HTTPHandlerWrapper {
+	return func(handler HTTPHandlerFunc) HTTPHandlerFunc {
+		return func(c context.Context, fc *fasthttp.RequestCtx) error {
+			return concurrencyLimitHandle(limiter, handler, c, fc)
+		}
+	}
+}
@@ -0,0 +1,29 @@
+package fast
+
+import (
+	"context"
+	"github.com/rjansen/haki/cors"
+	"github.com/valyala/fasthttp"
+)
+
+func corsHandle(policy *cors.Policy, handler HTTPHandlerFunc, c context.Context, fc *fasthttp.RequestCtx) error {
+	preflight := policy.Handle(&fc.Response.Header, string(fc.Method()),
+		string(fc.Request.Header.Peek(cors.OriginHeader)),
+		string(fc.Request.Header.Peek(cors.RequestMethodHeader)),
+		string(fc.Request.Header.Peek(cors.RequestHeadersHeader)),
+	)
+	if preflight {
+		fc.SetStatusCode(fasthttp.StatusNoContent)
+		return nil
+	}
+	return handler(c, fc)
+}
+
+//CORS creates a wrapper that writes the cross origin headers of the policy and answers the preflight requests
+func CORS(policy *cors.Policy) HTTPHandlerWrapper {
+	return func(handler HTTPHandlerFunc) HTTPHandlerFunc {
+		return func(c context.Context, fc *fasthttp.RequestCtx) error {
+			return corsHandle(policy, handler, c, fc)
+		}
+	}
+}
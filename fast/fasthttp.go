@@ -1,13 +1,23 @@
 package fast
 
 import (
+	"bufio"
 	"bytes"
 	"context"
 	"github.com/rjansen/haki"
+	"github.com/rjansen/haki/media/cbor"
+	"github.com/rjansen/haki/media/form"
 	"github.com/rjansen/haki/media/json"
+	"github.com/rjansen/haki/media/jsonpb"
+	"github.com/rjansen/haki/media/msgpack"
 	"github.com/rjansen/haki/media/proto"
+	"github.com/rjansen/haki/media/text"
+	"github.com/rjansen/haki/media/xml"
 	"github.com/rjansen/l"
+	"github.com/valyala/bytebufferpool"
 	"github.com/valyala/fasthttp"
+	"io"
+	"io/ioutil"
 	"net/http"
 	"time"
 )
@@ -25,6 +35,9 @@ func (h HTTPHandlerFunc) HandleRequest(c context.Context, fc *fasthttp.RequestCt
 	return h(c, fc)
 }
 
+//HTTPHandlerWrapper is a function to create handler wraps to execute like a chain mechanism between the handlers
+type HTTPHandlerWrapper func(HTTPHandlerFunc) HTTPHandlerFunc
+
 //HTTPHandler is a contract for fast http handlers
 type HTTPHandler interface {
 	HandleRequest(context.Context, *fasthttp.RequestCtx) error
@@ -41,7 +54,7 @@ func Handler(handler HTTPHandlerFunc) fasthttp.RequestHandler {
 
 func errorHandle(handler HTTPHandlerFunc, c context.Context, fc *fasthttp.RequestCtx) error {
 	if err := handler(c, fc); err != nil {
-		fc.Error(err.Error(), fasthttp.StatusInternalServerError)
+		writeErr(fc, err)
 		return err
 	}
 	return nil
@@ -105,14 +118,50 @@ func Log(handler HTTPHandlerFunc) HTTPHandlerFunc {
 	}
 }
 
-//ReadByContentType reads data from context using the Content-Type header to define the media type
+//DecodeBody replaces the request body by its decoded content when the Content-Encoding header is present
+func DecodeBody(ctx *fasthttp.RequestCtx) error {
+	contentEncoding := ctx.Request.Header.Peek(haki.ContentEncodingHeader)
+	if len(contentEncoding) == 0 {
+		return nil
+	}
+	body, err := haki.ContentDecoder(string(contentEncoding), bytes.NewReader(ctx.PostBody()))
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+	decoded, err := ioutil.ReadAll(body)
+	if err != nil {
+		return err
+	}
+	ctx.Request.Header.Del(haki.ContentEncodingHeader)
+	ctx.Request.SetBody(decoded)
+	return nil
+}
+
+//ReadByContentType reads data from context using the Content-Type header to define the media type.
+//Bodies with gzip or deflate Content-Encoding are decoded before the read
 func ReadByContentType(ctx *fasthttp.RequestCtx, data interface{}) error {
+	if err := DecodeBody(ctx); err != nil {
+		return err
+	}
 	contentType := ctx.Request.Header.ContentType()
 	switch {
 	case bytes.Contains(contentType, []byte(json.ContentType)):
 		return ReadJSON(ctx, data)
 	case bytes.Contains(contentType, []byte(proto.ContentType)):
 		return ReadProtoBuff(ctx, data)
+	case bytes.Contains(contentType, []byte(msgpack.ContentType)):
+		return ReadMsgPack(ctx, data)
+	case bytes.Contains(contentType, []byte(cbor.ContentType)):
+		return ReadCBOR(ctx, data)
+	case bytes.Contains(contentType, []byte(xml.ContentType)), bytes.Contains(contentType, []byte(xml.ContentTypeText)):
+		return ReadXML(ctx, data)
+	case bytes.Contains(contentType, []byte(text.ContentType)):
+		return ReadText(ctx, data)
+	case bytes.Contains(contentType, []byte(form.ContentType)):
+		return ReadForm(ctx, data)
+	case bytes.Contains(contentType, []byte(form.MultipartContentType)):
+		return ReadMultipart(ctx, form.DefaultLimits, data, nil)
 	default:
 		return haki.ErrInvalidContentType
 	}
@@ -126,38 +175,59 @@ func WriteByAccept(ctx *fasthttp.RequestCtx, status int, result interface{}) err
 		return JSON(ctx, status, result)
 	case bytes.Contains(contentType, []byte(proto.ContentType)):
 		return ProtoBuff(ctx, status, result)
+	case bytes.Contains(contentType, []byte(msgpack.ContentType)):
+		return MsgPack(ctx, status, result)
+	case bytes.Contains(contentType, []byte(cbor.ContentType)):
+		return CBOR(ctx, status, result)
+	case bytes.Contains(contentType, []byte(xml.ContentType)), bytes.Contains(contentType, []byte(xml.ContentTypeText)):
+		return XML(ctx, status, result)
+	case bytes.Contains(contentType, []byte(text.ContentType)):
+		return Text(ctx, status, result)
 	default:
 		return haki.ErrInvalidAccept
 	}
 }
 
-//JSON writes the provided json media to the response
+//JSON writes the provided json media directly into the response body.
+//Protocol buffer messages are written using the proto3 json mapping
 func JSON(ctx *fasthttp.RequestCtx, status int, result interface{}) error {
-	jsonBytes, err := json.MarshalBytes(result)
+	ctx.Response.ResetBody()
+	var err error
+	if jsonpb.IsMessage(result) {
+		err = jsonpb.Marshal(ctx.Response.BodyWriter(), result)
+	} else {
+		err = json.Marshal(ctx.Response.BodyWriter(), result)
+	}
 	if err != nil {
+		ctx.Response.ResetBody()
 		return err
 	}
-	ctx.SetBody(jsonBytes)
 	ctx.SetContentType(json.ContentType)
 	ctx.SetStatusCode(status)
 	return nil
 }
 
-//ReadJSON unmarshals from provided context a json media into data
+//ReadJSON unmarshals from provided context a json media into data.
+//Protocol buffer messages are read using the proto3 json mapping
 func ReadJSON(ctx *fasthttp.RequestCtx, data interface{}) error {
+	if jsonpb.IsMessage(data) {
+		return jsonpb.UnmarshalBytes(ctx.PostBody(), data)
+	}
 	if err := json.UnmarshalBytes(ctx.PostBody(), data); err != nil {
 		return err
 	}
 	return nil
 }
 
-//ProtoBuff writes the provided protocol buffer media to the response
+//ProtoBuff writes the provided protocol buffer media to the response using a pooled buffer
 func ProtoBuff(ctx *fasthttp.RequestCtx, status int, result interface{}) error {
-	protoBytes, err := proto.MarshalBytes(result)
-	if err != nil {
+	buf := bytebufferpool.Get()
+	defer bytebufferpool.Put(buf)
+	var err error
+	if buf.B, err = proto.MarshalAppend(buf.B[:0], result); err != nil {
 		return err
 	}
-	ctx.SetBody(protoBytes)
+	ctx.SetBody(buf.B)
 	ctx.SetContentType(proto.ContentType)
 	ctx.SetStatusCode(status)
 	return nil
@@ -171,6 +241,154 @@ func ReadProtoBuff(ctx *fasthttp.RequestCtx, data interface{}) error {
 	return nil
 }
 
+//MsgPack writes the provided msgpack media to the response
+func MsgPack(ctx *fasthttp.RequestCtx, status int, result interface{}) error {
+	msgpackBytes, err := msgpack.MarshalBytes(result)
+	if err != nil {
+		return err
+	}
+	ctx.SetBody(msgpackBytes)
+	ctx.SetContentType(msgpack.ContentType)
+	ctx.SetStatusCode(status)
+	return nil
+}
+
+//ReadMsgPack unmarshals from provided context a msgpack media into data
+func ReadMsgPack(ctx *fasthttp.RequestCtx, data interface{}) error {
+	if err := msgpack.UnmarshalBytes(ctx.PostBody(), data); err != nil {
+		return err
+	}
+	return nil
+}
+
+//CBOR writes the provided cbor media to the response
+func CBOR(ctx *fasthttp.RequestCtx, status int, result interface{}) error {
+	cborBytes, err := cbor.MarshalBytes(result)
+	if err != nil {
+		return err
+	}
+	ctx.SetBody(cborBytes)
+	ctx.SetContentType(cbor.ContentType)
+	ctx.SetStatusCode(status)
+	return nil
+}
+
+//ReadCBOR unmarshals from provided context a cbor media into data
+func ReadCBOR(ctx *fasthttp.RequestCtx, data interface{}) error {
+	if err := cbor.UnmarshalBytes(ctx.PostBody(), data); err != nil {
+		return err
+	}
+	return nil
+}
+
+//XML writes the provided xml media to the response
+func XML(ctx *fasthttp.RequestCtx, status int, result interface{}) error {
+	xmlBytes, err := xml.MarshalBytes(result)
+	if err != nil {
+		return err
+	}
+	ctx.SetBody(xmlBytes)
+	ctx.SetContentType(xml.ContentTypeUTF8)
+	ctx.SetStatusCode(status)
+	return nil
+}
+
+//ReadXML unmarshals from provided context a xml media into data
+func ReadXML(ctx *fasthttp.RequestCtx, data interface{}) error {
+	if err := xml.UnmarshalBytes(ctx.PostBody(), data); err != nil {
+		return err
+	}
+	return nil
+}
+
+//Text writes the provided plain text media to the response
+func Text(ctx *fasthttp.RequestCtx, status int, result interface{}) error {
+	textBytes, err := text.MarshalBytes(result)
+	if err != nil {
+		return err
+	}
+	ctx.SetBody(textBytes)
+	ctx.SetContentType(text.ContentTypeUTF8)
+	ctx.SetStatusCode(status)
+	return nil
+}
+
+//ReadText reads from provided context a plain text media into data
+func ReadText(ctx *fasthttp.RequestCtx, data interface{}) error {
+	if err := text.UnmarshalBytes(ctx.PostBody(), data); err != nil {
+		return err
+	}
+	return nil
+}
+
+//ReadForm unmarshals from provided context a url encoded form media into data
+func ReadForm(ctx *fasthttp.RequestCtx, data interface{}) error {
+	if err := form.UnmarshalBytes(ctx.PostBody(), data); err != nil {
+		return err
+	}
+	return nil
+}
+
+//ReadMultipart reads from provided context a multipart form media.
+//Value parts are decoded into data and file parts are passed to handle, both bounded by the provided limits
+func ReadMultipart(ctx *fasthttp.RequestCtx, limits form.Limits, data interface{}, handle form.PartFunc) error {
+	boundary := ctx.Request.Header.MultipartFormBoundary()
+	if len(boundary) == 0 {
+		return fasthttp.ErrNoMultipartForm
+	}
+	return form.ReadMultipart(bytes.NewReader(ctx.PostBody()), string(boundary), limits, data, handle)
+}
+
+//ReadProtoBuffStream reads from provided context a varint length-delimited protocol buffer stream.
+//For each message, newMsg must return a new message reference that is decoded and passed to handle.
+//Unlike the http variant, fasthttp buffers the whole request body before the handler runs,
+//so the body size is bounded by the Server MaxRequestBodySize and not only by maxSize
+func ReadProtoBuffStream(ctx *fasthttp.RequestCtx, maxSize int, newMsg func() interface{}, handle func(interface{}) error) error {
+	decoder := proto.NewDecoder(bytes.NewReader(ctx.PostBody()))
+	decoder.MaxSize = maxSize
+	for {
+		msg := newMsg()
+		if err := decoder.Decode(msg); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		if err := handle(msg); err != nil {
+			return err
+		}
+	}
+}
+
+//ProtoBuffStream writes a varint length-delimited protocol buffer stream to the response.
+//The stream func runs after the handler returns, so its errors are logged and abort the response body
+func ProtoBuffStream(ctx *fasthttp.RequestCtx, status int, maxSize int, stream func(*proto.Encoder) error) error {
+	ctx.SetContentType(proto.DelimitedContentType)
+	ctx.SetStatusCode(status)
+	ctx.SetBodyStreamWriter(func(w *bufio.Writer) {
+		encoder := proto.NewEncoder(flushWriter{w: w})
+		encoder.MaxSize = maxSize
+		if err := stream(encoder); err != nil {
+			l.Error("haki.fast.ProtoBuffStreamErr",
+				l.Err(err),
+			)
+		}
+	})
+	return nil
+}
+
+type flushWriter struct {
+	w *bufio.Writer
+}
+
+func (f flushWriter) Write(b []byte) (int, error) {
+	n, err := f.w.Write(b)
+	if err != nil {
+		return n, err
+	}
+	return n, f.w.Flush()
+}
+
 //Status writes the provided status to the response
 func Status(ctx *fasthttp.RequestCtx, status int) error {
 	ctx.SetStatusCode(status)
@@ -180,10 +398,25 @@ func Status(ctx *fasthttp.RequestCtx, status int) error {
 //Err writes the provided  error to the response
 func Err(ctx *fasthttp.RequestCtx, err error) error {
 	//w.WriteHeader(http.StatusInternalServerError)
-	ctx.Error(err.Error(), fasthttp.StatusInternalServerError)
+	writeErr(ctx, err)
 	return err
 }
 
+//writeErr writes the error message as a text response.
+//The headers set before a haki.StatusError, like Retry-After, are kept as the net/http Error does
+func writeErr(ctx *fasthttp.RequestCtx, err error) {
+	status := haki.ErrStatus(err)
+	if status == fasthttp.StatusInternalServerError {
+		ctx.Error(err.Error(), status)
+		return
+	}
+	ctx.Response.ResetBody()
+	ctx.Response.Header.Del(haki.ContentEncodingHeader)
+	ctx.SetStatusCode(status)
+	ctx.SetContentType("text/plain; charset=utf-8")
+	ctx.SetBodyString(err.Error())
+}
+
 //BaseHandler is a struct to add response helper function to other handlers
 type BaseHandler struct {
 }
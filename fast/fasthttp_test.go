@@ -1,17 +1,51 @@
 package fast
 
 import (
+	"bufio"
 	"bytes"
 	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
 	"errors"
+	"github.com/klauspost/compress/gzip"
+	"github.com/rjansen/haki"
+	"github.com/rjansen/haki/apikey"
+	"github.com/rjansen/haki/auth"
+	"github.com/rjansen/haki/authz"
+	"github.com/rjansen/haki/concurrency"
+	"github.com/rjansen/haki/cors"
+	"github.com/rjansen/haki/health"
+	"github.com/rjansen/haki/media/cbor"
+	"github.com/rjansen/haki/media/form"
+	"github.com/rjansen/haki/media/msgpack"
 	"github.com/rjansen/haki/media/proto"
+	"github.com/rjansen/haki/media/text"
+	"github.com/rjansen/haki/media/xml"
+	"github.com/rjansen/haki/mtls"
+	"github.com/rjansen/haki/proxy"
+	"github.com/rjansen/haki/ratelimit"
+	"github.com/rjansen/haki/secure"
+	"github.com/rjansen/haki/session"
 	"github.com/rjansen/l"
 	"github.com/rjansen/l/zap"
 	"github.com/stretchr/testify/assert"
 	"github.com/valyala/fasthttp"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/url"
+	"path/filepath"
 	// "os"
 	"strings"
 	"testing"
+	"time"
 )
 
 func init() {
@@ -250,6 +284,49 @@ func TestJSONByContentType(t *testing.T) {
 	assert.True(t, bytes.Contains(ctx.Response.Header.ContentType(), []byte("application/json")), "Response.ContenType is not application/json")
 }
 
+func TestProtoJSONByContentType(t *testing.T) {
+	media := &proto.Store{
+		Id:   1,
+		Name: "Proto JSON Store",
+		Data: []*proto.Store_Data{
+			&proto.Store_Data{
+				Id:   1,
+				Type: proto.Store_HOME,
+			},
+		},
+	}
+
+	uri := "http://resultprotojson/"
+
+	var ctx fasthttp.RequestCtx
+	var req fasthttp.Request
+	req.SetRequestURI(uri)
+	req.Header.Set("Accept", "application/json")
+	ctx.Init(&req, nil, nil)
+
+	var resultErr error
+	assert.NotPanics(t, func() {
+		resultErr = WriteByAccept(&ctx, fasthttp.StatusOK, media)
+	})
+
+	assert.Nil(t, resultErr)
+	assert.Equal(t, fasthttp.StatusOK, ctx.Response.StatusCode())
+	assert.True(t, bytes.Contains(ctx.Response.Body(), []byte(`"type":"HOME"`)), "Response.Body does not use the proto3 json mapping")
+
+	var readCtx fasthttp.RequestCtx
+	var readReq fasthttp.Request
+	readReq.SetRequestURI(uri)
+	readReq.SetBody(ctx.Response.Body())
+	readReq.Header.SetContentType("application/json")
+	readCtx.Init(&readReq, nil, nil)
+
+	result := new(proto.Store)
+	assert.Nil(t, ReadByContentType(&readCtx, result))
+	assert.Equal(t, media.Name, result.Name)
+	assert.Len(t, result.Data, 1)
+	assert.Equal(t, proto.Store_HOME, result.Data[0].Type)
+}
+
 func TestProtoResult(t *testing.T) {
 	media := &proto.Store{
 		Id:   1,
@@ -463,3 +540,938 @@ func TestHandlerResult(t *testing.T) {
 	assert.Equal(t, fasthttp.StatusFound, ctx.Response.StatusCode())
 	assert.Empty(t, ctx.Response.Body())
 }
+
+func TestProtoBuffStream(t *testing.T) {
+	stores := []*proto.Store{
+		&proto.Store{Id: 1, Name: "Proto Stream Store 1"},
+		&proto.Store{Id: 2, Name: "Proto Stream Store 2"},
+	}
+	uri := "http://resultprotostream/"
+
+	var ctx fasthttp.RequestCtx
+	var req fasthttp.Request
+	req.SetRequestURI(uri)
+	ctx.Init(&req, nil, nil)
+
+	var resultErr error
+	assert.NotPanics(t, func() {
+		resultErr = ProtoBuffStream(&ctx, fasthttp.StatusOK, proto.DefaultMaxMessageSize,
+			func(e *proto.Encoder) error {
+				for _, s := range stores {
+					if err := e.Encode(s); err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+		)
+	})
+
+	assert.Nil(t, resultErr)
+	assert.Equal(t, fasthttp.StatusOK, ctx.Response.StatusCode())
+	assert.Equal(t, []byte(proto.DelimitedContentType), ctx.Response.Header.ContentType())
+	body := ctx.Response.Body()
+	assert.NotEmpty(t, body)
+
+	var readCtx fasthttp.RequestCtx
+	var readReq fasthttp.Request
+	readReq.SetRequestURI(uri)
+	readReq.SetBody(body)
+	readCtx.Init(&readReq, nil, nil)
+
+	var results []*proto.Store
+	assert.NotPanics(t, func() {
+		resultErr = ReadProtoBuffStream(&readCtx, proto.DefaultMaxMessageSize,
+			func() interface{} { return new(proto.Store) },
+			func(msg interface{}) error {
+				results = append(results, msg.(*proto.Store))
+				return nil
+			},
+		)
+	})
+
+	assert.Nil(t, resultErr)
+	assert.Len(t, results, len(stores))
+	for i, s := range stores {
+		assert.Equal(t, s.Id, results[i].Id)
+		assert.Equal(t, s.Name, results[i].Name)
+	}
+
+	readReq.SetBody(body)
+	readCtx.Init(&readReq, nil, nil)
+	resultErr = ReadProtoBuffStream(&readCtx, 2,
+		func() interface{} { return new(proto.Store) },
+		func(msg interface{}) error { return nil },
+	)
+	assert.Equal(t, proto.ErrMessageTooLarge, resultErr)
+}
+
+func TestMsgPackByAccept(t *testing.T) {
+	type mockMsgPack struct {
+		Username string `json:"username"`
+		Name     string `json:"name"`
+		Age      int    `json:"age"`
+	}
+	media := &mockMsgPack{
+		Username: "TestMsgPackResult",
+		Name:     "Test MsgPack Result",
+		Age:      15,
+	}
+	uri := "http://resultmsgpack/"
+
+	var ctx fasthttp.RequestCtx
+	var req fasthttp.Request
+	req.SetRequestURI(uri)
+	req.Header.Set("Accept", msgpack.ContentType)
+	ctx.Init(&req, nil, nil)
+
+	var resultErr error
+	assert.NotPanics(t, func() {
+		resultErr = WriteByAccept(&ctx, fasthttp.StatusOK, media)
+	})
+
+	assert.Nil(t, resultErr)
+	assert.Equal(t, fasthttp.StatusOK, ctx.Response.StatusCode())
+	assert.True(t, bytes.Contains(ctx.Response.Body(), []byte(media.Username)), "Response.Body does not contain media.Username")
+	assert.Equal(t, []byte(msgpack.ContentType), ctx.Response.Header.ContentType())
+
+	var readCtx fasthttp.RequestCtx
+	var readReq fasthttp.Request
+	readReq.SetRequestURI(uri)
+	readReq.SetBody(ctx.Response.Body())
+	readReq.Header.SetContentType(msgpack.ContentType)
+	readCtx.Init(&readReq, nil, nil)
+
+	var result mockMsgPack
+	assert.NotPanics(t, func() {
+		resultErr = ReadByContentType(&readCtx, &result)
+	})
+	assert.Nil(t, resultErr)
+	assert.Equal(t, *media, result)
+}
+
+func TestCBORByAccept(t *testing.T) {
+	type mockCBOR struct {
+		Username string `json:"username"`
+		Name     string `json:"name"`
+		Age      int    `json:"age"`
+	}
+	media := &mockCBOR{
+		Username: "TestCBORResult",
+		Name:     "Test CBOR Result",
+		Age:      15,
+	}
+	uri := "http://resultcbor/"
+
+	var ctx fasthttp.RequestCtx
+	var req fasthttp.Request
+	req.SetRequestURI(uri)
+	req.Header.Set("Accept", cbor.ContentType)
+	ctx.Init(&req, nil, nil)
+
+	var resultErr error
+	assert.NotPanics(t, func() {
+		resultErr = WriteByAccept(&ctx, fasthttp.StatusOK, media)
+	})
+
+	assert.Nil(t, resultErr)
+	assert.Equal(t, fasthttp.StatusOK, ctx.Response.StatusCode())
+	assert.True(t, bytes.Contains(ctx.Response.Body(), []byte(media.Username)), "Response.Body does not contain media.Username")
+	assert.Equal(t, []byte(cbor.ContentType), ctx.Response.Header.ContentType())
+
+	var readCtx fasthttp.RequestCtx
+	var readReq fasthttp.Request
+	readReq.SetRequestURI(uri)
+	readReq.SetBody(ctx.Response.Body())
+	readReq.Header.SetContentType(cbor.ContentType)
+	readCtx.Init(&readReq, nil, nil)
+
+	var result mockCBOR
+	assert.NotPanics(t, func() {
+		resultErr = ReadByContentType(&readCtx, &result)
+	})
+	assert.Nil(t, resultErr)
+	assert.Equal(t, *media, result)
+}
+
+func TestXMLByAccept(t *testing.T) {
+	type mockXML struct {
+		Username string `xml:"username"`
+		Name     string `xml:"name"`
+		Age      int    `xml:"age"`
+	}
+	media := &mockXML{
+		Username: "TestXMLResult",
+		Name:     "Test XML Result",
+		Age:      15,
+	}
+	uri := "http://resultxml/"
+
+	var ctx fasthttp.RequestCtx
+	var req fasthttp.Request
+	req.SetRequestURI(uri)
+	req.Header.Set("Accept", xml.ContentType)
+	ctx.Init(&req, nil, nil)
+
+	var resultErr error
+	assert.NotPanics(t, func() {
+		resultErr = WriteByAccept(&ctx, fasthttp.StatusOK, media)
+	})
+
+	assert.Nil(t, resultErr)
+	assert.Equal(t, fasthttp.StatusOK, ctx.Response.StatusCode())
+	assert.True(t, bytes.Contains(ctx.Response.Body(), []byte("<username>TestXMLResult</username>")), "Response.Body does not contain media.Username")
+	assert.Equal(t, []byte(xml.ContentTypeUTF8), ctx.Response.Header.ContentType())
+
+	var readCtx fasthttp.RequestCtx
+	var readReq fasthttp.Request
+	readReq.SetRequestURI(uri)
+	readReq.SetBody(ctx.Response.Body())
+	readReq.Header.SetContentType(xml.ContentTypeText)
+	readCtx.Init(&readReq, nil, nil)
+
+	var result mockXML
+	assert.NotPanics(t, func() {
+		resultErr = ReadByContentType(&readCtx, &result)
+	})
+	assert.Nil(t, resultErr)
+	assert.Equal(t, *media, result)
+}
+
+func TestTextByAccept(t *testing.T) {
+	serverMsg := "OK"
+	uri := "http://resulttext/health"
+
+	var ctx fasthttp.RequestCtx
+	var req fasthttp.Request
+	req.SetRequestURI(uri)
+	req.Header.Set("Accept", text.ContentType)
+	ctx.Init(&req, nil, nil)
+
+	var resultErr error
+	assert.NotPanics(t, func() {
+		resultErr = WriteByAccept(&ctx, fasthttp.StatusOK, serverMsg)
+	})
+
+	assert.Nil(t, resultErr)
+	assert.Equal(t, fasthttp.StatusOK, ctx.Response.StatusCode())
+	assert.Equal(t, serverMsg, string(ctx.Response.Body()))
+	assert.Equal(t, []byte(text.ContentTypeUTF8), ctx.Response.Header.ContentType())
+
+	var readCtx fasthttp.RequestCtx
+	var readReq fasthttp.Request
+	readReq.SetRequestURI(uri)
+	readReq.SetBody(ctx.Response.Body())
+	readReq.Header.SetContentType(text.ContentType)
+	readCtx.Init(&readReq, nil, nil)
+
+	var result []byte
+	assert.NotPanics(t, func() {
+		resultErr = ReadByContentType(&readCtx, &result)
+	})
+	assert.Nil(t, resultErr)
+	assert.Equal(t, serverMsg, string(result))
+}
+
+type mockLoginForm struct {
+	Username string `form:"fivecolors_username"`
+	Password string `form:"fivecolors_password"`
+}
+
+func TestFormReadByContentType(t *testing.T) {
+	uri := "http://contentform/auth/login/"
+
+	var ctx fasthttp.RequestCtx
+	var req fasthttp.Request
+	req.SetRequestURI(uri)
+	req.SetBody([]byte("fivecolors_username=mock&fivecolors_password=p%40ss"))
+	req.Header.SetContentType(form.ContentType)
+	ctx.Init(&req, nil, nil)
+
+	var readErr error
+	var media mockLoginForm
+	assert.NotPanics(t, func() {
+		readErr = ReadByContentType(&ctx, &media)
+	})
+
+	assert.Nil(t, readErr)
+	assert.Equal(t, "mock", media.Username)
+	assert.Equal(t, "p@ss", media.Password)
+}
+
+func TestMultipartRead(t *testing.T) {
+	fileContent := []byte("multipart mock file content")
+	body := new(bytes.Buffer)
+	writer := multipart.NewWriter(body)
+	assert.Nil(t, writer.WriteField("fivecolors_username", "mock"))
+	fileWriter, err := writer.CreateFormFile("avatar", "avatar.png")
+	assert.Nil(t, err)
+	_, err = fileWriter.Write(fileContent)
+	assert.Nil(t, err)
+	assert.Nil(t, writer.Close())
+
+	uri := "http://contentmultipart/upload"
+
+	var ctx fasthttp.RequestCtx
+	var req fasthttp.Request
+	req.SetRequestURI(uri)
+	req.SetBody(body.Bytes())
+	req.Header.SetContentType(writer.FormDataContentType())
+	ctx.Init(&req, nil, nil)
+
+	var readErr error
+	var media mockLoginForm
+	var content []byte
+	assert.NotPanics(t, func() {
+		readErr = ReadMultipart(&ctx, form.DefaultLimits, &media, func(p *form.Part) error {
+			assert.Equal(t, "avatar.png", p.FileName)
+			content, err = ioutil.ReadAll(p)
+			return err
+		})
+	})
+	assert.Nil(t, readErr)
+	assert.Equal(t, "mock", media.Username)
+	assert.Equal(t, fileContent, content)
+
+	readErr = ReadMultipart(&ctx, form.Limits{MaxPartSize: 4}, &media, func(p *form.Part) error {
+		_, err := ioutil.ReadAll(p)
+		return err
+	})
+	assert.Equal(t, form.ErrPartTooLarge, readErr)
+	assert.Equal(t, form.ErrUnhandledFilePart, ReadByContentType(&ctx, &media))
+
+	req.Header.SetContentType(form.ContentType)
+	ctx.Init(&req, nil, nil)
+	assert.Equal(t, fasthttp.ErrNoMultipartForm, ReadMultipart(&ctx, form.DefaultLimits, &media, nil))
+}
+
+func TestJSONReadGzipBody(t *testing.T) {
+	type mockJSON struct {
+		Username string `json:"username"`
+		Age      int    `json:"age"`
+	}
+	var body bytes.Buffer
+	writer := gzip.NewWriter(&body)
+	_, err := writer.Write([]byte(`{"username": "mock-gzip.json", "age": 35}`))
+	assert.Nil(t, err)
+	assert.Nil(t, writer.Close())
+
+	uri := "http://contentjson/gzip"
+
+	var ctx fasthttp.RequestCtx
+	var req fasthttp.Request
+	req.SetRequestURI(uri)
+	req.SetBody(body.Bytes())
+	req.Header.SetContentType("application/json")
+	req.Header.Set(haki.ContentEncodingHeader, "gzip")
+	ctx.Init(&req, nil, nil)
+
+	var media mockJSON
+	assert.Nil(t, ReadByContentType(&ctx, &media))
+	assert.Equal(t, "mock-gzip.json", media.Username)
+	assert.Equal(t, 35, media.Age)
+	assert.Empty(t, ctx.Request.Header.Peek(haki.ContentEncodingHeader))
+
+	req.SetBody([]byte("invalid gzip body"))
+	req.Header.Set(haki.ContentEncodingHeader, "gzip")
+	ctx.Init(&req, nil, nil)
+	assert.NotNil(t, ReadByContentType(&ctx, &media))
+
+	req.Header.Set(haki.ContentEncodingHeader, "compress")
+	ctx.Init(&req, nil, nil)
+	assert.Equal(t, haki.ErrInvalidContentEncoding, ReadByContentType(&ctx, &media))
+
+	maxSize := haki.MaxDecodedBodySize
+	defer func() { haki.MaxDecodedBodySize = maxSize }()
+	haki.MaxDecodedBodySize = 8
+	req.SetBody(body.Bytes())
+	req.Header.Set(haki.ContentEncodingHeader, "gzip")
+	ctx.Init(&req, nil, nil)
+	err = ReadByContentType(&ctx, &media)
+	assert.Equal(t, haki.ErrBodyTooLarge, err)
+	assert.Equal(t, fasthttp.StatusRequestEntityTooLarge, haki.ErrStatus(err))
+}
+
+func BenchmarkJSON(b *testing.B) {
+	type mockJSON struct {
+		Username string `json:"username"`
+		Name     string `json:"name"`
+		Age      int    `json:"age"`
+	}
+	media := &mockJSON{
+		Username: "BenchmarkJSON",
+		Name:     "Benchmark JSON",
+		Age:      15,
+	}
+	var ctx fasthttp.RequestCtx
+	var req fasthttp.Request
+	req.SetRequestURI("http://benchmarkjson/")
+	ctx.Init(&req, nil, nil)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := JSON(&ctx, fasthttp.StatusOK, media); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkProtoBuff(b *testing.B) {
+	media := &proto.Store{
+		Id:   1,
+		Name: "BenchmarkProtoBuff",
+		Data: []*proto.Store_Data{
+			&proto.Store_Data{
+				Id:    1,
+				Name:  "Proto Data Name",
+				Email: "Proto Data Email",
+			},
+		},
+	}
+	var ctx fasthttp.RequestCtx
+	var req fasthttp.Request
+	req.SetRequestURI("http://benchmarkproto/")
+	ctx.Init(&req, nil, nil)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := ProtoBuff(&ctx, fasthttp.StatusOK, media); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestRateLimitWrapper(t *testing.T) {
+	var calls int
+	handler := Error(RateLimit(ratelimit.New(ratelimit.Rate{Limit: 1, Period: time.Minute, Burst: 2}, nil), TokenKey)(
+		func(c context.Context, fc *fasthttp.RequestCtx) error {
+			calls++
+			return Text(fc, fasthttp.StatusOK, "context.fast_test.TestRateLimitWrapper")
+		},
+	))
+	c := context.WithValue(context.Background(), TokenContextKey, "mock_token")
+	for _, remaining := range []string{"1", "0"} {
+		var ctx fasthttp.RequestCtx
+		assert.Nil(t, handler(c, &ctx))
+		assert.Equal(t, fasthttp.StatusOK, ctx.Response.StatusCode())
+		assert.Equal(t, "2", string(ctx.Response.Header.Peek(haki.RateLimitHeader)))
+		assert.Equal(t, remaining, string(ctx.Response.Header.Peek(haki.RateLimitRemainHeader)))
+	}
+	var ctx fasthttp.RequestCtx
+	assert.Equal(t, haki.ErrTooManyRequests, handler(c, &ctx))
+	assert.Equal(t, fasthttp.StatusTooManyRequests, ctx.Response.StatusCode())
+	assert.Equal(t, "60", string(ctx.Response.Header.Peek(haki.RetryAfterHeader)))
+	assert.Equal(t, "0", string(ctx.Response.Header.Peek(haki.RateLimitRemainHeader)))
+	assert.Equal(t, haki.ErrTooManyRequests.Error(), string(ctx.Response.Body()))
+	assert.Equal(t, 2, calls)
+
+	ctx = fasthttp.RequestCtx{}
+	assert.Nil(t, handler(context.Background(), &ctx))
+	assert.Equal(t, 3, calls)
+	assert.Equal(t, "1", string(ctx.Response.Header.Peek(haki.RateLimitRemainHeader)), "Anonymous request limited by ip")
+	assert.Equal(t, "0.0.0.0", ClientIPKey(context.Background(), &ctx))
+}
+
+func TestRateLimitWrapperKey(t *testing.T) {
+	limiter := ratelimit.New(ratelimit.Rate{Limit: 1, Period: time.Minute}, nil)
+	var calls int
+	handler := RateLimit(limiter, TokenKey)(func(c context.Context, fc *fasthttp.RequestCtx) error {
+		calls++
+		return Status(fc, fasthttp.StatusNoContent)
+	})
+	anonymous := func(ip string) *fasthttp.RequestCtx {
+		var ctx fasthttp.RequestCtx
+		ctx.Init(&fasthttp.Request{}, &net.TCPAddr{IP: net.ParseIP(ip), Port: 1234}, nil)
+		return &ctx
+	}
+
+	assert.Nil(t, handler(context.Background(), anonymous("192.0.2.1")))
+	assert.Equal(t, haki.ErrTooManyRequests, handler(context.Background(), anonymous("192.0.2.1")))
+	assert.Equal(t, 1, calls)
+
+	//Anonymous requests from other clients have their own buckets
+	assert.Nil(t, handler(context.Background(), anonymous("192.0.2.2")))
+	assert.Equal(t, 2, calls)
+	assert.Equal(t, "192.0.2.1", TokenKey(context.Background(), anonymous("192.0.2.1")))
+	assert.Equal(t, "192.0.2.1", TokenKey(context.WithValue(context.Background(), TokenContextKey, ""), anonymous("192.0.2.1")))
+	assert.Equal(t, "tuser", TokenKey(context.WithValue(context.Background(), TokenContextKey, "tuser"), anonymous("192.0.2.1")))
+}
+
+func TestConcurrencyLimitWrapper(t *testing.T) {
+	limiter := concurrency.New(concurrency.Options{Limit: 1})
+	var nested fasthttp.RequestCtx
+	var nestedErr error
+	var handler HTTPHandlerFunc
+	handler = Error(ConcurrencyLimit(limiter)(func(c context.Context, fc *fasthttp.RequestCtx) error {
+		if fc != &nested {
+			nestedErr = handler(c, &nested)
+		}
+		return Status(fc, fasthttp.StatusNoContent)
+	}))
+
+	var ctx fasthttp.RequestCtx
+	assert.Nil(t, handler(context.Background(), &ctx))
+	assert.Equal(t, fasthttp.StatusNoContent, ctx.Response.StatusCode())
+	assert.Equal(t, haki.ErrServiceUnavailable, nestedErr)
+	assert.Equal(t, fasthttp.StatusServiceUnavailable, nested.Response.StatusCode())
+	assert.Equal(t, "1", string(nested.Response.Header.Peek(haki.RetryAfterHeader)))
+	assert.Equal(t, concurrency.Stats{Limit: 1, Rejected: 1}, limiter.Stats())
+}
+
+func TestConcurrencyLimitWrapperClientErrors(t *testing.T) {
+	limiter := concurrency.New(concurrency.Options{Mode: concurrency.AIMD, Limit: 4, MaxLimit: 4, Backoff: 0.5})
+	var status int
+	handler := Error(ConcurrencyLimit(limiter)(func(c context.Context, fc *fasthttp.RequestCtx) error {
+		switch status {
+		case fasthttp.StatusInternalServerError:
+			return errors.New("MockErr")
+		case fasthttp.StatusServiceUnavailable:
+			return haki.ErrServiceUnavailable
+		}
+		return haki.NewStatusError(status, "MockStatusErr")
+	}))
+
+	for _, status = range []int{fasthttp.StatusBadRequest, fasthttp.StatusUnauthorized, fasthttp.StatusNotFound, fasthttp.StatusConflict, fasthttp.StatusTooManyRequests, fasthttp.StatusServiceUnavailable} {
+		var ctx fasthttp.RequestCtx
+		assert.NotNil(t, handler(context.Background(), &ctx))
+		assert.Equal(t, status, ctx.Response.StatusCode())
+	}
+	assert.Equal(t, concurrency.Stats{Limit: 4}, limiter.Stats())
+
+	status = fasthttp.StatusInternalServerError
+	var ctx fasthttp.RequestCtx
+	assert.NotNil(t, handler(context.Background(), &ctx))
+	assert.Equal(t, fasthttp.StatusInternalServerError, ctx.Response.StatusCode())
+	assert.Equal(t, concurrency.Stats{Limit: 2}, limiter.Stats())
+}
+
+func TestCORSWrapper(t *testing.T) {
+	policy, err := cors.New(cors.Options{AllowedOrigins: []string{"https://*.example.com"}})
+	assert.Nil(t, err)
+	var calls int
+	handler := CORS(policy)(func(c context.Context, fc *fasthttp.RequestCtx) error {
+		calls++
+		return Status(fc, fasthttp.StatusOK)
+	})
+
+	var ctx fasthttp.RequestCtx
+	ctx.Request.Header.SetMethod("OPTIONS")
+	ctx.Request.Header.Set(cors.OriginHeader, "https://web.example.com")
+	ctx.Request.Header.Set(cors.RequestMethodHeader, "POST")
+	ctx.Request.Header.Set(cors.RequestHeadersHeader, "Content-Type")
+	assert.Nil(t, handler(context.Background(), &ctx))
+	assert.Equal(t, fasthttp.StatusNoContent, ctx.Response.StatusCode())
+	assert.Equal(t, "https://web.example.com", string(ctx.Response.Header.Peek(cors.AllowOriginHeader)))
+	assert.NotEmpty(t, ctx.Response.Header.Peek(cors.AllowHeadersHeader))
+	assert.Equal(t, 0, calls)
+
+	var get fasthttp.RequestCtx
+	get.Request.Header.Set(cors.OriginHeader, "https://web.example.com")
+	assert.Nil(t, handler(context.Background(), &get))
+	assert.Equal(t, fasthttp.StatusOK, get.Response.StatusCode())
+	assert.Equal(t, "https://web.example.com", string(get.Response.Header.Peek(cors.AllowOriginHeader)))
+	assert.Equal(t, "X-Request-Id, X-Request-Context", string(get.Response.Header.Peek(cors.ExposeHeadersHeader)))
+	assert.Equal(t, "Origin", string(get.Response.Header.Peek(haki.VaryHeader)))
+	assert.Equal(t, 1, calls)
+}
+
+func TestSecureHeadersWrapper(t *testing.T) {
+	handler := SecureHeaders(secure.DefaultHeaders)(func(c context.Context, fc *fasthttp.RequestCtx) error {
+		return Status(fc, fasthttp.StatusOK)
+	})
+	var ctx fasthttp.RequestCtx
+	assert.Nil(t, handler(context.Background(), &ctx))
+	assert.Equal(t, fasthttp.StatusOK, ctx.Response.StatusCode())
+	assert.Equal(t, "default-src 'self'; frame-ancestors 'none'", string(ctx.Response.Header.Peek(secure.ContentSecurityPolicyHeader)))
+	assert.Equal(t, "strict-origin-when-cross-origin", string(ctx.Response.Header.Peek(secure.ReferrerPolicyHeader)))
+}
+
+func TestCSRFWrapper(t *testing.T) {
+	csrf := secure.NewCSRF(secure.CSRFOptions{})
+	var calls int
+	var token string
+	handler := CSRF(csrf)(func(c context.Context, fc *fasthttp.RequestCtx) error {
+		calls++
+		token = GetCSRFToken(c)
+		return Status(fc, fasthttp.StatusOK)
+	})
+
+	var get fasthttp.RequestCtx
+	assert.Nil(t, handler(context.Background(), &get))
+	cookie := fasthttp.AcquireCookie()
+	defer fasthttp.ReleaseCookie(cookie)
+	cookie.SetKey(secure.CSRFCookie)
+	assert.True(t, get.Response.Header.Cookie(cookie))
+	assert.Equal(t, token, string(cookie.Value()))
+	assert.True(t, cookie.Secure())
+	assert.Equal(t, fasthttp.CookieSameSiteLaxMode, cookie.SameSite())
+	assert.Equal(t, 1, calls)
+
+	var post fasthttp.RequestCtx
+	post.Request.Header.SetMethod("POST")
+	post.Request.Header.SetCookie(secure.CSRFCookie, token)
+	assert.Equal(t, secure.ErrCSRFTokenMissing, handler(context.Background(), &post))
+
+	var form fasthttp.RequestCtx
+	form.Request.Header.SetMethod("POST")
+	form.Request.Header.SetCookie(secure.CSRFCookie, token)
+	form.Request.Header.SetContentType("application/x-www-form-urlencoded")
+	form.Request.SetBodyString("csrf_token=" + token)
+	assert.Nil(t, handler(context.Background(), &form))
+	assert.False(t, form.Response.Header.Cookie(cookie), "Valid cookie token reused")
+	assert.Equal(t, 2, calls)
+
+	var put fasthttp.RequestCtx
+	put.Request.Header.SetMethod("PUT")
+	put.Request.Header.SetCookie(secure.CSRFCookie, token)
+	put.Request.Header.Set(secure.CSRFHeader, "other")
+	assert.Equal(t, secure.ErrCSRFTokenInvalid, handler(context.Background(), &put))
+	assert.Equal(t, 2, calls)
+
+	signed := CSRF(secure.NewCSRF(secure.CSRFOptions{Secret: []byte("secret")}))(func(c context.Context, fc *fasthttp.RequestCtx) error {
+		token = GetCSRFToken(c)
+		return Status(fc, fasthttp.StatusOK)
+	})
+	attacker := context.WithValue(context.Background(), TokenContextKey, "attacker_token")
+	get = fasthttp.RequestCtx{}
+	assert.Nil(t, signed(attacker, &get))
+	planted := token
+	var bound fasthttp.RequestCtx
+	bound.Request.Header.SetMethod("DELETE")
+	bound.Request.Header.SetCookie(secure.CSRFCookie, planted)
+	bound.Request.Header.Set(secure.CSRFHeader, planted)
+	assert.Nil(t, signed(attacker, &bound))
+	var victim fasthttp.RequestCtx
+	victim.Request.Header.SetMethod("DELETE")
+	victim.Request.Header.SetCookie(secure.CSRFCookie, planted)
+	victim.Request.Header.Set(secure.CSRFHeader, planted)
+	assert.Equal(t, secure.ErrCSRFTokenInvalid, signed(context.WithValue(context.Background(), TokenContextKey, "victim_token"), &victim), "Token planted from other identity")
+}
+
+func TestSessionWrapper(t *testing.T) {
+	codec, err := session.NewEncryptedCodec(bytes.Repeat([]byte("k"), 32))
+	assert.Nil(t, err)
+	manager, err := session.New(session.Options{Codec: codec, Store: session.NewMemoryStore()})
+	assert.Nil(t, err)
+	var token interface{}
+	handler := Session(manager)(func(c context.Context, fc *fasthttp.RequestCtx) error {
+		token = c.Value(TokenContextKey)
+		if string(fc.Path()) == "/login" {
+			if err := GetSession(c).SetIdentity("user_token", "user"); err != nil {
+				return err
+			}
+		}
+		return Status(fc, fasthttp.StatusOK)
+	})
+
+	var login fasthttp.RequestCtx
+	login.Request.SetRequestURI("/login")
+	assert.Nil(t, handler(context.Background(), &login))
+	assert.Nil(t, token)
+	cookie := fasthttp.AcquireCookie()
+	defer fasthttp.ReleaseCookie(cookie)
+	cookie.SetKey(session.DefaultCookieName)
+	assert.True(t, login.Response.Header.Cookie(cookie))
+	assert.True(t, cookie.HTTPOnly())
+
+	var home fasthttp.RequestCtx
+	home.Request.SetRequestURI("/home")
+	home.Request.Header.SetCookie(session.DefaultCookieName, string(cookie.Value()))
+	assert.Nil(t, handler(context.Background(), &home))
+	assert.Equal(t, "user_token", token)
+	assert.False(t, home.Response.Header.Cookie(cookie))
+}
+
+type mockUserStore map[string]*auth.User
+
+func (s mockUserStore) FindUser(username string) (*auth.User, error) {
+	return s[username], nil
+}
+
+func TestLoginHandler(t *testing.T) {
+	hash, err := auth.HashPassword("secret", 4)
+	assert.Nil(t, err)
+	authenticator := auth.NewAuthenticator(mockUserStore{"user": {Username: "user", PasswordHash: hash, Token: "user_token"}}, 4)
+	codec, err := session.NewSignedCodec(bytes.Repeat([]byte("k"), 32))
+	assert.Nil(t, err)
+	manager, err := session.New(session.Options{Codec: codec})
+	assert.Nil(t, err)
+	handler := Session(manager)(Login(authenticator, auth.LoginOptions{RedirectURL: "/web"}))
+
+	var ctx fasthttp.RequestCtx
+	ctx.Request.SetRequestURI("http://loginhandle/auth/login")
+	ctx.Request.Header.SetMethod("POST")
+	ctx.Request.Header.SetContentType("application/x-www-form-urlencoded")
+	ctx.Request.SetBodyString("username=user&password=secret")
+	assert.Nil(t, handler(context.Background(), &ctx))
+	assert.Equal(t, fasthttp.StatusSeeOther, ctx.Response.StatusCode())
+	assert.Equal(t, "http://loginhandle/web", string(ctx.Response.Header.Peek("Location")))
+	cookie := fasthttp.AcquireCookie()
+	defer fasthttp.ReleaseCookie(cookie)
+	cookie.SetKey(session.DefaultCookieName)
+	assert.True(t, ctx.Response.Header.Cookie(cookie))
+	s, err := manager.Load(string(cookie.Value()))
+	assert.Nil(t, err)
+	assert.Equal(t, "user_token", s.Token)
+
+	var failed fasthttp.RequestCtx
+	failed.Request.Header.SetMethod("POST")
+	failed.Request.Header.SetContentType("application/x-www-form-urlencoded")
+	failed.Request.SetBodyString("username=user&password=wrong")
+	assert.Equal(t, auth.ErrInvalidCredentials, handler(context.Background(), &failed))
+
+	var get fasthttp.RequestCtx
+	assert.Equal(t, haki.ErrMethodNotAllowed, handler(context.Background(), &get))
+}
+
+func TestProxyHandler(t *testing.T) {
+	upstream, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer upstream.Close()
+	go fasthttp.Serve(upstream, func(fc *fasthttp.RequestCtx) {
+		fc.Response.Header.SetBytesV("X-Path", fc.Path())
+		fc.Response.Header.SetBytesV("X-Query", fc.URI().QueryString())
+		fc.Response.Header.Set("X-Hop", "upstream")
+		fc.Response.Header.Set("Connection", "X-Hop")
+		for _, header := range []string{haki.RequestIDHeader, haki.RequestContextHeader, haki.IdentityHeader, "X-Forwarded-For", "X-Client-Hop"} {
+			fc.Response.Header.SetBytesV("X-Upstream-"+header, fc.Request.Header.Peek(header))
+		}
+		if string(fc.Path()) == "/slow" {
+			time.Sleep(100 * time.Millisecond)
+		}
+		fc.SetStatusCode(fasthttp.StatusCreated)
+		fc.SetBody(fc.PostBody())
+	})
+	router, err := proxy.NewRouter(proxy.Route{Prefix: "/api/", Upstream: "http://" + upstream.Addr().String(), StripPrefix: true})
+	assert.Nil(t, err)
+	handler := Proxy(router)
+
+	var ctx fasthttp.RequestCtx
+	ctx.Request.SetRequestURI("http://proxyhandle/api/users?id=1")
+	ctx.Request.Header.SetMethod("POST")
+	ctx.Request.Header.Set(haki.RequestContextHeader, "mock_cid")
+	ctx.Request.Header.Set(haki.IdentityHeader, "forged_token")
+	ctx.Request.Header.Set("Connection", "X-Client-Hop")
+	ctx.Request.Header.Set("X-Client-Hop", "client")
+	ctx.Request.SetBodyString("body")
+	assert.Nil(t, handler(context.WithValue(context.Background(), TokenContextKey, "user_token"), &ctx))
+	assert.Equal(t, fasthttp.StatusCreated, ctx.Response.StatusCode())
+	assert.Equal(t, "body", string(ctx.Response.Body()))
+	assert.Equal(t, "/users", string(ctx.Response.Header.Peek("X-Path")))
+	assert.Equal(t, "id=1", string(ctx.Response.Header.Peek("X-Query")))
+	assert.Len(t, ctx.Response.Header.Peek("X-Upstream-"+haki.RequestIDHeader), 36)
+	assert.Equal(t, "mock_cid", string(ctx.Response.Header.Peek("X-Upstream-"+haki.RequestContextHeader)))
+	assert.Equal(t, "user_token", string(ctx.Response.Header.Peek("X-Upstream-"+haki.IdentityHeader)))
+	assert.Equal(t, "0.0.0.0", string(ctx.Response.Header.Peek("X-Upstream-X-Forwarded-For")))
+	assert.Equal(t, "", string(ctx.Response.Header.Peek("X-Upstream-X-Client-Hop")))
+	assert.Equal(t, "", string(ctx.Response.Header.Peek("X-Hop")), "Response hop header")
+
+	var traced fasthttp.RequestCtx
+	traced.Request.SetRequestURI("http://proxyhandle/api/users")
+	traced.Request.Header.Set(haki.RequestIDHeader, "mock_tid")
+	assert.Nil(t, handler(context.Background(), &traced))
+	assert.Equal(t, "mock_tid", string(traced.Response.Header.Peek("X-Upstream-"+haki.RequestIDHeader)))
+	assert.Equal(t, "mock_tid", string(traced.Response.Header.Peek("X-Upstream-"+haki.RequestContextHeader)))
+	assert.Equal(t, "", string(traced.Response.Header.Peek("X-Upstream-"+haki.IdentityHeader)))
+
+	var notFound fasthttp.RequestCtx
+	notFound.Request.SetRequestURI("/web")
+	assert.Equal(t, proxy.ErrNoRoute, handler(context.Background(), &notFound))
+
+	var slow fasthttp.RequestCtx
+	slow.Request.SetRequestURI("/api/slow")
+	assert.Equal(t, haki.ErrGatewayTimeout, ProxyTimeout(router, 10*time.Millisecond)(context.Background(), &slow))
+
+	closed, err := proxy.NewRouter(proxy.Route{Prefix: "/", Upstream: "http://127.0.0.1:1"})
+	assert.Nil(t, err)
+	var bad fasthttp.RequestCtx
+	bad.Request.SetRequestURI("/")
+	assert.Equal(t, haki.ErrBadGateway, Proxy(closed)(context.Background(), &bad))
+}
+
+func TestProxyHandlerUpgrade(t *testing.T) {
+	upstream, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer upstream.Close()
+	requests := make(chan *http.Request, 1)
+	closed := make(chan struct{})
+	go func() {
+		conn, err := upstream.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		reader := bufio.NewReader(conn)
+		req, err := http.ReadRequest(reader)
+		if err != nil {
+			return
+		}
+		requests <- req
+		conn.Write([]byte("HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: websocket\r\n\r\n"))
+		io.Copy(conn, reader)
+		close(closed)
+	}()
+	router, err := proxy.NewRouter(proxy.Route{Prefix: "/ws", Upstream: "http://" + upstream.Addr().String()})
+	assert.Nil(t, err)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer listener.Close()
+	handler := Proxy(router)
+	go fasthttp.Serve(listener, func(fc *fasthttp.RequestCtx) {
+		handler(context.Background(), fc)
+	})
+
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	assert.Nil(t, err)
+	defer conn.Close()
+	conn.Write([]byte("GET /ws/echo HTTP/1.1\r\nHost: proxyhandle\r\nConnection: Upgrade\r\nUpgrade: websocket\r\n\r\n"))
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusSwitchingProtocols, resp.StatusCode)
+	req := <-requests
+	assert.Equal(t, "/ws/echo", req.URL.Path)
+	assert.Equal(t, "websocket", req.Header.Get("Upgrade"))
+	assert.Equal(t, "proxyhandle", req.Header.Get("X-Forwarded-Host"))
+
+	conn.Write([]byte("ping"))
+	message := make([]byte, 4)
+	_, err = io.ReadFull(reader, message)
+	assert.Nil(t, err)
+	assert.Equal(t, "ping", string(message))
+
+	conn.Close()
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		assert.Fail(t, "Upstream connection left open after the client closed")
+	}
+}
+
+func TestRequireWrapper(t *testing.T) {
+	var calls int
+	handler := Require(authz.Roles("admin"))(func(c context.Context, fc *fasthttp.RequestCtx) error {
+		calls++
+		return Status(fc, fasthttp.StatusOK)
+	})
+
+	var ctx fasthttp.RequestCtx
+	assert.Equal(t, authz.ErrUnauthenticated, handler(context.Background(), &ctx))
+	c := context.WithValue(context.Background(), TokenContextKey, "user")
+	assert.Equal(t, authz.ErrForbidden, handler(context.WithValue(c, IdentityContextKey, map[string]interface{}{"roles": "editor"}), &ctx))
+	assert.Nil(t, handler(context.WithValue(c, IdentityContextKey, map[string]interface{}{"roles": "editor admin"}), &ctx))
+	assert.Equal(t, 1, calls)
+
+	Error(handler)(context.Background(), &ctx)
+	assert.Equal(t, fasthttp.StatusUnauthorized, ctx.Response.StatusCode())
+}
+
+func TestAPIKeyWrapper(t *testing.T) {
+	key, stored, err := apikey.Generate("billing", "invoices:read")
+	assert.Nil(t, err)
+	path := filepath.Join(t.TempDir(), "keys.json")
+	assert.Nil(t, apikey.Save(path, stored))
+	store, err := apikey.NewFileStore(path)
+	assert.Nil(t, err)
+	resolver := apikey.NewResolver(store)
+	resolver.Header = "Authorization-Key"
+	var token interface{}
+	handler := APIKey(resolver)(Require(authz.Scopes("invoices:read"))(func(c context.Context, fc *fasthttp.RequestCtx) error {
+		token = c.Value(TokenContextKey)
+		return Status(fc, fasthttp.StatusOK)
+	}))
+
+	var ctx fasthttp.RequestCtx
+	ctx.Request.Header.Set("Authorization-Key", key)
+	assert.Nil(t, handler(context.Background(), &ctx))
+	assert.Equal(t, stored.Token(), token)
+
+	var query fasthttp.RequestCtx
+	query.Request.SetRequestURI("/invoices?api_key=" + key)
+	assert.Nil(t, handler(context.Background(), &query))
+
+	var invalid fasthttp.RequestCtx
+	invalid.Request.Header.Set("Authorization-Key", "invalid")
+	assert.Equal(t, apikey.ErrInvalidKey, handler(context.Background(), &invalid))
+}
+
+//newCertificate creates a self signed certificate with the uri SANs
+func newCertificate(t *testing.T, commonName string, uris ...string) *x509.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	for _, uri := range uris {
+		u, err := url.Parse(uri)
+		assert.Nil(t, err)
+		template.URIs = append(template.URIs, u)
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.Nil(t, err)
+	cert, err := x509.ParseCertificate(der)
+	assert.Nil(t, err)
+	return cert
+}
+
+//tlsConn is a connection with the tls state checked by the RequestCtx
+type tlsConn struct {
+	net.Conn
+	state tls.ConnectionState
+}
+
+func (c *tlsConn) Handshake() error {
+	return nil
+}
+
+func (c *tlsConn) ConnectionState() tls.ConnectionState {
+	return c.state
+}
+
+func TestClientCertificateWrapper(t *testing.T) {
+	cert := newCertificate(t, "billing")
+	var token interface{}
+	handler := ClientCertificate(true)(func(c context.Context, fc *fasthttp.RequestCtx) error {
+		token = c.Value(TokenContextKey)
+		return Status(fc, fasthttp.StatusOK)
+	})
+
+	var ctx fasthttp.RequestCtx
+	ctx.Init2(&tlsConn{state: tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}}, nil, false)
+	assert.Nil(t, handler(context.Background(), &ctx))
+	assert.Equal(t, "x509:CN=billing", token)
+
+	var plain fasthttp.RequestCtx
+	assert.Equal(t, mtls.ErrNoCertificate, handler(context.Background(), &plain))
+	assert.Nil(t, ClientCertificate(false)(func(c context.Context, fc *fasthttp.RequestCtx) error {
+		return nil
+	})(context.Background(), &plain))
+}
+
+func TestHealthHandlers(t *testing.T) {
+	registry := health.New()
+	registry.Register(health.Check{Name: "cache", Liveness: true, Check: func(ctx context.Context) error {
+		return errors.New("cache unavailable")
+	}})
+
+	var ctx fasthttp.RequestCtx
+	assert.Nil(t, Livez(registry)(context.Background(), &ctx))
+	assert.Equal(t, fasthttp.StatusOK, ctx.Response.StatusCode())
+	assert.Equal(t, "no-store", string(ctx.Response.Header.Peek("Cache-Control")))
+	assert.Contains(t, string(ctx.Response.Body()), `"status":"degraded"`)
+	assert.Contains(t, string(ctx.Response.Body()), `"error":"cache unavailable"`)
+
+	ctx.Response.Reset()
+	assert.Nil(t, Readyz(registry)(context.Background(), &ctx))
+	assert.Equal(t, fasthttp.StatusServiceUnavailable, ctx.Response.StatusCode())
+
+	registry.SetReady(true)
+	ctx.Response.Reset()
+	assert.Nil(t, Healthz(registry)(context.Background(), &ctx))
+	assert.Equal(t, fasthttp.StatusOK, ctx.Response.StatusCode())
+}
@@ -0,0 +1,42 @@
+package fast
+
+import (
+	"context"
+	"github.com/rjansen/haki/health"
+	"github.com/rjansen/l"
+	"github.com/valyala/fasthttp"
+)
+
+func healthHandle(registry *health.Registry, kind health.Kind, c context.Context, fc *fasthttp.RequestCtx) error {
+	report := registry.Run(c, kind)
+	if report.Status != health.StatusUp {
+		contextLogger(c, fc).Warn("haki.fast.Health",
+			l.String("status", string(report.Status)),
+			l.Struct("checks", report.Checks),
+		)
+	}
+	fc.Response.Header.Set("Cache-Control", "no-store")
+	return JSON(fc, report.Code(), report)
+}
+
+//Health creates a handler that runs the registry checks of the kind and writes the JSON report, 503 when it is down
+func Health(registry *health.Registry, kind health.Kind) HTTPHandlerFunc {
+	return func(c context.Context, fc *fasthttp.RequestCtx) error {
+		return healthHandle(registry, kind, c, fc)
+	}
+}
+
+//Healthz creates the /healthz handler with all the registry checks
+func Healthz(registry *health.Registry) HTTPHandlerFunc {
+	return Health(registry, health.Health)
+}
+
+//Readyz creates the /readyz handler, down before the registry Setup and during the graceful shutdown
+func Readyz(registry *health.Registry) HTTPHandlerFunc {
+	return Health(registry, health.Readiness)
+}
+
+//Livez creates the /livez handler with the registry Liveness checks
+func Livez(registry *health.Registry) HTTPHandlerFunc {
+	return Health(registry, health.Liveness)
+}
@@ -0,0 +1,62 @@
+package fast
+
+import (
+	"context"
+	"github.com/rjansen/haki"
+	"github.com/rjansen/haki/auth"
+	"github.com/rjansen/haki/session"
+	"github.com/rjansen/l"
+	"github.com/valyala/fasthttp"
+	"net/http"
+)
+
+//contextLogger returns the logger stored by the Log wrapper or a logger with the request path when it is not in use
+func contextLogger(c context.Context, fc *fasthttp.RequestCtx) l.Logger {
+	if logger, ok := c.Value("log").(l.Logger); ok {
+		return logger
+	}
+	return l.WithFields(l.Bytes("path", fc.Path()))
+}
+
+func loginHandle(authenticator *auth.Authenticator, options *auth.LoginOptions, c context.Context, fc *fasthttp.RequestCtx) error {
+	if !fc.IsPost() {
+		fc.Response.Header.Set("Allow", http.MethodPost)
+		return haki.ErrMethodNotAllowed
+	}
+	s := GetSession(c)
+	if s == nil {
+		return session.ErrNoSession
+	}
+	logger := contextLogger(c, fc)
+	username := string(fc.PostArgs().Peek(options.UsernameField))
+	user, err := authenticator.Authenticate(username, string(fc.PostArgs().Peek(options.PasswordField)))
+	if err != nil {
+		logger.Warn("haki.fast.LoginErr",
+			l.String("username", username),
+			l.Err(err),
+		)
+		if options.FailureURL != "" && haki.ErrStatus(err) != http.StatusInternalServerError {
+			fc.Redirect(options.FailureURL, fasthttp.StatusSeeOther)
+			return nil
+		}
+		return err
+	}
+	if err := s.SetIdentity(user.Token, user.Value); err != nil {
+		return err
+	}
+	logger.Info("haki.fast.Login",
+		l.String("username", username),
+		l.String("token", user.Token),
+	)
+	fc.Redirect(options.RedirectURL, fasthttp.StatusSeeOther)
+	return nil
+}
+
+//Login creates a form login handler, to be mounted at the FormURI inside the Session wrapper.
+//It authenticates the form credentials, stores the user identity in the session and redirects to the RedirectURL
+func Login(authenticator *auth.Authenticator, options auth.LoginOptions) HTTPHandlerFunc {
+	options = options.WithDefaults()
+	return func(c context.Context, fc *fasthttp.RequestCtx) error {
+		return loginHandle(authenticator, &options, c, fc)
+	}
+}
@@ -0,0 +1,40 @@
+package fast
+
+import (
+	"context"
+	"github.com/rjansen/haki/mtls"
+	"github.com/rjansen/l"
+	"github.com/valyala/fasthttp"
+)
+
+func clientCertificateHandle(required bool, handler HTTPHandlerFunc, c context.Context, fc *fasthttp.RequestCtx) error {
+	logger := contextLogger(c, fc)
+	peer, err := mtls.PeerOf(fc.TLSConnectionState())
+	if err != nil {
+		if !required {
+			return handler(c, fc)
+		}
+		logger.Warn("haki.fast.ClientCertificateErr",
+			l.Err(err),
+		)
+		return err
+	}
+	c = context.WithValue(c, TokenContextKey, peer.Token())
+	c = context.WithValue(c, IdentityContextKey, peer.Identity())
+	logger.Info("haki.fast.ClientCertificate",
+		l.String("subject", peer.Subject),
+		l.String("spiffeId", peer.SPIFFEID),
+		l.String("fingerprint", peer.Fingerprint),
+	)
+	return handler(c, fc)
+}
+
+//ClientCertificate creates a wrapper that resolves the verified client certificate of the connection into the context identity,
+//see TokenContextKey and IdentityContextKey. When required, the requests without a verified certificate return a 401 mtls.ErrNoCertificate
+func ClientCertificate(required bool) HTTPHandlerWrapper {
+	return func(handler HTTPHandlerFunc) HTTPHandlerFunc {
+		return func(c context.Context, fc *fasthttp.RequestCtx) error {
+			return clientCertificateHandle(required, handler, c, fc)
+		}
+	}
+}
@@ -0,0 +1,225 @@
+package fast
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"github.com/rjansen/haki"
+	"github.com/rjansen/haki/proxy"
+	"github.com/rjansen/l"
+	"github.com/satori/go.uuid"
+	"github.com/valyala/fasthttp"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+var (
+	//ProxyDialTimeout is the max duration to connect the upstream of the upgraded connections
+	ProxyDialTimeout = 5 * time.Second
+)
+
+type hopHeader interface {
+	Peek(key string) []byte
+	Del(key string)
+}
+
+func removeHopHeaders(header hopHeader) {
+	for _, name := range proxy.ConnectionHeaders(string(header.Peek("Connection"))) {
+		header.Del(name)
+	}
+	for _, name := range proxy.HopHeaders {
+		header.Del(name)
+	}
+}
+
+//proxyErr maps the upstream failures to the gateway status errors
+func proxyErr(err error) error {
+	var netErr net.Error
+	if err == fasthttp.ErrTimeout || (errors.As(err, &netErr) && netErr.Timeout()) {
+		return haki.ErrGatewayTimeout
+	}
+	return haki.ErrBadGateway
+}
+
+//forwardRequest sets the upstream url and the haki headers of the proxied request
+func forwardRequest(target proxy.Target, c context.Context, fc *fasthttp.RequestCtx, req *fasthttp.Request) {
+	uri := *target.URL
+	if query := fc.URI().QueryString(); len(query) > 0 {
+		if uri.RawQuery != "" {
+			uri.RawQuery += "&"
+		}
+		uri.RawQuery += string(query)
+	}
+	req.SetRequestURI(uri.String())
+	req.Header.SetHost(target.URL.Host)
+	if forwardedFor := req.Header.Peek("X-Forwarded-For"); len(forwardedFor) > 0 {
+		req.Header.Set("X-Forwarded-For", string(forwardedFor)+", "+fc.RemoteIP().String())
+	} else {
+		req.Header.Set("X-Forwarded-For", fc.RemoteIP().String())
+	}
+	req.Header.SetBytesV("X-Forwarded-Host", fc.Host())
+	if fc.IsTLS() {
+		req.Header.Set("X-Forwarded-Proto", "https")
+	} else {
+		req.Header.Set("X-Forwarded-Proto", "http")
+	}
+	//The identity is set only by the proxy, never by the client
+	req.Header.Del(haki.IdentityHeader)
+	if token, ok := c.Value(TokenContextKey).(string); ok && token != "" {
+		req.Header.Set(haki.IdentityHeader, token)
+	}
+	//Like the net/http Audit wrapper, the request context falls back to the request id that is generated when missing
+	tid := string(req.Header.Peek(haki.RequestIDHeader))
+	if tid == "" {
+		tid = uuid.NewV4().String()
+		req.Header.Set(haki.RequestIDHeader, tid)
+	}
+	if len(req.Header.Peek(haki.RequestContextHeader)) == 0 {
+		req.Header.Set(haki.RequestContextHeader, tid)
+	}
+}
+
+type hostClients struct {
+	sync.Mutex
+	clients map[string]*fasthttp.HostClient
+}
+
+func (h *hostClients) get(target proxy.Target) *fasthttp.HostClient {
+	key := target.URL.Scheme + "://" + target.Host
+	h.Lock()
+	defer h.Unlock()
+	client, found := h.clients[key]
+	if !found {
+		client = &fasthttp.HostClient{
+			Addr:                          target.Host,
+			IsTLS:                         target.URL.Scheme == "https",
+			DisableHeaderNamesNormalizing: true,
+			DisablePathNormalizing:        true,
+		}
+		h.clients[key] = client
+	}
+	return client
+}
+
+func proxyHandle(router *proxy.Router, clients *hostClients, timeout time.Duration, c context.Context, fc *fasthttp.RequestCtx) error {
+	start := time.Now()
+	target, found := router.Match(string(fc.Path()))
+	if !found {
+		return proxy.ErrNoRoute
+	}
+	logger := contextLogger(c, fc)
+	upgrade := string(fc.Request.Header.Peek("Upgrade"))
+	if proxy.IsUpgrade(string(fc.Request.Header.Peek("Connection")), upgrade) {
+		return proxyUpgrade(target, upgrade, logger, c, fc)
+	}
+	req := fasthttp.AcquireRequest()
+	defer fasthttp.ReleaseRequest(req)
+	resp := fasthttp.AcquireResponse()
+	defer fasthttp.ReleaseResponse(resp)
+	fc.Request.CopyTo(req)
+	removeHopHeaders(&req.Header)
+	forwardRequest(target, c, fc, req)
+
+	upstreamStart := time.Now()
+	var err error
+	if timeout > 0 {
+		err = clients.get(target).DoTimeout(req, resp, timeout)
+	} else {
+		err = clients.get(target).Do(req, resp)
+	}
+	fields := []l.Field{
+		l.String("upstream", target.Host),
+		l.String("upstreamPath", target.URL.Path),
+		l.Duration("upstreamTime", time.Since(upstreamStart)),
+	}
+	if err != nil {
+		logger.Error("haki.fast.ProxyErr", append(fields, l.Duration("proxyTime", time.Since(start)), l.Err(err))...)
+		return proxyErr(err)
+	}
+	removeHopHeaders(&resp.Header)
+	fc.Response.SetStatusCode(resp.StatusCode())
+	resp.Header.VisitAll(func(key []byte, value []byte) {
+		if string(key) != haki.ContentLengthHeader {
+			fc.Response.Header.AddBytesKV(key, value)
+		}
+	})
+	fc.Response.SetBody(resp.Body())
+	logger.Info("haki.fast.Proxy", append(fields, l.Duration("proxyTime", time.Since(start)))...)
+	return nil
+}
+
+//proxyUpgrade sends the upgrade request to the upstream and copies the upgraded connections, like WebSocket, both ways
+func proxyUpgrade(target proxy.Target, upgrade string, logger l.Logger, c context.Context, fc *fasthttp.RequestCtx) error {
+	upstreamStart := time.Now()
+	var backend net.Conn
+	var err error
+	if target.URL.Scheme == "https" {
+		dialer := &net.Dialer{Timeout: ProxyDialTimeout}
+		backend, err = tls.DialWithDialer(dialer, "tcp", target.Host, &tls.Config{ServerName: target.URL.Hostname()})
+	} else {
+		backend, err = fasthttp.DialTimeout(target.Host, ProxyDialTimeout)
+	}
+	if err == nil {
+		req := fasthttp.AcquireRequest()
+		defer fasthttp.ReleaseRequest(req)
+		fc.Request.CopyTo(req)
+		removeHopHeaders(&req.Header)
+		forwardRequest(target, c, fc, req)
+		req.Header.Set("Connection", "Upgrade")
+		req.Header.Set("Upgrade", upgrade)
+		writer := bufio.NewWriter(backend)
+		if err = req.Write(writer); err == nil {
+			err = writer.Flush()
+		}
+		if err != nil {
+			backend.Close()
+		}
+	}
+	fields := []l.Field{
+		l.String("upstream", target.Host),
+		l.String("upstreamPath", target.URL.Path),
+		l.String("upgrade", upgrade),
+		l.Duration("upstreamTime", time.Since(upstreamStart)),
+	}
+	if err != nil {
+		logger.Error("haki.fast.ProxyErr", append(fields, l.Err(err))...)
+		return proxyErr(err)
+	}
+	logger.Info("haki.fast.ProxyUpgrade", fields...)
+	//The upstream response, like 101 Switching Protocols, is copied as is to the client
+	fc.HijackSetNoResponse(true)
+	fc.Hijack(func(client net.Conn) {
+		done := make(chan struct{}, 2)
+		copyConn := func(dst net.Conn, src net.Conn) {
+			io.Copy(dst, src)
+			done <- struct{}{}
+		}
+		go copyConn(backend, client)
+		go copyConn(client, backend)
+		//The first side that ends closes both connections, which ends the other copy
+		<-done
+		backend.Close()
+		client.Close()
+		<-done
+		logger.Info("haki.fast.ProxyUpgradeClosed", append(fields, l.Duration("connectionTime", time.Since(upstreamStart)))...)
+	})
+	return nil
+}
+
+//Proxy creates a reverse proxy handler that sends the requests to the upstream of the Router route of their paths.
+//The identity token stored under TokenContextKey is forwarded in the X-Identity-Token header,
+//the X-Request-Id and X-Request-Context headers are forwarded or generated when missing
+func Proxy(router *proxy.Router) HTTPHandlerFunc {
+	return ProxyTimeout(router, 0)
+}
+
+//ProxyTimeout creates a reverse proxy handler like Proxy that limits the upstream requests duration, zero means no timeout
+func ProxyTimeout(router *proxy.Router, timeout time.Duration) HTTPHandlerFunc {
+	clients := &hostClients{clients: make(map[string]*fasthttp.HostClient)}
+	return func(c context.Context, fc *fasthttp.RequestCtx) error {
+		return proxyHandle(router, clients, timeout, c, fc)
+	}
+}
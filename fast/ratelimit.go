@@ -0,0 +1,64 @@
+package fast
+
+import (
+	"context"
+	"github.com/rjansen/haki"
+	"github.com/rjansen/haki/ratelimit"
+	"github.com/rjansen/l"
+	"github.com/valyala/fasthttp"
+	"strconv"
+)
+
+//TokenContextKey is the context key of the identity token used by TokenKey
+const TokenContextKey = "token"
+
+//RateLimitKeyFunc returns the rate limit key of the request, requests with an empty key are not limited
+type RateLimitKeyFunc func(context.Context, *fasthttp.RequestCtx) string
+
+//ClientIPKey is a RateLimitKeyFunc that limits by the remote address ip
+func ClientIPKey(c context.Context, fc *fasthttp.RequestCtx) string {
+	return fc.RemoteIP().String()
+}
+
+//TokenKey is a RateLimitKeyFunc that limits by the identity token stored in the context under TokenContextKey.
+//Anonymous requests are limited by the ClientIPKey, so a noisy client does not throttle every anonymous user
+func TokenKey(c context.Context, fc *fasthttp.RequestCtx) string {
+	if token, ok := c.Value(TokenContextKey).(string); ok && token != "" {
+		return token
+	}
+	return ClientIPKey(c, fc)
+}
+
+func rateLimitHandle(limiter *ratelimit.Limiter, key RateLimitKeyFunc, handler HTTPHandlerFunc, c context.Context, fc *fasthttp.RequestCtx) error {
+	limitKey := key(c, fc)
+	if limitKey == "" {
+		return handler(c, fc)
+	}
+	result, err := limiter.Allow(limitKey)
+	if err != nil {
+		//Fails open, an unavailable store must not take the service down
+		l.Error("haki.fast.RateLimitErr",
+			l.String("key", limitKey),
+			l.Err(err),
+		)
+		return handler(c, fc)
+	}
+	fc.Response.Header.Set(haki.RateLimitHeader, strconv.Itoa(result.Limit))
+	fc.Response.Header.Set(haki.RateLimitRemainHeader, strconv.Itoa(result.Remaining))
+	fc.Response.Header.Set(haki.RateLimitResetHeader, strconv.FormatInt(haki.Seconds(result.ResetAfter), 10))
+	if !result.Allowed {
+		fc.Response.Header.Set(haki.RetryAfterHeader, strconv.FormatInt(haki.Seconds(result.RetryAfter), 10))
+		return haki.ErrTooManyRequests
+	}
+	return handler(c, fc)
+}
+
+//RateLimit creates a wrapper that limits the requests by the key returned by the RateLimitKeyFunc.
+//Limited requests return haki.ErrTooManyRequests that the Error wrapper renders as a 429 response
+func RateLimit(limiter *ratelimit.Limiter, key RateLimitKeyFunc) HTTPHandlerWrapper {
+	return func(handler HTTPHandlerFunc) HTTPHandlerFunc {
+		return func(c context.Context, fc *fasthttp.RequestCtx) error {
+			return rateLimitHandle(limiter, key, handler, c, fc)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package fast
+
+import (
+	"context"
+	"github.com/rjansen/haki/secure"
+	"github.com/valyala/fasthttp"
+	"net/http"
+)
+
+//CSRFContextKey is the context key of the token stored by the CSRF wrapper
+const CSRFContextKey = "csrf"
+
+//SecureHeaders creates a wrapper that writes the provided security headers, see secure.DefaultHeaders
+func SecureHeaders(headers secure.Headers) HTTPHandlerWrapper {
+	return func(handler HTTPHandlerFunc) HTTPHandlerFunc {
+		return func(c context.Context, fc *fasthttp.RequestCtx) error {
+			headers.Write(&fc.Response.Header)
+			return handler(c, fc)
+		}
+	}
+}
+
+//GetCSRFToken returns the token stored by the CSRF wrapper, to be rendered in the forms
+func GetCSRFToken(c context.Context) string {
+	token, _ := c.Value(CSRFContextKey).(string)
+	return token
+}
+
+func setCookie(fc *fasthttp.RequestCtx, cookie *http.Cookie) {
+	fastCookie := fasthttp.AcquireCookie()
+	defer fasthttp.ReleaseCookie(fastCookie)
+	fastCookie.SetKey(cookie.Name)
+	fastCookie.SetValue(cookie.Value)
+	fastCookie.SetDomain(cookie.Domain)
+	fastCookie.SetPath(cookie.Path)
+	if cookie.MaxAge < 0 {
+		fastCookie.SetExpire(fasthttp.CookieExpireDelete)
+	} else {
+		fastCookie.SetMaxAge(cookie.MaxAge)
+	}
+	fastCookie.SetSecure(cookie.Secure)
+	fastCookie.SetHTTPOnly(cookie.HttpOnly)
+	switch cookie.SameSite {
+	case http.SameSiteLaxMode:
+		fastCookie.SetSameSite(fasthttp.CookieSameSiteLaxMode)
+	case http.SameSiteStrictMode:
+		fastCookie.SetSameSite(fasthttp.CookieSameSiteStrictMode)
+	case http.SameSiteNoneMode:
+		fastCookie.SetSameSite(fasthttp.CookieSameSiteNoneMode)
+	}
+	fc.Response.Header.SetCookie(fastCookie)
+}
+
+func csrfHandle(csrf *secure.CSRF, handler HTTPHandlerFunc, c context.Context, fc *fasthttp.RequestCtx) error {
+	options := csrf.Options()
+	//The identity token signs the CSRF tokens, so a token issued to other client is not accepted
+	binding, _ := c.Value(TokenContextKey).(string)
+	var cookieToken string
+	if cookie := string(fc.Request.Header.Cookie(options.CookieName)); csrf.ValidToken(cookie, binding) {
+		cookieToken = cookie
+	}
+	token := cookieToken
+	if token == "" {
+		var err error
+		if token, err = csrf.NewToken(binding); err != nil {
+			return err
+		}
+		setCookie(fc, csrf.Cookie(token))
+	}
+	c = context.WithValue(c, CSRFContextKey, token)
+	method := string(fc.Method())
+	if !secure.SafeMethod(method) {
+		submitted := string(fc.Request.Header.Peek(options.HeaderName))
+		if submitted == "" {
+			submitted = string(fc.PostArgs().Peek(options.FieldName))
+		}
+		if err := csrf.Check(method, cookieToken, submitted, binding); err != nil {
+			return err
+		}
+	}
+	return handler(c, fc)
+}
+
+//CSRF creates a wrapper that sets the token cookie and rejects the unsafe requests without the token.
+//With a secure.CSRFOptions.Secret the token is bound to the identity token, so use it inside the Session or APIKey wrappers.
+//Rejected requests return a 403 secure.ErrCSRFTokenMissing or secure.ErrCSRFTokenInvalid, rendered by the Error wrapper
+func CSRF(csrf *secure.CSRF) HTTPHandlerWrapper {
+	return func(handler HTTPHandlerFunc) HTTPHandlerFunc {
+		return func(c context.Context, fc *fasthttp.RequestCtx) error {
+			return csrfHandle(csrf, handler, c, fc)
+		}
+	}
+}
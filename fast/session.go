@@ -0,0 +1,56 @@
+package fast
+
+import (
+	"context"
+	"github.com/rjansen/haki"
+	"github.com/rjansen/haki/session"
+	"github.com/rjansen/l"
+	"github.com/valyala/fasthttp"
+)
+
+//SessionContextKey is the context key of the session loaded by the Session wrapper
+const SessionContextKey = "session"
+
+//GetSession returns the session loaded by the Session wrapper, nil when the wrapper is not in use
+func GetSession(c context.Context) *session.Session {
+	s, _ := c.Value(SessionContextKey).(*session.Session)
+	return s
+}
+
+func sessionHandle(manager *session.Manager, handler HTTPHandlerFunc, c context.Context, fc *fasthttp.RequestCtx) error {
+	s, err := manager.Load(string(fc.Request.Header.Cookie(manager.Options().CookieName)))
+	if err != nil {
+		return err
+	}
+	c = context.WithValue(c, SessionContextKey, s)
+	if s.Authenticated() {
+		c = context.WithValue(c, TokenContextKey, s.Token)
+		c = context.WithValue(c, IdentityContextKey, s.Value)
+	}
+	fc.Response.Header.Add(haki.VaryHeader, "Cookie")
+	if err := handler(c, fc); err != nil {
+		return err
+	}
+	cookie, err := manager.Save(s)
+	if err != nil {
+		l.Error("haki.fast.SessionSaveErr",
+			l.Bytes("path", fc.Path()),
+			l.Err(err),
+		)
+		return err
+	}
+	if cookie != nil {
+		setCookie(fc, cookie)
+	}
+	return nil
+}
+
+//Session creates a wrapper that loads the request session and saves it when changed.
+//The session identity, when set, is stored in the context under TokenContextKey and IdentityContextKey
+func Session(manager *session.Manager) HTTPHandlerWrapper {
+	return func(handler HTTPHandlerFunc) HTTPHandlerFunc {
+		return func(c context.Context, fc *fasthttp.RequestCtx) error {
+			return sessionHandle(manager, handler, c, fc)
+		}
+	}
+}
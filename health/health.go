@@ -0,0 +1,266 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"github.com/rjansen/haki"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+//Status is the state of a check or of a Report
+type Status string
+
+//Kind selects the checks run by a probe
+type Kind int
+
+const (
+	StatusUp       Status = "up"
+	StatusDegraded Status = "degraded"
+	StatusDown     Status = "down"
+)
+
+const (
+	//Health runs all the checks, like /healthz
+	Health Kind = iota
+	//Readiness runs all the checks and is down until the Setup succeeds and after the Shutdown, like /readyz
+	Readiness
+	//Liveness runs only the Liveness checks, like /livez
+	Liveness
+)
+
+var (
+	//DefaultTimeout is the Check.Timeout when zero
+	DefaultTimeout = 5 * time.Second
+	//DefaultCacheTTL is how long the results are reused by the registries created by New
+	DefaultCacheTTL = time.Second
+	//ErrTimeout is the result error of the checks that do not finish in their Timeout
+	ErrTimeout = errors.New("Health check timeout")
+	//ErrNotReady is the result error of the readiness before the Setup succeeds
+	ErrNotReady = errors.New("Setup not finished")
+	//ErrShutdown is the result error of the readiness after the Shutdown
+	ErrShutdown = errors.New("Shutting down")
+)
+
+//CheckFunc checks a component, like a database ping, and returns the error when it is unhealthy
+type CheckFunc func(ctx context.Context) error
+
+//Check is a named component check
+type Check struct {
+	Name  string
+	Check CheckFunc
+	//Timeout is the max duration of the check, DefaultTimeout when zero
+	Timeout time.Duration
+	//Critical turns the report down when the check fails, otherwise it is only degraded
+	Critical bool
+	//Liveness includes the check in the Liveness probe, only for failures that a restart fixes
+	Liveness bool
+}
+
+//Result is the outcome of a check
+type Result struct {
+	Name     string    `json:"name"`
+	Status   Status    `json:"status"`
+	Critical bool      `json:"critical"`
+	Error    string    `json:"error,omitempty"`
+	Duration float64   `json:"durationMs"`
+	Checked  time.Time `json:"checked"`
+}
+
+//Report is the outcome of a probe, down when a critical check fails and degraded when other check fails
+type Report struct {
+	Status Status   `json:"status"`
+	Checks []Result `json:"checks"`
+}
+
+//Code returns the http status code of the report, 503 when down
+func (r Report) Code() int {
+	if r.Status == StatusDown {
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusOK
+}
+
+//Registry keeps the registered checks and the readiness state
+type Registry struct {
+	//CacheTTL is how long the check results are reused, zero runs the checks in every probe
+	CacheTTL time.Duration
+	mutex    sync.RWMutex
+	checks   []Check
+	results  map[string]Result
+	ready    bool
+	setupErr error
+	shutdown bool
+	now      func() time.Time
+}
+
+//New creates an empty Registry, not ready until the Setup succeeds or SetReady is called
+func New() *Registry {
+	return &Registry{CacheTTL: DefaultCacheTTL, results: make(map[string]Result), now: time.Now}
+}
+
+//Register adds or replaces the check of the name
+func (r *Registry) Register(check Check) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for i, c := range r.checks {
+		if c.Name == check.Name {
+			r.checks[i] = check
+			delete(r.results, check.Name)
+			return
+		}
+	}
+	r.checks = append(r.checks, check)
+}
+
+//Setup calls the haki.Setup with the provided functions, the registry becomes ready when it succeeds
+func (r *Registry) Setup(setupFuncs ...haki.SetupFunc) error {
+	err := haki.Setup(setupFuncs...)
+	r.mutex.Lock()
+	r.setupErr = err
+	r.ready = err == nil
+	r.mutex.Unlock()
+	return err
+}
+
+//SetupContext calls the haki.SetupContext with the provided functions, the registry becomes ready when it succeeds
+func (r *Registry) SetupContext(ctx context.Context, setupFuncs ...haki.SetupContextFunc) error {
+	err := haki.SetupContext(ctx, setupFuncs...)
+	r.mutex.Lock()
+	r.setupErr = err
+	r.ready = err == nil
+	r.mutex.Unlock()
+	return err
+}
+
+//SetReady sets the readiness when the components are not initialized by Setup
+func (r *Registry) SetReady(ready bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.ready = ready
+}
+
+//Shutdown turns the readiness down, so the load balancers stop sending requests during the graceful shutdown.
+//It fits the http.Server RegisterOnShutdown
+func (r *Registry) Shutdown() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.shutdown = true
+}
+
+//run returns the check result and false when the probe ctx failed the check, a result that must not be cached
+func (r *Registry) run(parent context.Context, check Check) (Result, bool) {
+	timeout := check.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	ctx, cancel := context.WithTimeout(parent, timeout)
+	defer cancel()
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() {
+		done <- check.Check(ctx)
+	}()
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = ErrTimeout
+	}
+	cacheable := true
+	if parentErr := parent.Err(); parentErr != nil && err != nil {
+		//A probe that gave up, like a disconnected client, says nothing about the checked component
+		err = parentErr
+		cacheable = false
+	}
+	result := Result{
+		Name:     check.Name,
+		Status:   StatusUp,
+		Critical: check.Critical,
+		Duration: float64(time.Since(start)) / float64(time.Millisecond),
+		Checked:  r.now(),
+	}
+	if err != nil {
+		result.Status = StatusDown
+		result.Error = err.Error()
+	}
+	return result, cacheable
+}
+
+//Run runs the checks of the probe kind concurrently, reusing the results newer than the CacheTTL.
+//The checks failed by a done ctx, like a disconnected probe client, report the ctx error and are not cached
+func (r *Registry) Run(ctx context.Context, kind Kind) Report {
+	r.mutex.RLock()
+	now := r.now()
+	var checks []Check
+	results := make([]Result, 0, len(r.checks)+1)
+	for _, check := range r.checks {
+		if kind == Liveness && !check.Liveness {
+			continue
+		}
+		if cached, found := r.results[check.Name]; found && now.Sub(cached.Checked) < r.CacheTTL {
+			results = append(results, cached)
+			continue
+		}
+		checks = append(checks, check)
+	}
+	if kind == Readiness {
+		if readiness := r.readiness(now); readiness.Status != StatusUp {
+			results = append(results, readiness)
+		}
+	}
+	r.mutex.RUnlock()
+
+	fresh := make([]Result, len(checks))
+	cacheable := make([]bool, len(checks))
+	var wg sync.WaitGroup
+	for i, check := range checks {
+		wg.Add(1)
+		go func(i int, check Check) {
+			defer wg.Done()
+			fresh[i], cacheable[i] = r.run(ctx, check)
+		}(i, check)
+	}
+	wg.Wait()
+	if len(fresh) > 0 {
+		r.mutex.Lock()
+		for i, result := range fresh {
+			if cacheable[i] {
+				r.results[result.Name] = result
+			}
+		}
+		r.mutex.Unlock()
+	}
+	results = append(results, fresh...)
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Name < results[j].Name
+	})
+	report := Report{Status: StatusUp, Checks: results}
+	for _, result := range results {
+		if result.Status == StatusUp {
+			continue
+		}
+		if result.Critical {
+			report.Status = StatusDown
+			break
+		}
+		report.Status = StatusDegraded
+	}
+	return report
+}
+
+//readiness returns the critical result of the readiness state
+func (r *Registry) readiness(now time.Time) Result {
+	result := Result{Name: "readiness", Status: StatusUp, Critical: true, Checked: now}
+	switch {
+	case r.shutdown:
+		result.Status, result.Error = StatusDown, ErrShutdown.Error()
+	case r.setupErr != nil:
+		result.Status, result.Error = StatusDown, r.setupErr.Error()
+	case !r.ready:
+		result.Status, result.Error = StatusDown, ErrNotReady.Error()
+	}
+	return result
+}
@@ -0,0 +1,144 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"github.com/rjansen/haki"
+	"github.com/rjansen/l"
+	"github.com/rjansen/l/zap"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func init() {
+	if setupErr := zap.Setup(new(l.Configuration)); setupErr != nil {
+		panic(setupErr)
+	}
+	l.Info("context.health_test.init")
+}
+
+func TestRun(t *testing.T) {
+	registry := New()
+	registry.CacheTTL = 0
+	var cacheErr error
+	registry.Register(Check{Name: "db", Critical: true, Check: func(ctx context.Context) error {
+		return nil
+	}})
+	registry.Register(Check{Name: "cache", Liveness: true, Check: func(ctx context.Context) error {
+		return cacheErr
+	}})
+
+	report := registry.Run(context.Background(), Health)
+	assert.Equal(t, StatusUp, report.Status)
+	assert.Equal(t, http.StatusOK, report.Code())
+	assert.Len(t, report.Checks, 2)
+	assert.Equal(t, "cache", report.Checks[0].Name)
+	assert.Equal(t, "db", report.Checks[1].Name)
+
+	cacheErr = errors.New("cache unavailable")
+	report = registry.Run(context.Background(), Health)
+	assert.Equal(t, StatusDegraded, report.Status)
+	assert.Equal(t, http.StatusOK, report.Code())
+	assert.Equal(t, StatusDown, report.Checks[0].Status)
+	assert.Equal(t, "cache unavailable", report.Checks[0].Error)
+
+	registry.Register(Check{Name: "db", Critical: true, Check: func(ctx context.Context) error {
+		return errors.New("db unavailable")
+	}})
+	report = registry.Run(context.Background(), Health)
+	assert.Equal(t, StatusDown, report.Status)
+	assert.Equal(t, http.StatusServiceUnavailable, report.Code())
+	assert.Len(t, report.Checks, 2)
+
+	report = registry.Run(context.Background(), Liveness)
+	assert.Equal(t, StatusDegraded, report.Status)
+	assert.Len(t, report.Checks, 1)
+	assert.Equal(t, "cache", report.Checks[0].Name)
+}
+
+func TestRunTimeoutAndConcurrency(t *testing.T) {
+	registry := New()
+	for _, name := range []string{"a", "b", "c"} {
+		registry.Register(Check{Name: name, Critical: true, Timeout: 20 * time.Millisecond, Check: func(ctx context.Context) error {
+			<-ctx.Done()
+			return ctx.Err()
+		}})
+	}
+	start := time.Now()
+	report := registry.Run(context.Background(), Health)
+	assert.True(t, time.Since(start) < 200*time.Millisecond, "Checks run concurrently")
+	assert.Equal(t, StatusDown, report.Status)
+	for _, result := range report.Checks {
+		assert.Equal(t, ErrTimeout.Error(), result.Error)
+	}
+}
+
+func TestRunCache(t *testing.T) {
+	registry := New()
+	now := time.Now()
+	registry.now = func() time.Time {
+		return now
+	}
+	var calls int32
+	registry.Register(Check{Name: "db", Check: func(ctx context.Context) error {
+		atomic.AddInt32(&calls, 1)
+		return nil
+	}})
+	registry.Run(context.Background(), Health)
+	registry.Run(context.Background(), Readiness)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+
+	now = now.Add(DefaultCacheTTL)
+	registry.Run(context.Background(), Health)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+}
+
+func TestRunCanceled(t *testing.T) {
+	registry := New()
+	var calls int32
+	registry.Register(Check{Name: "db", Critical: true, Check: func(ctx context.Context) error {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			<-ctx.Done()
+			return ctx.Err()
+		}
+		return nil
+	}})
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+	report := registry.Run(ctx, Health)
+	assert.Equal(t, StatusDown, report.Status)
+	assert.Equal(t, context.Canceled.Error(), report.Checks[0].Error, "The probe ctx error is reported")
+
+	report = registry.Run(context.Background(), Health)
+	assert.Equal(t, StatusUp, report.Status, "The canceled result is not cached")
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+}
+
+func TestReadiness(t *testing.T) {
+	registry := New()
+	report := registry.Run(context.Background(), Readiness)
+	assert.Equal(t, StatusDown, report.Status)
+	assert.Equal(t, ErrNotReady.Error(), report.Checks[0].Error)
+	assert.Equal(t, StatusUp, registry.Run(context.Background(), Health).Status)
+
+	setupErr := errors.New("setup failed")
+	assert.True(t, errors.Is(registry.Setup(func() error { return setupErr }), setupErr))
+	report = registry.Run(context.Background(), Readiness)
+	assert.Equal(t, StatusDown, report.Status)
+	assert.Contains(t, report.Checks[0].Error, "setup failed")
+
+	assert.NotNil(t, registry.SetupContext(context.Background(), func(ctx context.Context) error { return setupErr }))
+	assert.Nil(t, registry.Setup(haki.SetupFunc(func() error { return nil })))
+	report = registry.Run(context.Background(), Readiness)
+	assert.Equal(t, StatusUp, report.Status)
+	assert.Len(t, report.Checks, 0)
+
+	registry.Shutdown()
+	report = registry.Run(context.Background(), Readiness)
+	assert.Equal(t, StatusDown, report.Status)
+	assert.Equal(t, ErrShutdown.Error(), report.Checks[0].Error)
+	assert.Equal(t, StatusUp, registry.Run(context.Background(), Liveness).Status)
+}
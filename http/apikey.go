@@ -0,0 +1,42 @@
+package http
+
+import (
+	"github.com/rjansen/haki/apikey"
+	"github.com/rjansen/l"
+	"net/http"
+)
+
+func apiKeyHandle(resolver *apikey.Resolver, handler HTTPHandlerFunc, w http.ResponseWriter, r *http.Request) error {
+	key := r.Header.Get(resolver.Header)
+	if key == "" && resolver.Query != "" {
+		key = r.URL.Query().Get(resolver.Query)
+	}
+	if key == "" {
+		return handler(w, r)
+	}
+	logger, _ := auditLogger(r)
+	stored, err := resolver.Resolve(key)
+	if err != nil {
+		logger.Warn("haki.http.APIKeyErr",
+			l.String("key", apikey.Redact(key)),
+			l.Err(err),
+		)
+		return err
+	}
+	r = setIdentity(r, &Identity{Token: stored.Token(), Value: stored.Identity()})
+	logger.Info("haki.http.APIKey",
+		l.String("prefix", stored.Prefix),
+		l.String("name", stored.Name),
+	)
+	return handler(w, r)
+}
+
+//APIKey creates a wrapper that resolves the request API key into the Identity, use it inside Audit.
+//Requests without a key are kept anonymous and the invalid keys return a 401 apikey.ErrInvalidKey
+func APIKey(resolver *apikey.Resolver) HTTPHandlerWrapper {
+	return func(handler HTTPHandlerFunc) HTTPHandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) error {
+			return apiKeyHandle(resolver, handler, w, r)
+		}
+	}
+}
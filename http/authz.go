@@ -0,0 +1,50 @@
+package http
+
+import (
+	"github.com/rjansen/haki/authz"
+	"github.com/rjansen/l"
+	"net/http"
+)
+
+//Subject returns the authz.Subject of the request Identity, anonymous when there is no Identity or it has the AnonymousToken
+func Subject(r *http.Request) authz.Subject {
+	identity, ok := Get(r, ContextKeys.IDENTITY).(*Identity)
+	if !ok || identity == nil {
+		return authz.Subject{}
+	}
+	return authz.Subject{
+		Token:         identity.Token,
+		Value:         identity.Value,
+		Authenticated: identity.Token != "" && identity.Token != AnonymousToken,
+	}
+}
+
+func requireHandle(policy authz.Policy, handler HTTPHandlerFunc, w http.ResponseWriter, r *http.Request) error {
+	subject := Subject(r)
+	err := authz.Evaluate(policy, subject, authz.Request{Method: r.Method, Path: r.URL.Path, Header: r.Header.Get})
+	logger, _ := auditLogger(r)
+	if err != nil {
+		logger.Warn("haki.http.AccessDenied",
+			l.String("policy", policy.Name),
+			l.String("token", subject.Token),
+			l.Bool("authenticated", subject.Authenticated),
+		)
+		return err
+	}
+	logger.Info("haki.http.AccessAllowed",
+		l.String("policy", policy.Name),
+		l.String("token", subject.Token),
+	)
+	return handler(w, r)
+}
+
+//Require creates a wrapper that calls the handler only when the policy allows the request Identity.
+//Denied requests return a 401 authz.ErrUnauthenticated for anonymous identities and a 403 authz.ErrForbidden otherwise,
+//so use it inside Audit and Session and record the decisions through the Auditor
+func Require(policy authz.Policy) HTTPHandlerWrapper {
+	return func(handler HTTPHandlerFunc) HTTPHandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) error {
+			return requireHandle(policy, handler, w, r)
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package client
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+//State is the state of a host circuit
+type State int
+
+const (
+	//StateClosed lets all requests pass and counts the consecutive failures
+	StateClosed State = iota
+	//StateOpen rejects all requests until the open timeout expires
+	StateOpen
+	//StateHalfOpen lets a limited number of trial requests pass to probe the host
+	StateHalfOpen
+)
+
+func (s State) String() string {
+	switch s {
+	case StateClosed:
+		return "closed"
+	case StateOpen:
+		return "open"
+	case StateHalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+var (
+	//ErrCircuitOpen is returned when a request is rejected by an open host circuit
+	ErrCircuitOpen = errors.New("Circuit open. The host failed too many times, retry later")
+)
+
+//Metrics receives the Breaker events, implementations must be safe for concurrent use.
+//StateChange is called with the breaker locked and must not call the Breaker back
+type Metrics interface {
+	//StateChange is called when the host circuit moves between states
+	StateChange(host string, from State, to State)
+	//Success is called when a request to the host succeeds
+	Success(host string)
+	//Failure is called when a request to the host fails
+	Failure(host string)
+	//Rejected is called when a request to the host is rejected by the circuit
+	Rejected(host string)
+}
+
+//Breaker is a per host circuit breaker
+type Breaker struct {
+	//Threshold is the number of consecutive failures that opens the circuit
+	Threshold int
+	//OpenTimeout is how long the circuit stays open before the half open trials
+	OpenTimeout time.Duration
+	//HalfOpenRequests is the max number of concurrent trial requests in the half open state
+	HalfOpenRequests int
+	//Metrics receives the breaker events when not nil
+	Metrics Metrics
+
+	mutex sync.Mutex
+	hosts map[string]*circuit
+}
+
+type circuit struct {
+	state    State
+	failures int
+	openedAt time.Time
+	trials   int
+}
+
+//NewBreaker creates a Breaker that opens after threshold consecutive failures for the open timeout
+func NewBreaker(threshold int, openTimeout time.Duration) *Breaker {
+	return &Breaker{
+		Threshold:        threshold,
+		OpenTimeout:      openTimeout,
+		HalfOpenRequests: 1,
+	}
+}
+
+//State returns the circuit state of the host
+func (b *Breaker) State(host string) State {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if c, found := b.hosts[host]; found {
+		return c.state
+	}
+	return StateClosed
+}
+
+//Allow returns ErrCircuitOpen when the host circuit rejects the request.
+//Every allowed request must be reported with Done
+func (b *Breaker) Allow(host string) error {
+	b.mutex.Lock()
+	c := b.circuit(host)
+	if c.state == StateOpen && time.Since(c.openedAt) >= b.OpenTimeout {
+		b.change(host, c, StateHalfOpen)
+	}
+	allowed := true
+	switch c.state {
+	case StateOpen:
+		allowed = false
+	case StateHalfOpen:
+		maxTrials := b.HalfOpenRequests
+		if maxTrials < 1 {
+			maxTrials = 1
+		}
+		if c.trials >= maxTrials {
+			allowed = false
+		} else {
+			c.trials++
+		}
+	}
+	b.mutex.Unlock()
+	if !allowed {
+		if b.Metrics != nil {
+			b.Metrics.Rejected(host)
+		}
+		return ErrCircuitOpen
+	}
+	return nil
+}
+
+//Done reports the result of a request allowed by the host circuit
+func (b *Breaker) Done(host string, failed bool) {
+	b.mutex.Lock()
+	c := b.circuit(host)
+	if c.state == StateHalfOpen && c.trials > 0 {
+		c.trials--
+	}
+	if failed {
+		c.failures++
+		if c.state == StateHalfOpen || (c.state == StateClosed && c.failures >= b.Threshold) {
+			c.openedAt = time.Now()
+			b.change(host, c, StateOpen)
+		}
+	} else {
+		c.failures = 0
+		if c.state == StateHalfOpen {
+			b.change(host, c, StateClosed)
+		}
+	}
+	b.mutex.Unlock()
+	if b.Metrics != nil {
+		if failed {
+			b.Metrics.Failure(host)
+		} else {
+			b.Metrics.Success(host)
+		}
+	}
+}
+
+func (b *Breaker) circuit(host string) *circuit {
+	if b.hosts == nil {
+		b.hosts = make(map[string]*circuit)
+	}
+	c, found := b.hosts[host]
+	if !found {
+		c = new(circuit)
+		b.hosts[host] = c
+	}
+	return c
+}
+
+func (b *Breaker) change(host string, c *circuit, to State) {
+	from := c.state
+	c.state = to
+	c.trials = 0
+	if b.Metrics != nil {
+		b.Metrics.StateChange(host, from, to)
+	}
+}
@@ -0,0 +1,296 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/rjansen/haki"
+	hakihttp "github.com/rjansen/haki/http"
+	"github.com/rjansen/haki/media"
+	"github.com/rjansen/l"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+var (
+	//ErrInvalidResponseContentType is returned when the response Content-Type does not have a media codec
+	ErrInvalidResponseContentType = errors.New("Invalid response Content-Type. Only the media package codecs are valid")
+	//MaxErrorBodySize is the max size in bytes of a non 2xx response body kept by Error
+	MaxErrorBodySize int64 = 64 << 10
+)
+
+//Error is the structured error of a response with a non 2xx status
+type Error struct {
+	StatusCode  int
+	ContentType string
+	//Message is the plain text body, like the haki Err helpers writes, or the status text for other medias
+	Message string
+	Body    []byte
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("Request failed with status %d: %s", e.StatusCode, e.Message)
+}
+
+//Decode reads the error body into ref using the codec of the response Content-Type
+func (e *Error) Decode(ref interface{}) error {
+	codec, found := media.ForContentType(e.ContentType)
+	if !found {
+		return ErrInvalidResponseContentType
+	}
+	return codec.UnmarshalBytes(e.Body, ref)
+}
+
+//NewError reads the body of a non 2xx response into an Error
+func NewError(statusCode int, contentType string, body []byte) *Error {
+	message := strings.TrimSpace(string(body))
+	if !strings.Contains(contentType, media.Text.ContentType) || message == "" {
+		message = http.StatusText(statusCode)
+	}
+	return &Error{
+		StatusCode:  statusCode,
+		ContentType: contentType,
+		Message:     message,
+		Body:        body,
+	}
+}
+
+//Client is a http client that handles the request and response medias like the haki server helpers
+type Client struct {
+	//HTTPClient sends the requests, http.DefaultClient when nil
+	HTTPClient *http.Client
+	//BaseURL is the prefix of the request paths
+	BaseURL string
+	//Codec encodes the request bodies
+	Codec media.ContentCodec
+	//Accept is the Accept header value, the Codec content type when empty
+	Accept string
+	//Header holds the headers set in every request
+	Header http.Header
+	//RequestTimeout is the max duration of each request attempt, zero means only the context deadline
+	RequestTimeout time.Duration
+	//Retry is the policy to resend the idempotent requests, nil disables the retries
+	Retry *Retry
+	//Breaker rejects the requests to the hosts that are failing, nil disables the circuit breaking
+	Breaker *Breaker
+}
+
+//New creates a Client of the provided base url that sends and accepts json
+func New(baseURL string) *Client {
+	return &Client{
+		BaseURL: baseURL,
+		Codec:   media.JSON,
+		Header:  make(http.Header),
+	}
+}
+
+//Forward sets the request headers with the tid, cid, trace parent and authorization found in the incoming request context.
+//The values are stored in the context by the haki http Audit wrapper
+func Forward(ctx context.Context, req *http.Request) {
+	headers := []struct {
+		key    string
+		header string
+	}{
+		{hakihttp.ContextKeys.TID, haki.RequestIDHeader},
+		{hakihttp.ContextKeys.CID, haki.RequestContextHeader},
+		{hakihttp.ContextKeys.TRACE, haki.TraceParentHeader},
+		{hakihttp.ContextKeys.AUTHORIZATION, haki.AuthorizationHeader},
+	}
+	for _, h := range headers {
+		if val, ok := ctx.Value(h.key).(string); ok && val != "" && req.Header.Get(h.header) == "" {
+			req.Header.Set(h.header, val)
+		}
+	}
+}
+
+//NewRequest creates a request with the body encoded by the client codec and the incoming context forwarded
+func (c *Client) NewRequest(ctx context.Context, method string, path string, body interface{}) (*http.Request, error) {
+	bodyBytes, err := c.encode(body)
+	if err != nil {
+		return nil, err
+	}
+	return c.newRequest(ctx, method, path, bodyBytes)
+}
+
+func (c *Client) encode(body interface{}) ([]byte, error) {
+	if body == nil {
+		return nil, nil
+	}
+	var buf bytes.Buffer
+	if err := c.Codec.Codec.Marshal(&buf, body); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (c *Client) newRequest(ctx context.Context, method string, path string, body []byte) (*http.Request, error) {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequest(method, c.BaseURL+path, reader)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	for name, values := range c.Header {
+		req.Header[name] = append([]string(nil), values...)
+	}
+	if body != nil {
+		req.Header.Set(haki.ContentTypeHeader, c.Codec.ContentType)
+	}
+	accept := c.Accept
+	if accept == "" {
+		accept = c.Codec.ContentType
+	}
+	req.Header.Set(haki.AcceptHeader, accept)
+	Forward(ctx, req)
+	return req, nil
+}
+
+//Do sends a request with the encoded body, if not nil, and decodes the response into result, if not nil.
+//Idempotent requests are retried by the Retry policy while the ctx deadline allows and
+//the Breaker rejects the requests to failing hosts with ErrCircuitOpen.
+//Non 2xx responses are returned as *Error
+func (c *Client) Do(ctx context.Context, method string, path string, body interface{}, result interface{}) error {
+	start := time.Now()
+	bodyBytes, err := c.encode(body)
+	if err != nil {
+		return err
+	}
+	attempts := 1
+	if c.Retry.Retryable(method) {
+		attempts = c.Retry.Attempts
+	}
+	for attempt := 1; ; attempt++ {
+		retry, err := c.do(ctx, method, path, bodyBytes, result, attempt < attempts)
+		if retry == nil {
+			l.Debug("haki.client.Response",
+				l.String("method", method),
+				l.String("url", c.BaseURL+path),
+				l.Int("attempts", attempt),
+				l.Duration("requestTime", time.Since(start)),
+				l.Err(err),
+			)
+			return err
+		}
+		wait, ok := c.Retry.Wait(attempt-1, retry.retryAfter)
+		l.Warn("haki.client.Retry",
+			l.String("method", method),
+			l.String("url", c.BaseURL+path),
+			l.Int("attempt", attempt),
+			l.Duration("wait", wait),
+			l.Bool("retry", ok),
+			l.Err(retry.err),
+		)
+		//A Retry-After past the MaxBackoff or the ctx deadline ends the retries with the last failure
+		if !ok || !Sleep(ctx, wait) {
+			return retry.err
+		}
+	}
+}
+
+//retryErr holds the failure of an attempt that can be retried
+type retryErr struct {
+	err        error
+	retryAfter string
+}
+
+//do sends one attempt of the request and returns a retryErr, when retryable is true and the attempt failed temporarily
+func (c *Client) do(ctx context.Context, method string, path string, body []byte, result interface{}, retryable bool) (*retryErr, error) {
+	reqCtx := ctx
+	if c.RequestTimeout > 0 {
+		var cancel context.CancelFunc
+		reqCtx, cancel = context.WithTimeout(ctx, c.RequestTimeout)
+		defer cancel()
+	}
+	req, err := c.newRequest(reqCtx, method, path, body)
+	if err != nil {
+		return nil, err
+	}
+	host := req.URL.Host
+	if c.Breaker != nil {
+		if err := c.Breaker.Allow(host); err != nil {
+			return nil, err
+		}
+	}
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Do(req)
+	if c.Breaker != nil {
+		c.Breaker.Done(host, err != nil || resp.StatusCode >= http.StatusInternalServerError)
+	}
+	if err != nil {
+		l.Error("haki.client.RequestErr",
+			l.String("method", method),
+			l.String("url", req.URL.String()),
+			l.Err(err),
+		)
+		if retryable && ctx.Err() == nil {
+			return &retryErr{err: err}, err
+		}
+		return nil, err
+	}
+	defer resp.Body.Close()
+	err = ReadResponse(resp, result)
+	if retryable && RetryStatus(resp.StatusCode) {
+		return &retryErr{err: err, retryAfter: resp.Header.Get(haki.RetryAfterHeader)}, err
+	}
+	return nil, err
+}
+
+//Get sends a GET request and decodes the response into result
+func (c *Client) Get(ctx context.Context, path string, result interface{}) error {
+	return c.Do(ctx, http.MethodGet, path, nil, result)
+}
+
+//Post sends a POST request with the encoded body and decodes the response into result
+func (c *Client) Post(ctx context.Context, path string, body interface{}, result interface{}) error {
+	return c.Do(ctx, http.MethodPost, path, body, result)
+}
+
+//Put sends a PUT request with the encoded body and decodes the response into result
+func (c *Client) Put(ctx context.Context, path string, body interface{}, result interface{}) error {
+	return c.Do(ctx, http.MethodPut, path, body, result)
+}
+
+//Patch sends a PATCH request with the encoded body and decodes the response into result
+func (c *Client) Patch(ctx context.Context, path string, body interface{}, result interface{}) error {
+	return c.Do(ctx, http.MethodPatch, path, body, result)
+}
+
+//Delete sends a DELETE request and decodes the response into result
+func (c *Client) Delete(ctx context.Context, path string, result interface{}) error {
+	return c.Do(ctx, http.MethodDelete, path, nil, result)
+}
+
+//ReadResponse decodes a 2xx response body into result by its Content-Type and Content-Encoding.
+//Other responses are returned as *Error
+func ReadResponse(resp *http.Response, result interface{}) error {
+	body, err := haki.ContentDecoder(resp.Header.Get(haki.ContentEncodingHeader), resp.Body)
+	if err != nil {
+		return err
+	}
+	contentType := resp.Header.Get(haki.ContentTypeHeader)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		errBody, err := ioutil.ReadAll(io.LimitReader(body, MaxErrorBodySize))
+		if err != nil {
+			return err
+		}
+		return NewError(resp.StatusCode, contentType, errBody)
+	}
+	if result == nil || resp.StatusCode == http.StatusNoContent {
+		return nil
+	}
+	codec, found := media.ForContentType(contentType)
+	if !found {
+		return ErrInvalidResponseContentType
+	}
+	return codec.Unmarshal(body, result)
+}
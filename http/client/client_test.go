@@ -0,0 +1,420 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"github.com/klauspost/compress/gzip"
+	"github.com/rjansen/haki"
+	hakihttp "github.com/rjansen/haki/http"
+	"github.com/rjansen/haki/media"
+	"github.com/rjansen/l"
+	"github.com/rjansen/l/zap"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func init() {
+	if setupErr := zap.Setup(new(l.Configuration)); setupErr != nil {
+		panic(setupErr)
+	}
+	l.Info("context.http.client_test.init")
+}
+
+type mockUser struct {
+	Username string `json:"username" codec:"username" xml:"username"`
+	Name     string `json:"name" codec:"name" xml:"name"`
+}
+
+type mockErr struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+//echoServer decodes the request body by its Content-Type and writes it back with the Accept media
+func echoServer(t *testing.T) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, header := range []string{haki.RequestIDHeader, haki.RequestContextHeader, haki.TraceParentHeader, haki.AuthorizationHeader} {
+			w.Header().Set("Echo-"+header, r.Header.Get(header))
+		}
+		var user mockUser
+		if r.ContentLength != 0 {
+			codec, found := media.ForContentType(r.Header.Get(haki.ContentTypeHeader))
+			assert.True(t, found)
+			assert.Nil(t, codec.Unmarshal(r.Body, &user))
+		}
+		user.Name = r.Method + " " + user.Name
+		codec, found := media.ForContentType(r.Header.Get(haki.AcceptHeader))
+		assert.True(t, found)
+		w.Header().Set(haki.ContentTypeHeader, r.Header.Get(haki.AcceptHeader))
+		assert.Nil(t, codec.Marshal(w, &user))
+	}))
+}
+
+func TestClientDo(t *testing.T) {
+	server := echoServer(t)
+	defer server.Close()
+
+	cases := []struct {
+		codec  media.ContentCodec
+		accept string
+	}{
+		{codec: media.JSON},
+		{codec: media.MsgPack},
+		{codec: media.CBOR},
+		{codec: media.XML},
+		{codec: media.JSON, accept: media.MsgPack.ContentType},
+	}
+	for _, c := range cases {
+		client := New(server.URL)
+		client.Codec = c.codec
+		client.Accept = c.accept
+
+		var result mockUser
+		err := client.Post(context.Background(), "/users", &mockUser{Username: "mock", Name: "Mock User"}, &result)
+		assert.Nil(t, err, c.codec.ContentType)
+		assert.Equal(t, mockUser{Username: "mock", Name: "POST Mock User"}, result, c.codec.ContentType)
+	}
+	client := New(server.URL)
+	var result mockUser
+	assert.Nil(t, client.Get(context.Background(), "/users", &result))
+	assert.Equal(t, "GET ", result.Name)
+	assert.Nil(t, client.Delete(context.Background(), "/users", nil))
+}
+
+func TestClientForward(t *testing.T) {
+	var echo http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		echo = r.Header
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	ctx = context.WithValue(ctx, hakihttp.ContextKeys.TID, "mock-tid")
+	ctx = context.WithValue(ctx, hakihttp.ContextKeys.CID, "mock-cid")
+	ctx = context.WithValue(ctx, hakihttp.ContextKeys.TRACE, "00-mock-trace-01")
+	ctx = context.WithValue(ctx, hakihttp.ContextKeys.AUTHORIZATION, "Bearer mock")
+
+	client := New(server.URL)
+	assert.Nil(t, client.Put(ctx, "/users", &mockUser{Username: "mock"}, &mockUser{}))
+	assert.Equal(t, "mock-tid", echo.Get(haki.RequestIDHeader))
+	assert.Equal(t, "mock-cid", echo.Get(haki.RequestContextHeader))
+	assert.Equal(t, "00-mock-trace-01", echo.Get(haki.TraceParentHeader))
+	assert.Equal(t, "Bearer mock", echo.Get(haki.AuthorizationHeader))
+	assert.Equal(t, media.JSON.ContentType, echo.Get(haki.ContentTypeHeader))
+	assert.Equal(t, media.JSON.ContentType, echo.Get(haki.AcceptHeader))
+
+	client.Header.Set(haki.AuthorizationHeader, "Bearer service")
+	assert.Nil(t, client.Get(ctx, "/users", nil))
+	assert.Equal(t, "Bearer service", echo.Get(haki.AuthorizationHeader))
+	assert.Equal(t, "mock-tid", echo.Get(haki.RequestIDHeader))
+
+	assert.Nil(t, client.Get(context.Background(), "/users", nil))
+	assert.Equal(t, "", echo.Get(haki.RequestIDHeader))
+	assert.Equal(t, "", echo.Get(haki.TraceParentHeader))
+}
+
+func TestClientForwardAudit(t *testing.T) {
+	var echo http.Header
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		echo = r.Header
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer backend.Close()
+
+	client := New(backend.URL)
+	frontend := httptest.NewServer(hakihttp.AuditHandler(func(w http.ResponseWriter, r *http.Request) error {
+		return client.Get(r.Context(), "/backend", nil)
+	}))
+	defer frontend.Close()
+
+	req, err := http.NewRequest(http.MethodGet, frontend.URL, nil)
+	assert.Nil(t, err)
+	req.Header.Set(haki.TraceParentHeader, "00-mock-trace-01")
+	req.Header.Set(haki.AuthorizationHeader, "Bearer mock")
+	resp, err := http.DefaultClient.Do(req)
+	assert.Nil(t, err)
+	resp.Body.Close()
+
+	assert.NotEmpty(t, echo.Get(haki.RequestIDHeader))
+	assert.Equal(t, resp.Header.Get(haki.RequestIDHeader), echo.Get(haki.RequestIDHeader))
+	assert.Equal(t, echo.Get(haki.RequestIDHeader), echo.Get(haki.RequestContextHeader))
+	assert.Equal(t, "00-mock-trace-01", echo.Get(haki.TraceParentHeader))
+	assert.Equal(t, "Bearer mock", echo.Get(haki.AuthorizationHeader))
+}
+
+func TestClientErr(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/text":
+			w.Header().Set(haki.ContentTypeHeader, media.Text.ContentType)
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("Invalid mock request\n"))
+		case "/json":
+			w.Header().Set(haki.ContentTypeHeader, media.JSON.ContentType)
+			w.WriteHeader(http.StatusConflict)
+			w.Write([]byte(`{"code": "mock.conflict", "message": "Mock conflict"}`))
+		case "/gzip":
+			var buf bytes.Buffer
+			gz := gzip.NewWriter(&buf)
+			gz.Write([]byte("Compressed mock error"))
+			gz.Close()
+			w.Header().Set(haki.ContentTypeHeader, media.Text.ContentType)
+			w.Header().Set(haki.ContentEncodingHeader, "gzip")
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write(buf.Bytes())
+		case "/unknown":
+			w.Header().Set(haki.ContentTypeHeader, "image/png")
+			w.Write([]byte{1, 2, 3})
+		}
+	}))
+	defer server.Close()
+	client := New(server.URL)
+
+	err := client.Get(context.Background(), "/text", &mockUser{})
+	assert.IsType(t, &Error{}, err)
+	assert.Equal(t, http.StatusBadRequest, err.(*Error).StatusCode)
+	assert.Equal(t, "Invalid mock request", err.(*Error).Message)
+	assert.Equal(t, "Request failed with status 400: Invalid mock request", err.Error())
+
+	err = client.Get(context.Background(), "/json", &mockUser{})
+	assert.IsType(t, &Error{}, err)
+	assert.Equal(t, http.StatusConflict, err.(*Error).StatusCode)
+	assert.Equal(t, http.StatusText(http.StatusConflict), err.(*Error).Message)
+	var errBody mockErr
+	assert.Nil(t, err.(*Error).Decode(&errBody))
+	assert.Equal(t, mockErr{Code: "mock.conflict", Message: "Mock conflict"}, errBody)
+
+	err = client.Get(context.Background(), "/gzip", nil)
+	assert.IsType(t, &Error{}, err)
+	assert.Equal(t, "Compressed mock error", err.(*Error).Message)
+	assert.NotNil(t, err.(*Error).Decode(&errBody))
+
+	err = client.Get(context.Background(), "/unknown", &mockUser{})
+	assert.Equal(t, ErrInvalidResponseContentType, err)
+
+	err = client.Post(context.Background(), "/json", make(chan int), nil)
+	assert.NotNil(t, err)
+}
+
+func TestClientRetry(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1)%3 != 0 {
+			w.Header().Set(haki.RetryAfterHeader, "0")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set(haki.ContentTypeHeader, media.JSON.ContentType)
+		w.Write([]byte(`{"username": "mock"}`))
+	}))
+	defer server.Close()
+
+	client := New(server.URL)
+	client.Retry = &Retry{Attempts: 3, Backoff: time.Millisecond, MaxBackoff: 5 * time.Millisecond, Jitter: 0.5}
+	var result mockUser
+	assert.Nil(t, client.Get(context.Background(), "/users", &result))
+	assert.Equal(t, "mock", result.Username)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&calls))
+
+	atomic.StoreInt32(&calls, 0)
+	err := client.Post(context.Background(), "/users", &mockUser{}, &result)
+	assert.IsType(t, &Error{}, err)
+	assert.Equal(t, http.StatusServiceUnavailable, err.(*Error).StatusCode)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+
+	atomic.StoreInt32(&calls, 0)
+	client.Retry.Attempts = 2
+	err = client.Delete(context.Background(), "/users", nil)
+	assert.IsType(t, &Error{}, err)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+}
+
+func TestClientRetryDeadline(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		if r.URL.Path == "/slow" {
+			time.Sleep(50 * time.Millisecond)
+		}
+		w.Header().Set(haki.RetryAfterHeader, "30")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	client := New(server.URL)
+	client.Retry = &Retry{Attempts: 3, Backoff: time.Millisecond}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	start := time.Now()
+	err := client.Get(ctx, "/users", nil)
+	assert.IsType(t, &Error{}, err)
+	assert.Equal(t, http.StatusTooManyRequests, err.(*Error).StatusCode)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+	assert.True(t, time.Since(start) < time.Second)
+
+	atomic.StoreInt32(&calls, 0)
+	client.Retry = &Retry{Attempts: 3, Backoff: time.Millisecond, MaxBackoff: 2 * time.Second}
+	start = time.Now()
+	err = client.Get(context.Background(), "/users", nil)
+	assert.IsType(t, &Error{}, err)
+	assert.Equal(t, http.StatusTooManyRequests, err.(*Error).StatusCode)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls), "No retry before the Retry-After")
+	assert.True(t, time.Since(start) < time.Second)
+
+	atomic.StoreInt32(&calls, 0)
+	client.Retry = &Retry{Attempts: 3, Backoff: time.Millisecond}
+	client.RequestTimeout = 10 * time.Millisecond
+	err = client.Get(context.Background(), "/slow", nil)
+	assert.NotNil(t, err)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&calls))
+}
+
+func TestRetryPolicy(t *testing.T) {
+	retry := &Retry{Attempts: 3, Backoff: 10 * time.Millisecond, MaxBackoff: 50 * time.Millisecond}
+	assert.Equal(t, 10*time.Millisecond, retry.Delay(0))
+	assert.Equal(t, 20*time.Millisecond, retry.Delay(1))
+	assert.Equal(t, 40*time.Millisecond, retry.Delay(2))
+	assert.Equal(t, 50*time.Millisecond, retry.Delay(3))
+	assert.Equal(t, 50*time.Millisecond, retry.Delay(100))
+	wait, ok := retry.Wait(0, "3600")
+	assert.False(t, ok, "Retry-After past the MaxBackoff")
+	assert.Equal(t, time.Hour, wait)
+	wait, ok = retry.Wait(0, "0")
+	assert.True(t, ok)
+	assert.Equal(t, 10*time.Millisecond, wait)
+	wait, ok = (&Retry{Backoff: time.Millisecond}).Wait(0, "2")
+	assert.True(t, ok)
+	assert.Equal(t, 2*time.Second, wait)
+	wait, ok = retry.Wait(0, "invalid")
+	assert.True(t, ok)
+	assert.Equal(t, 10*time.Millisecond, wait)
+
+	retry.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		wait := retry.Delay(1)
+		assert.True(t, wait > 10*time.Millisecond && wait <= 20*time.Millisecond, wait.String())
+	}
+
+	assert.True(t, retry.Retryable(http.MethodGet))
+	assert.True(t, retry.Retryable(http.MethodPut))
+	assert.False(t, retry.Retryable(http.MethodPost))
+	assert.False(t, retry.Retryable(http.MethodPatch))
+	assert.False(t, (*Retry)(nil).Retryable(http.MethodGet))
+	assert.False(t, (&Retry{Attempts: 1}).Retryable(http.MethodGet))
+
+	now := time.Date(2016, 11, 20, 10, 30, 15, 0, time.UTC)
+	wait, ok = RetryAfter("120", now)
+	assert.True(t, ok)
+	assert.Equal(t, 2*time.Minute, wait)
+	wait, ok = RetryAfter("Sun, 20 Nov 2016 10:30:45 GMT", now)
+	assert.True(t, ok)
+	assert.Equal(t, 30*time.Second, wait)
+	wait, ok = RetryAfter("Sun, 20 Nov 2016 10:00:00 GMT", now)
+	assert.True(t, ok)
+	assert.Equal(t, time.Duration(0), wait)
+	for _, value := range []string{"", "-1", "tomorrow"} {
+		_, ok = RetryAfter(value, now)
+		assert.False(t, ok, value)
+	}
+}
+
+type mockMetrics struct {
+	sync.Mutex
+	changes   []string
+	successes int
+	failures  int
+	rejected  int
+}
+
+func (m *mockMetrics) StateChange(host string, from State, to State) {
+	m.Lock()
+	defer m.Unlock()
+	m.changes = append(m.changes, host+":"+from.String()+"->"+to.String())
+}
+
+func (m *mockMetrics) Success(host string) {
+	m.Lock()
+	defer m.Unlock()
+	m.successes++
+}
+
+func (m *mockMetrics) Failure(host string) {
+	m.Lock()
+	defer m.Unlock()
+	m.failures++
+}
+
+func (m *mockMetrics) Rejected(host string) {
+	m.Lock()
+	defer m.Unlock()
+	m.rejected++
+}
+
+func TestBreaker(t *testing.T) {
+	metrics := new(mockMetrics)
+	breaker := NewBreaker(2, 20*time.Millisecond)
+	breaker.Metrics = metrics
+
+	assert.Equal(t, StateClosed, breaker.State("mock"))
+	assert.Nil(t, breaker.Allow("mock"))
+	breaker.Done("mock", true)
+	assert.Nil(t, breaker.Allow("mock"))
+	breaker.Done("mock", false)
+	assert.Nil(t, breaker.Allow("mock"))
+	breaker.Done("mock", true)
+	assert.Equal(t, StateClosed, breaker.State("mock"))
+	assert.Nil(t, breaker.Allow("mock"))
+	breaker.Done("mock", true)
+	assert.Equal(t, StateOpen, breaker.State("mock"))
+	assert.Equal(t, ErrCircuitOpen, breaker.Allow("mock"))
+	assert.Nil(t, breaker.Allow("other"))
+	breaker.Done("other", false)
+
+	time.Sleep(25 * time.Millisecond)
+	assert.Nil(t, breaker.Allow("mock"))
+	assert.Equal(t, StateHalfOpen, breaker.State("mock"))
+	assert.Equal(t, ErrCircuitOpen, breaker.Allow("mock"))
+	breaker.Done("mock", true)
+	assert.Equal(t, StateOpen, breaker.State("mock"))
+
+	time.Sleep(25 * time.Millisecond)
+	assert.Nil(t, breaker.Allow("mock"))
+	breaker.Done("mock", false)
+	assert.Equal(t, StateClosed, breaker.State("mock"))
+
+	assert.Equal(t, []string{
+		"mock:closed->open",
+		"mock:open->half-open",
+		"mock:half-open->open",
+		"mock:open->half-open",
+		"mock:half-open->closed",
+	}, metrics.changes)
+	assert.Equal(t, 3, metrics.successes)
+	assert.Equal(t, 4, metrics.failures)
+	assert.Equal(t, 2, metrics.rejected)
+}
+
+func TestClientBreaker(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	client := NewWithConfig(server.URL, Configuration{RequestTimeout: 500, MaxConnsPerHost: 250})
+	assert.Equal(t, 500*time.Millisecond, client.RequestTimeout)
+	assert.Equal(t, 250, client.HTTPClient.Transport.(*http.Transport).MaxConnsPerHost)
+	client.Breaker = NewBreaker(2, time.Minute)
+	for i := 0; i < 2; i++ {
+		assert.IsType(t, &Error{}, client.Get(context.Background(), "/users", nil))
+	}
+	assert.Equal(t, ErrCircuitOpen, client.Get(context.Background(), "/users", nil))
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+}
@@ -0,0 +1,42 @@
+package client
+
+import (
+	"net/http"
+	"time"
+)
+
+var (
+	//DefaultBreakerThreshold is the consecutive failures that opens the circuits of the clients created by NewWithConfig
+	DefaultBreakerThreshold = 5
+	//DefaultBreakerTimeout is the open timeout of the circuits of the clients created by NewWithConfig
+	DefaultBreakerTimeout = 10 * time.Second
+)
+
+//Configuration maps the http section of the haki.yaml file
+type Configuration struct {
+	//RequestTimeout is the max duration in milliseconds of each request attempt
+	RequestTimeout int `json:"request_timeout" yaml:"request_timeout" mapstructure:"request_timeout"`
+	//MaxConnsPerHost is the max number of connections to each host
+	MaxConnsPerHost int `json:"max_conns_perhost" yaml:"max_conns_perhost" mapstructure:"max_conns_perhost"`
+}
+
+//Timeout returns the RequestTimeout as a time.Duration
+func (c Configuration) Timeout() time.Duration {
+	return time.Duration(c.RequestTimeout) * time.Millisecond
+}
+
+//NewWithConfig creates a json Client of the provided base url with the DefaultRetry policy and a per host Breaker
+func NewWithConfig(baseURL string, config Configuration) *Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if config.MaxConnsPerHost > 0 {
+		transport.MaxConnsPerHost = config.MaxConnsPerHost
+		transport.MaxIdleConnsPerHost = config.MaxConnsPerHost
+	}
+	retry := DefaultRetry
+	client := New(baseURL)
+	client.HTTPClient = &http.Client{Transport: transport}
+	client.RequestTimeout = config.Timeout()
+	client.Retry = &retry
+	client.Breaker = NewBreaker(DefaultBreakerThreshold, DefaultBreakerTimeout)
+	return client
+}
@@ -0,0 +1,117 @@
+package client
+
+import (
+	"context"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+//DefaultRetry is the Retry policy of the clients created by NewWithConfig
+var DefaultRetry = Retry{
+	Attempts:   3,
+	Backoff:    50 * time.Millisecond,
+	MaxBackoff: 2 * time.Second,
+	Jitter:     0.5,
+}
+
+//Retry is the policy to resend idempotent requests that failed by a transport error or by a retryable status
+type Retry struct {
+	//Attempts is the max number of times a request is sent, including the first one
+	Attempts int
+	//Backoff is the wait before the first retry, doubled in each next retry
+	Backoff time.Duration
+	//MaxBackoff is the max wait computed by the exponential backoff and the longest Retry-After waited before a retry
+	MaxBackoff time.Duration
+	//Jitter is the fraction, between 0 and 1, of the backoff wait that is randomized
+	Jitter float64
+}
+
+//Retryable returns true when the method is idempotent and the policy allows more than one attempt
+func (r *Retry) Retryable(method string) bool {
+	if r == nil || r.Attempts < 2 {
+		return false
+	}
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	default:
+		return false
+	}
+}
+
+//Delay returns the exponential backoff wait with jitter of the provided retry, starting at 0
+func (r *Retry) Delay(retry int) time.Duration {
+	wait := r.Backoff
+	for i := 0; i < retry && (r.MaxBackoff <= 0 || wait < r.MaxBackoff); i++ {
+		wait *= 2
+	}
+	if r.MaxBackoff > 0 && wait > r.MaxBackoff {
+		wait = r.MaxBackoff
+	}
+	if r.Jitter > 0 && wait > 0 {
+		wait -= time.Duration(rand.Float64() * r.Jitter * float64(wait))
+	}
+	return wait
+}
+
+//Wait returns the wait before the provided retry, the Retry-After header value is used when it is longer than the backoff.
+//It returns false when the Retry-After is longer than the MaxBackoff, so the request is not retried before the server allows it
+func (r *Retry) Wait(retry int, retryAfter string) (time.Duration, bool) {
+	wait := r.Delay(retry)
+	if after, ok := RetryAfter(retryAfter, time.Now()); ok && after > wait {
+		if r.MaxBackoff > 0 && after > r.MaxBackoff {
+			return after, false
+		}
+		wait = after
+	}
+	return wait, true
+}
+
+//RetryStatus returns true for the statuses that signals a temporary server condition
+func RetryStatus(status int) bool {
+	switch status {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	default:
+		return false
+	}
+}
+
+//RetryAfter parses a Retry-After header value in delay seconds or http date format
+func RetryAfter(value string, now time.Time) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+	date, err := http.ParseTime(value)
+	if err != nil {
+		return 0, false
+	}
+	if wait := date.Sub(now); wait > 0 {
+		return wait, true
+	}
+	return 0, true
+}
+
+//Sleep waits the provided duration or until the context is done.
+//It returns false, without waiting, when the context deadline expires before the wait ends
+func Sleep(ctx context.Context, wait time.Duration) bool {
+	if deadline, ok := ctx.Deadline(); ok && time.Now().Add(wait).After(deadline) {
+		return false
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
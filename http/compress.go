@@ -0,0 +1,311 @@
+package http
+
+import (
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zlib"
+	"github.com/rjansen/haki"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+//Compressor is a content encoding writer that can be flushed and reused by the compression wrapper
+type Compressor interface {
+	io.WriteCloser
+	Flush() error
+	Reset(io.Writer)
+}
+
+//CompressorFunc creates a Compressor that writes into w using the provided compression level
+type CompressorFunc func(w io.Writer, level int) (Compressor, error)
+
+//CompressOptions holds the response compression settings
+type CompressOptions struct {
+	//Encodings are the content codings in server preference order, ties in the Accept-Encoding quality are resolved by it
+	Encodings []string
+	//Level is the compression level handed to the CompressorFunc of the negotiated encoding
+	Level int
+	//MinSize is the min body size in bytes to compress, smaller bodies are sent as is
+	MinSize int
+}
+
+var (
+	//DefaultCompressOptions are the settings used by the Compress wrapper
+	DefaultCompressOptions = CompressOptions{
+		Encodings: []string{"gzip", "deflate"},
+		Level:     gzip.DefaultCompression,
+		MinSize:   1024,
+	}
+	//IncompressibleContentTypes are the Content-Type prefixes of already compressed bodies that are never compressed again
+	IncompressibleContentTypes = []string{
+		"image/jpeg", "image/png", "image/gif", "image/webp",
+		"video/", "audio/", "font/woff",
+		"application/zip", "application/gzip", "application/x-gzip",
+		"application/x-bzip2", "application/x-7z-compressed", "application/x-rar-compressed",
+	}
+
+	compressorsMutex sync.RWMutex
+	compressors      = map[string]CompressorFunc{
+		"gzip": func(w io.Writer, level int) (Compressor, error) {
+			return gzip.NewWriterLevel(w, level)
+		},
+		"deflate": func(w io.Writer, level int) (Compressor, error) {
+			return zlib.NewWriterLevel(w, level)
+		},
+	}
+	compressorPools = make(map[string]*sync.Pool)
+)
+
+//RegisterCompressor adds or replaces the CompressorFunc of a content coding, like br or zstd.
+//The encoding also needs to be listed in CompressOptions.Encodings to be negotiated
+func RegisterCompressor(encoding string, newCompressor CompressorFunc) {
+	compressorsMutex.Lock()
+	defer compressorsMutex.Unlock()
+	compressors[encoding] = newCompressor
+	for key := range compressorPools {
+		if strings.HasPrefix(key, encoding+":") {
+			delete(compressorPools, key)
+		}
+	}
+}
+
+func compressorPool(encoding string, level int) *sync.Pool {
+	key := encoding + ":" + strconv.Itoa(level)
+	compressorsMutex.RLock()
+	pool, found := compressorPools[key]
+	compressorsMutex.RUnlock()
+	if found {
+		return pool
+	}
+	compressorsMutex.Lock()
+	defer compressorsMutex.Unlock()
+	if pool, found = compressorPools[key]; !found {
+		pool = new(sync.Pool)
+		compressorPools[key] = pool
+	}
+	return pool
+}
+
+func newCompressor(encoding string, level int, w io.Writer) (Compressor, *sync.Pool, error) {
+	pool := compressorPool(encoding, level)
+	if c, ok := pool.Get().(Compressor); ok {
+		c.Reset(w)
+		return c, pool, nil
+	}
+	compressorsMutex.RLock()
+	newFunc := compressors[encoding]
+	compressorsMutex.RUnlock()
+	c, err := newFunc(w, level)
+	return c, pool, err
+}
+
+//negotiateEncoding returns the accepted encoding with the highest quality, or empty when none is acceptable
+func negotiateEncoding(acceptEncoding string, encodings []string) string {
+	if acceptEncoding == "" {
+		return ""
+	}
+	accepted := make(map[string]float64)
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		name, quality := part, 1.0
+		if i := strings.Index(part, ";"); i >= 0 {
+			name = part[:i]
+			param := strings.TrimSpace(part[i+1:])
+			if strings.HasPrefix(param, "q=") {
+				if q, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					quality = q
+				}
+			}
+		}
+		accepted[strings.ToLower(strings.TrimSpace(name))] = quality
+	}
+	var best string
+	var bestQuality float64
+	compressorsMutex.RLock()
+	defer compressorsMutex.RUnlock()
+	for _, encoding := range encodings {
+		if _, registered := compressors[encoding]; !registered {
+			continue
+		}
+		quality, found := accepted[encoding]
+		if !found {
+			quality, found = accepted["*"]
+		}
+		if found && quality > bestQuality {
+			best, bestQuality = encoding, quality
+		}
+	}
+	return best
+}
+
+type compressResponseWriter struct {
+	*responseWriter
+	options    *CompressOptions
+	encoding   string
+	status     int
+	buf        []byte
+	decided    bool
+	compressor Compressor
+	pool       *sync.Pool
+}
+
+func (w *compressResponseWriter) WriteHeader(s int) {
+	if w.status != 0 {
+		return
+	}
+	w.status = s
+	if !bodyAllowed(s) {
+		w.start(false)
+	}
+}
+
+func (w *compressResponseWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	w.responseWriter.rawSize += len(b)
+	if w.decided {
+		if w.compressor != nil {
+			return w.compressor.Write(b)
+		}
+		return w.responseWriter.Write(b)
+	}
+	if !w.compressible() {
+		if err := w.start(false); err != nil {
+			return 0, err
+		}
+		return w.responseWriter.Write(b)
+	}
+	w.buf = append(w.buf, b...)
+	if len(w.buf) >= w.options.MinSize {
+		if err := w.start(true); err != nil {
+			return 0, err
+		}
+	}
+	return len(b), nil
+}
+
+func (w *compressResponseWriter) Flush() {
+	if !w.decided {
+		if w.status == 0 {
+			w.status = http.StatusOK
+		}
+		w.start(w.compressible())
+	}
+	if w.compressor != nil {
+		w.compressor.Flush()
+	}
+	w.responseWriter.Flush()
+}
+
+func (w *compressResponseWriter) Status() int {
+	if w.status != 0 {
+		return w.status
+	}
+	return w.responseWriter.Status()
+}
+
+func (w *compressResponseWriter) Written() bool {
+	return w.status != 0 || w.responseWriter.Written()
+}
+
+func (w *compressResponseWriter) compressible() bool {
+	if w.encoding == "" || !bodyAllowed(w.status) {
+		return false
+	}
+	header := w.Header()
+	if header.Get(haki.ContentEncodingHeader) != "" {
+		return false
+	}
+	contentType := header.Get(haki.ContentTypeHeader)
+	for _, incompressible := range IncompressibleContentTypes {
+		if strings.HasPrefix(contentType, incompressible) {
+			return false
+		}
+	}
+	return true
+}
+
+func (w *compressResponseWriter) start(compress bool) error {
+	w.decided = true
+	if w.status == 0 {
+		return nil
+	}
+	if compress {
+		compressor, pool, err := newCompressor(w.encoding, w.options.Level, w.responseWriter)
+		if err != nil {
+			return err
+		}
+		w.compressor, w.pool = compressor, pool
+		w.responseWriter.encoded = true
+		w.Header().Set(haki.ContentEncodingHeader, w.encoding)
+		w.Header().Del(haki.ContentLengthHeader)
+	}
+	w.responseWriter.WriteHeader(w.status)
+	if len(w.buf) == 0 {
+		return nil
+	}
+	var err error
+	if w.compressor != nil {
+		_, err = w.compressor.Write(w.buf)
+	} else {
+		_, err = w.responseWriter.Write(w.buf)
+	}
+	w.buf = nil
+	return err
+}
+
+func (w *compressResponseWriter) close() error {
+	if !w.decided {
+		return w.start(false)
+	}
+	if w.compressor == nil {
+		return nil
+	}
+	err := w.compressor.Close()
+	w.pool.Put(w.compressor)
+	w.compressor = nil
+	return err
+}
+
+func bodyAllowed(status int) bool {
+	return status == 0 || (status >= 200 && status != http.StatusNoContent && status != http.StatusNotModified)
+}
+
+func compressHandle(options *CompressOptions, handler HTTPHandlerFunc, w http.ResponseWriter, r *http.Request) error {
+	w.Header().Add(haki.VaryHeader, haki.AcceptEncodingHeader)
+	var encoding string
+	if r.Method != http.MethodHead {
+		encoding = negotiateEncoding(r.Header.Get(haki.AcceptEncodingHeader), options.Encodings)
+	}
+	rw, ok := w.(*responseWriter)
+	if !ok {
+		rw = NewResponseWriter(w).(*responseWriter)
+	}
+	cw := &compressResponseWriter{
+		responseWriter: rw,
+		options:        options,
+		encoding:       encoding,
+	}
+	err := handler(cw, r)
+	if closeErr := cw.close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+//CompressWith returns a wrapper that compresses the response body with the provided settings.
+//Wrap it inside Log or Audit, like Wrap(handler, Compress, Log), to log both body sizes
+func CompressWith(options CompressOptions) HTTPHandlerWrapper {
+	return func(handler HTTPHandlerFunc) HTTPHandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) error {
+			return compressHandle(&options, handler, w, r)
+		}
+	}
+}
+
+//Compress wraps the provided HTTPHandlerFunc with response compression negotiated by the Accept-Encoding header
+func Compress(handler HTTPHandlerFunc) HTTPHandlerFunc {
+	return CompressWith(DefaultCompressOptions)(handler)
+}
@@ -0,0 +1,45 @@
+package http
+
+import (
+	"errors"
+	"github.com/rjansen/haki"
+	"github.com/rjansen/haki/concurrency"
+	"github.com/rjansen/l"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+func concurrencyLimitHandle(limiter *concurrency.Limiter, handler HTTPHandlerFunc, w http.ResponseWriter, r *http.Request) error {
+	if !limiter.Acquire(r.Context().Done()) {
+		stats := limiter.Stats()
+		l.Warn("haki.http.RequestShed",
+			l.String("path", r.URL.Path),
+			l.Int("limit", stats.Limit),
+			l.Int("inFlight", stats.InFlight),
+			l.Uint64("rejected", stats.Rejected),
+		)
+		w.Header().Set(haki.RetryAfterHeader, strconv.FormatInt(haki.Seconds(limiter.RetryAfter()), 10))
+		return haki.ErrServiceUnavailable
+	}
+	//The same request time reported by the Log and Audit wrappers feeds the adaptive limit
+	start := time.Now()
+	failed := true
+	defer func() {
+		limiter.Release(time.Since(start), failed)
+	}()
+	err := handler(w, r)
+	//Client errors say nothing about the service health and the shed of a nested limiter is not a slow request
+	failed = err != nil && haki.ErrStatus(err) >= http.StatusInternalServerError && !errors.Is(err, haki.ErrServiceUnavailable)
+	return err
+}
+
+//ConcurrencyLimit creates a wrapper that bounds the requests in flight with the provided Limiter.
+//Shed requests return haki.ErrServiceUnavailable that the Error and Audit wrappers renders as a 503 response
+func ConcurrencyLimit(limiter *concurrency.Limiter) HTTPHandlerWrapper {
+	return func(handler HTTPHandlerFunc) HTTPHandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) error {
+			return concurrencyLimitHandle(limiter, handler, w, r)
+		}
+	}
+}
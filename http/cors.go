@@ -0,0 +1,28 @@
+package http
+
+import (
+	"github.com/rjansen/haki/cors"
+	"net/http"
+)
+
+func corsHandle(policy *cors.Policy, handler HTTPHandlerFunc, w http.ResponseWriter, r *http.Request) error {
+	preflight := policy.Handle(w.Header(), r.Method,
+		r.Header.Get(cors.OriginHeader),
+		r.Header.Get(cors.RequestMethodHeader),
+		r.Header.Get(cors.RequestHeadersHeader),
+	)
+	if preflight {
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+	return handler(w, r)
+}
+
+//CORS creates a wrapper that writes the cross origin headers of the policy and answers the preflight requests
+func CORS(policy *cors.Policy) HTTPHandlerWrapper {
+	return func(handler HTTPHandlerFunc) HTTPHandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) error {
+			return corsHandle(policy, handler, w, r)
+		}
+	}
+}
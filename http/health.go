@@ -0,0 +1,42 @@
+package http
+
+import (
+	"github.com/rjansen/haki/health"
+	"github.com/rjansen/l"
+	"net/http"
+)
+
+func healthHandle(registry *health.Registry, kind health.Kind, w http.ResponseWriter, r *http.Request) error {
+	report := registry.Run(r.Context(), kind)
+	if report.Status != health.StatusUp {
+		logger, _ := auditLogger(r)
+		logger.Warn("haki.http.Health",
+			l.String("status", string(report.Status)),
+			l.Struct("checks", report.Checks),
+		)
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	return JSON(w, report.Code(), report)
+}
+
+//Health creates a handler that runs the registry checks of the kind and writes the JSON report, 503 when it is down
+func Health(registry *health.Registry, kind health.Kind) HTTPHandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		return healthHandle(registry, kind, w, r)
+	}
+}
+
+//Healthz creates the /healthz handler with all the registry checks
+func Healthz(registry *health.Registry) HTTPHandlerFunc {
+	return Health(registry, health.Health)
+}
+
+//Readyz creates the /readyz handler, down before the registry Setup and during the graceful shutdown
+func Readyz(registry *health.Registry) HTTPHandlerFunc {
+	return Health(registry, health.Readiness)
+}
+
+//Livez creates the /livez handler with the registry Liveness checks
+func Livez(registry *health.Registry) HTTPHandlerFunc {
+	return Health(registry, health.Liveness)
+}
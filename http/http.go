@@ -1,11 +1,21 @@
 package http
 
 import (
+	"bytes"
 	"context"
 	"github.com/rjansen/haki"
+	"github.com/rjansen/haki/media/cbor"
+	"github.com/rjansen/haki/media/form"
 	"github.com/rjansen/haki/media/json"
+	"github.com/rjansen/haki/media/jsonpb"
+	"github.com/rjansen/haki/media/msgpack"
+	"github.com/rjansen/haki/media/proto"
+	"github.com/rjansen/haki/media/text"
+	"github.com/rjansen/haki/media/xml"
 	"github.com/rjansen/l"
 	"github.com/satori/go.uuid"
+	"io"
+	"mime"
 	"net/http"
 	"strings"
 	"time"
@@ -24,6 +34,22 @@ type ResponseWriter interface {
 	Size() int
 }
 
+// WireSizer is implemented by the ResponseWriter that knows the size of the
+// response body sent to the client, after any content encoding.
+type WireSizer interface {
+	// WireSize returns the size of the response body sent to the client, after
+	// any content encoding. It equals Size when the body is not encoded.
+	WireSize() int
+}
+
+// wireSize returns the WireSize of the WireSizer or the Size of the other ResponseWriter
+func wireSize(w ResponseWriter) int {
+	if sizer, ok := w.(WireSizer); ok {
+		return sizer.WireSize()
+	}
+	return w.Size()
+}
+
 // NewResponseWriter creates a ResponseWriter that wraps an http.ResponseWriter
 func NewResponseWriter(w http.ResponseWriter) ResponseWriter {
 	return &responseWriter{
@@ -33,8 +59,10 @@ func NewResponseWriter(w http.ResponseWriter) ResponseWriter {
 
 type responseWriter struct {
 	http.ResponseWriter
-	status int
-	size   int
+	status  int
+	size    int
+	rawSize int
+	encoded bool
 }
 
 func (w *responseWriter) WriteHeader(s int) {
@@ -57,6 +85,13 @@ func (w *responseWriter) Status() int {
 }
 
 func (w *responseWriter) Size() int {
+	if w.encoded {
+		return w.rawSize
+	}
+	return w.size
+}
+
+func (w *responseWriter) WireSize() int {
 	return w.size
 }
 
@@ -64,6 +99,11 @@ func (w *responseWriter) Written() bool {
 	return w.status != 0
 }
 
+//Unwrap returns the original ResponseWriter, used by http.ResponseController to hijack the connections
+func (w *responseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
 func (w *responseWriter) Flush() {
 	flusher, ok := w.ResponseWriter.(http.Flusher)
 	if ok {
@@ -113,7 +153,7 @@ func Handler(handler HTTPHandlerFunc) http.HandlerFunc {
 
 func errorHandle(handler HTTPHandlerFunc, w http.ResponseWriter, r *http.Request) error {
 	if err := handler(w, r); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		http.Error(w, err.Error(), haki.ErrStatus(err))
 		return err
 	}
 	return nil
@@ -157,6 +197,7 @@ func logHandle(handler HTTPHandlerFunc, w http.ResponseWriter, r *http.Request)
 	logger.Info("haki.http.Response",
 		l.String("status", http.StatusText(response.Status())),
 		l.Int("size", response.Size()),
+		l.Int("wireSize", wireSize(response)),
 		l.Duration("requestTime", time.Since(start)),
 	)
 	return err
@@ -185,10 +226,21 @@ func auditHandle(handler HTTPHandlerFunc, w http.ResponseWriter, r *http.Request
 	w.Header().Set(haki.RequestContextHeader, cid)
 
 	r = set(r, ContextKeys.TID, tid)
-	r = set(r, ContextKeys.CID, tid)
+	if cid == "" {
+		r = set(r, ContextKeys.CID, tid)
+	} else {
+		r = set(r, ContextKeys.CID, cid)
+	}
+	//Keeps the incoming credentials and trace for the outbound calls, see the http/client package
+	if traceParent := r.Header.Get(haki.TraceParentHeader); traceParent != "" {
+		r = set(r, ContextKeys.TRACE, traceParent)
+	}
+	if authorization := r.Header.Get(haki.AuthorizationHeader); authorization != "" {
+		r = set(r, ContextKeys.AUTHORIZATION, authorization)
+	}
 
 	identity := &Identity{
-		Token: "tanonymous",
+		Token: AnonymousToken,
 		Value: map[string]interface{}{
 			"ID":   "uanonymous",
 			"Name": "User Anonymous",
@@ -227,6 +279,7 @@ func auditHandle(handler HTTPHandlerFunc, w http.ResponseWriter, r *http.Request
 	auditor.Info("haki.http.Response",
 		l.String("status", http.StatusText(response.Status())),
 		l.Int("size", response.Size()),
+		l.Int("wireSize", wireSize(response)),
 		l.Duration("requestTime", time.Since(start)),
 	)
 	return err
@@ -247,14 +300,47 @@ func (h AuditHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	auditHandle(HTTPHandlerFunc(h), w, r)
 }
 
-//ReadByContentType reads data from context using the Content-Type header to define the media type
+//DecodeBody replaces the request body by its decoded content when the Content-Encoding header is present
+func DecodeBody(r *http.Request) error {
+	contentEncoding := r.Header.Get(haki.ContentEncodingHeader)
+	if contentEncoding == "" {
+		return nil
+	}
+	body, err := haki.ContentDecoder(contentEncoding, r.Body)
+	if err != nil {
+		return err
+	}
+	r.Body = body
+	r.Header.Del(haki.ContentEncodingHeader)
+	r.Header.Del(haki.ContentLengthHeader)
+	r.ContentLength = -1
+	return nil
+}
+
+//ReadByContentType reads data from context using the Content-Type header to define the media type.
+//Bodies with gzip or deflate Content-Encoding are decoded before the read
 func ReadByContentType(r *http.Request, data interface{}) error {
+	if err := DecodeBody(r); err != nil {
+		return err
+	}
 	contentType := r.Header.Get(haki.ContentTypeHeader)
 	switch {
 	case strings.Contains(contentType, json.ContentType):
 		return ReadJSON(r, data)
-	// case strings.Contains(contentType, proto.ContentType):
-	// 	return ReadProtoBuff(r, data)
+	case strings.Contains(contentType, proto.ContentType):
+		return ReadProtoBuff(r, data)
+	case strings.Contains(contentType, msgpack.ContentType):
+		return ReadMsgPack(r, data)
+	case strings.Contains(contentType, cbor.ContentType):
+		return ReadCBOR(r, data)
+	case strings.Contains(contentType, xml.ContentType), strings.Contains(contentType, xml.ContentTypeText):
+		return ReadXML(r, data)
+	case strings.Contains(contentType, text.ContentType):
+		return ReadText(r, data)
+	case strings.Contains(contentType, form.ContentType):
+		return ReadForm(r, data)
+	case strings.Contains(contentType, form.MultipartContentType):
+		return ReadMultipart(r, form.DefaultLimits, data, nil)
 	default:
 		return haki.ErrInvalidContentType
 	}
@@ -266,21 +352,148 @@ func WriteByAccept(w http.ResponseWriter, r *http.Request, status int, result in
 	switch {
 	case strings.Contains(contentType, json.ContentType):
 		return JSON(w, status, result)
-	// case bytes.Contains(contentType, []byte(proto.ContentType)):
-	// 	return ProtoBuff(ctx, status, result)
+	case strings.Contains(contentType, proto.ContentType):
+		return ProtoBuff(w, status, result)
+	case strings.Contains(contentType, msgpack.ContentType):
+		return MsgPack(w, status, result)
+	case strings.Contains(contentType, cbor.ContentType):
+		return CBOR(w, status, result)
+	case strings.Contains(contentType, xml.ContentType), strings.Contains(contentType, xml.ContentTypeText):
+		return XML(w, status, result)
+	case strings.Contains(contentType, text.ContentType):
+		return Text(w, status, result)
 	default:
 		return haki.ErrInvalidAccept
 	}
 }
 
-//ReadJSON unmarshals from provided context a json media into data
+//ReadJSON unmarshals from provided context a json media into data.
+//Protocol buffer messages are read using the proto3 json mapping
 func ReadJSON(r *http.Request, data interface{}) error {
+	if jsonpb.IsMessage(data) {
+		return jsonpb.Unmarshal(r.Body, data)
+	}
 	if err := json.Unmarshal(r.Body, data); err != nil {
 		return err
 	}
 	return nil
 }
 
+//ReadProtoBuff unmarshals from provided request a protocol buffer media into data
+func ReadProtoBuff(r *http.Request, data interface{}) error {
+	if err := proto.Unmarshal(r.Body, data); err != nil {
+		return err
+	}
+	return nil
+}
+
+//ReadMsgPack unmarshals from provided request a msgpack media into data
+func ReadMsgPack(r *http.Request, data interface{}) error {
+	if err := msgpack.Unmarshal(r.Body, data); err != nil {
+		return err
+	}
+	return nil
+}
+
+//ReadCBOR unmarshals from provided request a cbor media into data
+func ReadCBOR(r *http.Request, data interface{}) error {
+	if err := cbor.Unmarshal(r.Body, data); err != nil {
+		return err
+	}
+	return nil
+}
+
+//ReadXML unmarshals from provided request a xml media into data
+func ReadXML(r *http.Request, data interface{}) error {
+	if err := xml.Unmarshal(r.Body, data); err != nil {
+		return err
+	}
+	return nil
+}
+
+//ReadText reads from provided request a plain text media into data
+func ReadText(r *http.Request, data interface{}) error {
+	if err := text.Unmarshal(r.Body, data); err != nil {
+		return err
+	}
+	return nil
+}
+
+//ReadForm unmarshals from provided request a url encoded form media into data.
+//Bodies larger than form.MaxFormSize return a 413 haki.ErrBodyTooLarge
+func ReadForm(r *http.Request, data interface{}) error {
+	var body io.Reader = r.Body
+	if form.MaxFormSize > 0 {
+		body = io.LimitReader(r.Body, form.MaxFormSize+1)
+	}
+	var buf bytes.Buffer
+	if _, err := buf.ReadFrom(body); err != nil {
+		return err
+	}
+	if form.MaxFormSize > 0 && int64(buf.Len()) > form.MaxFormSize {
+		return haki.ErrBodyTooLarge
+	}
+	if err := form.UnmarshalBytes(buf.Bytes(), data); err != nil {
+		return err
+	}
+	return nil
+}
+
+//ReadMultipart reads from provided request a multipart form media.
+//Value parts are decoded into data and file parts are passed to handle, both bounded by the provided limits
+func ReadMultipart(r *http.Request, limits form.Limits, data interface{}, handle form.PartFunc) error {
+	_, params, err := mime.ParseMediaType(r.Header.Get(haki.ContentTypeHeader))
+	if err != nil {
+		return err
+	}
+	boundary := params["boundary"]
+	if boundary == "" {
+		return http.ErrMissingBoundary
+	}
+	return form.ReadMultipart(r.Body, boundary, limits, data, handle)
+}
+
+//ReadProtoBuffStream reads from provided request a varint length-delimited protocol buffer stream.
+//For each message, newMsg must return a new message reference that is decoded and passed to handle
+func ReadProtoBuffStream(r *http.Request, maxSize int, newMsg func() interface{}, handle func(interface{}) error) error {
+	decoder := proto.NewDecoder(r.Body)
+	decoder.MaxSize = maxSize
+	for {
+		msg := newMsg()
+		if err := decoder.Decode(msg); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		if err := handle(msg); err != nil {
+			return err
+		}
+	}
+}
+
+type flushWriter struct {
+	w http.ResponseWriter
+}
+
+func (f flushWriter) Write(b []byte) (int, error) {
+	n, err := f.w.Write(b)
+	if flusher, ok := f.w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+	return n, err
+}
+
+//ProtoBuffStream writes a varint length-delimited protocol buffer stream to the response.
+//The stream func encodes the messages and each one is flushed to the client as soon as it was written
+func ProtoBuffStream(w http.ResponseWriter, status int, maxSize int, stream func(*proto.Encoder) error) error {
+	w.Header().Set(haki.ContentTypeHeader, proto.DelimitedContentType)
+	w.WriteHeader(status)
+	encoder := proto.NewEncoder(flushWriter{w: w})
+	encoder.MaxSize = maxSize
+	return stream(encoder)
+}
+
 func Bytes(w http.ResponseWriter, status int, result []byte) error {
 	w.Header().Set(haki.ContentTypeHeader, "application/octet-stream")
 	w.WriteHeader(status)
@@ -291,22 +504,87 @@ func Bytes(w http.ResponseWriter, status int, result []byte) error {
 	return nil
 }
 
+//JSON writes the provided json media to the response.
+//Protocol buffer messages are written using the proto3 json mapping
 func JSON(w http.ResponseWriter, status int, result interface{}) error {
 	w.Header().Set(haki.ContentTypeHeader, json.ContentType)
 	w.WriteHeader(status)
+	if jsonpb.IsMessage(result) {
+		return jsonpb.Marshal(w, result)
+	}
 	if err := json.Marshal(w, result); err != nil {
 		return err
 	}
 	return nil
 }
 
+//ProtoBuff writes the provided protocol buffer media to the response
+func ProtoBuff(w http.ResponseWriter, status int, result interface{}) error {
+	protoBytes, err := proto.MarshalBytes(result)
+	if err != nil {
+		return err
+	}
+	w.Header().Set(haki.ContentTypeHeader, proto.ContentType)
+	w.WriteHeader(status)
+	_, err = w.Write(protoBytes)
+	return err
+}
+
+//MsgPack writes the provided msgpack media to the response
+func MsgPack(w http.ResponseWriter, status int, result interface{}) error {
+	msgpackBytes, err := msgpack.MarshalBytes(result)
+	if err != nil {
+		return err
+	}
+	w.Header().Set(haki.ContentTypeHeader, msgpack.ContentType)
+	w.WriteHeader(status)
+	_, err = w.Write(msgpackBytes)
+	return err
+}
+
+//CBOR writes the provided cbor media to the response
+func CBOR(w http.ResponseWriter, status int, result interface{}) error {
+	cborBytes, err := cbor.MarshalBytes(result)
+	if err != nil {
+		return err
+	}
+	w.Header().Set(haki.ContentTypeHeader, cbor.ContentType)
+	w.WriteHeader(status)
+	_, err = w.Write(cborBytes)
+	return err
+}
+
+//XML writes the provided xml media to the response
+func XML(w http.ResponseWriter, status int, result interface{}) error {
+	xmlBytes, err := xml.MarshalBytes(result)
+	if err != nil {
+		return err
+	}
+	w.Header().Set(haki.ContentTypeHeader, xml.ContentTypeUTF8)
+	w.WriteHeader(status)
+	_, err = w.Write(xmlBytes)
+	return err
+}
+
+//Text writes the provided plain text media to the response
+func Text(w http.ResponseWriter, status int, result interface{}) error {
+	textBytes, err := text.MarshalBytes(result)
+	if err != nil {
+		return err
+	}
+	w.Header().Set(haki.ContentTypeHeader, text.ContentTypeUTF8)
+	w.WriteHeader(status)
+	_, err = w.Write(textBytes)
+	return err
+}
+
 func Status(w http.ResponseWriter, status int) error {
 	w.WriteHeader(status)
 	return nil
 }
 
 func Err(w http.ResponseWriter, err error) error {
-	http.Error(w, err.Error(), http.StatusInternalServerError)
+	http.Error(w, err.Error(), haki.ErrStatus(err))
 	return err
 }
 
@@ -1,19 +1,52 @@
 package http
 
 import (
+	"bufio"
 	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
 	"errors"
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zlib"
 	"github.com/rjansen/haki"
+	"github.com/rjansen/haki/apikey"
+	"github.com/rjansen/haki/auth"
+	"github.com/rjansen/haki/authz"
+	"github.com/rjansen/haki/concurrency"
+	"github.com/rjansen/haki/cors"
+	"github.com/rjansen/haki/health"
+	"github.com/rjansen/haki/media/cbor"
+	"github.com/rjansen/haki/media/form"
 	"github.com/rjansen/haki/media/json"
+	"github.com/rjansen/haki/media/msgpack"
+	"github.com/rjansen/haki/media/proto"
+	"github.com/rjansen/haki/media/text"
+	"github.com/rjansen/haki/media/xml"
+	"github.com/rjansen/haki/proxy"
+	"github.com/rjansen/haki/ratelimit"
+	"github.com/rjansen/haki/secure"
+	"github.com/rjansen/haki/session"
 	"github.com/rjansen/l"
 	"github.com/rjansen/l/zap"
 	"github.com/stretchr/testify/assert"
+	"io"
 	"io/ioutil"
+	"math/big"
+	"mime/multipart"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"path/filepath"
 	// "os"
 	"strings"
 	"testing"
+	"time"
 )
 
 func init() {
@@ -289,72 +322,99 @@ func TestJSONResultByAccept(t *testing.T) {
 	assert.True(t, strings.Contains(rec.Header().Get(haki.ContentTypeHeader), "application/json"), "Response.ContenType is not application/json")
 }
 
-// func TestProtoResult(t *testing.T) {
-// 	media := &proto.Store{
-// 		Id:   1,
-// 		Name: "Proto Buffer Store",
-// 		Data: []*proto.Store_Data{
-// 			&proto.Store_Data{
-// 				Id:    1,
-// 				Name:  "Proto Data Name",
-// 				Email: "Proto Data Email",
-// 			},
-// 		},
-// 	}
-
-// 	uri := "http://resultprotobuf/"
-
-// 	var ctx fasthttp.RequestCtx
-// 	var req fasthttp.Request
-// 	req.SetRequestURI(uri)
-// 	ctx.Init(&req, nil, nil)
-
-// 	var resultErr error
-// 	assert.NotPanics(t, func() {
-// 		resultErr = ProtoBuff(&ctx, fasthttp.StatusOK, media)
-// 	})
-
-// 	assert.Nil(t, resultErr)
-// 	assert.Equal(t, fasthttp.StatusOK, ctx.Response.StatusCode())
-// 	assert.NotEmpty(t, ctx.Response.Body())
-// 	//TODO: Check better if body content is the correct protocol buffer of the message
-// 	assert.True(t, bytes.Contains(ctx.Response.Body(), []byte(media.Name)), "Response.Body does not contain media.Name")
-// 	assert.True(t, bytes.Contains(ctx.Response.Header.ContentType(), []byte("application/octet-stream")), "Response.ContenType is not application/octet-stream")
-// }
-
-// func TestProtoByContentType(t *testing.T) {
-// 	media := &proto.Store{
-// 		Id:   1,
-// 		Name: "Proto Buffer Store",
-// 		Data: []*proto.Store_Data{
-// 			&proto.Store_Data{
-// 				Id:    1,
-// 				Name:  "Proto Data Name",
-// 				Email: "Proto Data Email",
-// 			},
-// 		},
-// 	}
-
-// 	uri := "http://resultprototype/"
-
-// 	var ctx fasthttp.RequestCtx
-// 	var req fasthttp.Request
-// 	req.SetRequestURI(uri)
-// 	req.Header.Set("Accept", "application/octet-stream")
-// 	ctx.Init(&req, nil, nil)
-
-// 	var resultErr error
-// 	assert.NotPanics(t, func() {
-// 		resultErr = WriteByAccept(&ctx, fasthttp.StatusOK, media)
-// 	})
-
-// 	assert.Nil(t, resultErr)
-// 	assert.Equal(t, fasthttp.StatusOK, ctx.Response.StatusCode())
-// 	assert.NotEmpty(t, ctx.Response.Body())
-// 	//TODO: Check better if body content is the correct protocol buffer of the message
-// 	assert.True(t, bytes.Contains(ctx.Response.Body(), []byte(media.Name)), "Response.Body does not contain media.Name")
-// 	assert.True(t, bytes.Contains(ctx.Response.Header.ContentType(), []byte("application/octet-stream")), "Response.ContenType is not application/octect-stream")
-// }
+func TestProtoResult(t *testing.T) {
+	media := &proto.Store{
+		Id:   1,
+		Name: "Proto Buffer Store",
+		Data: []*proto.Store_Data{
+			&proto.Store_Data{
+				Id:    1,
+				Name:  "Proto Data Name",
+				Email: "Proto Data Email",
+			},
+		},
+	}
+
+	rec := httptest.NewRecorder()
+	var resultErr error
+	assert.NotPanics(t, func() {
+		resultErr = ProtoBuff(rec, http.StatusOK, media)
+	})
+
+	assert.Nil(t, resultErr)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.NotEmpty(t, rec.Body.Bytes())
+	result := new(proto.Store)
+	assert.Nil(t, proto.UnmarshalBytes(rec.Body.Bytes(), result))
+	assert.Equal(t, media.Name, result.Name)
+	assert.True(t, strings.Contains(rec.Header().Get(haki.ContentTypeHeader), "application/octet-stream"), "Response.ContenType is not application/octet-stream")
+}
+
+func TestProtoByAccept(t *testing.T) {
+	media := &proto.Store{
+		Id:   1,
+		Name: "Proto Buffer Store",
+		Data: []*proto.Store_Data{
+			&proto.Store_Data{
+				Id:    1,
+				Name:  "Proto Data Name",
+				Email: "Proto Data Email",
+				Type:  proto.Store_WORK,
+			},
+		},
+	}
+
+	uri := "http://resultprototype/"
+	for _, accept := range []string{proto.ContentType, json.ContentType} {
+		rec := httptest.NewRecorder()
+		req, err := http.NewRequest("GET", uri, nil)
+		assert.Nil(t, err)
+		req.Header.Set(haki.AcceptHeader, accept)
+		var resultErr error
+		assert.NotPanics(t, func() {
+			resultErr = WriteByAccept(rec, req, http.StatusOK, media)
+		})
+
+		assert.Nil(t, resultErr)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.NotEmpty(t, rec.Body.Bytes())
+		assert.True(t, bytes.Contains(rec.Body.Bytes(), []byte(media.Name)), "Response.Body does not contain media.Name")
+		assert.True(t, strings.Contains(rec.Header().Get(haki.ContentTypeHeader), accept), "Response.ContenType is not the Accept value")
+
+		req, err = http.NewRequest("POST", uri, bytes.NewReader(rec.Body.Bytes()))
+		assert.Nil(t, err)
+		req.Header.Set(haki.ContentTypeHeader, accept)
+		result := new(proto.Store)
+		assert.Nil(t, ReadByContentType(req, result))
+		assert.Equal(t, media.Name, result.Name)
+		assert.Len(t, result.Data, 1)
+		assert.Equal(t, proto.Store_WORK, result.Data[0].Type)
+	}
+}
+
+func TestProtoJSONResult(t *testing.T) {
+	media := &proto.Store{
+		Id:   1,
+		Name: "Proto JSON Store",
+		Data: []*proto.Store_Data{
+			&proto.Store_Data{
+				Id:   1,
+				Type: proto.Store_HOME,
+			},
+		},
+	}
+
+	rec := httptest.NewRecorder()
+	var resultErr error
+	assert.NotPanics(t, func() {
+		resultErr = JSON(rec, http.StatusOK, media)
+	})
+
+	assert.Nil(t, resultErr)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.True(t, bytes.Contains(rec.Body.Bytes(), []byte(`"type":"HOME"`)), "Response.Body does not use the proto3 json mapping")
+	assert.True(t, strings.Contains(rec.Header().Get(haki.ContentTypeHeader), "application/json"), "Response.ContenType is not application/json")
+}
 
 func TestBytesResult(t *testing.T) {
 	serverMsg := []byte("this is a mock server message")
@@ -495,3 +555,1119 @@ func TestHandlerResult(t *testing.T) {
 	assert.NotEmpty(t, rec.Body.Bytes())
 	assert.Equal(t, rec.Body.Bytes(), serverMsg)
 }
+
+func TestProtoBuffStream(t *testing.T) {
+	stores := []*proto.Store{
+		&proto.Store{Id: 1, Name: "Proto Stream Store 1"},
+		&proto.Store{Id: 2, Name: "Proto Stream Store 2"},
+	}
+
+	rec := httptest.NewRecorder()
+	var resultErr error
+	assert.NotPanics(t, func() {
+		resultErr = ProtoBuffStream(rec, http.StatusOK, proto.DefaultMaxMessageSize,
+			func(e *proto.Encoder) error {
+				for _, s := range stores {
+					if err := e.Encode(s); err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+		)
+	})
+
+	assert.Nil(t, resultErr)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.True(t, rec.Flushed, "Response was not flushed")
+	assert.Equal(t, proto.DelimitedContentType, rec.Header().Get(haki.ContentTypeHeader))
+
+	uri := "http://contentprotostream/read"
+	req, err := http.NewRequest("POST", uri, bytes.NewReader(rec.Body.Bytes()))
+	assert.Nil(t, err)
+	var results []*proto.Store
+	assert.NotPanics(t, func() {
+		resultErr = ReadProtoBuffStream(req, proto.DefaultMaxMessageSize,
+			func() interface{} { return new(proto.Store) },
+			func(msg interface{}) error {
+				results = append(results, msg.(*proto.Store))
+				return nil
+			},
+		)
+	})
+
+	assert.Nil(t, resultErr)
+	assert.Len(t, results, len(stores))
+	for i, s := range stores {
+		assert.Equal(t, s.Id, results[i].Id)
+		assert.Equal(t, s.Name, results[i].Name)
+	}
+}
+
+func TestReadProtoBuffStreamErr(t *testing.T) {
+	var body bytes.Buffer
+	assert.Nil(t, proto.NewEncoder(&body).Encode(&proto.Store{Id: 1, Name: "Proto Stream Store"}))
+
+	uri := "http://contentprotostream/readerr"
+	req, err := http.NewRequest("POST", uri, bytes.NewReader(body.Bytes()))
+	assert.Nil(t, err)
+	var readErr error
+	assert.NotPanics(t, func() {
+		readErr = ReadProtoBuffStream(req, 2,
+			func() interface{} { return new(proto.Store) },
+			func(msg interface{}) error { return nil },
+		)
+	})
+	assert.Equal(t, proto.ErrMessageTooLarge, readErr)
+
+	mockErr := errors.New("MockErr")
+	req, err = http.NewRequest("POST", uri, bytes.NewReader(body.Bytes()))
+	assert.Nil(t, err)
+	readErr = ReadProtoBuffStream(req, proto.DefaultMaxMessageSize,
+		func() interface{} { return new(proto.Store) },
+		func(msg interface{}) error { return mockErr },
+	)
+	assert.Equal(t, mockErr, readErr)
+}
+
+func TestMsgPackByAccept(t *testing.T) {
+	type mockMsgPack struct {
+		Username string `json:"username"`
+		Name     string `json:"name"`
+		Age      int    `json:"age"`
+	}
+	media := &mockMsgPack{
+		Username: "TestMsgPackResult",
+		Name:     "Test MsgPack Result",
+		Age:      15,
+	}
+	uri := "http://resultmsgpack/"
+
+	rec := httptest.NewRecorder()
+	req, err := http.NewRequest("GET", uri, nil)
+	assert.Nil(t, err)
+	req.Header.Set(haki.AcceptHeader, msgpack.ContentType)
+	var resultErr error
+	assert.NotPanics(t, func() {
+		resultErr = WriteByAccept(rec, req, http.StatusOK, media)
+	})
+
+	assert.Nil(t, resultErr)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.True(t, bytes.Contains(rec.Body.Bytes(), []byte(media.Username)), "Response.Body does not contain media.Username")
+	assert.Equal(t, msgpack.ContentType, rec.Header().Get(haki.ContentTypeHeader))
+
+	req, err = http.NewRequest("POST", uri, bytes.NewReader(rec.Body.Bytes()))
+	assert.Nil(t, err)
+	req.Header.Set(haki.ContentTypeHeader, msgpack.ContentType)
+	var result mockMsgPack
+	assert.NotPanics(t, func() {
+		resultErr = ReadByContentType(req, &result)
+	})
+	assert.Nil(t, resultErr)
+	assert.Equal(t, *media, result)
+}
+
+func TestCBORByAccept(t *testing.T) {
+	type mockCBOR struct {
+		Username string `json:"username"`
+		Name     string `json:"name"`
+		Age      int    `json:"age"`
+	}
+	media := &mockCBOR{
+		Username: "TestCBORResult",
+		Name:     "Test CBOR Result",
+		Age:      15,
+	}
+	uri := "http://resultcbor/"
+
+	rec := httptest.NewRecorder()
+	req, err := http.NewRequest("GET", uri, nil)
+	assert.Nil(t, err)
+	req.Header.Set(haki.AcceptHeader, cbor.ContentType)
+	var resultErr error
+	assert.NotPanics(t, func() {
+		resultErr = WriteByAccept(rec, req, http.StatusOK, media)
+	})
+
+	assert.Nil(t, resultErr)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.True(t, bytes.Contains(rec.Body.Bytes(), []byte(media.Username)), "Response.Body does not contain media.Username")
+	assert.Equal(t, cbor.ContentType, rec.Header().Get(haki.ContentTypeHeader))
+
+	req, err = http.NewRequest("POST", uri, bytes.NewReader(rec.Body.Bytes()))
+	assert.Nil(t, err)
+	req.Header.Set(haki.ContentTypeHeader, cbor.ContentType)
+	var result mockCBOR
+	assert.NotPanics(t, func() {
+		resultErr = ReadByContentType(req, &result)
+	})
+	assert.Nil(t, resultErr)
+	assert.Equal(t, *media, result)
+}
+
+func TestXMLByAccept(t *testing.T) {
+	type mockXML struct {
+		Username string `xml:"username"`
+		Name     string `xml:"name"`
+		Age      int    `xml:"age"`
+	}
+	media := &mockXML{
+		Username: "TestXMLResult",
+		Name:     "Test XML Result",
+		Age:      15,
+	}
+	uri := "http://resultxml/"
+
+	for _, accept := range []string{xml.ContentType, xml.ContentTypeText} {
+		rec := httptest.NewRecorder()
+		req, err := http.NewRequest("GET", uri, nil)
+		assert.Nil(t, err)
+		req.Header.Set(haki.AcceptHeader, accept)
+		var resultErr error
+		assert.NotPanics(t, func() {
+			resultErr = WriteByAccept(rec, req, http.StatusOK, media)
+		})
+
+		assert.Nil(t, resultErr)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.True(t, bytes.Contains(rec.Body.Bytes(), []byte("<username>TestXMLResult</username>")), "Response.Body does not contain media.Username")
+		assert.Equal(t, xml.ContentTypeUTF8, rec.Header().Get(haki.ContentTypeHeader))
+
+		req, err = http.NewRequest("POST", uri, bytes.NewReader(rec.Body.Bytes()))
+		assert.Nil(t, err)
+		req.Header.Set(haki.ContentTypeHeader, accept)
+		var result mockXML
+		assert.NotPanics(t, func() {
+			resultErr = ReadByContentType(req, &result)
+		})
+		assert.Nil(t, resultErr)
+		assert.Equal(t, *media, result)
+	}
+}
+
+func TestTextByAccept(t *testing.T) {
+	serverMsg := "OK"
+	uri := "http://resulttext/health"
+
+	rec := httptest.NewRecorder()
+	req, err := http.NewRequest("GET", uri, nil)
+	assert.Nil(t, err)
+	req.Header.Set(haki.AcceptHeader, text.ContentType)
+	var resultErr error
+	assert.NotPanics(t, func() {
+		resultErr = WriteByAccept(rec, req, http.StatusOK, serverMsg)
+	})
+
+	assert.Nil(t, resultErr)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, serverMsg, rec.Body.String())
+	assert.Equal(t, text.ContentTypeUTF8, rec.Header().Get(haki.ContentTypeHeader))
+
+	req, err = http.NewRequest("POST", uri, bytes.NewReader(rec.Body.Bytes()))
+	assert.Nil(t, err)
+	req.Header.Set(haki.ContentTypeHeader, text.ContentTypeUTF8)
+	var result string
+	assert.NotPanics(t, func() {
+		resultErr = ReadByContentType(req, &result)
+	})
+	assert.Nil(t, resultErr)
+	assert.Equal(t, serverMsg, result)
+}
+
+type mockLoginForm struct {
+	Username string `form:"fivecolors_username"`
+	Password string `form:"fivecolors_password"`
+}
+
+func TestFormReadByContentType(t *testing.T) {
+	uri := "http://contentform/auth/login/"
+	req, err := http.NewRequest("POST", uri, bytes.NewBufferString("fivecolors_username=mock&fivecolors_password=p%40ss"))
+	assert.Nil(t, err)
+	req.Header.Set(haki.ContentTypeHeader, form.ContentType)
+
+	var readErr error
+	var media mockLoginForm
+	assert.NotPanics(t, func() {
+		readErr = ReadByContentType(req, &media)
+	})
+
+	assert.Nil(t, readErr)
+	assert.Equal(t, "mock", media.Username)
+	assert.Equal(t, "p@ss", media.Password)
+
+	maxSize := form.MaxFormSize
+	defer func() { form.MaxFormSize = maxSize }()
+	form.MaxFormSize = 16
+	req, err = http.NewRequest("POST", uri, bytes.NewBufferString("fivecolors_username=mock"))
+	assert.Nil(t, err)
+	req.Header.Set(haki.ContentTypeHeader, form.ContentType)
+	assert.Equal(t, haki.ErrBodyTooLarge, ReadByContentType(req, &media))
+}
+
+func TestMultipartRead(t *testing.T) {
+	fileContent := []byte("multipart mock file content")
+	body := new(bytes.Buffer)
+	writer := multipart.NewWriter(body)
+	assert.Nil(t, writer.WriteField("fivecolors_username", "mock"))
+	fileWriter, err := writer.CreateFormFile("avatar", "avatar.png")
+	assert.Nil(t, err)
+	_, err = fileWriter.Write(fileContent)
+	assert.Nil(t, err)
+	assert.Nil(t, writer.Close())
+	raw := body.Bytes()
+
+	uri := "http://contentmultipart/upload"
+	req, err := http.NewRequest("POST", uri, bytes.NewReader(raw))
+	assert.Nil(t, err)
+	req.Header.Set(haki.ContentTypeHeader, writer.FormDataContentType())
+
+	var readErr error
+	var media mockLoginForm
+	var content []byte
+	assert.NotPanics(t, func() {
+		readErr = ReadMultipart(req, form.DefaultLimits, &media, func(p *form.Part) error {
+			assert.Equal(t, "avatar.png", p.FileName)
+			content, err = ioutil.ReadAll(p)
+			return err
+		})
+	})
+	assert.Nil(t, readErr)
+	assert.Equal(t, "mock", media.Username)
+	assert.Equal(t, fileContent, content)
+
+	req, err = http.NewRequest("POST", uri, bytes.NewReader(raw))
+	assert.Nil(t, err)
+	req.Header.Set(haki.ContentTypeHeader, writer.FormDataContentType())
+	assert.Equal(t, form.ErrUnhandledFilePart, ReadByContentType(req, &media))
+
+	req, err = http.NewRequest("POST", uri, bytes.NewReader(raw))
+	assert.Nil(t, err)
+	req.Header.Set(haki.ContentTypeHeader, form.MultipartContentType)
+	assert.Equal(t, http.ErrMissingBoundary, ReadMultipart(req, form.DefaultLimits, &media, nil))
+}
+
+func TestNegotiateEncoding(t *testing.T) {
+	encodings := []string{"gzip", "deflate"}
+	cases := []struct {
+		acceptEncoding string
+		expected       string
+	}{
+		{"", ""},
+		{"identity", ""},
+		{"br", ""},
+		{"gzip", "gzip"},
+		{"deflate, gzip", "gzip"},
+		{"deflate;q=1.0, gzip;q=0.5", "deflate"},
+		{"gzip;q=0, deflate", "deflate"},
+		{"*", "gzip"},
+		{"GZIP", "gzip"},
+	}
+	for _, c := range cases {
+		assert.Equal(t, c.expected, negotiateEncoding(c.acceptEncoding, encodings), c.acceptEncoding)
+	}
+}
+
+func TestCompressWrapper(t *testing.T) {
+	serverMsg := bytes.Repeat([]byte("context.http_test.TestCompressWrapper "), 64)
+	uri := "http://compresshandle/compress"
+
+	var size, wireSize int
+	sizes := func(handler HTTPHandlerFunc) HTTPHandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) error {
+			rw := NewResponseWriter(w)
+			err := handler(rw, r)
+			size, wireSize = rw.Size(), rw.(WireSizer).WireSize()
+			return err
+		}
+	}
+	handler := Wrap(func(w http.ResponseWriter, r *http.Request) error {
+		w.Header().Set(haki.ContentTypeHeader, "text/plain")
+		w.WriteHeader(http.StatusAccepted)
+		_, err := w.Write(serverMsg)
+		return err
+	}, Compress, sizes)
+
+	for _, encoding := range []string{"gzip", "deflate"} {
+		rec := httptest.NewRecorder()
+		req, err := http.NewRequest("GET", uri, nil)
+		assert.Nil(t, err)
+		req.Header.Set(haki.AcceptEncodingHeader, encoding)
+		assert.NotPanics(t, func() {
+			handler(rec, req)
+		})
+
+		assert.Equal(t, http.StatusAccepted, rec.Code)
+		assert.Equal(t, encoding, rec.Header().Get(haki.ContentEncodingHeader))
+		assert.Equal(t, haki.AcceptEncodingHeader, rec.Header().Get(haki.VaryHeader))
+		assert.Equal(t, len(serverMsg), size)
+		assert.Equal(t, rec.Body.Len(), wireSize)
+		assert.True(t, wireSize < size, "Response was not compressed")
+
+		var reader io.Reader
+		if encoding == "gzip" {
+			reader, err = gzip.NewReader(rec.Body)
+		} else {
+			reader, err = zlib.NewReader(rec.Body)
+		}
+		assert.Nil(t, err)
+		body, err := ioutil.ReadAll(reader)
+		assert.Nil(t, err)
+		assert.Equal(t, serverMsg, body)
+	}
+}
+
+func TestCompressWrapperSkip(t *testing.T) {
+	largeMsg := bytes.Repeat([]byte("context.http_test.TestCompressWrapperSkip "), 64)
+	uri := "http://compresshandle/skip"
+	cases := []struct {
+		name           string
+		acceptEncoding string
+		contentType    string
+		encoding       string
+		status         int
+		body           []byte
+	}{
+		{"small", "gzip", "text/plain", "", http.StatusOK, []byte("small body")},
+		{"noaccept", "", "text/plain", "", http.StatusOK, largeMsg},
+		{"image", "gzip", "image/png", "", http.StatusOK, largeMsg},
+		{"encoded", "gzip", "text/plain", "br", http.StatusOK, largeMsg},
+		{"nocontent", "gzip", "text/plain", "", http.StatusNoContent, nil},
+	}
+	for _, c := range cases {
+		handler := Compress(func(w http.ResponseWriter, r *http.Request) error {
+			w.Header().Set(haki.ContentTypeHeader, c.contentType)
+			if c.encoding != "" {
+				w.Header().Set(haki.ContentEncodingHeader, c.encoding)
+			}
+			w.WriteHeader(c.status)
+			if c.body == nil {
+				return nil
+			}
+			_, err := w.Write(c.body)
+			return err
+		})
+		rec := httptest.NewRecorder()
+		req, err := http.NewRequest("GET", uri, nil)
+		assert.Nil(t, err)
+		req.Header.Set(haki.AcceptEncodingHeader, c.acceptEncoding)
+		assert.Nil(t, handler(rec, req), c.name)
+
+		assert.Equal(t, c.status, rec.Code, c.name)
+		assert.Equal(t, c.encoding, rec.Header().Get(haki.ContentEncodingHeader), c.name)
+		assert.Equal(t, haki.AcceptEncodingHeader, rec.Header().Get(haki.VaryHeader), c.name)
+		assert.Equal(t, len(c.body), rec.Body.Len(), c.name)
+	}
+}
+
+func TestCompressWrapperFlush(t *testing.T) {
+	uri := "http://compresshandle/flush"
+	handler := Compress(func(w http.ResponseWriter, r *http.Request) error {
+		if _, err := w.Write([]byte("first chunk")); err != nil {
+			return err
+		}
+		w.(http.Flusher).Flush()
+		_, err := w.Write([]byte("second chunk"))
+		return err
+	})
+	rec := httptest.NewRecorder()
+	req, err := http.NewRequest("GET", uri, nil)
+	assert.Nil(t, err)
+	req.Header.Set(haki.AcceptEncodingHeader, "gzip")
+	assert.Nil(t, handler(rec, req))
+
+	assert.True(t, rec.Flushed, "Response was not flushed")
+	assert.Equal(t, "gzip", rec.Header().Get(haki.ContentEncodingHeader))
+	reader, err := gzip.NewReader(rec.Body)
+	assert.Nil(t, err)
+	body, err := ioutil.ReadAll(reader)
+	assert.Nil(t, err)
+	assert.Equal(t, "first chunksecond chunk", string(body))
+}
+
+func TestJSONReadGzipBody(t *testing.T) {
+	type mockJSON struct {
+		Username string `json:"username"`
+		Age      int    `json:"age"`
+	}
+	var body bytes.Buffer
+	writer := gzip.NewWriter(&body)
+	_, err := writer.Write([]byte(`{"username": "mock-gzip.json", "age": 35}`))
+	assert.Nil(t, err)
+	assert.Nil(t, writer.Close())
+
+	uri := "http://contentjson/gzip"
+	req, err := http.NewRequest("POST", uri, bytes.NewReader(body.Bytes()))
+	assert.Nil(t, err)
+	req.Header.Set(haki.ContentTypeHeader, json.ContentType)
+	req.Header.Set(haki.ContentEncodingHeader, "gzip")
+
+	var media mockJSON
+	assert.Nil(t, ReadByContentType(req, &media))
+	assert.Equal(t, "mock-gzip.json", media.Username)
+	assert.Equal(t, 35, media.Age)
+
+	req, err = http.NewRequest("POST", uri, bytes.NewReader(body.Bytes()))
+	assert.Nil(t, err)
+	req.Header.Set(haki.ContentTypeHeader, json.ContentType)
+	req.Header.Set(haki.ContentEncodingHeader, "compress")
+	assert.Equal(t, haki.ErrInvalidContentEncoding, ReadByContentType(req, &media))
+
+	maxSize := haki.MaxDecodedBodySize
+	defer func() { haki.MaxDecodedBodySize = maxSize }()
+	haki.MaxDecodedBodySize = 8
+	handler := Wrap(func(w http.ResponseWriter, r *http.Request) error {
+		var raw string
+		if err := ReadByContentType(r, &raw); err != nil {
+			return err
+		}
+		return Status(w, http.StatusNoContent)
+	}, Error)
+	req = httptest.NewRequest("POST", uri, bytes.NewReader(body.Bytes()))
+	req.Header.Set(haki.ContentTypeHeader, text.ContentType)
+	req.Header.Set(haki.ContentEncodingHeader, "gzip")
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code, "Decoded body past the max size")
+}
+
+func TestRateLimitWrapper(t *testing.T) {
+	uri := "http://ratelimithandle/limit"
+	handler := Wrap(func(w http.ResponseWriter, r *http.Request) error {
+		return Text(w, http.StatusOK, "context.http_test.TestRateLimitWrapper")
+	}, RateLimit(ratelimit.New(ratelimit.Rate{Limit: 1, Period: time.Minute, Burst: 2}, nil), ClientIPKey), Error)
+
+	for i, remaining := range []string{"1", "0"} {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", uri, nil)
+		handler(rec, req)
+		assert.Equal(t, http.StatusOK, rec.Code, i)
+		assert.Equal(t, "2", rec.Header().Get(haki.RateLimitHeader))
+		assert.Equal(t, remaining, rec.Header().Get(haki.RateLimitRemainHeader))
+		assert.Equal(t, "", rec.Header().Get(haki.RetryAfterHeader))
+	}
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", uri, nil)
+	handler(rec, req)
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	assert.Equal(t, "0", rec.Header().Get(haki.RateLimitRemainHeader))
+	assert.Equal(t, "60", rec.Header().Get(haki.RetryAfterHeader))
+	assert.Equal(t, "120", rec.Header().Get(haki.RateLimitResetHeader))
+	assert.Equal(t, haki.ErrTooManyRequests.Error()+"\n", rec.Body.String())
+
+	rec = httptest.NewRecorder()
+	req = httptest.NewRequest("GET", uri, nil)
+	req.RemoteAddr = "192.0.2.2:1234"
+	handler(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
+
+func TestRateLimitWrapperKey(t *testing.T) {
+	limiter := ratelimit.New(ratelimit.Rate{Limit: 1, Period: time.Minute}, nil)
+	var calls int
+	handler := Audit(RateLimit(limiter, IdentityKey)(func(w http.ResponseWriter, r *http.Request) error {
+		calls++
+		return Status(w, http.StatusNoContent)
+	}))
+
+	rec := httptest.NewRecorder()
+	assert.Nil(t, handler(rec, httptest.NewRequest("GET", "http://ratelimithandle/limit", nil)))
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	rec = httptest.NewRecorder()
+	assert.Equal(t, haki.ErrTooManyRequests, handler(rec, httptest.NewRequest("GET", "http://ratelimithandle/limit", nil)))
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	assert.Equal(t, 1, calls)
+
+	//Anonymous requests from other clients have their own buckets
+	rec = httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "http://ratelimithandle/limit", nil)
+	req.RemoteAddr = "192.0.2.2:1234"
+	assert.Nil(t, handler(rec, req))
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	assert.Equal(t, 2, calls)
+	anonymous := httptest.NewRequest("GET", "http://ratelimithandle/limit", nil)
+	anonymous = setIdentity(anonymous, &Identity{Token: AnonymousToken})
+	assert.Equal(t, "192.0.2.1", IdentityKey(anonymous))
+	authenticated := setIdentity(anonymous, &Identity{Token: "tuser"})
+	assert.Equal(t, "tuser", IdentityKey(authenticated))
+
+	unlimited := RateLimit(limiter, IdentityKey)(func(w http.ResponseWriter, r *http.Request) error {
+		calls++
+		return nil
+	})
+	assert.Nil(t, unlimited(httptest.NewRecorder(), httptest.NewRequest("GET", "http://ratelimithandle/limit", nil)))
+	assert.Equal(t, 3, calls)
+	assert.Equal(t, "192.0.2.1", ClientIPKey(httptest.NewRequest("GET", "http://ratelimithandle/limit", nil)))
+}
+
+func TestConcurrencyLimitWrapper(t *testing.T) {
+	limiter := concurrency.New(concurrency.Options{Limit: 1, RetryAfter: 2 * time.Second})
+	release := make(chan struct{})
+	started := make(chan struct{})
+	handler := Wrap(func(w http.ResponseWriter, r *http.Request) error {
+		if r.URL.Path == "/slow" {
+			close(started)
+			<-release
+		}
+		if r.URL.Path == "/err" {
+			return errors.New("MockErr")
+		}
+		return Status(w, http.StatusNoContent)
+	}, ConcurrencyLimit(limiter), Error)
+
+	slow := httptest.NewRecorder()
+	done := make(chan struct{})
+	go func() {
+		handler(slow, httptest.NewRequest("GET", "http://concurrencyhandle/slow", nil))
+		close(done)
+	}()
+	<-started
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest("GET", "http://concurrencyhandle/fast", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	assert.Equal(t, "2", rec.Header().Get(haki.RetryAfterHeader))
+	assert.Equal(t, concurrency.Stats{Limit: 1, InFlight: 1, Rejected: 1}, limiter.Stats())
+
+	close(release)
+	<-done
+	assert.Equal(t, http.StatusNoContent, slow.Code)
+	rec = httptest.NewRecorder()
+	handler(rec, httptest.NewRequest("GET", "http://concurrencyhandle/err", nil))
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	assert.Equal(t, concurrency.Stats{Limit: 1, Rejected: 1}, limiter.Stats())
+}
+
+func TestConcurrencyLimitWrapperClientErrors(t *testing.T) {
+	limiter := concurrency.New(concurrency.Options{Mode: concurrency.AIMD, Limit: 4, MaxLimit: 4, Backoff: 0.5})
+	var status int
+	handler := Wrap(func(w http.ResponseWriter, r *http.Request) error {
+		switch status {
+		case http.StatusInternalServerError:
+			return errors.New("MockErr")
+		case http.StatusServiceUnavailable:
+			return haki.ErrServiceUnavailable
+		}
+		return haki.NewStatusError(status, "MockStatusErr")
+	}, ConcurrencyLimit(limiter), Error)
+
+	for _, status = range []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusNotFound, http.StatusConflict, http.StatusTooManyRequests, http.StatusServiceUnavailable} {
+		rec := httptest.NewRecorder()
+		handler(rec, httptest.NewRequest("GET", "http://concurrencyhandle/client", nil))
+		assert.Equal(t, status, rec.Code)
+	}
+	assert.Equal(t, concurrency.Stats{Limit: 4}, limiter.Stats())
+
+	status = http.StatusInternalServerError
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest("GET", "http://concurrencyhandle/server", nil))
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	assert.Equal(t, concurrency.Stats{Limit: 2}, limiter.Stats())
+}
+
+func TestCORSWrapper(t *testing.T) {
+	policy, err := cors.New(cors.Options{AllowedOrigins: []string{"http://127.0.0.1:3000"}, AllowCredentials: true})
+	assert.Nil(t, err)
+	var calls int
+	handler := Wrap(func(w http.ResponseWriter, r *http.Request) error {
+		calls++
+		return Status(w, http.StatusOK)
+	}, CORS(policy))
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest("OPTIONS", "http://corshandle/cors", nil)
+	req.Header.Set(cors.OriginHeader, "http://127.0.0.1:3000")
+	req.Header.Set(cors.RequestMethodHeader, "DELETE")
+	handler(rec, req)
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	assert.Equal(t, "http://127.0.0.1:3000", rec.Header().Get(cors.AllowOriginHeader))
+	assert.Equal(t, "true", rec.Header().Get(cors.AllowCredentialsHeader))
+	assert.NotEmpty(t, rec.Header().Get(cors.AllowMethodsHeader))
+	assert.Equal(t, 0, calls)
+
+	rec = httptest.NewRecorder()
+	req = httptest.NewRequest("GET", "http://corshandle/cors", nil)
+	req.Header.Set(cors.OriginHeader, "http://127.0.0.1:3000")
+	handler(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "http://127.0.0.1:3000", rec.Header().Get(cors.AllowOriginHeader))
+	assert.Equal(t, "X-Request-Id, X-Request-Context", rec.Header().Get(cors.ExposeHeadersHeader))
+	assert.Equal(t, "Origin", rec.Header().Get(haki.VaryHeader))
+	assert.Equal(t, 1, calls)
+
+	rec = httptest.NewRecorder()
+	handler(rec, httptest.NewRequest("OPTIONS", "http://corshandle/cors", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, 2, calls)
+}
+
+func TestSecureHeadersWrapper(t *testing.T) {
+	handler := Wrap(func(w http.ResponseWriter, r *http.Request) error {
+		return Status(w, http.StatusOK)
+	}, SecureHeaders(secure.DefaultHeaders))
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest("GET", "http://securehandle/secure", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "max-age=31536000; includeSubDomains", rec.Header().Get(secure.StrictTransportSecurityHeader))
+	assert.Equal(t, "nosniff", rec.Header().Get(secure.ContentTypeOptionsHeader))
+	assert.Equal(t, "DENY", rec.Header().Get(secure.FrameOptionsHeader))
+}
+
+func TestCSRFWrapper(t *testing.T) {
+	csrf := secure.NewCSRF(secure.CSRFOptions{Secret: []byte("secret")})
+	var calls int
+	var token, field string
+	handler := Wrap(func(w http.ResponseWriter, r *http.Request) error {
+		calls++
+		token = GetCSRFToken(r)
+		if r.Method == "POST" {
+			r.ParseForm()
+			field = r.PostForm.Get("field")
+		}
+		return Status(w, http.StatusOK)
+	}, CSRF(csrf), Error)
+
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest("GET", "http://csrfhandle/form", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	cookies := rec.Result().Cookies()
+	assert.Len(t, cookies, 1)
+	assert.Equal(t, secure.CSRFCookie, cookies[0].Name)
+	assert.Equal(t, token, cookies[0].Value)
+	assert.True(t, csrf.ValidToken(token, ""))
+
+	rec = httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "http://csrfhandle/form", strings.NewReader("field=value"))
+	req.Header.Set(haki.ContentTypeHeader, form.ContentType)
+	req.AddCookie(cookies[0])
+	handler(rec, req)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	assert.Equal(t, 1, calls)
+
+	rec = httptest.NewRecorder()
+	req = httptest.NewRequest("POST", "http://csrfhandle/form", strings.NewReader("field=value&csrf_token="+token))
+	req.Header.Set(haki.ContentTypeHeader, form.ContentType)
+	req.AddCookie(cookies[0])
+	handler(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "value", field, "Body restored for the handler")
+	assert.Empty(t, rec.Result().Cookies(), "Valid cookie token reused")
+	assert.Equal(t, 2, calls)
+
+	rec = httptest.NewRecorder()
+	req = httptest.NewRequest("DELETE", "http://csrfhandle/form", nil)
+	req.Header.Set(secure.CSRFHeader, token)
+	req.AddCookie(cookies[0])
+	handler(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, 3, calls)
+
+	rec = httptest.NewRecorder()
+	req = httptest.NewRequest("DELETE", "http://csrfhandle/form", nil)
+	req.Header.Set(secure.CSRFHeader, token)
+	handler(rec, req)
+	assert.Equal(t, http.StatusForbidden, rec.Code, "Missing cookie")
+	assert.Equal(t, 3, calls)
+
+	rec = httptest.NewRecorder()
+	req = httptest.NewRequest("POST", "http://csrfhandle/form", strings.NewReader("field=%zz&csrf_token="+token))
+	req.Header.Set(haki.ContentTypeHeader, form.ContentType)
+	req.AddCookie(cookies[0])
+	handler(rec, req)
+	assert.Equal(t, http.StatusBadRequest, rec.Code, "Malformed form")
+	assert.Equal(t, 3, calls)
+
+	maxSize := haki.MaxDecodedBodySize
+	defer func() { haki.MaxDecodedBodySize = maxSize }()
+	haki.MaxDecodedBodySize = int64(len("field=value&csrf_token=" + token))
+	rec = httptest.NewRecorder()
+	req = httptest.NewRequest("POST", "http://csrfhandle/form", strings.NewReader("field=value&csrf_token="+token))
+	req.Header.Set(haki.ContentTypeHeader, form.ContentType)
+	req.AddCookie(cookies[0])
+	handler(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code, "Body at the max size")
+	assert.Equal(t, 4, calls)
+
+	rec = httptest.NewRecorder()
+	req = httptest.NewRequest("POST", "http://csrfhandle/form", strings.NewReader("field=value&csrf_token="+token+"&"))
+	req.Header.Set(haki.ContentTypeHeader, form.ContentType)
+	req.AddCookie(cookies[0])
+	handler(rec, req)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code, "Body past the max size")
+	assert.Equal(t, 4, calls)
+
+	rec = httptest.NewRecorder()
+	req = setIdentity(httptest.NewRequest("DELETE", "http://csrfhandle/form", nil), &Identity{Token: "victim_token"})
+	req.Header.Set(secure.CSRFHeader, token)
+	req.AddCookie(cookies[0])
+	handler(rec, req)
+	assert.Equal(t, http.StatusForbidden, rec.Code, "Anonymous token planted in an authenticated request")
+	assert.Len(t, rec.Result().Cookies(), 1, "New token of the identity")
+	assert.Equal(t, 4, calls)
+}
+
+func TestSessionWrapper(t *testing.T) {
+	codec, err := session.NewSignedCodec(bytes.Repeat([]byte("k"), 32))
+	assert.Nil(t, err)
+	manager, err := session.New(session.Options{Codec: codec, Insecure: true})
+	assert.Nil(t, err)
+	var identity *Identity
+	handler := Wrap(func(w http.ResponseWriter, r *http.Request) error {
+		identity = GetIdentity(r)
+		s := GetSession(r)
+		switch r.URL.Path {
+		case "/login":
+			if err := s.SetIdentity("user_token", "user"); err != nil {
+				return err
+			}
+		case "/logout":
+			s.Destroy()
+		}
+		return Text(w, http.StatusOK, r.URL.Path)
+	}, Session(manager), Audit)
+
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest("GET", "http://sessionhandle/home", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "tanonymous", identity.Token)
+	assert.Empty(t, rec.Result().Cookies())
+
+	rec = httptest.NewRecorder()
+	handler(rec, httptest.NewRequest("POST", "http://sessionhandle/login", nil))
+	assert.Equal(t, "/login", rec.Body.String())
+	cookies := rec.Result().Cookies()
+	assert.Len(t, cookies, 1)
+	assert.Equal(t, session.DefaultCookieName, cookies[0].Name)
+	assert.True(t, cookies[0].HttpOnly)
+
+	rec = httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "http://sessionhandle/home", nil)
+	req.AddCookie(cookies[0])
+	handler(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, &Identity{Token: "user_token", Value: "user"}, identity)
+	assert.Empty(t, rec.Result().Cookies())
+
+	rec = httptest.NewRecorder()
+	req = httptest.NewRequest("POST", "http://sessionhandle/logout", nil)
+	req.AddCookie(cookies[0])
+	handler(rec, req)
+	assert.Equal(t, -1, rec.Result().Cookies()[0].MaxAge)
+}
+
+type mockUserStore map[string]*auth.User
+
+func (s mockUserStore) FindUser(username string) (*auth.User, error) {
+	return s[username], nil
+}
+
+func TestLoginHandler(t *testing.T) {
+	hash, err := auth.HashPassword("secret", 4)
+	assert.Nil(t, err)
+	authenticator := auth.NewAuthenticator(mockUserStore{"user": {Username: "user", PasswordHash: hash, Token: "user_token", Value: "user"}}, 4)
+	codec, err := session.NewSignedCodec(bytes.Repeat([]byte("k"), 32))
+	assert.Nil(t, err)
+	manager, err := session.New(session.Options{Codec: codec})
+	assert.Nil(t, err)
+	options := auth.NewLoginOptions(auth.FormConfiguration{FormUsernameField: "login", RedirectURL: "/web"})
+	handler := Wrap(Login(authenticator, options), Session(manager), Audit)
+	login := func(method string, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(method, "http://loginhandle/auth/login", strings.NewReader(body))
+		req.Header.Set(haki.ContentTypeHeader, form.ContentType)
+		handler(rec, req)
+		return rec
+	}
+
+	rec := login("POST", "login=user&password=secret")
+	assert.Equal(t, http.StatusSeeOther, rec.Code)
+	assert.Equal(t, "/web", rec.Header().Get("Location"))
+	cookies := rec.Result().Cookies()
+	assert.Len(t, cookies, 1)
+	s, err := manager.Load(cookies[0].Value)
+	assert.Nil(t, err)
+	assert.Equal(t, "user_token", s.Token)
+
+	rec = login("POST", "login=user&password=wrong")
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Empty(t, rec.Result().Cookies())
+	rec = login("POST", "login=user")
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	rec = login("GET", "")
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+	assert.Equal(t, "POST", rec.Header().Get("Allow"))
+
+	options.FailureURL = "/login?failed"
+	handler = Wrap(Login(authenticator, options), Session(manager), Audit)
+	rec = login("POST", "login=unknown&password=secret")
+	assert.Equal(t, http.StatusSeeOther, rec.Code)
+	assert.Equal(t, "/login?failed", rec.Header().Get("Location"))
+
+	handler = Wrap(Login(authenticator, options), Audit)
+	rec = login("POST", "login=user&password=secret")
+	assert.Equal(t, http.StatusInternalServerError, rec.Code, "Session wrapper missing")
+}
+
+//newUpgradeUpstream starts an upstream that answers the upgrade requests with 101 and echoes the upgraded connection
+func newUpgradeUpstream(t *testing.T) (net.Listener, chan *http.Request) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	requests := make(chan *http.Request, 1)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				reader := bufio.NewReader(conn)
+				req, err := http.ReadRequest(reader)
+				if err != nil {
+					return
+				}
+				requests <- req
+				conn.Write([]byte("HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: websocket\r\n\r\n"))
+				io.Copy(conn, reader)
+			}()
+		}
+	}()
+	return listener, requests
+}
+
+func TestProxyHandler(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Path", r.URL.Path)
+		w.Header().Set("X-Query", r.URL.RawQuery)
+		w.Header().Set("X-Hop", "upstream")
+		w.Header().Set("Connection", "X-Hop")
+		for _, header := range []string{haki.RequestIDHeader, haki.RequestContextHeader, haki.IdentityHeader, "X-Forwarded-For", "X-Forwarded-Host", "Keep-Alive", "X-Client-Hop"} {
+			w.Header().Set("X-Upstream-"+header, r.Header.Get(header))
+		}
+		if r.URL.Path == "/v1/slow" {
+			time.Sleep(100 * time.Millisecond)
+		}
+		w.WriteHeader(http.StatusCreated)
+		io.Copy(w, r.Body)
+	}))
+	defer upstream.Close()
+	router, err := proxy.NewRouter(proxy.Route{Prefix: "/api", Upstream: upstream.URL + "/v1?source=proxy", StripPrefix: true})
+	assert.Nil(t, err)
+	handler := Wrap(Proxy(router), Audit)
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "http://proxyhandle/api/users?id=1", strings.NewReader("body"))
+	req.Header.Set(haki.RequestContextHeader, "mock_cid")
+	req.Header.Set(haki.IdentityHeader, "forged_token")
+	req.Header.Set("Connection", "Keep-Alive, X-Client-Hop")
+	req.Header.Set("Keep-Alive", "timeout=5")
+	req.Header.Set("X-Client-Hop", "client")
+	handler(rec, req)
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	assert.Equal(t, "body", rec.Body.String())
+	assert.Equal(t, "/v1/users", rec.Header().Get("X-Path"))
+	assert.Equal(t, "source=proxy&id=1", rec.Header().Get("X-Query"))
+	assert.Equal(t, rec.Header().Get(haki.RequestIDHeader), rec.Header().Get("X-Upstream-"+haki.RequestIDHeader))
+	assert.Equal(t, "mock_cid", rec.Header().Get("X-Upstream-"+haki.RequestContextHeader))
+	assert.Equal(t, "tanonymous", rec.Header().Get("X-Upstream-"+haki.IdentityHeader))
+	assert.Equal(t, "192.0.2.1", rec.Header().Get("X-Upstream-X-Forwarded-For"))
+	assert.Equal(t, "proxyhandle", rec.Header().Get("X-Upstream-X-Forwarded-Host"))
+	assert.Equal(t, "", rec.Header().Get("X-Upstream-Keep-Alive"))
+	assert.Equal(t, "", rec.Header().Get("X-Upstream-X-Client-Hop"))
+	assert.Equal(t, "", rec.Header().Get("X-Hop"), "Response hop header")
+
+	rec = httptest.NewRecorder()
+	handler(rec, httptest.NewRequest("GET", "http://proxyhandle/web", nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	rec = httptest.NewRecorder()
+	Wrap(ProxyTransport(router, &http.Transport{ResponseHeaderTimeout: 10 * time.Millisecond}), Error)(rec, httptest.NewRequest("GET", "http://proxyhandle/api/slow", nil))
+	assert.Equal(t, http.StatusGatewayTimeout, rec.Code)
+
+	closed, err := proxy.NewRouter(proxy.Route{Prefix: "/", Upstream: "http://127.0.0.1:1"})
+	assert.Nil(t, err)
+	rec = httptest.NewRecorder()
+	Wrap(Proxy(closed), Error)(rec, httptest.NewRequest("GET", "http://proxyhandle/", nil))
+	assert.Equal(t, http.StatusBadGateway, rec.Code)
+}
+
+func TestProxyHandlerUpgrade(t *testing.T) {
+	upstream, requests := newUpgradeUpstream(t)
+	defer upstream.Close()
+	router, err := proxy.NewRouter(proxy.Route{Prefix: "/ws", Upstream: "http://" + upstream.Addr().String()})
+	assert.Nil(t, err)
+	server := httptest.NewServer(Wrap(Proxy(router), Audit))
+	defer server.Close()
+
+	conn, err := net.Dial("tcp", server.Listener.Addr().String())
+	assert.Nil(t, err)
+	defer conn.Close()
+	conn.Write([]byte("GET /ws/echo HTTP/1.1\r\nHost: proxyhandle\r\nConnection: Upgrade\r\nUpgrade: websocket\r\n\r\n"))
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusSwitchingProtocols, resp.StatusCode)
+	req := <-requests
+	assert.Equal(t, "/ws/echo", req.URL.Path)
+	assert.Equal(t, "websocket", req.Header.Get("Upgrade"))
+	assert.NotEmpty(t, req.Header.Get(haki.RequestIDHeader))
+
+	conn.Write([]byte("ping"))
+	message := make([]byte, 4)
+	_, err = io.ReadFull(reader, message)
+	assert.Nil(t, err)
+	assert.Equal(t, "ping", string(message))
+}
+
+func TestRequireWrapper(t *testing.T) {
+	withIdentity := func(identity *Identity) HTTPHandlerWrapper {
+		return func(handler HTTPHandlerFunc) HTTPHandlerFunc {
+			return func(w http.ResponseWriter, r *http.Request) error {
+				if identity != nil {
+					r = set(r, ContextKeys.IDENTITY, identity)
+				}
+				return handler(w, r)
+			}
+		}
+	}
+	var calls int
+	handler := func(w http.ResponseWriter, r *http.Request) error {
+		calls++
+		return Status(w, http.StatusOK)
+	}
+	policy := authz.Any(authz.Roles("admin"), authz.Scopes("users:write"))
+	for _, test := range []struct {
+		identity *Identity
+		status   int
+	}{
+		{nil, http.StatusUnauthorized},
+		{&Identity{Token: AnonymousToken}, http.StatusUnauthorized},
+		{&Identity{Token: "user", Value: map[string]interface{}{"roles": []string{"editor"}}}, http.StatusForbidden},
+		{&Identity{Token: "user", Value: map[string]interface{}{"scope": "users:read users:write"}}, http.StatusOK},
+		{&Identity{Token: "admin", Value: map[string]interface{}{"roles": []interface{}{"admin"}}}, http.StatusOK},
+	} {
+		rec := httptest.NewRecorder()
+		Wrap(handler, Require(policy), withIdentity(test.identity), Audit)(rec, httptest.NewRequest("GET", "http://requirehandle/users", nil))
+		assert.Equal(t, test.status, rec.Code, test.identity)
+	}
+	assert.Equal(t, 2, calls)
+}
+
+func TestAPIKeyWrapper(t *testing.T) {
+	key, stored, err := apikey.Generate("billing", "invoices:read")
+	assert.Nil(t, err)
+	path := filepath.Join(t.TempDir(), "keys.json")
+	assert.Nil(t, apikey.Save(path, stored))
+	store, err := apikey.NewFileStore(path)
+	assert.Nil(t, err)
+	var identity *Identity
+	handler := Wrap(func(w http.ResponseWriter, r *http.Request) error {
+		identity = GetIdentity(r)
+		return Status(w, http.StatusOK)
+	}, Require(authz.Scopes("invoices:read")), APIKey(apikey.NewResolver(store)), Audit)
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "http://apikeyhandle/invoices", nil)
+	req.Header.Set(apikey.Header, key)
+	handler(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, stored.Token(), identity.Token)
+	assert.Equal(t, "billing", identity.Value.(map[string]interface{})["name"])
+
+	rec = httptest.NewRecorder()
+	handler(rec, httptest.NewRequest("GET", "http://apikeyhandle/invoices?api_key="+key, nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	rec = httptest.NewRecorder()
+	req = httptest.NewRequest("GET", "http://apikeyhandle/invoices", nil)
+	req.Header.Set(apikey.Header, key+"x")
+	handler(rec, req)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Equal(t, "Invalid API key\n", rec.Body.String())
+
+	rec = httptest.NewRecorder()
+	handler(rec, httptest.NewRequest("GET", "http://apikeyhandle/invoices", nil))
+	assert.Equal(t, http.StatusUnauthorized, rec.Code, "Anonymous denied by the policy")
+}
+
+//newCertificate creates a self signed certificate with the uri SANs
+func newCertificate(t *testing.T, commonName string, uris ...string) *x509.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	for _, uri := range uris {
+		u, err := url.Parse(uri)
+		assert.Nil(t, err)
+		template.URIs = append(template.URIs, u)
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.Nil(t, err)
+	cert, err := x509.ParseCertificate(der)
+	assert.Nil(t, err)
+	return cert
+}
+
+func TestClientCertificateWrapper(t *testing.T) {
+	cert := newCertificate(t, "billing", "spiffe://example.com/billing")
+	var identity *Identity
+	handler := func(w http.ResponseWriter, r *http.Request) error {
+		identity = GetIdentity(r)
+		return Status(w, http.StatusOK)
+	}
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "https://mtlshandle/invoices", nil)
+	req.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+	Wrap(handler, ClientCertificate(true), Audit)(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "spiffe://example.com/billing", identity.Token)
+	assert.Equal(t, "billing", identity.Value.(map[string]interface{})["commonName"])
+
+	rec = httptest.NewRecorder()
+	req = httptest.NewRequest("GET", "https://mtlshandle/invoices", nil)
+	req.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}}
+	Wrap(handler, ClientCertificate(true), Audit)(rec, req)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code, "Unverified certificate")
+
+	rec = httptest.NewRecorder()
+	Wrap(handler, ClientCertificate(false), Audit)(rec, httptest.NewRequest("GET", "http://mtlshandle/invoices", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, AnonymousToken, identity.Token)
+}
+
+func TestHealthHandlers(t *testing.T) {
+	registry := health.New()
+	registry.Register(health.Check{Name: "db", Critical: true, Check: func(ctx context.Context) error {
+		return nil
+	}})
+
+	w := httptest.NewRecorder()
+	assert.Nil(t, Readyz(registry)(w, httptest.NewRequest("GET", "/readyz", nil)))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+	var report health.Report
+	assert.Nil(t, json.Unmarshal(w.Body, &report))
+	assert.Equal(t, health.StatusDown, report.Status)
+
+	registry.SetReady(true)
+	for _, handler := range []HTTPHandlerFunc{Healthz(registry), Readyz(registry), Livez(registry)} {
+		w = httptest.NewRecorder()
+		assert.Nil(t, handler(w, httptest.NewRequest("GET", "/healthz", nil)))
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `"status":"up"`)
+	}
+
+	server := &http.Server{}
+	server.RegisterOnShutdown(registry.Shutdown)
+	assert.Nil(t, server.Shutdown(context.Background()))
+	for i := 0; i < 100 && w.Code != http.StatusServiceUnavailable; i++ {
+		time.Sleep(time.Millisecond)
+		w = httptest.NewRecorder()
+		assert.Nil(t, Readyz(registry)(w, httptest.NewRequest("GET", "/readyz", nil)))
+	}
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code, "Shutdown flips the readiness off")
+}
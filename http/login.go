@@ -0,0 +1,63 @@
+package http
+
+import (
+	"github.com/rjansen/haki"
+	"github.com/rjansen/haki/auth"
+	"github.com/rjansen/haki/session"
+	"github.com/rjansen/l"
+	"net/http"
+)
+
+//auditLogger returns the Auditor of the request or a logger with the request path when the Audit wrapper is not in use
+func auditLogger(r *http.Request) (l.Logger, *Auditor) {
+	if auditor, ok := Get(r, ContextKeys.AUDITOR).(*Auditor); ok {
+		return auditor, auditor
+	}
+	return l.WithFields(l.String("path", r.URL.Path)), nil
+}
+
+func loginHandle(authenticator *auth.Authenticator, options *auth.LoginOptions, w http.ResponseWriter, r *http.Request) error {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		return haki.ErrMethodNotAllowed
+	}
+	s := GetSession(r)
+	if s == nil {
+		return session.ErrNoSession
+	}
+	logger, auditor := auditLogger(r)
+	username := r.PostFormValue(options.UsernameField)
+	user, err := authenticator.Authenticate(username, r.PostFormValue(options.PasswordField))
+	if err != nil {
+		logger.Warn("haki.http.LoginErr",
+			l.String("username", username),
+			l.Err(err),
+		)
+		if options.FailureURL != "" && haki.ErrStatus(err) != http.StatusInternalServerError {
+			http.Redirect(w, r, options.FailureURL, http.StatusSeeOther)
+			return nil
+		}
+		return err
+	}
+	if err := s.SetIdentity(user.Token, user.Value); err != nil {
+		return err
+	}
+	if auditor != nil {
+		auditor.Identity = &Identity{Token: user.Token, Value: user.Value}
+	}
+	logger.Info("haki.http.Login",
+		l.String("username", username),
+		l.String("token", user.Token),
+	)
+	http.Redirect(w, r, options.RedirectURL, http.StatusSeeOther)
+	return nil
+}
+
+//Login creates a form login handler, to be mounted at the FormURI inside the Session wrapper.
+//It authenticates the form credentials, stores the user identity in the session and redirects to the RedirectURL
+func Login(authenticator *auth.Authenticator, options auth.LoginOptions) HTTPHandlerFunc {
+	options = options.WithDefaults()
+	return func(w http.ResponseWriter, r *http.Request) error {
+		return loginHandle(authenticator, &options, w, r)
+	}
+}
@@ -0,0 +1,39 @@
+package http
+
+import (
+	"github.com/rjansen/haki/mtls"
+	"github.com/rjansen/l"
+	"net/http"
+)
+
+func clientCertificateHandle(required bool, handler HTTPHandlerFunc, w http.ResponseWriter, r *http.Request) error {
+	peer, err := mtls.PeerOf(r.TLS)
+	if err != nil {
+		if !required {
+			return handler(w, r)
+		}
+		logger, _ := auditLogger(r)
+		logger.Warn("haki.http.ClientCertificateErr",
+			l.Err(err),
+		)
+		return err
+	}
+	r = setIdentity(r, &Identity{Token: peer.Token(), Value: peer.Identity()})
+	logger, _ := auditLogger(r)
+	logger.Info("haki.http.ClientCertificate",
+		l.String("subject", peer.Subject),
+		l.String("spiffeId", peer.SPIFFEID),
+		l.String("fingerprint", peer.Fingerprint),
+	)
+	return handler(w, r)
+}
+
+//ClientCertificate creates a wrapper that resolves the verified client certificate of the connection into the Identity, use it inside Audit.
+//When required, the requests without a verified certificate return a 401 mtls.ErrNoCertificate, otherwise they are kept anonymous
+func ClientCertificate(required bool) HTTPHandlerWrapper {
+	return func(handler HTTPHandlerFunc) HTTPHandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) error {
+			return clientCertificateHandle(required, handler, w, r)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"github.com/rjansen/haki"
+	"github.com/rjansen/haki/proxy"
+	"github.com/rjansen/l"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"time"
+)
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+//proxyErr maps the upstream failures to the gateway status errors
+func proxyErr(err error) error {
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		return haki.ErrGatewayTimeout
+	}
+	return haki.ErrBadGateway
+}
+
+//forwardRequest sets the upstream url and the haki headers of the proxied request
+func forwardRequest(target proxy.Target, in *http.Request, out *http.Request) {
+	query := in.URL.RawQuery
+	out.URL = target.URL
+	if out.URL.RawQuery == "" || query == "" {
+		out.URL.RawQuery += query
+	} else {
+		out.URL.RawQuery += "&" + query
+	}
+	out.Host = target.URL.Host
+	out.Header.Set("X-Forwarded-Host", in.Host)
+	if in.TLS != nil {
+		out.Header.Set("X-Forwarded-Proto", "https")
+	} else {
+		out.Header.Set("X-Forwarded-Proto", "http")
+	}
+	//The identity is set only by the proxy, never by the client
+	out.Header.Del(haki.IdentityHeader)
+	if identity, ok := Get(in, ContextKeys.IDENTITY).(*Identity); ok && identity != nil {
+		out.Header.Set(haki.IdentityHeader, identity.Token)
+	}
+	if tid, ok := Get(in, ContextKeys.TID).(string); ok {
+		out.Header.Set(haki.RequestIDHeader, tid)
+	}
+	if cid, ok := Get(in, ContextKeys.CID).(string); ok {
+		out.Header.Set(haki.RequestContextHeader, cid)
+	}
+}
+
+func proxyHandle(router *proxy.Router, transport http.RoundTripper, w http.ResponseWriter, r *http.Request) error {
+	start := time.Now()
+	target, found := router.Match(r.URL.Path)
+	if !found {
+		return proxy.ErrNoRoute
+	}
+	var upstreamTime time.Duration
+	var upstreamErr error
+	reverseProxy := &httputil.ReverseProxy{
+		//The hop headers, including the ones listed in Connection, are removed by the ReverseProxy,
+		//which keeps only the Upgrade headers of the WebSocket requests and copies the upgraded connection
+		Director: func(out *http.Request) {
+			forwardRequest(target, r, out)
+		},
+		Transport: roundTripperFunc(func(out *http.Request) (*http.Response, error) {
+			upstreamStart := time.Now()
+			response, err := transport.RoundTrip(out)
+			upstreamTime = time.Since(upstreamStart)
+			return response, err
+		}),
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			upstreamErr = err
+		},
+	}
+	reverseProxy.ServeHTTP(w, r)
+	logger, _ := auditLogger(r)
+	fields := []l.Field{
+		l.String("upstream", target.Host),
+		l.String("upstreamPath", target.URL.Path),
+		l.Duration("upstreamTime", upstreamTime),
+		l.Duration("proxyTime", time.Since(start)),
+	}
+	if upstreamErr != nil {
+		logger.Error("haki.http.ProxyErr", append(fields, l.Err(upstreamErr))...)
+		if errors.Is(upstreamErr, context.Canceled) {
+			return nil
+		}
+		return proxyErr(upstreamErr)
+	}
+	logger.Info("haki.http.Proxy", fields...)
+	return nil
+}
+
+//Proxy creates a reverse proxy handler that sends the requests to the upstream of the Router route of their paths.
+//The tid, cid and Identity token of the Audit wrapper are forwarded in the X-Request-Id, X-Request-Context and X-Identity-Token headers
+func Proxy(router *proxy.Router) HTTPHandlerFunc {
+	return ProxyTransport(router, http.DefaultTransport)
+}
+
+//ProxyTransport creates a reverse proxy handler like Proxy that sends the upstream requests by the provided transport
+func ProxyTransport(router *proxy.Router, transport http.RoundTripper) HTTPHandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		return proxyHandle(router, transport, w, r)
+	}
+}
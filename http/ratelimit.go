@@ -0,0 +1,69 @@
+package http
+
+import (
+	"github.com/rjansen/haki"
+	"github.com/rjansen/haki/ratelimit"
+	"github.com/rjansen/l"
+	"net"
+	"net/http"
+	"strconv"
+)
+
+//RateLimitKeyFunc returns the rate limit key of the request, requests with an empty key are not limited
+type RateLimitKeyFunc func(*http.Request) string
+
+//ClientIPKey is a RateLimitKeyFunc that limits by the remote address ip.
+//Behind a reverse proxy the RemoteAddr must be replaced by the client ip before the wrapper
+func ClientIPKey(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+//IdentityKey is a RateLimitKeyFunc that limits by the Identity.Token stored by the Audit wrapper.
+//Anonymous requests are limited by the ClientIPKey, so a noisy client does not throttle every anonymous user
+func IdentityKey(r *http.Request) string {
+	if identity, ok := Get(r, ContextKeys.IDENTITY).(*Identity); ok && identity != nil {
+		if identity.Token == AnonymousToken {
+			return ClientIPKey(r)
+		}
+		return identity.Token
+	}
+	return ""
+}
+
+func rateLimitHandle(limiter *ratelimit.Limiter, key RateLimitKeyFunc, handler HTTPHandlerFunc, w http.ResponseWriter, r *http.Request) error {
+	limitKey := key(r)
+	if limitKey == "" {
+		return handler(w, r)
+	}
+	result, err := limiter.Allow(limitKey)
+	if err != nil {
+		//Fails open, an unavailable store must not take the service down
+		l.Error("haki.http.RateLimitErr",
+			l.String("key", limitKey),
+			l.Err(err),
+		)
+		return handler(w, r)
+	}
+	w.Header().Set(haki.RateLimitHeader, strconv.Itoa(result.Limit))
+	w.Header().Set(haki.RateLimitRemainHeader, strconv.Itoa(result.Remaining))
+	w.Header().Set(haki.RateLimitResetHeader, strconv.FormatInt(haki.Seconds(result.ResetAfter), 10))
+	if !result.Allowed {
+		w.Header().Set(haki.RetryAfterHeader, strconv.FormatInt(haki.Seconds(result.RetryAfter), 10))
+		return haki.ErrTooManyRequests
+	}
+	return handler(w, r)
+}
+
+//RateLimit creates a wrapper that limits the requests by the key returned by the RateLimitKeyFunc.
+//Limited requests return haki.ErrTooManyRequests that the Error and Audit wrappers renders as a 429 response
+func RateLimit(limiter *ratelimit.Limiter, key RateLimitKeyFunc) HTTPHandlerWrapper {
+	return func(handler HTTPHandlerFunc) HTTPHandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) error {
+			return rateLimitHandle(limiter, key, handler, w, r)
+		}
+	}
+}
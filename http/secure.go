@@ -0,0 +1,100 @@
+package http
+
+import (
+	"bytes"
+	"github.com/rjansen/haki"
+	"github.com/rjansen/haki/media/form"
+	"github.com/rjansen/haki/secure"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+//SecureHeaders creates a wrapper that writes the provided security headers, see secure.DefaultHeaders
+func SecureHeaders(headers secure.Headers) HTTPHandlerWrapper {
+	return func(handler HTTPHandlerFunc) HTTPHandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) error {
+			headers.Write(w.Header())
+			return handler(w, r)
+		}
+	}
+}
+
+//csrfField reads the token form field of an url encoded body and restores the body for the handler.
+//Bodies larger than haki.MaxDecodedBodySize return a 413 haki.ErrBodyTooLarge and malformed ones a 400 StatusError
+func csrfField(r *http.Request, field string) (string, error) {
+	if !strings.Contains(r.Header.Get(haki.ContentTypeHeader), form.ContentType) {
+		return "", nil
+	}
+	var reader io.Reader = r.Body
+	if haki.MaxDecodedBodySize > 0 {
+		//One byte past the max size tells a body at the limit from a larger one
+		reader = io.LimitReader(r.Body, haki.MaxDecodedBodySize+1)
+	}
+	body, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return "", err
+	}
+	if haki.MaxDecodedBodySize > 0 && int64(len(body)) > haki.MaxDecodedBodySize {
+		return "", haki.ErrBodyTooLarge
+	}
+	r.Body.Close()
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+	values, err := url.ParseQuery(string(body))
+	if err != nil {
+		return "", haki.NewStatusError(http.StatusBadRequest, err.Error())
+	}
+	return values.Get(field), nil
+}
+
+//csrfBinding returns the identity token that signs the CSRF tokens, empty for the anonymous requests
+func csrfBinding(r *http.Request) string {
+	if identity, ok := Get(r, ContextKeys.IDENTITY).(*Identity); ok && identity != nil && identity.Token != AnonymousToken {
+		return identity.Token
+	}
+	return ""
+}
+
+func csrfHandle(csrf *secure.CSRF, handler HTTPHandlerFunc, w http.ResponseWriter, r *http.Request) error {
+	options := csrf.Options()
+	binding := csrfBinding(r)
+	var cookieToken string
+	if cookie, err := r.Cookie(options.CookieName); err == nil && csrf.ValidToken(cookie.Value, binding) {
+		cookieToken = cookie.Value
+	}
+	token := cookieToken
+	if token == "" {
+		var err error
+		if token, err = csrf.NewToken(binding); err != nil {
+			return err
+		}
+		http.SetCookie(w, csrf.Cookie(token))
+	}
+	r = set(r, ContextKeys.CSRF, token)
+	if !secure.SafeMethod(r.Method) {
+		submitted := r.Header.Get(options.HeaderName)
+		if submitted == "" {
+			var err error
+			if submitted, err = csrfField(r, options.FieldName); err != nil {
+				return err
+			}
+		}
+		if err := csrf.Check(r.Method, cookieToken, submitted, binding); err != nil {
+			return err
+		}
+	}
+	return handler(w, r)
+}
+
+//CSRF creates a wrapper that sets the token cookie and rejects the unsafe requests without the token.
+//With a secure.CSRFOptions.Secret the token is bound to the request Identity, so use it inside the Audit and Session wrappers.
+//Rejected requests return a 403 secure.ErrCSRFTokenMissing or secure.ErrCSRFTokenInvalid, rendered by the Error and Audit wrappers
+func CSRF(csrf *secure.CSRF) HTTPHandlerWrapper {
+	return func(handler HTTPHandlerFunc) HTTPHandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) error {
+			return csrfHandle(csrf, handler, w, r)
+		}
+	}
+}
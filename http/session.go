@@ -0,0 +1,95 @@
+package http
+
+import (
+	"github.com/rjansen/haki"
+	"github.com/rjansen/haki/session"
+	"github.com/rjansen/l"
+	"net/http"
+)
+
+//GetSession returns the session loaded by the Session wrapper, nil when the wrapper is not in use
+func GetSession(r *http.Request) *session.Session {
+	s, _ := Get(r, ContextKeys.SESSION).(*session.Session)
+	return s
+}
+
+//sessionResponseWriter saves the session right before the response header is written, when the cookie can still be set
+type sessionResponseWriter struct {
+	http.ResponseWriter
+	manager *session.Manager
+	session *session.Session
+	saved   bool
+	err     error
+}
+
+func (w *sessionResponseWriter) save() error {
+	if w.saved {
+		return w.err
+	}
+	w.saved = true
+	var cookie *http.Cookie
+	if cookie, w.err = w.manager.Save(w.session); cookie != nil {
+		http.SetCookie(w.ResponseWriter, cookie)
+	}
+	return w.err
+}
+
+func (w *sessionResponseWriter) WriteHeader(s int) {
+	w.save()
+	w.ResponseWriter.WriteHeader(s)
+}
+
+func (w *sessionResponseWriter) Write(b []byte) (int, error) {
+	w.save()
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *sessionResponseWriter) Unwrap() http.ResponseWriter {
+	w.save()
+	return w.ResponseWriter
+}
+
+func (w *sessionResponseWriter) Flush() {
+	w.save()
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func sessionHandle(manager *session.Manager, handler HTTPHandlerFunc, w http.ResponseWriter, r *http.Request) error {
+	var value string
+	if cookie, err := r.Cookie(manager.Options().CookieName); err == nil {
+		value = cookie.Value
+	}
+	s, err := manager.Load(value)
+	if err != nil {
+		return err
+	}
+	r = set(r, ContextKeys.SESSION, s)
+	if s.Authenticated() {
+		r = setIdentity(r, &Identity{Token: s.Token, Value: s.Value})
+	}
+	w.Header().Add(haki.VaryHeader, "Cookie")
+	sw := &sessionResponseWriter{ResponseWriter: w, manager: manager, session: s}
+	if err := handler(sw, r); err != nil {
+		return err
+	}
+	if err := sw.save(); err != nil {
+		l.Error("haki.http.SessionSaveErr",
+			l.String("path", r.URL.Path),
+			l.Err(err),
+		)
+		return err
+	}
+	return nil
+}
+
+//Session creates a wrapper that loads the request session and saves it when changed.
+//The session identity, when set, replaces the Identity and token of the request, so use it inside Audit
+func Session(manager *session.Manager) HTTPHandlerWrapper {
+	return func(handler HTTPHandlerFunc) HTTPHandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) error {
+			return sessionHandle(manager, handler, w, r)
+		}
+	}
+}
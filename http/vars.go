@@ -6,24 +6,35 @@ import (
 	"net/http"
 )
 
+//AnonymousToken is the Identity token of the requests without an authenticated user
+const AnonymousToken = "tanonymous"
+
 var (
 	ContextKeys = Keys{
-		TID:      "tid",
-		CID:      "cid",
-		LOG:      "requestLog",
-		TOKEN:    "requestToken",
-		IDENTITY: "requestIdentity",
-		AUDITOR:  "requestAuditor",
+		TID:           "tid",
+		CID:           "cid",
+		LOG:           "requestLog",
+		TOKEN:         "requestToken",
+		IDENTITY:      "requestIdentity",
+		AUDITOR:       "requestAuditor",
+		TRACE:         "requestTraceParent",
+		AUTHORIZATION: "requestAuthorization",
+		CSRF:          "requestCSRFToken",
+		SESSION:       "requestSession",
 	}
 )
 
 type Keys struct {
-	TID      string
-	CID      string
-	LOG      string
-	TOKEN    string
-	IDENTITY string
-	AUDITOR  string
+	TID           string
+	CID           string
+	LOG           string
+	TOKEN         string
+	IDENTITY      string
+	AUDITOR       string
+	TRACE         string
+	AUTHORIZATION string
+	CSRF          string
+	SESSION       string
 }
 
 type Auditor struct {
@@ -42,6 +53,16 @@ func set(r *http.Request, key interface{}, val interface{}) *http.Request {
 	return r.WithContext(context.WithValue(r.Context(), key, val))
 }
 
+//setIdentity replaces the Identity and token of the request and of its Auditor
+func setIdentity(r *http.Request, identity *Identity) *http.Request {
+	r = set(r, ContextKeys.TOKEN, identity.Token)
+	r = set(r, ContextKeys.IDENTITY, identity)
+	if auditor, ok := Get(r, ContextKeys.AUDITOR).(*Auditor); ok {
+		auditor.Identity = identity
+	}
+	return r
+}
+
 func Get(r *http.Request, key interface{}) interface{} {
 	return r.Context().Value(key)
 }
@@ -65,3 +86,9 @@ func GetIdentity(r *http.Request) *Identity {
 func GetAuditor(r *http.Request) *Auditor {
 	return Get(r, ContextKeys.AUDITOR).(*Auditor)
 }
+
+//GetCSRFToken returns the token stored by the CSRF wrapper, to be rendered in the forms
+func GetCSRFToken(r *http.Request) string {
+	token, _ := Get(r, ContextKeys.CSRF).(string)
+	return token
+}
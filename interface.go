@@ -1,7 +1,32 @@
 package haki
 
+import (
+	"context"
+)
+
 //ErrorFunc is a func that returns error
 type ErrorFunc func() error
 
+//WithContext adapts the ErrorFunc to an ErrorContextFunc that ignores the context
+func (f ErrorFunc) WithContext() ErrorContextFunc {
+	return func(context.Context) error {
+		return f()
+	}
+}
+
+//ErrorContextFunc is a func that returns error and stops when the context is done
+type ErrorContextFunc func(context.Context) error
+
 //SetupFunc is a func that initializes and returns error if unexpected results happens
 type SetupFunc ErrorFunc
+
+//WithContext adapts the SetupFunc to a SetupContextFunc that ignores the context
+func (f SetupFunc) WithContext() SetupContextFunc {
+	return func(context.Context) error {
+		return f()
+	}
+}
+
+//SetupContextFunc is a SetupFunc that must stop when the context is done, so the initialization can be bounded by a deadline or cancelled.
+//The context carries the setup logger, returned by the ContextLogger
+type SetupContextFunc ErrorContextFunc
@@ -0,0 +1,110 @@
+package cbor
+
+import (
+	"github.com/rjansen/l"
+	"github.com/ugorji/go/codec"
+	"io"
+	"reflect"
+)
+
+const (
+	//ContentType is a constant to hold the cbor content type value
+	ContentType = "application/cbor"
+)
+
+var (
+	handles = map[Media]*codec.CborHandle{
+		Media{}:                  newHandle(Media{}),
+		Media{Canonical: true}:   newHandle(Media{Canonical: true}),
+		Media{TimeRFC3339: true}: newHandle(Media{TimeRFC3339: true}),
+		Media{Canonical: true, TimeRFC3339: true}: newHandle(Media{Canonical: true, TimeRFC3339: true}),
+	}
+	handle = handles[Media{}]
+)
+
+func newHandle(options Media) *codec.CborHandle {
+	h := new(codec.CborHandle)
+	h.Canonical = options.Canonical
+	h.TimeRFC3339 = options.TimeRFC3339
+	h.SkipUnexpectedTags = true
+	h.MapType = reflect.TypeOf(map[string]interface{}(nil))
+	return h
+}
+
+//Marshal writes a cbor representation of the struct instance
+func Marshal(w io.Writer, data interface{}) error {
+	return marshal(handle, w, data)
+}
+
+//Unmarshal reads a cbor representation into the struct instance
+func Unmarshal(r io.Reader, result interface{}) error {
+	return unmarshal(handle, r, result)
+}
+
+//MarshalBytes writes a cbor representation of the struct instance
+func MarshalBytes(data interface{}) ([]byte, error) {
+	return marshalBytes(handle, data)
+}
+
+//UnmarshalBytes reads a cbor representation into the struct instance
+func UnmarshalBytes(raw []byte, result interface{}) error {
+	return unmarshalBytes(handle, raw, result)
+}
+
+func marshal(h *codec.CborHandle, w io.Writer, data interface{}) error {
+	return codec.NewEncoder(w, h).Encode(data)
+}
+
+func unmarshal(h *codec.CborHandle, r io.Reader, result interface{}) error {
+	return codec.NewDecoder(r, h).Decode(result)
+}
+
+func marshalBytes(h *codec.CborHandle, data interface{}) ([]byte, error) {
+	var cborBytes []byte
+	err := codec.NewEncoderBytes(&cborBytes, h).Encode(data)
+	l.Debug("cbor.MarshalBytes",
+		l.Int("len", len(cborBytes)),
+		l.Bool("canonical", h.Canonical),
+		l.Err(err),
+	)
+	return cborBytes, err
+}
+
+func unmarshalBytes(h *codec.CborHandle, raw []byte, result interface{}) error {
+	err := codec.NewDecoderBytes(raw, h).Decode(result)
+	l.Debug("cbor.UnmarshalBytes",
+		l.Bool("nilResult", result == nil),
+		l.Err(err),
+	)
+	return err
+}
+
+//Media is a struct to helps writes and reads of a cbor representation.
+//Time values are written as tag 1 (epoch) unless TimeRFC3339 is set, which writes tag 0 (RFC3339 string).
+//Both tags are accepted on reads regardless of the options
+type Media struct {
+	//Canonical enables the deterministic encoding, map keys are written sorted so equal values always produce the same bytes
+	Canonical bool
+	//TimeRFC3339 writes time values as tag 0 RFC3339 strings instead of tag 1 epoch numbers
+	TimeRFC3339 bool
+}
+
+//Marshal writes a cbor representation of the struct instance
+func (m Media) Marshal(writer io.Writer, val interface{}) error {
+	return marshal(handles[m], writer, val)
+}
+
+//Unmarshal reads a cbor representation into the struct instance
+func (m Media) Unmarshal(reader io.Reader, ref interface{}) error {
+	return unmarshal(handles[m], reader, ref)
+}
+
+//MarshalBytes writes a cbor representation of the struct instance
+func (m Media) MarshalBytes(val interface{}) ([]byte, error) {
+	return marshalBytes(handles[m], val)
+}
+
+//UnmarshalBytes reads a cbor representation into the struct instance
+func (m Media) UnmarshalBytes(raw []byte, ref interface{}) error {
+	return unmarshalBytes(handles[m], raw, ref)
+}
@@ -0,0 +1,94 @@
+package cbor
+
+import (
+	"bytes"
+	"github.com/rjansen/l"
+	"github.com/rjansen/l/zap"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func init() {
+	if setupErr := zap.Setup(new(l.Configuration)); setupErr != nil {
+		panic(setupErr)
+	}
+	l.Info("context.media.cbor_test.init")
+}
+
+type mockMedia struct {
+	ID        int       `json:"id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+func TestCBORMarshalAndUnmarshalBytes(t *testing.T) {
+	m := &mockMedia{
+		ID:        1,
+		Name:      "CBOR Media",
+		CreatedAt: time.Date(2017, 6, 25, 19, 38, 37, 0, time.UTC),
+	}
+
+	b, e := MarshalBytes(m)
+	assert.Nil(t, e)
+	//tag 1 (epoch) followed by the uint32 header of the seconds value
+	assert.True(t, bytes.Contains(b, []byte{0xc1, 0x1a}), "Time is not encoded with tag 1")
+
+	var result mockMedia
+	e = UnmarshalBytes(b, &result)
+	assert.Nil(t, e)
+	assert.Equal(t, m.ID, result.ID)
+	assert.Equal(t, m.Name, result.Name)
+	assert.True(t, m.CreatedAt.Equal(result.CreatedAt), "CreatedAt was not decoded")
+}
+
+func TestCBORTimeRFC3339(t *testing.T) {
+	m := &mockMedia{
+		ID:        1,
+		Name:      "CBOR Media",
+		CreatedAt: time.Date(2017, 6, 25, 19, 38, 37, 0, time.UTC),
+	}
+	media := Media{TimeRFC3339: true}
+
+	mockBuffer := new(bytes.Buffer)
+	e := media.Marshal(mockBuffer, m)
+	assert.Nil(t, e)
+	//tag 0 (date/time string) followed by the text string header
+	assert.True(t, bytes.Contains(mockBuffer.Bytes(), []byte{0xc0, 0x74}), "Time is not encoded with tag 0")
+	assert.True(t, bytes.Contains(mockBuffer.Bytes(), []byte("2017-06-25T19:38:37Z")), "Time is not encoded as RFC3339")
+
+	var result mockMedia
+	e = Unmarshal(mockBuffer, &result)
+	assert.Nil(t, e)
+	assert.True(t, m.CreatedAt.Equal(result.CreatedAt), "CreatedAt was not decoded")
+}
+
+func TestCBORCanonical(t *testing.T) {
+	m := map[string]interface{}{}
+	for _, k := range []string{"e", "d", "c", "b", "a", "f", "g", "h"} {
+		m[k] = k
+	}
+	media := Media{Canonical: true}
+
+	expected, e := media.MarshalBytes(m)
+	assert.Nil(t, e)
+	for i := 0; i < 10; i++ {
+		b, e := media.MarshalBytes(m)
+		assert.Nil(t, e)
+		assert.Equal(t, expected, b)
+	}
+
+	var result map[string]interface{}
+	e = media.UnmarshalBytes(expected, &result)
+	assert.Nil(t, e)
+	assert.Equal(t, m, result)
+}
+
+func TestCBORUnmarshalErr(t *testing.T) {
+	var result mockMedia
+	e := UnmarshalBytes([]byte{0xff}, &result)
+	assert.NotNil(t, e)
+
+	e = Unmarshal(bytes.NewBuffer([]byte{}), &result)
+	assert.NotNil(t, e)
+}
@@ -0,0 +1,97 @@
+package media
+
+import (
+	"github.com/rjansen/haki/media/cbor"
+	"github.com/rjansen/haki/media/form"
+	"github.com/rjansen/haki/media/json"
+	"github.com/rjansen/haki/media/jsonpb"
+	"github.com/rjansen/haki/media/msgpack"
+	"github.com/rjansen/haki/media/proto"
+	"github.com/rjansen/haki/media/text"
+	"github.com/rjansen/haki/media/xml"
+	"io"
+	"strings"
+)
+
+//Codec is an interface to defines the contract of the media structs, like json.Media, that encodes and decodes values
+type Codec interface {
+	//Marshal writes the media representation of the value
+	Marshal(io.Writer, interface{}) error
+	//Unmarshal reads the media representation into the reference
+	Unmarshal(io.Reader, interface{}) error
+	//MarshalBytes writes the media representation of the value
+	MarshalBytes(interface{}) ([]byte, error)
+	//UnmarshalBytes reads the media representation into the reference
+	UnmarshalBytes([]byte, interface{}) error
+}
+
+//ContentCodec pairs a Content-Type header value with the Codec of its media
+type ContentCodec struct {
+	ContentType string
+	Codec       Codec
+}
+
+var (
+	//JSON is the json ContentCodec, protocol buffer messages are handled by the proto3 json mapping
+	JSON = ContentCodec{ContentType: json.ContentType, Codec: jsonCodec{}}
+	//ProtoBuff is the protocol buffer ContentCodec
+	ProtoBuff = ContentCodec{ContentType: proto.ContentType, Codec: proto.Media{}}
+	//MsgPack is the msgpack ContentCodec
+	MsgPack = ContentCodec{ContentType: msgpack.ContentType, Codec: msgpack.Media{}}
+	//CBOR is the cbor ContentCodec
+	CBOR = ContentCodec{ContentType: cbor.ContentType, Codec: cbor.Media{}}
+	//XML is the xml ContentCodec
+	XML = ContentCodec{ContentType: xml.ContentType, Codec: xml.Media{}}
+	//Text is the plain text ContentCodec
+	Text = ContentCodec{ContentType: text.ContentType, Codec: text.Media{}}
+	//Form is the url encoded form ContentCodec
+	Form = ContentCodec{ContentType: form.ContentType, Codec: form.Media{}}
+
+	//Codecs are the ContentCodecs looked up by ForContentType
+	Codecs = []ContentCodec{
+		JSON, ProtoBuff, MsgPack, CBOR, XML, Text, Form,
+		{ContentType: xml.ContentTypeText, Codec: xml.Media{}},
+	}
+)
+
+//ForContentType returns the Codec of the provided Content-Type header value
+func ForContentType(contentType string) (Codec, bool) {
+	for _, c := range Codecs {
+		if strings.Contains(contentType, c.ContentType) {
+			return c.Codec, true
+		}
+	}
+	return nil, false
+}
+
+//jsonCodec routes protocol buffer messages to jsonpb like the http and fast json helpers
+type jsonCodec struct {
+}
+
+func (jsonCodec) Marshal(w io.Writer, val interface{}) error {
+	if jsonpb.IsMessage(val) {
+		return jsonpb.Marshal(w, val)
+	}
+	return json.Marshal(w, val)
+}
+
+func (jsonCodec) Unmarshal(r io.Reader, ref interface{}) error {
+	if jsonpb.IsMessage(ref) {
+		return jsonpb.Unmarshal(r, ref)
+	}
+	return json.Unmarshal(r, ref)
+}
+
+func (jsonCodec) MarshalBytes(val interface{}) ([]byte, error) {
+	if jsonpb.IsMessage(val) {
+		return jsonpb.MarshalBytes(val)
+	}
+	return json.MarshalBytes(val)
+}
+
+func (jsonCodec) UnmarshalBytes(raw []byte, ref interface{}) error {
+	if jsonpb.IsMessage(ref) {
+		return jsonpb.UnmarshalBytes(raw, ref)
+	}
+	return json.UnmarshalBytes(raw, ref)
+}
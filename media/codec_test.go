@@ -0,0 +1,46 @@
+package media
+
+import (
+	"github.com/rjansen/haki/media/proto"
+	"github.com/rjansen/l"
+	"github.com/rjansen/l/zap"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func init() {
+	if setupErr := zap.Setup(new(l.Configuration)); setupErr != nil {
+		panic(setupErr)
+	}
+	l.Info("context.media_test.init")
+}
+
+func TestForContentType(t *testing.T) {
+	cases := map[string]Codec{
+		"application/json; charset=utf-8":   JSON.Codec,
+		"application/octet-stream":          ProtoBuff.Codec,
+		"application/msgpack":               MsgPack.Codec,
+		"application/cbor":                  CBOR.Codec,
+		"application/xml":                   XML.Codec,
+		"text/xml; charset=utf-8":           XML.Codec,
+		"text/plain; charset=utf-8":         Text.Codec,
+		"application/x-www-form-urlencoded": Form.Codec,
+	}
+	for contentType, expected := range cases {
+		codec, found := ForContentType(contentType)
+		assert.True(t, found, contentType)
+		assert.Equal(t, expected, codec, contentType)
+	}
+	_, found := ForContentType("image/png")
+	assert.False(t, found)
+}
+
+func TestJSONCodecProto(t *testing.T) {
+	message := &proto.Store{Id: 1, Name: "mock"}
+	raw, err := JSON.Codec.MarshalBytes(message)
+	assert.Nil(t, err)
+
+	var result proto.Store
+	assert.Nil(t, JSON.Codec.UnmarshalBytes(raw, &result))
+	assert.Equal(t, message.Name, result.Name)
+}
@@ -0,0 +1,312 @@
+package form
+
+import (
+	"bytes"
+	"encoding"
+	"errors"
+	"fmt"
+	"github.com/rjansen/l"
+	"io"
+	"net/url"
+	"reflect"
+	"strconv"
+	"time"
+)
+
+const (
+	//ContentType is a constant to hold the url encoded form content type value
+	ContentType = "application/x-www-form-urlencoded"
+	//TagName is the struct tag used to map the form field names, `form:"-"` skips the field
+	TagName = "form"
+)
+
+var (
+	//ErrInvalidFormReference is returned when the provided value is not a struct pointer or *url.Values
+	ErrInvalidFormReference = errors.New("Invalid form reference. Only: struct pointer, *url.Values are valid")
+	//MaxFormSize is the max size in bytes of an url encoded form body read by the http ReadForm, zero or less disables the check
+	MaxFormSize int64 = 10 << 20
+
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+	textMarshalerType   = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	durationType        = reflect.TypeOf(time.Duration(0))
+)
+
+//Decode sets the provided form values into the struct fields of result using the form tag
+func Decode(values url.Values, result interface{}) error {
+	if ref, ok := result.(*url.Values); ok {
+		*ref = values
+		return nil
+	}
+	rv := reflect.ValueOf(result)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return ErrInvalidFormReference
+	}
+	return decodeStruct(values, rv.Elem())
+}
+
+//Encode returns the form values of the struct fields of data using the form tag
+func Encode(data interface{}) (url.Values, error) {
+	if values, ok := data.(url.Values); ok {
+		return values, nil
+	}
+	rv := reflect.ValueOf(data)
+	if rv.Kind() == reflect.Ptr && !rv.IsNil() {
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return nil, ErrInvalidFormReference
+	}
+	values := make(url.Values)
+	if err := encodeStruct(values, rv); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+func fieldName(f reflect.StructField) (string, bool) {
+	if f.PkgPath != "" && !f.Anonymous {
+		return "", false
+	}
+	name := f.Tag.Get(TagName)
+	if name == "-" {
+		return "", false
+	}
+	if name == "" {
+		name = f.Name
+	}
+	return name, true
+}
+
+func decodeStruct(values url.Values, rv reflect.Value) error {
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		f := rt.Field(i)
+		name, ok := fieldName(f)
+		if !ok {
+			continue
+		}
+		fv := rv.Field(i)
+		if f.Anonymous && f.Tag.Get(TagName) == "" && fv.Kind() == reflect.Struct {
+			if err := decodeStruct(values, fv); err != nil {
+				return err
+			}
+			continue
+		}
+		vals, found := values[name]
+		if !found || len(vals) == 0 {
+			continue
+		}
+		if err := decodeField(fv, vals); err != nil {
+			return fmt.Errorf("Invalid form field %s: %s", name, err.Error())
+		}
+	}
+	return nil
+}
+
+func decodeField(fv reflect.Value, vals []string) error {
+	if fv.Kind() == reflect.Slice && fv.Type().Elem().Kind() != reflect.Uint8 && !fv.Addr().Type().Implements(textUnmarshalerType) {
+		slice := reflect.MakeSlice(fv.Type(), len(vals), len(vals))
+		for i, s := range vals {
+			if err := decodeValue(slice.Index(i), s); err != nil {
+				return err
+			}
+		}
+		fv.Set(slice)
+		return nil
+	}
+	return decodeValue(fv, vals[0])
+}
+
+func decodeValue(v reflect.Value, s string) error {
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return decodeValue(v.Elem(), s)
+	}
+	if v.CanAddr() && v.Addr().Type().Implements(textUnmarshalerType) {
+		return v.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(s))
+	}
+	if v.Type() == durationType {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Slice:
+		v.SetBytes([]byte(s))
+	case reflect.Bool:
+		if s == "on" {
+			//HTML checkboxes without value attribute are posted as on
+			v.SetBool(true)
+			return nil
+		}
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u, err := strconv.ParseUint(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(s, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	default:
+		return fmt.Errorf("Unsupported type %s", v.Type())
+	}
+	return nil
+}
+
+func encodeStruct(values url.Values, rv reflect.Value) error {
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		f := rt.Field(i)
+		name, ok := fieldName(f)
+		if !ok {
+			continue
+		}
+		fv := rv.Field(i)
+		if f.Anonymous && f.Tag.Get(TagName) == "" && fv.Kind() == reflect.Struct {
+			if err := encodeStruct(values, fv); err != nil {
+				return err
+			}
+			continue
+		}
+		if fv.Kind() == reflect.Slice && fv.Type().Elem().Kind() != reflect.Uint8 && !fv.Type().Implements(textMarshalerType) {
+			for j := 0; j < fv.Len(); j++ {
+				s, err := encodeValue(fv.Index(j))
+				if err != nil {
+					return fmt.Errorf("Invalid form field %s: %s", name, err.Error())
+				}
+				values.Add(name, s)
+			}
+			continue
+		}
+		if fv.Kind() == reflect.Ptr && fv.IsNil() {
+			continue
+		}
+		s, err := encodeValue(fv)
+		if err != nil {
+			return fmt.Errorf("Invalid form field %s: %s", name, err.Error())
+		}
+		values.Set(name, s)
+	}
+	return nil
+}
+
+func encodeValue(v reflect.Value) (string, error) {
+	if v.Kind() == reflect.Ptr {
+		return encodeValue(v.Elem())
+	}
+	if v.Type().Implements(textMarshalerType) {
+		b, err := v.Interface().(encoding.TextMarshaler).MarshalText()
+		return string(b), err
+	}
+	if v.Type() == durationType {
+		return time.Duration(v.Int()).String(), nil
+	}
+	switch v.Kind() {
+	case reflect.String:
+		return v.String(), nil
+	case reflect.Slice:
+		return string(v.Bytes()), nil
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(v.Uint(), 10), nil
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'f', -1, v.Type().Bits()), nil
+	default:
+		return "", fmt.Errorf("Unsupported type %s", v.Type())
+	}
+}
+
+//Marshal writes a url encoded form representation of the struct instance
+func Marshal(w io.Writer, data interface{}) error {
+	formBytes, err := MarshalBytes(data)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(formBytes)
+	return err
+}
+
+//Unmarshal reads a url encoded form representation into the struct instance
+func Unmarshal(r io.Reader, result interface{}) error {
+	var buf bytes.Buffer
+	if _, err := buf.ReadFrom(r); err != nil {
+		return err
+	}
+	return UnmarshalBytes(buf.Bytes(), result)
+}
+
+//MarshalBytes writes a url encoded form representation of the struct instance
+func MarshalBytes(data interface{}) ([]byte, error) {
+	values, err := Encode(data)
+	var formBytes []byte
+	if err == nil {
+		formBytes = []byte(values.Encode())
+	}
+	l.Debug("form.MarshalBytes",
+		l.Int("len", len(formBytes)),
+		l.Err(err),
+	)
+	return formBytes, err
+}
+
+//UnmarshalBytes reads a url encoded form representation into the struct instance
+func UnmarshalBytes(raw []byte, result interface{}) error {
+	values, err := url.ParseQuery(string(raw))
+	if err == nil {
+		err = Decode(values, result)
+	}
+	l.Debug("form.UnmarshalBytes",
+		l.Bool("nilResult", result == nil),
+		l.Err(err),
+	)
+	return err
+}
+
+//Media is a struct to helps writes and reads of a url encoded form representation
+type Media struct {
+}
+
+//Marshal writes a url encoded form representation of the struct instance
+func (Media) Marshal(writer io.Writer, val interface{}) error {
+	return Marshal(writer, val)
+}
+
+//Unmarshal reads a url encoded form representation into the struct instance
+func (Media) Unmarshal(reader io.Reader, ref interface{}) error {
+	return Unmarshal(reader, ref)
+}
+
+//MarshalBytes writes a url encoded form representation of the struct instance
+func (Media) MarshalBytes(val interface{}) ([]byte, error) {
+	return MarshalBytes(val)
+}
+
+//UnmarshalBytes reads a url encoded form representation into the struct instance
+func (Media) UnmarshalBytes(raw []byte, ref interface{}) error {
+	return UnmarshalBytes(raw, ref)
+}
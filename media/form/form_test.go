@@ -0,0 +1,194 @@
+package form
+
+import (
+	"bytes"
+	"github.com/rjansen/l"
+	"github.com/rjansen/l/zap"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net"
+	"net/url"
+	"os"
+	"testing"
+	"time"
+)
+
+func init() {
+	if setupErr := zap.Setup(new(l.Configuration)); setupErr != nil {
+		panic(setupErr)
+	}
+	l.Info("context.media.form_test.init")
+}
+
+type mockLogin struct {
+	Username string `form:"fivecolors_username"`
+	Password string `form:"fivecolors_password"`
+	Remember bool   `form:"remember"`
+}
+
+type mockForm struct {
+	mockLogin
+	Age      int           `form:"age"`
+	Score    float64       `form:"score"`
+	Tags     []string      `form:"tags"`
+	IDs      []uint        `form:"ids"`
+	TTL      time.Duration `form:"ttl"`
+	IP       net.IP        `form:"ip"`
+	Nickname *string       `form:"nickname"`
+	Ignored  string        `form:"-"`
+	Default  string
+}
+
+func TestFormUnmarshalBytes(t *testing.T) {
+	raw := []byte("fivecolors_username=mock&fivecolors_password=p%40ss&remember=on&age=35&score=9.5" +
+		"&tags=a&tags=b&ids=1&ids=2&ttl=30m&ip=127.0.0.1&nickname=mck&Ignored=x&Default=d")
+	var result mockForm
+	e := UnmarshalBytes(raw, &result)
+	assert.Nil(t, e)
+	assert.Equal(t, "mock", result.Username)
+	assert.Equal(t, "p@ss", result.Password)
+	assert.True(t, result.Remember)
+	assert.Equal(t, 35, result.Age)
+	assert.Equal(t, 9.5, result.Score)
+	assert.Equal(t, []string{"a", "b"}, result.Tags)
+	assert.Equal(t, []uint{1, 2}, result.IDs)
+	assert.Equal(t, 30*time.Minute, result.TTL)
+	assert.Equal(t, "127.0.0.1", result.IP.String())
+	assert.Equal(t, "mck", *result.Nickname)
+	assert.Empty(t, result.Ignored)
+	assert.Equal(t, "d", result.Default)
+
+	var values url.Values
+	assert.Nil(t, UnmarshalBytes(raw, &values))
+	assert.Equal(t, "mock", values.Get("fivecolors_username"))
+}
+
+func TestFormMarshalAndUnmarshal(t *testing.T) {
+	nickname := "mck"
+	m := &mockForm{
+		mockLogin: mockLogin{Username: "mock", Password: "p@ss"},
+		Age:       35,
+		Tags:      []string{"a", "b"},
+		TTL:       time.Second,
+		IP:        net.ParseIP("10.0.0.1"),
+		Nickname:  &nickname,
+		Ignored:   "x",
+	}
+	var media Media
+	mockBuffer := new(bytes.Buffer)
+	assert.Nil(t, media.Marshal(mockBuffer, m))
+	assert.False(t, bytes.Contains(mockBuffer.Bytes(), []byte("Ignored")), "Ignored field was encoded")
+
+	var result mockForm
+	assert.Nil(t, media.Unmarshal(mockBuffer, &result))
+	m.Ignored = ""
+	assert.Equal(t, *m, result)
+}
+
+func TestFormErr(t *testing.T) {
+	var result mockForm
+	assert.Equal(t, ErrInvalidFormReference, UnmarshalBytes([]byte("age=1"), result))
+	assert.Equal(t, ErrInvalidFormReference, UnmarshalBytes([]byte("age=1"), new(string)))
+	assert.NotNil(t, UnmarshalBytes([]byte("age=invalid"), &result))
+	assert.NotNil(t, UnmarshalBytes([]byte("ttl=invalid"), &result))
+	assert.NotNil(t, UnmarshalBytes([]byte("age=%zz"), &result))
+
+	_, e := MarshalBytes("invalid")
+	assert.Equal(t, ErrInvalidFormReference, e)
+}
+
+func newMockMultipart(t *testing.T, fileContent []byte) (*bytes.Buffer, string) {
+	body := new(bytes.Buffer)
+	writer := multipart.NewWriter(body)
+	assert.Nil(t, writer.WriteField("fivecolors_username", "mock"))
+	assert.Nil(t, writer.WriteField("fivecolors_password", "p@ss"))
+	fileWriter, err := writer.CreateFormFile("avatar", "avatar.png")
+	assert.Nil(t, err)
+	_, err = fileWriter.Write(fileContent)
+	assert.Nil(t, err)
+	assert.Nil(t, writer.Close())
+	return body, writer.Boundary()
+}
+
+func TestReadMultipart(t *testing.T) {
+	fileContent := bytes.Repeat([]byte("multipart mock file "), 64)
+	body, boundary := newMockMultipart(t, fileContent)
+
+	var result mockLogin
+	var parts []*Part
+	var content []byte
+	e := ReadMultipart(body, boundary, DefaultLimits, &result, func(p *Part) error {
+		parts = append(parts, p)
+		var err error
+		content, err = ioutil.ReadAll(p)
+		return err
+	})
+	assert.Nil(t, e)
+	assert.Equal(t, "mock", result.Username)
+	assert.Equal(t, "p@ss", result.Password)
+	assert.Len(t, parts, 1)
+	assert.Equal(t, "avatar", parts[0].FieldName)
+	assert.Equal(t, "avatar.png", parts[0].FileName)
+	assert.Equal(t, fileContent, content)
+}
+
+func TestReadMultipartTempFiles(t *testing.T) {
+	fileContent := bytes.Repeat([]byte("multipart mock file "), 64)
+	body, boundary := newMockMultipart(t, fileContent)
+
+	tempFiles := new(TempFiles)
+	e := ReadMultipart(body, boundary, DefaultLimits, nil, tempFiles.Handle)
+	assert.Nil(t, e)
+	assert.Len(t, tempFiles.Files, 1)
+	file := tempFiles.Files[0]
+	assert.Equal(t, "avatar", file.FieldName)
+	assert.Equal(t, "avatar.png", file.FileName)
+	assert.Equal(t, "application/octet-stream", file.ContentType)
+	assert.Equal(t, int64(len(fileContent)), file.Size)
+	stored, err := ioutil.ReadFile(file.Path)
+	assert.Nil(t, err)
+	assert.Equal(t, fileContent, stored)
+
+	assert.Nil(t, tempFiles.RemoveAll())
+	_, err = os.Stat(file.Path)
+	assert.True(t, os.IsNotExist(err), "Temp file was not removed")
+}
+
+func TestReadMultipartErr(t *testing.T) {
+	fileContent := bytes.Repeat([]byte("multipart mock file "), 64)
+	discard := func(p *Part) error {
+		_, err := io.Copy(ioutil.Discard, p)
+		return err
+	}
+	ignore := func(p *Part) error {
+		return nil
+	}
+
+	body, boundary := newMockMultipart(t, fileContent)
+	e := ReadMultipart(body, boundary, DefaultLimits, nil, nil)
+	assert.Equal(t, ErrUnhandledFilePart, e)
+
+	body, boundary = newMockMultipart(t, fileContent)
+	e = ReadMultipart(body, boundary, Limits{MaxPartSize: 128}, nil, discard)
+	assert.Equal(t, ErrPartTooLarge, e)
+
+	body, boundary = newMockMultipart(t, fileContent)
+	e = ReadMultipart(body, boundary, Limits{MaxPartSize: 128}, nil, ignore)
+	assert.Equal(t, ErrPartTooLarge, e)
+
+	body, boundary = newMockMultipart(t, fileContent)
+	e = ReadMultipart(body, boundary, Limits{MaxTotalSize: int64(len(fileContent))}, nil, discard)
+	assert.Equal(t, ErrMultipartTooLarge, e)
+
+	body, boundary = newMockMultipart(t, fileContent)
+	e = ReadMultipart(body, boundary, Limits{MaxPartSize: 2}, nil, discard)
+	assert.Equal(t, ErrPartTooLarge, e)
+
+	tempFiles := &TempFiles{Dir: os.TempDir()}
+	body, boundary = newMockMultipart(t, fileContent)
+	e = ReadMultipart(body, boundary, Limits{MaxPartSize: 128}, nil, tempFiles.Handle)
+	assert.Equal(t, ErrPartTooLarge, e)
+	assert.Empty(t, tempFiles.Files)
+}
@@ -0,0 +1,177 @@
+package form
+
+import (
+	"bytes"
+	"errors"
+	"github.com/rjansen/l"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/textproto"
+	"net/url"
+	"os"
+)
+
+const (
+	//MultipartContentType is a constant to hold the multipart form content type value
+	MultipartContentType = "multipart/form-data"
+)
+
+var (
+	//ErrPartTooLarge is returned when a single multipart part exceeds Limits.MaxPartSize
+	ErrPartTooLarge = errors.New("The multipart part exceeds the max part size")
+	//ErrMultipartTooLarge is returned when the sum of the multipart parts exceeds Limits.MaxTotalSize
+	ErrMultipartTooLarge = errors.New("The multipart form exceeds the max total size")
+	//ErrUnhandledFilePart is returned when a file part is read without a PartFunc to handle it
+	ErrUnhandledFilePart = errors.New("The multipart form has a file part but no part handler was provided")
+	//DefaultLimits are the limits used when the multipart form is read by content type
+	DefaultLimits = Limits{
+		MaxPartSize:  10 << 20,
+		MaxTotalSize: 32 << 20,
+	}
+)
+
+//Limits holds the size limits in bytes of a multipart form, zero or less disables the check
+type Limits struct {
+	MaxPartSize  int64
+	MaxTotalSize int64
+}
+
+//Part is a multipart file part. Reads fail with ErrPartTooLarge or ErrMultipartTooLarge when a limit is exceeded
+type Part struct {
+	io.Reader
+	FieldName string
+	FileName  string
+	Header    textproto.MIMEHeader
+}
+
+//PartFunc is a func that consumes a multipart file part
+type PartFunc func(*Part) error
+
+type limitReader struct {
+	r      io.Reader
+	limits Limits
+	part   int64
+	total  *int64
+}
+
+func (lr *limitReader) Read(p []byte) (int, error) {
+	n, err := lr.r.Read(p)
+	lr.part += int64(n)
+	*lr.total += int64(n)
+	if limitErr := lr.err(); limitErr != nil {
+		return n, limitErr
+	}
+	return n, err
+}
+
+func (lr *limitReader) err() error {
+	if lr.limits.MaxPartSize > 0 && lr.part > lr.limits.MaxPartSize {
+		return ErrPartTooLarge
+	}
+	if lr.limits.MaxTotalSize > 0 && *lr.total > lr.limits.MaxTotalSize {
+		return ErrMultipartTooLarge
+	}
+	return nil
+}
+
+//ReadMultipart reads a multipart form stream with the provided boundary.
+//Value parts are decoded into result like a url encoded form and file parts are passed to handle
+func ReadMultipart(r io.Reader, boundary string, limits Limits, result interface{}, handle PartFunc) error {
+	reader := multipart.NewReader(r, boundary)
+	values := make(url.Values)
+	var total int64
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		lr := &limitReader{r: part, limits: limits, total: &total}
+		if part.FileName() == "" {
+			var buf bytes.Buffer
+			if _, err := buf.ReadFrom(lr); err != nil {
+				return err
+			}
+			values.Add(part.FormName(), buf.String())
+			continue
+		}
+		if handle == nil {
+			return ErrUnhandledFilePart
+		}
+		if err := handle(&Part{
+			Reader:    lr,
+			FieldName: part.FormName(),
+			FileName:  part.FileName(),
+			Header:    part.Header,
+		}); err != nil {
+			return err
+		}
+		//Consumes what the handler left behind, so the limits also hold for unread bytes
+		if _, err := io.Copy(ioutil.Discard, lr); err != nil {
+			return err
+		}
+	}
+	l.Debug("form.ReadMultipart",
+		l.Int("values", len(values)),
+		l.Int64("size", total),
+	)
+	if result == nil {
+		return nil
+	}
+	return Decode(values, result)
+}
+
+//TempFile is a multipart file part stored in the local file system
+type TempFile struct {
+	FieldName   string
+	FileName    string
+	ContentType string
+	Path        string
+	Size        int64
+}
+
+//TempFiles stores multipart file parts as temp files. Its Handle method is a PartFunc
+type TempFiles struct {
+	//Dir is the directory of the temp files, empty uses the default temp directory
+	Dir   string
+	Files []TempFile
+}
+
+//Handle copies the provided part into a new temp file
+func (t *TempFiles) Handle(p *Part) error {
+	f, err := ioutil.TempFile(t.Dir, "haki-multipart-")
+	if err != nil {
+		return err
+	}
+	size, err := io.Copy(f, p)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	t.Files = append(t.Files, TempFile{
+		FieldName:   p.FieldName,
+		FileName:    p.FileName,
+		ContentType: p.Header.Get("Content-Type"),
+		Path:        f.Name(),
+		Size:        size,
+	})
+	return nil
+}
+
+//RemoveAll removes all stored temp files and returns the last raised error
+func (t *TempFiles) RemoveAll() error {
+	var err error
+	for _, f := range t.Files {
+		if removeErr := os.Remove(f.Path); removeErr != nil {
+			err = removeErr
+		}
+	}
+	t.Files = nil
+	return err
+}
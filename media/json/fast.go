@@ -0,0 +1,816 @@
+package json
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math"
+	"reflect"
+	"strconv"
+	"sync"
+	"time"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+//Marshaler is implemented by types with a generated json marshaler, see the hakijson command
+type Marshaler interface {
+	//MarshalJSONTo appends the json representation of the instance to buf and returns the extended slice
+	MarshalJSONTo(buf []byte) ([]byte, error)
+}
+
+//Unmarshaler is implemented by types with a generated json unmarshaler, see the hakijson command
+type Unmarshaler interface {
+	//UnmarshalJSONFrom reads the json representation in raw into the instance
+	UnmarshalJSONFrom(raw []byte) error
+}
+
+var (
+	//ErrInvalidJSON is returned by the generated unmarshalers when the input is not valid json
+	ErrInvalidJSON = errors.New("Invalid json input")
+	//ErrInvalidTimeYear is returned when a time with a year outside of [0,9999] is marshaled
+	ErrInvalidTimeYear = errors.New("The time year is outside of range [0,9999]")
+
+	nullLiteral = []byte("null")
+)
+
+const hex = "0123456789abcdef"
+
+//AppendString appends the quoted json representation of s to dst, escaping like encoding/json
+func AppendString(dst []byte, s string) []byte {
+	dst = append(dst, '"')
+	start := 0
+	for i := 0; i < len(s); {
+		if b := s[i]; b < utf8.RuneSelf {
+			if b >= 0x20 && b != '"' && b != '\\' && b != '<' && b != '>' && b != '&' {
+				i++
+				continue
+			}
+			dst = append(dst, s[start:i]...)
+			switch b {
+			case '"', '\\':
+				dst = append(dst, '\\', b)
+			case '\b':
+				dst = append(dst, '\\', 'b')
+			case '\f':
+				dst = append(dst, '\\', 'f')
+			case '\n':
+				dst = append(dst, '\\', 'n')
+			case '\r':
+				dst = append(dst, '\\', 'r')
+			case '\t':
+				dst = append(dst, '\\', 't')
+			default:
+				dst = append(dst, '\\', 'u', '0', '0', hex[b>>4], hex[b&0xF])
+			}
+			i++
+			start = i
+			continue
+		}
+		c, size := utf8.DecodeRuneInString(s[i:])
+		if c == utf8.RuneError && size == 1 {
+			dst = append(dst, s[start:i]...)
+			dst = append(dst, "\ufffd"...)
+			i += size
+			start = i
+			continue
+		}
+		if c == '\u2028' || c == '\u2029' {
+			dst = append(dst, s[start:i]...)
+			dst = append(dst, '\\', 'u', '2', '0', '2', hex[c&0xF])
+			i += size
+			start = i
+			continue
+		}
+		i += size
+	}
+	dst = append(dst, s[start:]...)
+	return append(dst, '"')
+}
+
+//AppendBytes appends the base64 json representation of b to dst, a nil slice is written as null
+func AppendBytes(dst []byte, b []byte) []byte {
+	if b == nil {
+		return append(dst, nullLiteral...)
+	}
+	dst = append(dst, '"')
+	n := base64.StdEncoding.EncodedLen(len(b))
+	if cap(dst)-len(dst) < n {
+		grown := make([]byte, len(dst), len(dst)+n+1)
+		copy(grown, dst)
+		dst = grown
+	}
+	base64.StdEncoding.Encode(dst[len(dst):len(dst)+n], b)
+	dst = dst[:len(dst)+n]
+	return append(dst, '"')
+}
+
+//AppendBool appends the json representation of b to dst
+func AppendBool(dst []byte, b bool) []byte {
+	return strconv.AppendBool(dst, b)
+}
+
+//AppendInt appends the json representation of i to dst
+func AppendInt(dst []byte, i int64) []byte {
+	return strconv.AppendInt(dst, i, 10)
+}
+
+//AppendUint appends the json representation of u to dst
+func AppendUint(dst []byte, u uint64) []byte {
+	return strconv.AppendUint(dst, u, 10)
+}
+
+//AppendFloat appends the json representation of f, with the provided bit size, to dst using the encoding/json format
+func AppendFloat(dst []byte, f float64, bits int) ([]byte, error) {
+	if math.IsInf(f, 0) || math.IsNaN(f) {
+		return dst, &json.UnsupportedValueError{
+			Value: reflect.ValueOf(f),
+			Str:   strconv.FormatFloat(f, 'g', -1, bits),
+		}
+	}
+	format := byte('f')
+	if abs := math.Abs(f); abs != 0 {
+		if bits == 64 && (abs < 1e-6 || abs >= 1e21) || bits == 32 && (float32(abs) < 1e-6 || float32(abs) >= 1e21) {
+			format = 'e'
+		}
+	}
+	dst = strconv.AppendFloat(dst, f, format, -1, bits)
+	if format == 'e' {
+		//Cleans up e-09 to e-9 like encoding/json
+		if n := len(dst); n >= 4 && dst[n-4] == 'e' && dst[n-3] == '-' && dst[n-2] == '0' {
+			dst[n-2] = dst[n-1]
+			dst = dst[:n-1]
+		}
+	}
+	return dst, nil
+}
+
+//AppendTime appends the RFC 3339 json representation of t to dst, like time.Time.MarshalJSON
+func AppendTime(dst []byte, t time.Time) ([]byte, error) {
+	if y := t.Year(); y < 0 || y >= 10000 {
+		return dst, ErrInvalidTimeYear
+	}
+	dst = append(dst, '"')
+	dst = t.AppendFormat(dst, time.RFC3339Nano)
+	return append(dst, '"'), nil
+}
+
+//AppendValue appends the json representation of v to dst, using its generated marshaler when available or encoding/json
+func AppendValue(dst []byte, v interface{}) ([]byte, error) {
+	if m, ok := v.(Marshaler); ok {
+		return m.MarshalJSONTo(dst)
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return dst, err
+	}
+	return append(dst, b...), nil
+}
+
+//IsEmptyValue returns true when v is empty by the encoding/json omitempty rules
+func IsEmptyValue(v interface{}) bool {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Invalid:
+		return true
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return rv.Len() == 0
+	case reflect.Bool:
+		return !rv.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return rv.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return rv.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return rv.Float() == 0
+	case reflect.Interface, reflect.Ptr:
+		return rv.IsNil()
+	}
+	return false
+}
+
+func skipSpace(data []byte, i int) int {
+	for i < len(data) {
+		switch data[i] {
+		case ' ', '\t', '\n', '\r':
+			i++
+		default:
+			return i
+		}
+	}
+	return i
+}
+
+//stringEnd returns the index after the json string that starts at i, validating its escapes and control characters
+func stringEnd(data []byte, i int) (int, error) {
+	for i++; i < len(data); i++ {
+		switch c := data[i]; {
+		case c == '"':
+			return i + 1, nil
+		case c == '\\':
+			if i+1 >= len(data) {
+				return i, ErrInvalidJSON
+			}
+			switch data[i+1] {
+			case '"', '\\', '/', 'b', 'f', 'n', 'r', 't':
+				i++
+			case 'u':
+				if _, ok := hexRune(data[i+2:]); !ok {
+					return i, ErrInvalidJSON
+				}
+				i += 5
+			default:
+				return i, ErrInvalidJSON
+			}
+		case c < 0x20:
+			return i, ErrInvalidJSON
+		}
+	}
+	return i, ErrInvalidJSON
+}
+
+//maxDepth is the max nesting of the json objects and arrays, like encoding/json
+const maxDepth = 10000
+
+//valueEnd returns the index after the json value that starts at i.
+//The whole value is validated, so the members skipped by the generated unmarshalers fail like encoding/json
+func valueEnd(data []byte, i int) (int, error) {
+	return skipValue(data, i, 0)
+}
+
+func skipValue(data []byte, i int, depth int) (int, error) {
+	if i >= len(data) {
+		return i, ErrInvalidJSON
+	}
+	switch c := data[i]; {
+	case c == '"':
+		return stringEnd(data, i)
+	case c == '{' || c == '[':
+		if depth >= maxDepth {
+			return i, ErrInvalidJSON
+		}
+		return containerEnd(data, i, depth+1)
+	case c == 't':
+		return literalEnd(data, i, "true")
+	case c == 'f':
+		return literalEnd(data, i, "false")
+	case c == 'n':
+		return literalEnd(data, i, "null")
+	case c == '-' || ('0' <= c && c <= '9'):
+		return numberEnd(data, i)
+	}
+	return i, ErrInvalidJSON
+}
+
+//containerEnd returns the index after the json object or array that starts at i
+func containerEnd(data []byte, i int, depth int) (int, error) {
+	object := data[i] == '{'
+	closing := byte(']')
+	if object {
+		closing = '}'
+	}
+	i = skipSpace(data, i+1)
+	if i < len(data) && data[i] == closing {
+		return i + 1, nil
+	}
+	for {
+		var err error
+		if object {
+			if i >= len(data) || data[i] != '"' {
+				return i, ErrInvalidJSON
+			}
+			if i, err = stringEnd(data, i); err != nil {
+				return i, err
+			}
+			i = skipSpace(data, i)
+			if i >= len(data) || data[i] != ':' {
+				return i, ErrInvalidJSON
+			}
+			i = skipSpace(data, i+1)
+		}
+		if i, err = skipValue(data, i, depth); err != nil {
+			return i, err
+		}
+		i = skipSpace(data, i)
+		if i >= len(data) {
+			return i, ErrInvalidJSON
+		}
+		switch data[i] {
+		case ',':
+			i = skipSpace(data, i+1)
+		case closing:
+			return i + 1, nil
+		default:
+			return i, ErrInvalidJSON
+		}
+	}
+}
+
+func literalEnd(data []byte, i int, literal string) (int, error) {
+	end := i + len(literal)
+	if end > len(data) || string(data[i:end]) != literal {
+		return i, ErrInvalidJSON
+	}
+	return end, nil
+}
+
+//numberEnd returns the index after the json number that starts at i, following the json number grammar
+func numberEnd(data []byte, i int) (int, error) {
+	if data[i] == '-' {
+		i++
+	}
+	switch {
+	case i < len(data) && data[i] == '0':
+		i++
+	case i < len(data) && '1' <= data[i] && data[i] <= '9':
+		i = digitsEnd(data, i)
+	default:
+		return i, ErrInvalidJSON
+	}
+	if i < len(data) && data[i] == '.' {
+		end := digitsEnd(data, i+1)
+		if end == i+1 {
+			return end, ErrInvalidJSON
+		}
+		i = end
+	}
+	if i < len(data) && (data[i] == 'e' || data[i] == 'E') {
+		i++
+		if i < len(data) && (data[i] == '+' || data[i] == '-') {
+			i++
+		}
+		end := digitsEnd(data, i)
+		if end == i {
+			return end, ErrInvalidJSON
+		}
+		i = end
+	}
+	return i, nil
+}
+
+func digitsEnd(data []byte, i int) int {
+	for i < len(data) && '0' <= data[i] && data[i] <= '9' {
+		i++
+	}
+	return i
+}
+
+//MatchKey returns the name equal to the key or, like encoding/json, the first name equal to it under case folding.
+//It returns empty when no name matches
+func MatchKey(key []byte, names ...string) string {
+	for _, name := range names {
+		if string(key) == name {
+			return name
+		}
+	}
+	for _, name := range names {
+		if bytes.EqualFold(key, []byte(name)) {
+			return name
+		}
+	}
+	return ""
+}
+
+//IsNull returns true when the provided json value is the null literal
+func IsNull(value []byte) bool {
+	return bytes.Equal(value, nullLiteral)
+}
+
+//ObjectScanner iterates over the members of a json object without allocations. The zero value is ready to Reset
+type ObjectScanner struct {
+	data    []byte
+	pos     int
+	key     []byte
+	value   []byte
+	started bool
+	done    bool
+	err     error
+}
+
+//Reset starts the scan of the provided json object, the null literal is handled as an object without members
+func (s *ObjectScanner) Reset(raw []byte) {
+	*s = ObjectScanner{data: raw}
+}
+
+//Next moves to the next object member and returns false when the object ends or an error is found
+func (s *ObjectScanner) Next() bool {
+	if s.done || s.err != nil {
+		return false
+	}
+	data := s.data
+	i := skipSpace(data, s.pos)
+	if !s.started {
+		s.started = true
+		if bytes.HasPrefix(data[i:], nullLiteral) {
+			return s.end(i + len(nullLiteral))
+		}
+		if i >= len(data) || data[i] != '{' {
+			return s.fail(i)
+		}
+		i = skipSpace(data, i+1)
+		if i < len(data) && data[i] == '}' {
+			return s.end(i + 1)
+		}
+	} else {
+		if i >= len(data) {
+			return s.fail(i)
+		}
+		if data[i] == '}' {
+			return s.end(i + 1)
+		}
+		if data[i] != ',' {
+			return s.fail(i)
+		}
+		i = skipSpace(data, i+1)
+	}
+	if i >= len(data) || data[i] != '"' {
+		return s.fail(i)
+	}
+	end, err := stringEnd(data, i)
+	if err != nil {
+		return s.fail(end)
+	}
+	key := data[i+1 : end-1]
+	if bytes.IndexByte(key, '\\') >= 0 {
+		unquoted, err := ParseString(data[i:end])
+		if err != nil {
+			return s.fail(i)
+		}
+		key = []byte(unquoted)
+	}
+	i = skipSpace(data, end)
+	if i >= len(data) || data[i] != ':' {
+		return s.fail(i)
+	}
+	i = skipSpace(data, i+1)
+	end, err = valueEnd(data, i)
+	if err != nil {
+		return s.fail(end)
+	}
+	s.key, s.value, s.pos = key, data[i:end], end
+	return true
+}
+
+//Key returns the unquoted name of the current member
+func (s *ObjectScanner) Key() []byte {
+	return s.key
+}
+
+//Value returns the raw json value of the current member
+func (s *ObjectScanner) Value() []byte {
+	return s.value
+}
+
+//Err returns the error found by the scan
+func (s *ObjectScanner) Err() error {
+	return s.err
+}
+
+func (s *ObjectScanner) end(i int) bool {
+	s.done, s.pos = true, i
+	if skipSpace(s.data, i) != len(s.data) {
+		s.err = ErrInvalidJSON
+	}
+	return false
+}
+
+func (s *ObjectScanner) fail(i int) bool {
+	s.pos, s.err = i, ErrInvalidJSON
+	return false
+}
+
+//ArrayScanner iterates over the elements of a json array without allocations. The zero value is ready to Reset
+type ArrayScanner struct {
+	data    []byte
+	pos     int
+	value   []byte
+	started bool
+	done    bool
+	err     error
+}
+
+//Reset starts the scan of the provided json array, the null literal is handled as an empty array
+func (s *ArrayScanner) Reset(raw []byte) {
+	*s = ArrayScanner{data: raw}
+}
+
+//Next moves to the next array element and returns false when the array ends or an error is found
+func (s *ArrayScanner) Next() bool {
+	if s.done || s.err != nil {
+		return false
+	}
+	data := s.data
+	i := skipSpace(data, s.pos)
+	if !s.started {
+		s.started = true
+		if bytes.HasPrefix(data[i:], nullLiteral) {
+			return s.end(i + len(nullLiteral))
+		}
+		if i >= len(data) || data[i] != '[' {
+			return s.fail(i)
+		}
+		i = skipSpace(data, i+1)
+		if i < len(data) && data[i] == ']' {
+			return s.end(i + 1)
+		}
+	} else {
+		if i >= len(data) {
+			return s.fail(i)
+		}
+		if data[i] == ']' {
+			return s.end(i + 1)
+		}
+		if data[i] != ',' {
+			return s.fail(i)
+		}
+		i = skipSpace(data, i+1)
+	}
+	end, err := valueEnd(data, i)
+	if err != nil {
+		return s.fail(end)
+	}
+	s.value, s.pos = data[i:end], end
+	return true
+}
+
+//Value returns the raw json value of the current element
+func (s *ArrayScanner) Value() []byte {
+	return s.value
+}
+
+//Err returns the error found by the scan
+func (s *ArrayScanner) Err() error {
+	return s.err
+}
+
+func (s *ArrayScanner) end(i int) bool {
+	s.done, s.pos = true, i
+	if skipSpace(s.data, i) != len(s.data) {
+		s.err = ErrInvalidJSON
+	}
+	return false
+}
+
+func (s *ArrayScanner) fail(i int) bool {
+	s.pos, s.err = i, ErrInvalidJSON
+	return false
+}
+
+//ParseString returns the unquoted value of the provided json string
+func ParseString(value []byte) (string, error) {
+	if len(value) < 2 || value[0] != '"' || value[len(value)-1] != '"' {
+		return "", ErrInvalidJSON
+	}
+	raw := value[1 : len(value)-1]
+	for i, b := range raw {
+		if b == '\\' || b == '"' || b < 0x20 || b >= utf8.RuneSelf {
+			var stack [64]byte
+			unquoted, err := unquote(append(stack[:0], raw[:i]...), raw[i:])
+			return internString(unquoted), err
+		}
+	}
+	return internString(raw), nil
+}
+
+//maxInternSize is the max length of the strings reused by the internString
+const maxInternSize = 16
+
+//stringCache keeps recent short strings by hash, collisions just replace the entry
+type stringCache [256]string
+
+var stringCaches = sync.Pool{
+	New: func() interface{} {
+		return new(stringCache)
+	},
+}
+
+//internString returns b as a string, reusing the cached short strings like the encoding/json decoder,
+//so repeated values like enum names and short identifiers do not allocate
+func internString(b []byte) string {
+	if len(b) == 0 || len(b) > maxInternSize {
+		return string(b)
+	}
+	var h uint32 = 2166136261
+	for _, c := range b {
+		h = (h ^ uint32(c)) * 16777619
+	}
+	cache := stringCaches.Get().(*stringCache)
+	entry := &cache[h&uint32(len(cache)-1)]
+	if *entry != string(b) {
+		*entry = string(b)
+	}
+	s := *entry
+	stringCaches.Put(cache)
+	return s
+}
+
+//unquote appends to dst the unescaped raw string content, invalid UTF-8 is replaced like encoding/json
+func unquote(dst []byte, raw []byte) ([]byte, error) {
+	for i := 0; i < len(raw); {
+		c := raw[i]
+		switch {
+		case c == '\\':
+			if i+1 >= len(raw) {
+				return dst, ErrInvalidJSON
+			}
+			switch raw[i+1] {
+			case '"', '\\', '/':
+				dst = append(dst, raw[i+1])
+			case 'b':
+				dst = append(dst, '\b')
+			case 'f':
+				dst = append(dst, '\f')
+			case 'n':
+				dst = append(dst, '\n')
+			case 'r':
+				dst = append(dst, '\r')
+			case 't':
+				dst = append(dst, '\t')
+			case 'u':
+				r, ok := hexRune(raw[i+2:])
+				if !ok {
+					return dst, ErrInvalidJSON
+				}
+				i += 6
+				if utf16.IsSurrogate(r) {
+					if i+1 < len(raw) && raw[i] == '\\' && raw[i+1] == 'u' {
+						if r2, ok := hexRune(raw[i+2:]); ok {
+							if decoded := utf16.DecodeRune(r, r2); decoded != utf8.RuneError {
+								i += 6
+								dst = appendRune(dst, decoded)
+								continue
+							}
+						}
+					}
+					r = utf8.RuneError
+				}
+				dst = appendRune(dst, r)
+				continue
+			default:
+				return dst, ErrInvalidJSON
+			}
+			i += 2
+		case c == '"' || c < 0x20:
+			return dst, ErrInvalidJSON
+		case c < utf8.RuneSelf:
+			dst = append(dst, c)
+			i++
+		default:
+			r, size := utf8.DecodeRune(raw[i:])
+			if r == utf8.RuneError && size == 1 {
+				dst = appendRune(dst, r)
+			} else {
+				dst = append(dst, raw[i:i+size]...)
+			}
+			i += size
+		}
+	}
+	return dst, nil
+}
+
+func hexRune(b []byte) (rune, bool) {
+	if len(b) < 4 {
+		return 0, false
+	}
+	var r rune
+	for _, c := range b[:4] {
+		switch {
+		case '0' <= c && c <= '9':
+			c = c - '0'
+		case 'a' <= c && c <= 'f':
+			c = c - 'a' + 10
+		case 'A' <= c && c <= 'F':
+			c = c - 'A' + 10
+		default:
+			return 0, false
+		}
+		r = r*16 + rune(c)
+	}
+	return r, true
+}
+
+func appendRune(dst []byte, r rune) []byte {
+	var buf [utf8.UTFMax]byte
+	n := utf8.EncodeRune(buf[:], r)
+	return append(dst, buf[:n]...)
+}
+
+//ParseBytes returns the decoded value of the provided base64 json string
+func ParseBytes(value []byte) ([]byte, error) {
+	if len(value) < 2 || value[0] != '"' || value[len(value)-1] != '"' {
+		return nil, ErrInvalidJSON
+	}
+	raw := value[1 : len(value)-1]
+	if bytes.IndexByte(raw, '\\') >= 0 {
+		s, err := ParseString(value)
+		if err != nil {
+			return nil, err
+		}
+		raw = []byte(s)
+	}
+	decoded := make([]byte, base64.StdEncoding.DecodedLen(len(raw)))
+	n, err := base64.StdEncoding.Decode(decoded, raw)
+	if err != nil {
+		return nil, err
+	}
+	return decoded[:n], nil
+}
+
+//ParseBool returns the value of the provided json boolean
+func ParseBool(value []byte) (bool, error) {
+	switch string(value) {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	}
+	return false, ErrInvalidJSON
+}
+
+//ParseInt returns the value of the provided json integer number, bits 0 means the int size
+func ParseInt(value []byte, bits int) (int64, error) {
+	if bits == 0 {
+		bits = strconv.IntSize
+	}
+	negative := len(value) > 0 && value[0] == '-'
+	digits := value
+	if negative {
+		digits = value[1:]
+	}
+	u, err := parseDigits(digits)
+	if err != nil {
+		return 0, err
+	}
+	limit := uint64(1) << uint(bits-1)
+	if negative {
+		if u > limit {
+			return 0, rangeErr(value)
+		}
+		return -int64(u), nil
+	}
+	if u >= limit {
+		return 0, rangeErr(value)
+	}
+	return int64(u), nil
+}
+
+//ParseUint returns the value of the provided json unsigned integer number, bits 0 means the uint size
+func ParseUint(value []byte, bits int) (uint64, error) {
+	if bits == 0 {
+		bits = strconv.IntSize
+	}
+	u, err := parseDigits(value)
+	if err != nil {
+		return 0, err
+	}
+	if bits < 64 && u >= uint64(1)<<uint(bits) {
+		return 0, rangeErr(value)
+	}
+	return u, nil
+}
+
+//ParseFloat returns the value of the provided json number with the provided bit size
+func ParseFloat(value []byte, bits int) (float64, error) {
+	if len(value) == 0 || (value[0] != '-' && (value[0] < '0' || value[0] > '9')) {
+		return 0, ErrInvalidJSON
+	}
+	return strconv.ParseFloat(string(value), bits)
+}
+
+func parseDigits(digits []byte) (uint64, error) {
+	if len(digits) == 0 || (digits[0] == '0' && len(digits) > 1) {
+		return 0, ErrInvalidJSON
+	}
+	var u uint64
+	for _, c := range digits {
+		if c < '0' || c > '9' {
+			return 0, ErrInvalidJSON
+		}
+		if u > (math.MaxUint64-uint64(c-'0'))/10 {
+			return 0, rangeErr(digits)
+		}
+		u = u*10 + uint64(c-'0')
+	}
+	return u, nil
+}
+
+func rangeErr(value []byte) error {
+	return &strconv.NumError{Func: "ParseInt", Num: string(value), Err: strconv.ErrRange}
+}
+
+//ParseTime returns the value of the provided RFC 3339 json string, like time.Time.UnmarshalJSON
+func ParseTime(value []byte) (time.Time, error) {
+	if len(value) < 2 || value[0] != '"' || value[len(value)-1] != '"' {
+		return time.Time{}, ErrInvalidJSON
+	}
+	return time.Parse(time.RFC3339, string(value[1:len(value)-1]))
+}
+
+//UnmarshalValue reads the provided json value into ref, using its generated unmarshaler when available or encoding/json
+func UnmarshalValue(value []byte, ref interface{}) error {
+	if u, ok := ref.(Unmarshaler); ok {
+		return u.UnmarshalJSONFrom(value)
+	}
+	return json.Unmarshal(value, ref)
+}
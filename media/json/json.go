@@ -3,7 +3,9 @@ package json
 import (
 	"encoding/json"
 	"github.com/rjansen/l"
+	"github.com/valyala/bytebufferpool"
 	"io"
+	"sync"
 )
 
 const (
@@ -13,19 +15,74 @@ const (
 	ContentTypeUTF8 = "application/json; charset=utf-8"
 )
 
-//Marshal writes a json representation of the struct instance
+//encoder is a reusable json.Encoder that writes into the current target writer
+type encoder struct {
+	w   io.Writer
+	enc *json.Encoder
+}
+
+func (e *encoder) Write(b []byte) (int, error) {
+	return e.w.Write(b)
+}
+
+var encoderPool = sync.Pool{
+	New: func() interface{} {
+		e := new(encoder)
+		e.enc = json.NewEncoder(e)
+		return e
+	},
+}
+
+//Marshal writes a json representation of the struct instance.
+//Instances with a generated Marshaler skip the encoding/json reflection
 func Marshal(w io.Writer, data interface{}) error {
-	return json.NewEncoder(w).Encode(&data)
+	if m, ok := data.(Marshaler); ok {
+		buf := bytebufferpool.Get()
+		defer bytebufferpool.Put(buf)
+		var err error
+		if buf.B, err = m.MarshalJSONTo(buf.B[:0]); err != nil {
+			return err
+		}
+		//Keeps the trailing new line written by json.Encoder
+		buf.B = append(buf.B, '\n')
+		_, err = w.Write(buf.B)
+		return err
+	}
+	e := encoderPool.Get().(*encoder)
+	e.w = w
+	err := e.enc.Encode(data)
+	e.w = nil
+	encoderPool.Put(e)
+	return err
 }
 
-//Unmarshal reads a json representation into the struct instance
+//Unmarshal reads a json representation into the struct instance.
+//Instances with a generated Unmarshaler skip the encoding/json reflection
 func Unmarshal(r io.Reader, result interface{}) error {
+	if u, ok := result.(Unmarshaler); ok {
+		buf := bytebufferpool.Get()
+		defer bytebufferpool.Put(buf)
+		if _, err := buf.ReadFrom(r); err != nil {
+			return err
+		}
+		return u.UnmarshalJSONFrom(buf.B)
+	}
 	return json.NewDecoder(r).Decode(&result)
 }
 
 //MarshalBytes writes a json representation of the struct instance
 func MarshalBytes(data interface{}) ([]byte, error) {
-	jsonBytes, err := json.Marshal(data)
+	var jsonBytes []byte
+	var err error
+	if m, ok := data.(Marshaler); ok {
+		buf := bytebufferpool.Get()
+		if buf.B, err = m.MarshalJSONTo(buf.B[:0]); err == nil {
+			jsonBytes = append([]byte(nil), buf.B...)
+		}
+		bytebufferpool.Put(buf)
+	} else {
+		jsonBytes, err = json.Marshal(data)
+	}
 	l.Debug("json.MarshalBytes",
 		l.Int("len", len(jsonBytes)),
 		l.Err(err),
@@ -35,7 +92,12 @@ func MarshalBytes(data interface{}) ([]byte, error) {
 
 //UnmarshalBytes reads a json representation into the struct instance
 func UnmarshalBytes(raw []byte, result interface{}) error {
-	err := json.Unmarshal(raw, &result)
+	var err error
+	if u, ok := result.(Unmarshaler); ok {
+		err = u.UnmarshalJSONFrom(raw)
+	} else {
+		err = json.Unmarshal(raw, &result)
+	}
 	l.Debug("json.UnmarshalBytes",
 		l.Bool("nilResult", result == nil),
 		l.Err(err),
@@ -49,20 +111,20 @@ type Media struct {
 
 //Marshal writes a json representation of the struct instance
 func (Media) Marshal(writer io.Writer, val interface{}) error {
-	return Marshal(writer, &val)
+	return Marshal(writer, val)
 }
 
 //Unmarshal reads a json representation into the struct instance
 func (Media) Unmarshal(reader io.Reader, ref interface{}) error {
-	return Unmarshal(reader, &ref)
+	return Unmarshal(reader, ref)
 }
 
 //MarshalBytes writes a json representation of the struct instance
 func (Media) MarshalBytes(val interface{}) ([]byte, error) {
-	return MarshalBytes(&val)
+	return MarshalBytes(val)
 }
 
 //UnmarshalBytes reads a json representation into the struct instance
 func (Media) UnmarshalBytes(raw []byte, ref interface{}) error {
-	return UnmarshalBytes(raw, &ref)
+	return UnmarshalBytes(raw, ref)
 }
@@ -0,0 +1,318 @@
+package json_test
+
+import (
+	"bytes"
+	stdjson "encoding/json"
+	"github.com/rjansen/haki/media/json"
+	"github.com/rjansen/l"
+	"github.com/rjansen/l/zap"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+	"time"
+)
+
+func init() {
+	if setupErr := zap.Setup(new(l.Configuration)); setupErr != nil {
+		panic(setupErr)
+	}
+	l.Info("context.media.json_test.init")
+}
+
+func newMockUser() mockUser {
+	nickname := "mock <nick> & \"name\""
+	return mockUser{
+		ID:       -9007199254740993,
+		Username: "json_test.mockUser",
+		Name:     "Mock \\ User\n\t\u2028 é 日本 \xff",
+		Age:      35,
+		Score:    1234.5678,
+		Ratio:    0.1,
+		Active:   true,
+		Level:    255,
+		Avatar:   []byte{0, 1, 2, 250, 251, 252},
+		Tags:     []string{"tag1", "", "tag3"},
+		Address: mockAddress{
+			Street: "Mock Street",
+			Number: 42,
+		},
+		Previous: &mockAddress{Street: "Previous Street"},
+		Contacts: []*mockAddress{
+			&mockAddress{Street: "Contact Street", Number: 1},
+			nil,
+		},
+		Attrs:     map[string]string{"attr1": "value1", "attr2": "value2"},
+		CreatedAt: time.Date(2016, 11, 20, 10, 30, 15, 0, time.UTC),
+		Nickname:  &nickname,
+		Internal:  "never written",
+	}
+}
+
+func TestGeneratedMarshalBytes(t *testing.T) {
+	full := newMockUser()
+	floats := mockUser{Score: 1e21, Ratio: 1e-7, Tags: []string{}, Contacts: []*mockAddress{}}
+	negative := mockUser{Score: -0.000001, Ratio: 3.4e38, Age: -1}
+	for _, user := range []mockUser{full, floats, negative, mockUser{}} {
+		expected, err := stdjson.Marshal(plainUser(user))
+		assert.Nil(t, err)
+
+		generated, err := json.MarshalBytes(&user)
+		assert.Nil(t, err)
+		assert.Equal(t, string(expected), string(generated))
+
+		generated, err = json.MarshalBytes(user)
+		assert.Nil(t, err)
+		assert.Equal(t, string(expected), string(generated))
+	}
+	address, err := json.MarshalBytes(mockAddress{})
+	assert.Nil(t, err)
+	assert.Equal(t, `{"street":""}`, string(address))
+}
+
+func TestGeneratedMarshal(t *testing.T) {
+	user := newMockUser()
+	var expected bytes.Buffer
+	assert.Nil(t, stdjson.NewEncoder(&expected).Encode(plainUser(user)))
+
+	var generated bytes.Buffer
+	assert.Nil(t, json.Marshal(&generated, &user))
+	assert.Equal(t, expected.String(), generated.String())
+
+	generated.Reset()
+	assert.Nil(t, json.Media{}.Marshal(&generated, &user))
+	assert.Equal(t, expected.String(), generated.String())
+}
+
+func TestGeneratedMarshalErr(t *testing.T) {
+	user := mockUser{Score: 0}
+	user.Score = user.Score / user.Score
+	_, err := json.MarshalBytes(&user)
+	assert.NotNil(t, err)
+}
+
+func TestGeneratedUnmarshalBytes(t *testing.T) {
+	user := newMockUser()
+	raw, err := stdjson.Marshal(plainUser(user))
+	assert.Nil(t, err)
+
+	inputs := [][]byte{
+		raw,
+		[]byte(`null`),
+		[]byte(`{}`),
+		[]byte(`{"tags": [], "contacts": [], "avatar": ""}`),
+		[]byte(` { "id" : 1 , "username":"mock\"useré😀", "unknown": {"a": [1, "]", {"b": null}]},
+			"age": 15, "tags": null, "contacts": [null, {"street": "Contact"}], "level": 0,
+			"previous": null, "nickname": null, "avatar": null, "score": -1.5e-3, "address": null,
+			"attrs": {"attr": "value"}, "active": false, "createdAt": "2016-11-20T10:30:15Z", "ratio": 12 } `),
+	}
+	for _, input := range inputs {
+		var expected plainUser
+		assert.Nil(t, stdjson.Unmarshal(input, &expected), string(input))
+
+		var generated mockUser
+		assert.Nil(t, json.UnmarshalBytes(input, &generated), string(input))
+		assert.Equal(t, expected, plainUser(generated), string(input))
+
+		generated = mockUser{}
+		assert.Nil(t, json.Unmarshal(bytes.NewReader(input), &generated), string(input))
+		assert.Equal(t, expected, plainUser(generated), string(input))
+	}
+}
+
+func TestGeneratedUnmarshalBytesFoldKeys(t *testing.T) {
+	inputs := []string{
+		`{"Username":"X","ID":5}`,
+		`{"USERNAME":"upper","CreatedAT":"2016-11-20T10:30:15Z","Address":{"STREET":"Mock"}}`,
+		`{"username":"exact","USERNAME":"fold"}`,
+		`{"USERNAME":"fold","username":"exact"}`,
+		`{"user_name":"none","Internal":"ignored"}`,
+	}
+	for _, input := range inputs {
+		var expected plainUser
+		assert.Nil(t, stdjson.Unmarshal([]byte(input), &expected), input)
+
+		var generated mockUser
+		assert.Nil(t, json.UnmarshalBytes([]byte(input), &generated), input)
+		assert.Equal(t, expected, plainUser(generated), input)
+
+		generated = mockUser{}
+		assert.Nil(t, json.Unmarshal(strings.NewReader(input), &generated), input)
+		assert.Equal(t, expected, plainUser(generated), input)
+	}
+	assert.Equal(t, "username", json.MatchKey([]byte("UserName"), "id", "username"))
+	assert.Equal(t, "", json.MatchKey([]byte("user"), "id", "username"))
+}
+
+func TestGeneratedUnmarshalBytesAllocs(t *testing.T) {
+	raw, err := stdjson.Marshal(plainUser(newBenchUser()))
+	assert.Nil(t, err)
+	reflection := testing.AllocsPerRun(100, func() {
+		var user plainUser
+		json.UnmarshalBytes(raw, &user)
+	})
+	generated := testing.AllocsPerRun(100, func() {
+		var user mockUser
+		json.UnmarshalBytes(raw, &user)
+	})
+	assert.True(t, generated <= reflection, "Generated allocs %v, reflection allocs %v", generated, reflection)
+}
+
+func TestParseString(t *testing.T) {
+	inputs := []string{
+		`""`,
+		`"plain"`,
+		`"quote \" backslash \\ slash \/ controls \b\f\n\r\t"`,
+		`"unicode \u00e9 \u65E5 \u2028"`,
+		`"surrogates \ud83d\ude00 \ud83d alone \ude00 \ud83dx"`,
+		"\"multi byte é 日本 😀 invalid \xff\xfe\"",
+		`"` + strings.Repeat(`long escaped \n string `, 10) + `"`,
+	}
+	for _, input := range inputs {
+		var expected string
+		assert.Nil(t, stdjson.Unmarshal([]byte(input), &expected), input)
+
+		parsed, err := json.ParseString([]byte(input))
+		assert.Nil(t, err, input)
+		assert.Equal(t, expected, parsed, input)
+	}
+	for _, input := range []string{`"`, `plain`, `"\x"`, `"\u12"`, `"\u12g4"`, "\"control \n\"", `"trailing \"`} {
+		_, err := json.ParseString([]byte(input))
+		assert.NotNil(t, err, input)
+	}
+}
+
+func TestGeneratedUnmarshalBytesErr(t *testing.T) {
+	inputs := []string{
+		``,
+		`{`,
+		`[]`,
+		`{"id":}`,
+		`{"id" 1}`,
+		`{"id":1,}`,
+		`{"id":1}x`,
+		`{"id":"1"}`,
+		`{"id":1.5}`,
+		`{"id":01}`,
+		`{"id":9223372036854775808}`,
+		`{"level":256}`,
+		`{"level":-1}`,
+		`{"username":1}`,
+		`{"username":"unterminated}`,
+		`{"active":tru}`,
+		`{"score":"1"}`,
+		`{"tags":[1]}`,
+		`{"tags":["a"`,
+		`{"tags":["a" "b"]}`,
+		`{"address":{"number":"1"}}`,
+		`{"contacts":[{"street":1}]}`,
+		`{"createdAt":"invalid"}`,
+		`{"unknown":[1, 2}`,
+		`{"unknown": @@@}`,
+		`{"unknown": tru}`,
+		`{"unknown": nul}`,
+		`{"unknown": 01}`,
+		`{"unknown": -}`,
+		`{"unknown": 1.}`,
+		`{"unknown": 1e+}`,
+		`{"unknown": "\x"}`,
+		`{"unknown": [1, @]}`,
+		`{"unknown": {"a" 1}}`,
+		`{"unknown": {"a": 1,}}`,
+		`{"unknown": {1: 1}}`,
+		"{\"unknown\": \"control \n\"}",
+		`{"unknown": ` + strings.Repeat("[", 10001) + strings.Repeat("]", 10001) + `}`,
+	}
+	for _, input := range inputs {
+		var expected plainUser
+		assert.NotNil(t, stdjson.Unmarshal([]byte(input), &expected), input)
+
+		var generated mockUser
+		assert.NotNil(t, json.UnmarshalBytes([]byte(input), &generated), input)
+	}
+}
+
+//newBenchUser returns a mockUser without the fields that the generated code leaves to encoding/json
+func newBenchUser() mockUser {
+	user := newMockUser()
+	user.Name = "Mock Bench User"
+	user.Attrs = nil
+	return user
+}
+
+func BenchmarkMarshalBytes(b *testing.B) {
+	user := plainUser(newBenchUser())
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := json.MarshalBytes(&user); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkMarshalBytesGenerated(b *testing.B) {
+	user := newBenchUser()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := json.MarshalBytes(&user); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkMarshal(b *testing.B) {
+	user := plainUser(newBenchUser())
+	var buf bytes.Buffer
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		buf.Reset()
+		if err := json.Marshal(&buf, &user); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkMarshalGenerated(b *testing.B) {
+	user := newBenchUser()
+	var buf bytes.Buffer
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		buf.Reset()
+		if err := json.Marshal(&buf, &user); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkUnmarshalBytes(b *testing.B) {
+	raw, err := stdjson.Marshal(plainUser(newBenchUser()))
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var user plainUser
+		if err := json.UnmarshalBytes(raw, &user); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkUnmarshalBytesGenerated(b *testing.B) {
+	raw, err := stdjson.Marshal(plainUser(newBenchUser()))
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var user mockUser
+		if err := json.UnmarshalBytes(raw, &user); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,291 @@
+// Code generated by hakijson from mock_test.go. DO NOT EDIT.
+
+package json_test
+
+import hakijson "github.com/rjansen/haki/media/json"
+
+// MarshalJSONTo appends the json representation of mockAddress to buf
+func (m mockAddress) MarshalJSONTo(buf []byte) ([]byte, error) {
+	start := len(buf)
+	buf = append(buf, ",\"street\":"...)
+	buf = hakijson.AppendString(buf, m.Street)
+	if m.Number != 0 {
+		buf = append(buf, ",\"number\":"...)
+		buf = hakijson.AppendInt(buf, int64(m.Number))
+	}
+	if len(buf) == start {
+		return append(buf, "{}"...), nil
+	}
+	buf[start] = '{'
+	return append(buf, '}'), nil
+}
+
+// UnmarshalJSONFrom reads the json representation in raw into mockAddress
+func (m *mockAddress) UnmarshalJSONFrom(raw []byte) error {
+	var scanner hakijson.ObjectScanner
+	scanner.Reset(raw)
+	for scanner.Next() {
+		value := scanner.Value()
+		var err error
+		switch hakijson.MatchKey(scanner.Key(), "street", "number") {
+		case "street":
+			if !hakijson.IsNull(value) {
+				m.Street, err = hakijson.ParseString(value)
+			}
+		case "number":
+			if !hakijson.IsNull(value) {
+				var n0 int64
+				if n0, err = hakijson.ParseInt(value, 0); err == nil {
+					m.Number = int(n0)
+				}
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// MarshalJSONTo appends the json representation of mockUser to buf
+func (m mockUser) MarshalJSONTo(buf []byte) ([]byte, error) {
+	var err error
+	start := len(buf)
+	buf = append(buf, ",\"id\":"...)
+	buf = hakijson.AppendInt(buf, m.ID)
+	buf = append(buf, ",\"username\":"...)
+	buf = hakijson.AppendString(buf, m.Username)
+	if m.Name != "" {
+		buf = append(buf, ",\"name\":"...)
+		buf = hakijson.AppendString(buf, m.Name)
+	}
+	buf = append(buf, ",\"age\":"...)
+	buf = hakijson.AppendInt(buf, int64(m.Age))
+	buf = append(buf, ",\"score\":"...)
+	if buf, err = hakijson.AppendFloat(buf, m.Score, 64); err != nil {
+		return buf, err
+	}
+	if m.Ratio != 0 {
+		buf = append(buf, ",\"ratio\":"...)
+		if buf, err = hakijson.AppendFloat(buf, float64(m.Ratio), 32); err != nil {
+			return buf, err
+		}
+	}
+	buf = append(buf, ",\"active\":"...)
+	buf = hakijson.AppendBool(buf, m.Active)
+	buf = append(buf, ",\"level\":"...)
+	buf = hakijson.AppendUint(buf, uint64(m.Level))
+	if len(m.Avatar) != 0 {
+		buf = append(buf, ",\"avatar\":"...)
+		buf = hakijson.AppendBytes(buf, m.Avatar)
+	}
+	buf = append(buf, ",\"tags\":"...)
+	if m.Tags == nil {
+		buf = append(buf, "null"...)
+	} else {
+		buf = append(buf, '[')
+		for i0 := range m.Tags {
+			if i0 > 0 {
+				buf = append(buf, ',')
+			}
+			buf = hakijson.AppendString(buf, m.Tags[i0])
+		}
+		buf = append(buf, ']')
+	}
+	buf = append(buf, ",\"address\":"...)
+	if buf, err = m.Address.MarshalJSONTo(buf); err != nil {
+		return buf, err
+	}
+	if m.Previous != nil {
+		buf = append(buf, ",\"previous\":"...)
+		if buf, err = (*m.Previous).MarshalJSONTo(buf); err != nil {
+			return buf, err
+		}
+	}
+	buf = append(buf, ",\"contacts\":"...)
+	if m.Contacts == nil {
+		buf = append(buf, "null"...)
+	} else {
+		buf = append(buf, '[')
+		for i0 := range m.Contacts {
+			if i0 > 0 {
+				buf = append(buf, ',')
+			}
+			if m.Contacts[i0] == nil {
+				buf = append(buf, "null"...)
+			} else {
+				if buf, err = (*m.Contacts[i0]).MarshalJSONTo(buf); err != nil {
+					return buf, err
+				}
+			}
+		}
+		buf = append(buf, ']')
+	}
+	if !hakijson.IsEmptyValue(m.Attrs) {
+		buf = append(buf, ",\"attrs\":"...)
+		if buf, err = hakijson.AppendValue(buf, m.Attrs); err != nil {
+			return buf, err
+		}
+	}
+	buf = append(buf, ",\"createdAt\":"...)
+	if buf, err = hakijson.AppendTime(buf, m.CreatedAt); err != nil {
+		return buf, err
+	}
+	buf = append(buf, ",\"nickname\":"...)
+	if m.Nickname == nil {
+		buf = append(buf, "null"...)
+	} else {
+		buf = hakijson.AppendString(buf, (*m.Nickname))
+	}
+	if len(buf) == start {
+		return append(buf, "{}"...), nil
+	}
+	buf[start] = '{'
+	return append(buf, '}'), nil
+}
+
+// UnmarshalJSONFrom reads the json representation in raw into mockUser
+func (m *mockUser) UnmarshalJSONFrom(raw []byte) error {
+	var scanner hakijson.ObjectScanner
+	scanner.Reset(raw)
+	for scanner.Next() {
+		value := scanner.Value()
+		var err error
+		switch hakijson.MatchKey(scanner.Key(), "id", "username", "name", "age", "score", "ratio", "active", "level", "avatar", "tags", "address", "previous", "contacts", "attrs", "createdAt", "nickname") {
+		case "id":
+			if !hakijson.IsNull(value) {
+				var n0 int64
+				if n0, err = hakijson.ParseInt(value, 64); err == nil {
+					m.ID = n0
+				}
+			}
+		case "username":
+			if !hakijson.IsNull(value) {
+				m.Username, err = hakijson.ParseString(value)
+			}
+		case "name":
+			if !hakijson.IsNull(value) {
+				m.Name, err = hakijson.ParseString(value)
+			}
+		case "age":
+			if !hakijson.IsNull(value) {
+				var n0 int64
+				if n0, err = hakijson.ParseInt(value, 0); err == nil {
+					m.Age = int(n0)
+				}
+			}
+		case "score":
+			if !hakijson.IsNull(value) {
+				var f0 float64
+				if f0, err = hakijson.ParseFloat(value, 64); err == nil {
+					m.Score = f0
+				}
+			}
+		case "ratio":
+			if !hakijson.IsNull(value) {
+				var f0 float64
+				if f0, err = hakijson.ParseFloat(value, 32); err == nil {
+					m.Ratio = float32(f0)
+				}
+			}
+		case "active":
+			if !hakijson.IsNull(value) {
+				m.Active, err = hakijson.ParseBool(value)
+			}
+		case "level":
+			if !hakijson.IsNull(value) {
+				var n0 uint64
+				if n0, err = hakijson.ParseUint(value, 8); err == nil {
+					m.Level = uint8(n0)
+				}
+			}
+		case "avatar":
+			if hakijson.IsNull(value) {
+				m.Avatar = nil
+			} else {
+				m.Avatar, err = hakijson.ParseBytes(value)
+			}
+		case "tags":
+			if hakijson.IsNull(value) {
+				m.Tags = nil
+			} else {
+				if cap(m.Tags) == 0 {
+					m.Tags = make([]string, 0, 4)
+				} else {
+					m.Tags = m.Tags[:0]
+				}
+				var a0 hakijson.ArrayScanner
+				a0.Reset(value)
+				for a0.Next() {
+					var e0 string
+					m.Tags = append(m.Tags, e0)
+					if !hakijson.IsNull(a0.Value()) {
+						m.Tags[len(m.Tags)-1], err = hakijson.ParseString(a0.Value())
+					}
+					if err != nil {
+						return err
+					}
+				}
+				err = a0.Err()
+			}
+		case "address":
+			err = m.Address.UnmarshalJSONFrom(value)
+		case "previous":
+			if hakijson.IsNull(value) {
+				m.Previous = nil
+			} else {
+				if m.Previous == nil {
+					m.Previous = new(mockAddress)
+				}
+				err = m.Previous.UnmarshalJSONFrom(value)
+			}
+		case "contacts":
+			if hakijson.IsNull(value) {
+				m.Contacts = nil
+			} else {
+				if cap(m.Contacts) == 0 {
+					m.Contacts = make([]*mockAddress, 0, 4)
+				} else {
+					m.Contacts = m.Contacts[:0]
+				}
+				var a0 hakijson.ArrayScanner
+				a0.Reset(value)
+				for a0.Next() {
+					var e0 *mockAddress
+					m.Contacts = append(m.Contacts, e0)
+					if hakijson.IsNull(a0.Value()) {
+						m.Contacts[len(m.Contacts)-1] = nil
+					} else {
+						if m.Contacts[len(m.Contacts)-1] == nil {
+							m.Contacts[len(m.Contacts)-1] = new(mockAddress)
+						}
+						err = m.Contacts[len(m.Contacts)-1].UnmarshalJSONFrom(a0.Value())
+					}
+					if err != nil {
+						return err
+					}
+				}
+				err = a0.Err()
+			}
+		case "attrs":
+			err = hakijson.UnmarshalValue(value, &m.Attrs)
+		case "createdAt":
+			if !hakijson.IsNull(value) {
+				m.CreatedAt, err = hakijson.ParseTime(value)
+			}
+		case "nickname":
+			if hakijson.IsNull(value) {
+				m.Nickname = nil
+			} else {
+				if m.Nickname == nil {
+					m.Nickname = new(string)
+				}
+				*m.Nickname, err = hakijson.ParseString(value)
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
@@ -0,0 +1,39 @@
+package json_test
+
+import (
+	"time"
+)
+
+//go:generate go run ../../cmd/hakijson mock_test.go
+
+//mockAddress is a nested struct with a generated json codec
+//haki:json
+type mockAddress struct {
+	Street string `json:"street"`
+	Number int    `json:"number,omitempty"`
+}
+
+//mockUser has a field of every kind handled by the hakijson command
+//haki:json
+type mockUser struct {
+	ID        int64             `json:"id"`
+	Username  string            `json:"username"`
+	Name      string            `json:"name,omitempty"`
+	Age       int               `json:"age"`
+	Score     float64           `json:"score"`
+	Ratio     float32           `json:"ratio,omitempty"`
+	Active    bool              `json:"active"`
+	Level     uint8             `json:"level"`
+	Avatar    []byte            `json:"avatar,omitempty"`
+	Tags      []string          `json:"tags"`
+	Address   mockAddress       `json:"address"`
+	Previous  *mockAddress      `json:"previous,omitempty"`
+	Contacts  []*mockAddress    `json:"contacts"`
+	Attrs     map[string]string `json:"attrs,omitempty"`
+	CreatedAt time.Time         `json:"createdAt"`
+	Nickname  *string           `json:"nickname"`
+	Internal  string            `json:"-"`
+}
+
+//plainUser has the mockUser fields without the generated methods, it is handled by encoding/json
+type plainUser mockUser
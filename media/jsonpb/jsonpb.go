@@ -0,0 +1,102 @@
+package jsonpb
+
+import (
+	"bytes"
+	"errors"
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/golang/protobuf/proto"
+	"github.com/rjansen/l"
+	"io"
+)
+
+const (
+	//ContentType is a constant to hold the json content type value
+	ContentType = "application/json"
+)
+
+var (
+	//ErrInvalidProtoMessage is returned when a invalid message is provided
+	ErrInvalidProtoMessage = errors.New("Invalid proto message value")
+
+	marshaler = &jsonpb.Marshaler{}
+)
+
+//IsMessage returns true when the provided value must be handled by the proto3 json mapping
+func IsMessage(val interface{}) bool {
+	_, ok := val.(proto.Message)
+	return ok
+}
+
+func protoMessage(val interface{}) (proto.Message, error) {
+	msg, ok := val.(proto.Message)
+	if !ok {
+		return nil, ErrInvalidProtoMessage
+	}
+	return msg, nil
+}
+
+//Marshal writes a proto3 json representation of the message instance
+func Marshal(w io.Writer, data interface{}) error {
+	msg, err := protoMessage(data)
+	if err != nil {
+		return err
+	}
+	return marshaler.Marshal(w, msg)
+}
+
+//Unmarshal reads a proto3 json representation into the message instance
+func Unmarshal(r io.Reader, result interface{}) error {
+	msg, err := protoMessage(result)
+	if err != nil {
+		return err
+	}
+	return jsonpb.Unmarshal(r, msg)
+}
+
+//MarshalBytes writes a proto3 json representation of the message instance
+func MarshalBytes(data interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	err := Marshal(&buf, data)
+	l.Debug("jsonpb.MarshalBytes",
+		l.Int("len", buf.Len()),
+		l.Err(err),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+//UnmarshalBytes reads a proto3 json representation into the message instance
+func UnmarshalBytes(raw []byte, result interface{}) error {
+	err := Unmarshal(bytes.NewReader(raw), result)
+	l.Debug("jsonpb.UnmarshalBytes",
+		l.Bool("nilResult", result == nil),
+		l.Err(err),
+	)
+	return err
+}
+
+//Media is a struct to helps writes and reads of a proto3 json representation
+type Media struct {
+}
+
+//Marshal writes a proto3 json representation of the message instance
+func (Media) Marshal(writer io.Writer, val interface{}) error {
+	return Marshal(writer, val)
+}
+
+//Unmarshal reads a proto3 json representation into the message instance
+func (Media) Unmarshal(reader io.Reader, ref interface{}) error {
+	return Unmarshal(reader, ref)
+}
+
+//MarshalBytes writes a proto3 json representation of the message instance
+func (Media) MarshalBytes(val interface{}) ([]byte, error) {
+	return MarshalBytes(val)
+}
+
+//UnmarshalBytes reads a proto3 json representation into the message instance
+func (Media) UnmarshalBytes(raw []byte, ref interface{}) error {
+	return UnmarshalBytes(raw, ref)
+}
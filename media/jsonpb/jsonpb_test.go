@@ -0,0 +1,82 @@
+package jsonpb
+
+import (
+	"bytes"
+	"github.com/rjansen/haki/media/proto"
+	"github.com/rjansen/l"
+	"github.com/rjansen/l/zap"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func init() {
+	if setupErr := zap.Setup(new(l.Configuration)); setupErr != nil {
+		panic(setupErr)
+	}
+	l.Info("context.media.jsonpb_test.init")
+}
+
+func TestJSONPBMarshalAndUnmarshalBytes(t *testing.T) {
+	p := &proto.Store{
+		Id:   1,
+		Name: "Proto JSON Store",
+		Data: []*proto.Store_Data{
+			&proto.Store_Data{
+				Id:    1,
+				Name:  "Proto Data Name",
+				Email: "Proto Data Email",
+				Type:  proto.Store_WORK,
+			},
+		},
+	}
+
+	b, e := MarshalBytes(p)
+	assert.Nil(t, e)
+	assert.True(t, bytes.Contains(b, []byte(`"type":"WORK"`)), "Enum is not encoded with its name")
+
+	result := new(proto.Store)
+	e = UnmarshalBytes(b, result)
+	assert.Nil(t, e)
+	assert.Equal(t, p.Id, result.Id)
+	assert.Equal(t, p.Name, result.Name)
+	assert.Len(t, result.Data, 1)
+	assert.Equal(t, proto.Store_WORK, result.Data[0].Type)
+
+	result = new(proto.Store)
+	e = UnmarshalBytes([]byte(`{"id": 2, "data": [{"type": "HOME"}]}`), result)
+	assert.Nil(t, e)
+	assert.Equal(t, int32(2), result.Id)
+	assert.Empty(t, result.Name)
+	assert.Equal(t, proto.Store_HOME, result.Data[0].Type)
+}
+
+func TestJSONPBMarshalAndUnmarshal(t *testing.T) {
+	p := &proto.Store{
+		Id:   1,
+		Name: "Proto JSON Store",
+	}
+	var mockBuffer bytes.Buffer
+	assert.Nil(t, Marshal(&mockBuffer, p))
+	assert.True(t, mockBuffer.Len() > 0, "Buffer does not have any value")
+
+	result := new(proto.Store)
+	assert.Nil(t, Unmarshal(&mockBuffer, result))
+	assert.Equal(t, p.Id, result.Id)
+	assert.Equal(t, p.Name, result.Name)
+}
+
+func TestJSONPBErr(t *testing.T) {
+	p := map[string]interface{}{
+		"Id":   1,
+		"Name": "Proto JSON Store",
+	}
+	assert.False(t, IsMessage(p))
+	assert.True(t, IsMessage(new(proto.Store)))
+
+	_, e := MarshalBytes(p)
+	assert.Equal(t, ErrInvalidProtoMessage, e)
+	e = UnmarshalBytes([]byte(`{"id": 1}`), p)
+	assert.Equal(t, ErrInvalidProtoMessage, e)
+	e = UnmarshalBytes([]byte(`{"id": "invalid"`), new(proto.Store))
+	assert.NotNil(t, e)
+}
@@ -0,0 +1,80 @@
+package msgpack
+
+import (
+	"github.com/rjansen/l"
+	"github.com/ugorji/go/codec"
+	"io"
+	"reflect"
+)
+
+const (
+	//ContentType is a constant to hold the msgpack content type value
+	ContentType = "application/msgpack"
+)
+
+var (
+	handle = newHandle()
+)
+
+func newHandle() *codec.MsgpackHandle {
+	h := new(codec.MsgpackHandle)
+	h.WriteExt = true
+	h.RawToString = true
+	h.MapType = reflect.TypeOf(map[string]interface{}(nil))
+	return h
+}
+
+//Marshal writes a msgpack representation of the struct instance
+func Marshal(w io.Writer, data interface{}) error {
+	return codec.NewEncoder(w, handle).Encode(data)
+}
+
+//Unmarshal reads a msgpack representation into the struct instance
+func Unmarshal(r io.Reader, result interface{}) error {
+	return codec.NewDecoder(r, handle).Decode(result)
+}
+
+//MarshalBytes writes a msgpack representation of the struct instance
+func MarshalBytes(data interface{}) ([]byte, error) {
+	var msgpackBytes []byte
+	err := codec.NewEncoderBytes(&msgpackBytes, handle).Encode(data)
+	l.Debug("msgpack.MarshalBytes",
+		l.Int("len", len(msgpackBytes)),
+		l.Err(err),
+	)
+	return msgpackBytes, err
+}
+
+//UnmarshalBytes reads a msgpack representation into the struct instance
+func UnmarshalBytes(raw []byte, result interface{}) error {
+	err := codec.NewDecoderBytes(raw, handle).Decode(result)
+	l.Debug("msgpack.UnmarshalBytes",
+		l.Bool("nilResult", result == nil),
+		l.Err(err),
+	)
+	return err
+}
+
+//Media is a struct to helps writes and reads of a msgpack representation
+type Media struct {
+}
+
+//Marshal writes a msgpack representation of the struct instance
+func (Media) Marshal(writer io.Writer, val interface{}) error {
+	return Marshal(writer, val)
+}
+
+//Unmarshal reads a msgpack representation into the struct instance
+func (Media) Unmarshal(reader io.Reader, ref interface{}) error {
+	return Unmarshal(reader, ref)
+}
+
+//MarshalBytes writes a msgpack representation of the struct instance
+func (Media) MarshalBytes(val interface{}) ([]byte, error) {
+	return MarshalBytes(val)
+}
+
+//UnmarshalBytes reads a msgpack representation into the struct instance
+func (Media) UnmarshalBytes(raw []byte, ref interface{}) error {
+	return UnmarshalBytes(raw, ref)
+}
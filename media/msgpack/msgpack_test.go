@@ -0,0 +1,86 @@
+package msgpack
+
+import (
+	"bytes"
+	"github.com/rjansen/l"
+	"github.com/rjansen/l/zap"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func init() {
+	if setupErr := zap.Setup(new(l.Configuration)); setupErr != nil {
+		panic(setupErr)
+	}
+	l.Info("context.media.msgpack_test.init")
+}
+
+type mockData struct {
+	ID    int    `json:"id"`
+	Name  string `json:"name"`
+	Email string `json:"email"`
+}
+
+type mockMedia struct {
+	ID   int        `json:"id"`
+	Name string     `json:"name"`
+	Raw  []byte     `json:"raw"`
+	Data []mockData `json:"data"`
+}
+
+func newMockMedia() *mockMedia {
+	return &mockMedia{
+		ID:   1,
+		Name: "MsgPack Media",
+		Raw:  []byte{0x00, 0x01, 0x02},
+		Data: []mockData{
+			mockData{
+				ID:    1,
+				Name:  "MsgPack Data Name",
+				Email: "MsgPack Data Email",
+			},
+		},
+	}
+}
+
+func TestMsgPackMarshalAndUnmarshalBytes(t *testing.T) {
+	m := newMockMedia()
+
+	b, e := MarshalBytes(m)
+	assert.Nil(t, e)
+	assert.NotEmpty(t, b)
+
+	var result mockMedia
+	e = UnmarshalBytes(b, &result)
+	assert.Nil(t, e)
+	assert.Equal(t, *m, result)
+
+	var generic map[string]interface{}
+	e = UnmarshalBytes(b, &generic)
+	assert.Nil(t, e)
+	assert.Equal(t, m.Name, generic["name"])
+}
+
+func TestMsgPackMarshalAndUnmarshal(t *testing.T) {
+	m := newMockMedia()
+	var media Media
+
+	mockBuffer := new(bytes.Buffer)
+	e := media.Marshal(mockBuffer, m)
+	assert.Nil(t, e)
+	assert.True(t, mockBuffer.Len() > 0, "Buffer does not have any value")
+
+	var result mockMedia
+	e = media.Unmarshal(mockBuffer, &result)
+	assert.Nil(t, e)
+	assert.Equal(t, *m, result)
+}
+
+func TestMsgPackUnmarshalErr(t *testing.T) {
+	var result mockMedia
+	e := UnmarshalBytes([]byte{0xc1}, &result)
+	assert.NotNil(t, e)
+
+	e = Unmarshal(bytes.NewBuffer([]byte{}), &result)
+	assert.NotNil(t, e)
+}
@@ -6,6 +6,7 @@ import (
 	"github.com/golang/protobuf/proto"
 	"github.com/rjansen/l"
 	"io"
+	"sync"
 )
 
 var (
@@ -15,6 +16,12 @@ var (
 	ErrEmptyInput = errors.New("The provided input (reader, []bytes) is empty")
 	//ContentType is a constant to hold the protocol buffer content type value
 	ContentType = "application/octet-stream"
+
+	bufferPool = sync.Pool{
+		New: func() interface{} {
+			return new(proto.Buffer)
+		},
+	}
 )
 
 func protoMessage(val interface{}) (proto.Message, error) {
@@ -61,6 +68,22 @@ func MarshalBytes(data interface{}) ([]byte, error) {
 	return protoBytes, err
 }
 
+//MarshalAppend appends the protocol buffer representation of the message instance to dst
+//and returns the extended slice, so pooled buffers can be reused without allocations
+func MarshalAppend(dst []byte, data interface{}) ([]byte, error) {
+	msg, err := protoMessage(data)
+	if err != nil {
+		return dst, err
+	}
+	buf := bufferPool.Get().(*proto.Buffer)
+	buf.SetBuf(dst)
+	err = buf.Marshal(msg)
+	dst = buf.Bytes()
+	buf.SetBuf(nil)
+	bufferPool.Put(buf)
+	return dst, err
+}
+
 //UnmarshalBytes reads a json representation into the struct instance
 func UnmarshalBytes(raw []byte, result interface{}) error {
 	msg, err := protoMessage(result)
@@ -7,9 +7,11 @@ import (
 	"github.com/rjansen/l/zap"
 	// "github.com/golang/protobuf/proto"
 	"bytes"
+	"encoding/binary"
 	"github.com/stretchr/testify/assert"
-	// "io"
+	"io"
 	"io/ioutil"
+	"runtime"
 	"testing"
 	"testing/iotest"
 )
@@ -84,6 +86,36 @@ func TestProtoUnmarshalBytesErr(t *testing.T) {
 	assert.Equal(t, ErrInvalidProtoMessage, e)
 }
 
+func TestProtoMarshalAppend(t *testing.T) {
+	p := &Store{
+		Id:   1,
+		Name: "Proto Buffer Store",
+		Data: []*Store_Data{
+			&Store_Data{
+				Id:    1,
+				Name:  "Proto Data Name",
+				Email: "Proto Data Email",
+			},
+		},
+	}
+	expected, e := MarshalBytes(p)
+	assert.Nil(t, e)
+
+	prefix := []byte("prefix")
+	b, e := MarshalAppend(prefix, p)
+	assert.Nil(t, e)
+	assert.Equal(t, prefix, b[:len(prefix)])
+	assert.Equal(t, expected, b[len(prefix):])
+
+	b, e = MarshalAppend(b[:0], p)
+	assert.Nil(t, e)
+	assert.Equal(t, expected, b)
+
+	b, e = MarshalAppend(prefix, map[string]interface{}{"Id": 1})
+	assert.Equal(t, ErrInvalidProtoMessage, e)
+	assert.Equal(t, prefix, b)
+}
+
 func TestProtoMarshalAndUnMarhsal(t *testing.T) {
 	p := &Store{
 		Id:   1,
@@ -176,3 +208,73 @@ func TestProtoUnmarshalErr(t *testing.T) {
 	e = Unmarshal(mockBuffer, p)
 	assert.Equal(t, ErrEmptyInput, e)
 }
+
+func TestProtoStreamEncodeAndDecode(t *testing.T) {
+	stores := []*Store{
+		&Store{Id: 1, Name: "Proto Stream Store 1"},
+		&Store{Id: 2, Name: "Proto Stream Store 2", Data: []*Store_Data{
+			&Store_Data{Id: 1, Name: "Proto Data Name", Email: "Proto Data Email"},
+		}},
+		&Store{},
+	}
+	mockBuffer := new(bytes.Buffer)
+	encoder := NewEncoder(mockBuffer)
+	for _, s := range stores {
+		assert.Nil(t, encoder.Encode(s))
+	}
+	assert.True(t, mockBuffer.Len() > 0, "Buffer does not have any value")
+
+	decoder := NewDecoder(mockBuffer)
+	for _, s := range stores {
+		p := new(Store)
+		e := decoder.Decode(p)
+		assert.Nil(t, e)
+		assert.Equal(t, s.Id, p.Id)
+		assert.Equal(t, s.Name, p.Name)
+		assert.Len(t, p.Data, len(s.Data))
+	}
+	assert.Equal(t, io.EOF, decoder.Decode(new(Store)))
+}
+
+func TestProtoStreamErr(t *testing.T) {
+	p := &Store{
+		Id:   1,
+		Name: "Proto Buffer Store",
+	}
+	mockBuffer := new(bytes.Buffer)
+	encoder := NewEncoder(mockBuffer)
+	assert.Equal(t, ErrInvalidProtoMessage, encoder.Encode(map[string]interface{}{"Id": 1}))
+	encoder.MaxSize = 2
+	assert.Equal(t, ErrMessageTooLarge, encoder.Encode(p))
+	assert.Zero(t, mockBuffer.Len())
+
+	encoder.MaxSize = 0
+	assert.Nil(t, encoder.Encode(p))
+	raw := mockBuffer.Bytes()
+
+	decoder := NewDecoder(bytes.NewReader(raw))
+	assert.Equal(t, ErrInvalidProtoMessage, decoder.Decode(make(map[string]interface{})))
+
+	decoder = NewDecoder(bytes.NewReader(raw))
+	decoder.MaxSize = 2
+	assert.Equal(t, ErrMessageTooLarge, decoder.Decode(new(Store)))
+
+	decoder = NewDecoder(bytes.NewReader(raw[:len(raw)-1]))
+	assert.Equal(t, io.ErrUnexpectedEOF, decoder.Decode(new(Store)))
+
+	varint := func(v uint64) []byte {
+		b := make([]byte, binary.MaxVarintLen64)
+		return b[:binary.PutUvarint(b, v)]
+	}
+	decoder = NewDecoder(bytes.NewReader(varint(1 << 62)))
+	decoder.MaxSize = 0
+	assert.Equal(t, ErrMessageTooLarge, decoder.Decode(new(Store)), "Length past the hard limit")
+
+	decoder = NewDecoder(bytes.NewReader(append(varint(MaxMessageSize), raw[1:]...)))
+	decoder.MaxSize = 0
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	assert.Equal(t, io.ErrUnexpectedEOF, decoder.Decode(new(Store)), "Length without its body")
+	runtime.ReadMemStats(&after)
+	assert.True(t, after.TotalAlloc-before.TotalAlloc < 1<<20, "Only the received bytes are allocated")
+}
@@ -0,0 +1,102 @@
+package proto
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"github.com/golang/protobuf/proto"
+	"github.com/rjansen/l"
+	"io"
+	"math"
+)
+
+const (
+	//DelimitedContentType is a constant to hold the varint length-delimited protocol buffer stream content type value
+	DelimitedContentType = "application/x-protobuf; delimited=true"
+	//DefaultMaxMessageSize is the default max size in bytes of a single message on a delimited stream
+	DefaultMaxMessageSize = 4 << 20
+	//MaxMessageSize is the hard limit in bytes of a single message, the protocol buffer encoding limit, enforced even when MaxSize disables the check
+	MaxMessageSize = math.MaxInt32
+)
+
+var (
+	//ErrMessageTooLarge is returned when a delimited message exceeds the configured max size
+	ErrMessageTooLarge = errors.New("The delimited proto message exceeds the max message size")
+)
+
+//Encoder writes varint length-delimited protocol buffer messages to an output stream
+type Encoder struct {
+	w io.Writer
+	//MaxSize is the max size in bytes of a single encoded message, zero or less disables the check
+	MaxSize int
+}
+
+//NewEncoder returns a new delimited message encoder that writes to w
+func NewEncoder(w io.Writer) *Encoder {
+	return &Encoder{
+		w:       w,
+		MaxSize: DefaultMaxMessageSize,
+	}
+}
+
+//Encode writes the length prefix and the protocol buffer representation of the provided message
+func (e *Encoder) Encode(data interface{}) error {
+	protoBytes, err := MarshalBytes(data)
+	if err != nil {
+		return err
+	}
+	if e.MaxSize > 0 && len(protoBytes) > e.MaxSize {
+		return ErrMessageTooLarge
+	}
+	frame := append(proto.EncodeVarint(uint64(len(protoBytes))), protoBytes...)
+	_, err = e.w.Write(frame)
+	return err
+}
+
+//Decoder reads varint length-delimited protocol buffer messages from an input stream
+type Decoder struct {
+	r   *bufio.Reader
+	buf []byte
+	//MaxSize is the max size in bytes of a single message, zero or less leaves only the MaxMessageSize check
+	MaxSize int
+}
+
+//NewDecoder returns a new delimited message decoder that reads from r
+func NewDecoder(r io.Reader) *Decoder {
+	return &Decoder{
+		r:       bufio.NewReader(r),
+		MaxSize: DefaultMaxMessageSize,
+	}
+}
+
+//Decode reads the next delimited message from the stream into result.
+//It returns io.EOF when the stream ends cleanly between two messages
+func (d *Decoder) Decode(result interface{}) error {
+	msg, err := protoMessage(result)
+	if err != nil {
+		return err
+	}
+	size, err := binary.ReadUvarint(d.r)
+	if err != nil {
+		return err
+	}
+	if size > MaxMessageSize || (d.MaxSize > 0 && size > uint64(d.MaxSize)) {
+		l.Debug("proto.Decoder.Decode",
+			l.Int64("size", int64(size)),
+			l.Int("maxSize", d.MaxSize),
+		)
+		return ErrMessageTooLarge
+	}
+	//The buffer grows as the bytes arrive, so a length prefix without its body does not allocate the announced size
+	buf := bytes.NewBuffer(d.buf[:0])
+	_, err = io.CopyN(buf, d.r, int64(size))
+	d.buf = buf.Bytes()
+	if err != nil {
+		if err == io.EOF {
+			return io.ErrUnexpectedEOF
+		}
+		return err
+	}
+	return proto.Unmarshal(d.buf, msg)
+}
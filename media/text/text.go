@@ -0,0 +1,123 @@
+package text
+
+import (
+	"bytes"
+	"encoding"
+	"errors"
+	"fmt"
+	"github.com/rjansen/l"
+	"io"
+)
+
+const (
+	//ContentType is a constant to hold the plain text content type value
+	ContentType = "text/plain"
+	//ContentTypeUTF8 is a constant to hold the utf8 plain text content type value
+	ContentTypeUTF8 = "text/plain; charset=utf-8"
+)
+
+var (
+	//ErrInvalidTextValue is returned when the provided value has no plain text representation
+	ErrInvalidTextValue = errors.New("Invalid text value. Only: string, []byte, fmt.Stringer, encoding.TextMarshaler are valid")
+	//ErrInvalidTextReference is returned when the provided reference can not receive a plain text value
+	ErrInvalidTextReference = errors.New("Invalid text reference. Only: *string, *[]byte, encoding.TextUnmarshaler are valid")
+)
+
+//Marshal writes a plain text representation of the value
+func Marshal(w io.Writer, data interface{}) error {
+	textBytes, err := MarshalBytes(data)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(textBytes)
+	return err
+}
+
+//Unmarshal reads a plain text representation into the reference
+func Unmarshal(r io.Reader, result interface{}) error {
+	var buf bytes.Buffer
+	if _, err := buf.ReadFrom(r); err != nil {
+		return err
+	}
+	return UnmarshalBytes(buf.Bytes(), result)
+}
+
+//MarshalBytes writes a plain text representation of the value
+func MarshalBytes(data interface{}) ([]byte, error) {
+	var textBytes []byte
+	var err error
+	switch val := data.(type) {
+	case string:
+		textBytes = []byte(val)
+	case *string:
+		//A nil *string is an empty text like a nil []byte
+		if val != nil {
+			textBytes = []byte(*val)
+		}
+	case []byte:
+		textBytes = val
+	case encoding.TextMarshaler:
+		textBytes, err = val.MarshalText()
+	case fmt.Stringer:
+		textBytes = []byte(val.String())
+	default:
+		err = ErrInvalidTextValue
+	}
+	l.Debug("text.MarshalBytes",
+		l.Int("len", len(textBytes)),
+		l.Err(err),
+	)
+	return textBytes, err
+}
+
+//UnmarshalBytes reads a plain text representation into the reference
+func UnmarshalBytes(raw []byte, result interface{}) error {
+	var err error
+	switch ref := result.(type) {
+	case *string:
+		if ref == nil {
+			err = ErrInvalidTextReference
+			break
+		}
+		*ref = string(raw)
+	case *[]byte:
+		if ref == nil {
+			err = ErrInvalidTextReference
+			break
+		}
+		*ref = append((*ref)[:0], raw...)
+	case encoding.TextUnmarshaler:
+		err = ref.UnmarshalText(raw)
+	default:
+		err = ErrInvalidTextReference
+	}
+	l.Debug("text.UnmarshalBytes",
+		l.Bool("nilResult", result == nil),
+		l.Err(err),
+	)
+	return err
+}
+
+//Media is a struct to helps writes and reads of a plain text representation
+type Media struct {
+}
+
+//Marshal writes a plain text representation of the value
+func (Media) Marshal(writer io.Writer, val interface{}) error {
+	return Marshal(writer, val)
+}
+
+//Unmarshal reads a plain text representation into the reference
+func (Media) Unmarshal(reader io.Reader, ref interface{}) error {
+	return Unmarshal(reader, ref)
+}
+
+//MarshalBytes writes a plain text representation of the value
+func (Media) MarshalBytes(val interface{}) ([]byte, error) {
+	return MarshalBytes(val)
+}
+
+//UnmarshalBytes reads a plain text representation into the reference
+func (Media) UnmarshalBytes(raw []byte, ref interface{}) error {
+	return UnmarshalBytes(raw, ref)
+}
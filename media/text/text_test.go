@@ -0,0 +1,81 @@
+package text
+
+import (
+	"bytes"
+	"github.com/rjansen/l"
+	"github.com/rjansen/l/zap"
+	"github.com/stretchr/testify/assert"
+	"net"
+	"testing"
+	"time"
+)
+
+func init() {
+	if setupErr := zap.Setup(new(l.Configuration)); setupErr != nil {
+		panic(setupErr)
+	}
+	l.Info("context.media.text_test.init")
+}
+
+func TestTextMarshalBytes(t *testing.T) {
+	msg := "text mock message"
+	date := time.Date(2017, 6, 25, 19, 38, 37, 0, time.UTC)
+	cases := []struct {
+		val      interface{}
+		expected string
+	}{
+		{msg, msg},
+		{&msg, msg},
+		{[]byte(msg), msg},
+		{date, "2017-06-25T19:38:37Z"},
+		{time.Minute, "1m0s"},
+	}
+	for _, c := range cases {
+		b, e := MarshalBytes(c.val)
+		assert.Nil(t, e)
+		assert.Equal(t, c.expected, string(b))
+	}
+
+	var nilStr *string
+	b, e := MarshalBytes(nilStr)
+	assert.Nil(t, e)
+	assert.Empty(t, b)
+
+	_, e = MarshalBytes(10)
+	assert.Equal(t, ErrInvalidTextValue, e)
+}
+
+func TestTextUnmarshalBytes(t *testing.T) {
+	raw := []byte("127.0.0.1")
+
+	var str string
+	assert.Nil(t, UnmarshalBytes(raw, &str))
+	assert.Equal(t, "127.0.0.1", str)
+
+	var b []byte
+	assert.Nil(t, UnmarshalBytes(raw, &b))
+	assert.Equal(t, raw, b)
+
+	var ip net.IP
+	assert.Nil(t, UnmarshalBytes(raw, &ip))
+	assert.Equal(t, "127.0.0.1", ip.String())
+
+	var i int
+	assert.Equal(t, ErrInvalidTextReference, UnmarshalBytes(raw, &i))
+	assert.Equal(t, ErrInvalidTextReference, UnmarshalBytes(raw, (*string)(nil)))
+	assert.Equal(t, ErrInvalidTextReference, UnmarshalBytes(raw, (*[]byte)(nil)))
+	assert.NotNil(t, UnmarshalBytes([]byte("invalid ip"), &ip))
+}
+
+func TestTextMarshalAndUnmarshal(t *testing.T) {
+	var media Media
+	msg := "text mock message"
+
+	mockBuffer := new(bytes.Buffer)
+	assert.Nil(t, media.Marshal(mockBuffer, msg))
+	assert.Equal(t, msg, mockBuffer.String())
+
+	var result string
+	assert.Nil(t, media.Unmarshal(mockBuffer, &result))
+	assert.Equal(t, msg, result)
+}
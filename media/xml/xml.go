@@ -0,0 +1,70 @@
+package xml
+
+import (
+	"encoding/xml"
+	"github.com/rjansen/l"
+	"io"
+)
+
+const (
+	//ContentType is a constant to hold the xml content type value
+	ContentType = "application/xml"
+	//ContentTypeUTF8 is a constant to hold the utf8 xml content type value
+	ContentTypeUTF8 = "application/xml; charset=utf-8"
+	//ContentTypeText is a constant to hold the legacy text xml content type value
+	ContentTypeText = "text/xml"
+)
+
+//Marshal writes a xml representation of the struct instance
+func Marshal(w io.Writer, data interface{}) error {
+	return xml.NewEncoder(w).Encode(data)
+}
+
+//Unmarshal reads a xml representation into the struct instance
+func Unmarshal(r io.Reader, result interface{}) error {
+	return xml.NewDecoder(r).Decode(result)
+}
+
+//MarshalBytes writes a xml representation of the struct instance
+func MarshalBytes(data interface{}) ([]byte, error) {
+	xmlBytes, err := xml.Marshal(data)
+	l.Debug("xml.MarshalBytes",
+		l.Int("len", len(xmlBytes)),
+		l.Err(err),
+	)
+	return xmlBytes, err
+}
+
+//UnmarshalBytes reads a xml representation into the struct instance
+func UnmarshalBytes(raw []byte, result interface{}) error {
+	err := xml.Unmarshal(raw, result)
+	l.Debug("xml.UnmarshalBytes",
+		l.Bool("nilResult", result == nil),
+		l.Err(err),
+	)
+	return err
+}
+
+//Media is a struct to helps writes and reads of a xml representation
+type Media struct {
+}
+
+//Marshal writes a xml representation of the struct instance
+func (Media) Marshal(writer io.Writer, val interface{}) error {
+	return Marshal(writer, val)
+}
+
+//Unmarshal reads a xml representation into the struct instance
+func (Media) Unmarshal(reader io.Reader, ref interface{}) error {
+	return Unmarshal(reader, ref)
+}
+
+//MarshalBytes writes a xml representation of the struct instance
+func (Media) MarshalBytes(val interface{}) ([]byte, error) {
+	return MarshalBytes(val)
+}
+
+//UnmarshalBytes reads a xml representation into the struct instance
+func (Media) UnmarshalBytes(raw []byte, ref interface{}) error {
+	return UnmarshalBytes(raw, ref)
+}
@@ -0,0 +1,56 @@
+package xml
+
+import (
+	"bytes"
+	"github.com/rjansen/l"
+	"github.com/rjansen/l/zap"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func init() {
+	if setupErr := zap.Setup(new(l.Configuration)); setupErr != nil {
+		panic(setupErr)
+	}
+	l.Info("context.media.xml_test.init")
+}
+
+type mockMedia struct {
+	ID   int    `xml:"id,attr"`
+	Name string `xml:"name"`
+}
+
+func TestXMLMarshalAndUnmarshalBytes(t *testing.T) {
+	m := &mockMedia{ID: 1, Name: "XML Media"}
+
+	b, e := MarshalBytes(m)
+	assert.Nil(t, e)
+	assert.Equal(t, `<mockMedia id="1"><name>XML Media</name></mockMedia>`, string(b))
+
+	var result mockMedia
+	e = UnmarshalBytes(b, &result)
+	assert.Nil(t, e)
+	assert.Equal(t, *m, result)
+}
+
+func TestXMLMarshalAndUnmarshal(t *testing.T) {
+	m := &mockMedia{ID: 1, Name: "XML Media"}
+	var media Media
+
+	mockBuffer := new(bytes.Buffer)
+	assert.Nil(t, media.Marshal(mockBuffer, m))
+	assert.True(t, mockBuffer.Len() > 0, "Buffer does not have any value")
+
+	var result mockMedia
+	assert.Nil(t, media.Unmarshal(mockBuffer, &result))
+	assert.Equal(t, *m, result)
+}
+
+func TestXMLErr(t *testing.T) {
+	_, e := MarshalBytes(map[string]interface{}{"id": 1})
+	assert.NotNil(t, e)
+
+	var result mockMedia
+	e = UnmarshalBytes([]byte(`<mockMedia><name>`), &result)
+	assert.NotNil(t, e)
+}
@@ -0,0 +1,154 @@
+package mtls
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"github.com/rjansen/l"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+)
+
+var (
+	//DefaultReloadInterval is the Options.ReloadInterval when zero
+	DefaultReloadInterval = 30 * time.Second
+	//ErrNoCA is returned when a client CA file has no certificate
+	ErrNoCA = errors.New("Client CA file without PEM certificates")
+)
+
+//Options holds the server tls settings
+type Options struct {
+	//CertFile and KeyFile are the PEM server certificate and key
+	CertFile string
+	KeyFile  string
+	//ClientCAFiles are the PEM files of the CAs that verify the client certificates
+	ClientCAFiles []string
+	//ClientAuth is the client certificate policy, tls.RequireAndVerifyClientCert when zero.
+	//Use tls.VerifyClientCertIfGiven to also accept the clients without certificate
+	ClientAuth tls.ClientAuthType
+	//ReloadInterval is the min interval between the files modification checks, negative disables the checks
+	ReloadInterval time.Duration
+}
+
+//Reloader keeps the tls.Config of the Options files, reloading it when the files change, like in a certificate rotation
+type Reloader struct {
+	options   Options
+	mutex     sync.RWMutex
+	config    *tls.Config
+	modTimes  map[string]time.Time
+	lastCheck time.Time
+	now       func() time.Time
+}
+
+//NewReloader creates a Reloader with the Options files loaded
+func NewReloader(options Options) (*Reloader, error) {
+	if options.ClientAuth == tls.NoClientCert {
+		options.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	if options.ReloadInterval == 0 {
+		options.ReloadInterval = DefaultReloadInterval
+	}
+	r := &Reloader{options: options, now: time.Now}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *Reloader) files() []string {
+	return append([]string{r.options.CertFile, r.options.KeyFile}, r.options.ClientCAFiles...)
+}
+
+func modTimes(files []string) (map[string]time.Time, error) {
+	times := make(map[string]time.Time, len(files))
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			return nil, err
+		}
+		times[file] = info.ModTime()
+	}
+	return times, nil
+}
+
+//Reload reads the files again, keeping the current config when it fails
+func (r *Reloader) Reload() error {
+	times, err := modTimes(r.files())
+	if err != nil {
+		return err
+	}
+	cert, err := tls.LoadX509KeyPair(r.options.CertFile, r.options.KeyFile)
+	if err != nil {
+		return err
+	}
+	pool := x509.NewCertPool()
+	for _, file := range r.options.ClientCAFiles {
+		pem, err := ioutil.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return ErrNoCA
+		}
+	}
+	config := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientCAs:    pool,
+		ClientAuth:   r.options.ClientAuth,
+		MinVersion:   tls.VersionTLS12,
+	}
+	r.mutex.Lock()
+	r.config = config
+	r.modTimes = times
+	r.lastCheck = r.now()
+	r.mutex.Unlock()
+	return nil
+}
+
+func (r *Reloader) changed() bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	now := r.now()
+	if r.options.ReloadInterval < 0 || now.Sub(r.lastCheck) < r.options.ReloadInterval {
+		return false
+	}
+	r.lastCheck = now
+	times, err := modTimes(r.files())
+	if err != nil {
+		//A rotation replacing the files may be in progress, the next check tries again
+		return false
+	}
+	for file, modTime := range times {
+		if !modTime.Equal(r.modTimes[file]) {
+			return true
+		}
+	}
+	return false
+}
+
+//Config returns the current tls.Config, checking the files modification every ReloadInterval
+func (r *Reloader) Config() *tls.Config {
+	if r.changed() {
+		if err := r.Reload(); err != nil {
+			l.Warn("haki.mtls.ReloadErr",
+				l.String("certFile", r.options.CertFile),
+				l.Err(err),
+			)
+		}
+	}
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return r.config
+}
+
+//TLSConfig returns the tls.Config to be used by the servers, it takes the current Config in every handshake
+func (r *Reloader) TLSConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			return r.Config(), nil
+		},
+	}
+}
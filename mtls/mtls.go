@@ -0,0 +1,98 @@
+package mtls
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"github.com/rjansen/haki"
+	"net/http"
+	"time"
+)
+
+const (
+	//SPIFFEScheme is the uri scheme of the SPIFFE ids in the certificate SANs
+	SPIFFEScheme = "spiffe"
+	//TokenPrefix prefixes the subject of the certificates without a SPIFFE id in the identity token
+	TokenPrefix = "x509:"
+)
+
+var (
+	//ErrNoCertificate is returned when the connection has no verified client certificate and rendered as a 401 response
+	ErrNoCertificate = haki.NewStatusError(http.StatusUnauthorized, "Verified client certificate required")
+)
+
+//Peer is the identity of a verified client certificate
+type Peer struct {
+	Subject        string
+	CommonName     string
+	Issuer         string
+	SerialNumber   string
+	DNSNames       []string
+	EmailAddresses []string
+	IPAddresses    []string
+	URIs           []string
+	//SPIFFEID is the first spiffe uri SAN, empty when there is none
+	SPIFFEID string
+	//Fingerprint is the hex SHA-256 of the certificate
+	Fingerprint string
+	NotAfter    time.Time
+}
+
+//NewPeer creates the Peer of a certificate
+func NewPeer(cert *x509.Certificate) *Peer {
+	sum := sha256.Sum256(cert.Raw)
+	peer := &Peer{
+		Subject:        cert.Subject.String(),
+		CommonName:     cert.Subject.CommonName,
+		Issuer:         cert.Issuer.String(),
+		SerialNumber:   cert.SerialNumber.String(),
+		DNSNames:       cert.DNSNames,
+		EmailAddresses: cert.EmailAddresses,
+		Fingerprint:    hex.EncodeToString(sum[:]),
+		NotAfter:       cert.NotAfter,
+	}
+	for _, ip := range cert.IPAddresses {
+		peer.IPAddresses = append(peer.IPAddresses, ip.String())
+	}
+	for _, uri := range cert.URIs {
+		peer.URIs = append(peer.URIs, uri.String())
+		if peer.SPIFFEID == "" && uri.Scheme == SPIFFEScheme {
+			peer.SPIFFEID = uri.String()
+		}
+	}
+	return peer
+}
+
+//PeerOf returns the Peer of the leaf certificate of the first verified chain of the connection, or ErrNoCertificate.
+//The chains are verified only when the tls.Config ClientAuth verifies the client certificates, see NewReloader
+func PeerOf(state *tls.ConnectionState) (*Peer, error) {
+	if state == nil || len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+		return nil, ErrNoCertificate
+	}
+	return NewPeer(state.VerifiedChains[0][0]), nil
+}
+
+//Token returns the identity token of the peer, its SPIFFE id or its subject
+func (p *Peer) Token() string {
+	if p.SPIFFEID != "" {
+		return p.SPIFFEID
+	}
+	return TokenPrefix + p.Subject
+}
+
+//Identity returns the identity value of the peer
+func (p *Peer) Identity() map[string]interface{} {
+	return map[string]interface{}{
+		"subject":     p.Subject,
+		"commonName":  p.CommonName,
+		"issuer":      p.Issuer,
+		"serial":      p.SerialNumber,
+		"dnsNames":    p.DNSNames,
+		"emails":      p.EmailAddresses,
+		"ips":         p.IPAddresses,
+		"uris":        p.URIs,
+		"spiffeId":    p.SPIFFEID,
+		"fingerprint": p.Fingerprint,
+	}
+}
@@ -0,0 +1,210 @@
+package mtls
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"github.com/rjansen/l"
+	"github.com/rjansen/l/zap"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func init() {
+	if setupErr := zap.Setup(new(l.Configuration)); setupErr != nil {
+		panic(setupErr)
+	}
+	l.Info("context.mtls_test.init")
+}
+
+type testCert struct {
+	cert   *x509.Certificate
+	key    *ecdsa.PrivateKey
+	pair   tls.Certificate
+	pem    []byte
+	keyPEM []byte
+}
+
+var (
+	serial             int64
+	errServerHandshake = errors.New("Server handshake failed")
+)
+
+//newTestCert creates a certificate signed by the parent, self signed CA when parent is nil
+func newTestCert(t *testing.T, commonName string, parent *testCert, uris ...string) *testCert {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+	serial++
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: commonName, Organization: []string{"haki"}},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	for _, uri := range uris {
+		u, err := url.Parse(uri)
+		assert.Nil(t, err)
+		template.URIs = append(template.URIs, u)
+	}
+	signer, signerKey := template, key
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+	} else {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	assert.Nil(t, err)
+	cert, err := x509.ParseCertificate(der)
+	assert.Nil(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	assert.Nil(t, err)
+	c := &testCert{
+		cert:   cert,
+		key:    key,
+		pem:    pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		keyPEM: pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}),
+	}
+	c.pair, err = tls.X509KeyPair(c.pem, c.keyPEM)
+	assert.Nil(t, err)
+	return c
+}
+
+//handshake connects a client with the certificate to a server of the config and returns the server connection state
+func handshake(t *testing.T, config *tls.Config, ca *testCert, client *testCert) (*tls.ConnectionState, error) {
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", config)
+	assert.Nil(t, err)
+	defer listener.Close()
+	states := make(chan *tls.ConnectionState, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			states <- nil
+			return
+		}
+		defer conn.Close()
+		tlsConn := conn.(*tls.Conn)
+		if err := tlsConn.Handshake(); err != nil {
+			states <- nil
+			return
+		}
+		state := tlsConn.ConnectionState()
+		states <- &state
+	}()
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	clientConfig := &tls.Config{RootCAs: roots, ServerName: "localhost"}
+	if client != nil {
+		clientConfig.Certificates = []tls.Certificate{client.pair}
+	}
+	conn, err := tls.Dial("tcp", listener.Addr().String(), clientConfig)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	//TLS 1.3 reports the client certificate errors only to the server, after the client handshake
+	state := <-states
+	if state == nil {
+		return nil, errServerHandshake
+	}
+	return state, nil
+}
+
+func TestPeer(t *testing.T) {
+	ca := newTestCert(t, "haki ca", nil)
+	client := newTestCert(t, "billing", ca, "https://billing.example.com", "spiffe://example.com/ns/prod/sa/billing")
+	peer := NewPeer(client.cert)
+	assert.Equal(t, "CN=billing,O=haki", peer.Subject)
+	assert.Equal(t, "billing", peer.CommonName)
+	assert.Equal(t, "CN=haki ca,O=haki", peer.Issuer)
+	assert.Equal(t, []string{"localhost"}, peer.DNSNames)
+	assert.Equal(t, []string{"127.0.0.1"}, peer.IPAddresses)
+	assert.Equal(t, "spiffe://example.com/ns/prod/sa/billing", peer.SPIFFEID)
+	assert.Equal(t, peer.SPIFFEID, peer.Token())
+	assert.Len(t, peer.Fingerprint, 64)
+	assert.Equal(t, "billing", peer.Identity()["commonName"])
+
+	assert.Equal(t, "x509:CN=haki ca,O=haki", NewPeer(ca.cert).Token())
+
+	_, err := PeerOf(nil)
+	assert.Equal(t, ErrNoCertificate, err)
+	_, err = PeerOf(&tls.ConnectionState{PeerCertificates: []*x509.Certificate{client.cert}})
+	assert.Equal(t, ErrNoCertificate, err, "Unverified certificate")
+}
+
+func writeFile(t *testing.T, path string, data []byte, modTime time.Time) {
+	assert.Nil(t, ioutil.WriteFile(path, data, 0600))
+	assert.Nil(t, os.Chtimes(path, modTime, modTime))
+}
+
+func TestReloader(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCert(t, "haki ca", nil)
+	server := newTestCert(t, "server", ca)
+	client := newTestCert(t, "billing", ca, "spiffe://example.com/billing")
+	modTime := time.Now().Add(-time.Hour)
+	options := Options{
+		CertFile:      filepath.Join(dir, "server.crt"),
+		KeyFile:       filepath.Join(dir, "server.key"),
+		ClientCAFiles: []string{filepath.Join(dir, "ca.crt")},
+	}
+	writeFile(t, options.CertFile, server.pem, modTime)
+	writeFile(t, options.KeyFile, server.keyPEM, modTime)
+	writeFile(t, options.ClientCAFiles[0], ca.pem, modTime)
+
+	reloader, err := NewReloader(options)
+	assert.Nil(t, err)
+	now := time.Now()
+	reloader.now = func() time.Time { return now }
+	config := reloader.TLSConfig()
+
+	state, err := handshake(t, config, ca, client)
+	assert.Nil(t, err)
+	peer, err := PeerOf(state)
+	assert.Nil(t, err)
+	assert.Equal(t, "spiffe://example.com/billing", peer.Token())
+
+	_, err = handshake(t, config, ca, nil)
+	assert.NotNil(t, err, "Client certificate required")
+
+	rotatedCA := newTestCert(t, "haki rotated ca", nil)
+	rotatedClient := newTestCert(t, "billing", rotatedCA)
+	writeFile(t, options.ClientCAFiles[0], rotatedCA.pem, modTime.Add(time.Minute))
+	_, err = handshake(t, config, ca, rotatedClient)
+	assert.NotNil(t, err, "Not checked before the ReloadInterval")
+
+	now = now.Add(DefaultReloadInterval)
+	state, err = handshake(t, config, ca, rotatedClient)
+	assert.Nil(t, err)
+	peer, err = PeerOf(state)
+	assert.Nil(t, err)
+	assert.Equal(t, "x509:CN=billing,O=haki", peer.Token())
+	_, err = handshake(t, config, ca, client)
+	assert.NotNil(t, err, "Previous CA removed")
+
+	writeFile(t, options.ClientCAFiles[0], []byte("invalid"), modTime.Add(2*time.Minute))
+	now = now.Add(DefaultReloadInterval)
+	_, err = handshake(t, config, ca, rotatedClient)
+	assert.Nil(t, err, "Invalid files keep the current config")
+
+	_, err = NewReloader(Options{CertFile: options.CertFile, KeyFile: options.KeyFile, ClientCAFiles: options.ClientCAFiles})
+	assert.Equal(t, ErrNoCA, err)
+	_, err = NewReloader(Options{CertFile: filepath.Join(dir, "missing.crt"), KeyFile: options.KeyFile})
+	assert.NotNil(t, err)
+}
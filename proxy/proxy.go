@@ -0,0 +1,173 @@
+package proxy
+
+import (
+	"errors"
+	"github.com/rjansen/haki"
+	"net"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+)
+
+var (
+	//HopHeaders are the connection headers of each hop, removed from the proxied requests and responses
+	HopHeaders = []string{
+		"Connection", "Proxy-Connection", "Keep-Alive", "Proxy-Authenticate", "Proxy-Authorization",
+		"Te", "Trailer", "Transfer-Encoding", "Upgrade",
+	}
+	//ErrNoRoute is returned when no route matches the request path and rendered as a 404 response
+	ErrNoRoute = haki.NewStatusError(http.StatusNotFound, "No upstream for the request path")
+	//ErrInvalidUpstream is returned by NewRouter when an upstream is not an absolute http or https url
+	ErrInvalidUpstream = errors.New("Invalid upstream. Only absolute http and https urls are valid")
+)
+
+//Configuration maps the proxy section of the haki.yaml file
+type Configuration struct {
+	//APIURL is the upstream of the /api/ paths
+	APIURL string `json:"api_url" yaml:"api_url" mapstructure:"api_url"`
+	//WebURL is the upstream of the /web/ paths
+	WebURL string `json:"web_url" yaml:"web_url" mapstructure:"web_url"`
+	//LoginURL is the upstream of the /auth/ paths, empty when the login is served by the proxy itself, see the auth package
+	LoginURL string `json:"login_url" yaml:"login_url" mapstructure:"login_url"`
+}
+
+//Routes returns the routes of the configured upstreams, with the prefixes stripped
+func (c Configuration) Routes() []Route {
+	var routes []Route
+	for _, route := range []Route{
+		{Prefix: "/api/", Upstream: c.APIURL, StripPrefix: true},
+		{Prefix: "/web/", Upstream: c.WebURL, StripPrefix: true},
+		{Prefix: "/auth/", Upstream: c.LoginURL},
+	} {
+		if route.Upstream != "" {
+			routes = append(routes, route)
+		}
+	}
+	return routes
+}
+
+//Route sends the requests of the paths starting with Prefix to the Upstream
+type Route struct {
+	Prefix string
+	//Upstream is the base url of the proxied requests, its path is prepended to the request path
+	Upstream string
+	//StripPrefix removes the Prefix from the request path
+	StripPrefix bool
+}
+
+//Target is the upstream location of a request
+type Target struct {
+	//URL is the upstream url without the request query
+	URL *url.URL
+	//Host is the upstream host with the port, defaulted by the scheme
+	Host string
+}
+
+type route struct {
+	Route
+	upstream *url.URL
+	host     string
+}
+
+//Router matches the request paths to the routes by the longest prefix
+type Router struct {
+	routes []route
+}
+
+//NewRouter creates a Router of the provided routes
+func NewRouter(routes ...Route) (*Router, error) {
+	router := &Router{routes: make([]route, len(routes))}
+	for i, r := range routes {
+		upstream, err := url.Parse(r.Upstream)
+		if err != nil {
+			return nil, err
+		}
+		if (upstream.Scheme != "http" && upstream.Scheme != "https") || upstream.Host == "" {
+			return nil, ErrInvalidUpstream
+		}
+		host := upstream.Host
+		if upstream.Port() == "" {
+			port := "80"
+			if upstream.Scheme == "https" {
+				port = "443"
+			}
+			host = net.JoinHostPort(upstream.Hostname(), port)
+		}
+		router.routes[i] = route{Route: r, upstream: upstream, host: host}
+	}
+	sort.SliceStable(router.routes, func(i, j int) bool {
+		return len(router.routes[i].Prefix) > len(router.routes[j].Prefix)
+	})
+	return router, nil
+}
+
+//NewRouterWithConfig creates a Router of the haki.yaml proxy section upstreams
+func NewRouterWithConfig(config Configuration) (*Router, error) {
+	return NewRouter(config.Routes()...)
+}
+
+func matchPrefix(path string, prefix string) bool {
+	if !strings.HasPrefix(path, prefix) {
+		return false
+	}
+	//The /api prefix matches /api and /api/users, but not /apis
+	return len(path) == len(prefix) || strings.HasSuffix(prefix, "/") || path[len(prefix)] == '/'
+}
+
+//cleanPath removes the dot segments and the duplicated slashes of the request path and keeps its trailing slash
+func cleanPath(requestPath string) string {
+	if requestPath == "" || requestPath[0] != '/' {
+		requestPath = "/" + requestPath
+	}
+	cleaned := path.Clean(requestPath)
+	if cleaned != "/" && strings.HasSuffix(requestPath, "/") {
+		cleaned += "/"
+	}
+	return cleaned
+}
+
+//Match returns the upstream target of the request path, false when no route matches.
+//The path is cleaned before the match, so the dot segments can not escape the route prefix or the upstream path
+func (r *Router) Match(requestPath string) (Target, bool) {
+	requestPath = cleanPath(requestPath)
+	for _, rt := range r.routes {
+		if !matchPrefix(requestPath, rt.Prefix) {
+			continue
+		}
+		upstreamPath := requestPath
+		if rt.StripPrefix {
+			upstreamPath = "/" + strings.TrimPrefix(requestPath[len(rt.Prefix):], "/")
+		}
+		target := *rt.upstream
+		target.Path = strings.TrimSuffix(target.Path, "/") + upstreamPath
+		target.RawPath = ""
+		return Target{URL: &target, Host: rt.host}, true
+	}
+	return Target{}, false
+}
+
+//ConnectionHeaders returns the header names listed in a Connection header value, also removed as hop headers
+func ConnectionHeaders(connection string) []string {
+	var headers []string
+	for _, header := range strings.Split(connection, ",") {
+		if header = strings.TrimSpace(header); header != "" {
+			headers = append(headers, header)
+		}
+	}
+	return headers
+}
+
+//IsUpgrade returns true when the Connection and Upgrade header values ask for a protocol upgrade, like WebSocket
+func IsUpgrade(connection string, upgrade string) bool {
+	if upgrade == "" {
+		return false
+	}
+	for _, header := range ConnectionHeaders(connection) {
+		if strings.EqualFold(header, "upgrade") {
+			return true
+		}
+	}
+	return false
+}
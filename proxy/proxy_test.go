@@ -0,0 +1,63 @@
+package proxy
+
+import (
+	"github.com/rjansen/l"
+	"github.com/rjansen/l/zap"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func init() {
+	if setupErr := zap.Setup(new(l.Configuration)); setupErr != nil {
+		panic(setupErr)
+	}
+	l.Info("context.proxy_test.init")
+}
+
+func TestRouter(t *testing.T) {
+	router, err := NewRouter(
+		Route{Prefix: "/api", Upstream: "http://127.0.0.1:4000/v1/", StripPrefix: true},
+		Route{Prefix: "/api/admin", Upstream: "https://admin.example.com"},
+		Route{Prefix: "/", Upstream: "http://127.0.0.1:3000"},
+	)
+	assert.Nil(t, err)
+
+	for path, expected := range map[string][]string{
+		"/api":             {"http://127.0.0.1:4000/v1/", "127.0.0.1:4000"},
+		"/api/users":       {"http://127.0.0.1:4000/v1/users", "127.0.0.1:4000"},
+		"/api/admin/users": {"https://admin.example.com/api/admin/users", "admin.example.com:443"},
+		"/apis":            {"http://127.0.0.1:3000/apis", "127.0.0.1:3000"},
+		"/web/index.html":  {"http://127.0.0.1:3000/web/index.html", "127.0.0.1:3000"},
+		"/api/users/":      {"http://127.0.0.1:4000/v1/users/", "127.0.0.1:4000"},
+		"/api/../admin":    {"http://127.0.0.1:3000/admin", "127.0.0.1:3000"},
+		"/api/./users":     {"http://127.0.0.1:4000/v1/users", "127.0.0.1:4000"},
+		"/api/users/../..": {"http://127.0.0.1:3000/", "127.0.0.1:3000"},
+		"/api//admin/x":    {"https://admin.example.com/api/admin/x", "admin.example.com:443"},
+		"/api/../../etc":   {"http://127.0.0.1:3000/etc", "127.0.0.1:3000"},
+	} {
+		target, found := router.Match(path)
+		assert.True(t, found, path)
+		assert.Equal(t, expected[0], target.URL.String(), path)
+		assert.Equal(t, expected[1], target.Host, path)
+	}
+
+	router, err = NewRouterWithConfig(Configuration{APIURL: "http://127.0.0.1:4000", WebURL: "http://127.0.0.1:3000"})
+	assert.Nil(t, err)
+	target, found := router.Match("/web/index.html")
+	assert.True(t, found)
+	assert.Equal(t, "http://127.0.0.1:3000/index.html", target.URL.String())
+	_, found = router.Match("/auth/login")
+	assert.False(t, found)
+
+	for _, upstream := range []string{"127.0.0.1:4000", "ftp://127.0.0.1", "/api"} {
+		_, err = NewRouter(Route{Prefix: "/", Upstream: upstream})
+		assert.NotNil(t, err, upstream)
+	}
+}
+
+func TestHopHeaders(t *testing.T) {
+	assert.Equal(t, []string{"Keep-Alive", "X-Hop"}, ConnectionHeaders("Keep-Alive, X-Hop,"))
+	assert.True(t, IsUpgrade("keep-alive, Upgrade", "websocket"))
+	assert.False(t, IsUpgrade("Upgrade", ""))
+	assert.False(t, IsUpgrade("keep-alive", "websocket"))
+}
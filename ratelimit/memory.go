@@ -0,0 +1,100 @@
+package ratelimit
+
+import (
+	"hash/fnv"
+	"sync"
+	"time"
+)
+
+var (
+	//DefaultShards is the number of shards of the stores created by NewMemoryStore
+	DefaultShards = 32
+	//SweepInterval is the min interval between the expired keys cleanups of a shard
+	SweepInterval = time.Minute
+)
+
+//MemoryStore is an in memory Store sharded by the key hash to reduce the lock contention
+type MemoryStore struct {
+	shards []*shard
+}
+
+type shard struct {
+	sync.Mutex
+	values    map[string]entry
+	lastSweep int64
+}
+
+type entry struct {
+	value   int64
+	expires int64
+}
+
+//NewMemoryStore creates a MemoryStore with DefaultShards shards
+func NewMemoryStore() *MemoryStore {
+	return NewMemoryStoreShards(DefaultShards)
+}
+
+//NewMemoryStoreShards creates a MemoryStore with the provided number of shards
+func NewMemoryStoreShards(shards int) *MemoryStore {
+	if shards < 1 {
+		shards = 1
+	}
+	store := &MemoryStore{shards: make([]*shard, shards)}
+	for i := range store.shards {
+		store.shards[i] = &shard{values: make(map[string]entry), lastSweep: time.Now().UnixNano()}
+	}
+	return store
+}
+
+func (s *MemoryStore) shard(key string) *shard {
+	hash := fnv.New32a()
+	hash.Write([]byte(key))
+	return s.shards[hash.Sum32()%uint32(len(s.shards))]
+}
+
+//Get returns the key value, zero when the key is not found or expired
+func (s *MemoryStore) Get(key string) (int64, error) {
+	sh := s.shard(key)
+	sh.Lock()
+	defer sh.Unlock()
+	if e, found := sh.values[key]; found && e.expires > time.Now().UnixNano() {
+		return e.value, nil
+	}
+	return 0, nil
+}
+
+//CompareAndSwap sets the key to new, expiring after ttl, only when the current value is old
+func (s *MemoryStore) CompareAndSwap(key string, old int64, new int64, ttl time.Duration) (bool, error) {
+	sh := s.shard(key)
+	sh.Lock()
+	defer sh.Unlock()
+	now := time.Now().UnixNano()
+	var current int64
+	if e, found := sh.values[key]; found && e.expires > now {
+		current = e.value
+	}
+	if current != old {
+		return false, nil
+	}
+	sh.values[key] = entry{value: new, expires: now + int64(ttl)}
+	if now-sh.lastSweep > int64(SweepInterval) {
+		for k, e := range sh.values {
+			if e.expires <= now {
+				delete(sh.values, k)
+			}
+		}
+		sh.lastSweep = now
+	}
+	return true, nil
+}
+
+//Len returns the number of keys kept by the store, including the expired ones not swept yet
+func (s *MemoryStore) Len() int {
+	var size int
+	for _, sh := range s.shards {
+		sh.Lock()
+		size += len(sh.values)
+		sh.Unlock()
+	}
+	return size
+}
@@ -0,0 +1,133 @@
+package ratelimit
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	//ErrStoreConflict is returned when the store value of a key changes concurrently more than MaxConflicts times
+	ErrStoreConflict = errors.New("Rate limit store conflict. The key was updated concurrently too many times")
+	//MaxConflicts is the max number of compare and swap retries of a Limiter
+	MaxConflicts = 10
+)
+
+//Rate is the number of requests allowed in a period and the max burst of requests allowed at once
+type Rate struct {
+	//Limit is the number of requests allowed in Period, it must be greater than zero
+	Limit int
+	//Period is the interval where Limit requests are allowed
+	Period time.Duration
+	//Burst is the max number of requests allowed at once, Limit when zero
+	Burst int
+}
+
+//PerSecond creates a Rate of n requests per second
+func PerSecond(n int) Rate {
+	return Rate{Limit: n, Period: time.Second}
+}
+
+//PerMinute creates a Rate of n requests per minute
+func PerMinute(n int) Rate {
+	return Rate{Limit: n, Period: time.Minute}
+}
+
+//PerHour creates a Rate of n requests per hour
+func PerHour(n int) Rate {
+	return Rate{Limit: n, Period: time.Hour}
+}
+
+func (r Rate) interval() time.Duration {
+	return r.Period / time.Duration(r.Limit)
+}
+
+func (r Rate) burst() int {
+	if r.Burst > 0 {
+		return r.Burst
+	}
+	return r.Limit
+}
+
+//Result is the outcome of a Limiter.Allow call
+type Result struct {
+	//Allowed is true when the request is within the rate
+	Allowed bool
+	//Limit is the max burst of requests
+	Limit int
+	//Remaining is the number of requests allowed right now after this one
+	Remaining int
+	//RetryAfter is the wait until the next request is allowed, zero when Allowed is true
+	RetryAfter time.Duration
+	//ResetAfter is the wait until the key is back to the full burst
+	ResetAfter time.Duration
+}
+
+//Store keeps the theoretical arrival time, in unix nanoseconds, of each key.
+//Distributed implementations must make CompareAndSwap atomic
+type Store interface {
+	//Get returns the key value, zero when the key is not found or expired
+	Get(key string) (int64, error)
+	//CompareAndSwap sets the key to new, expiring after ttl, only when the current value is old.
+	//An old value of zero means that the key must not exist
+	CompareAndSwap(key string, old int64, new int64, ttl time.Duration) (bool, error)
+}
+
+//Limiter is a generic cell rate algorithm (GCRA) limiter, a token bucket that keeps one value per key
+type Limiter struct {
+	Rate  Rate
+	Store Store
+	//now is replaced in the tests
+	now func() time.Time
+}
+
+//New creates a Limiter of the provided rate, a MemoryStore is used when store is nil
+func New(rate Rate, store Store) *Limiter {
+	if store == nil {
+		store = NewMemoryStore()
+	}
+	return &Limiter{Rate: rate, Store: store, now: time.Now}
+}
+
+//Allow takes one request of the key rate
+func (l *Limiter) Allow(key string) (Result, error) {
+	interval := l.Rate.interval()
+	burst := l.Rate.burst()
+	tolerance := interval * time.Duration(burst)
+	clock := l.now
+	if clock == nil {
+		clock = time.Now
+	}
+	for i := 0; i < MaxConflicts; i++ {
+		now := clock().UnixNano()
+		old, err := l.Store.Get(key)
+		if err != nil {
+			return Result{}, err
+		}
+		tat := old
+		if tat < now {
+			tat = now
+		}
+		newTat := tat + int64(interval)
+		allowAt := newTat - int64(tolerance)
+		if now < allowAt {
+			return Result{
+				Limit:      burst,
+				RetryAfter: time.Duration(allowAt - now),
+				ResetAfter: time.Duration(tat - now),
+			}, nil
+		}
+		swapped, err := l.Store.CompareAndSwap(key, old, newTat, time.Duration(newTat-now))
+		if err != nil {
+			return Result{}, err
+		}
+		if swapped {
+			return Result{
+				Allowed:    true,
+				Limit:      burst,
+				Remaining:  int((now - allowAt) / int64(interval)),
+				ResetAfter: time.Duration(newTat - now),
+			}, nil
+		}
+	}
+	return Result{}, ErrStoreConflict
+}
@@ -0,0 +1,193 @@
+package ratelimit
+
+import (
+	"errors"
+	"fmt"
+	"github.com/rjansen/l"
+	"github.com/rjansen/l/zap"
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func init() {
+	if setupErr := zap.Setup(new(l.Configuration)); setupErr != nil {
+		panic(setupErr)
+	}
+	l.Info("context.ratelimit_test.init")
+}
+
+type mockClock struct {
+	now time.Time
+}
+
+func (c *mockClock) Now() time.Time {
+	return c.now
+}
+
+func TestLimiterBurst(t *testing.T) {
+	clock := &mockClock{now: time.Unix(1479637815, 0)}
+	limiter := New(Rate{Limit: 10, Period: time.Second, Burst: 3}, nil)
+	limiter.now = clock.Now
+
+	for i := 2; i >= 0; i-- {
+		result, err := limiter.Allow("mock")
+		assert.Nil(t, err)
+		assert.True(t, result.Allowed)
+		assert.Equal(t, 3, result.Limit)
+		assert.Equal(t, i, result.Remaining)
+	}
+	result, err := limiter.Allow("mock")
+	assert.Nil(t, err)
+	assert.False(t, result.Allowed)
+	assert.Equal(t, 0, result.Remaining)
+	assert.Equal(t, 100*time.Millisecond, result.RetryAfter)
+	assert.Equal(t, 300*time.Millisecond, result.ResetAfter)
+
+	result, err = limiter.Allow("other")
+	assert.Nil(t, err)
+	assert.True(t, result.Allowed)
+
+	clock.now = clock.now.Add(100 * time.Millisecond)
+	result, err = limiter.Allow("mock")
+	assert.Nil(t, err)
+	assert.True(t, result.Allowed)
+	assert.Equal(t, 0, result.Remaining)
+	result, err = limiter.Allow("mock")
+	assert.Nil(t, err)
+	assert.False(t, result.Allowed)
+
+	clock.now = clock.now.Add(time.Second)
+	result, err = limiter.Allow("mock")
+	assert.Nil(t, err)
+	assert.True(t, result.Allowed)
+	assert.Equal(t, 2, result.Remaining)
+}
+
+func TestLimiterRate(t *testing.T) {
+	assert.Equal(t, Rate{Limit: 5, Period: time.Second}, PerSecond(5))
+	assert.Equal(t, Rate{Limit: 5, Period: time.Minute}, PerMinute(5))
+	assert.Equal(t, Rate{Limit: 5, Period: time.Hour}, PerHour(5))
+
+	clock := &mockClock{now: time.Unix(1479637815, 0)}
+	limiter := &Limiter{Rate: PerMinute(60), Store: NewMemoryStoreShards(0)}
+	limiter.now = clock.Now
+	var allowed int
+	for i := 0; i < 120; i++ {
+		result, err := limiter.Allow("mock")
+		assert.Nil(t, err)
+		if result.Allowed {
+			allowed++
+		}
+		clock.now = clock.now.Add(100 * time.Millisecond)
+	}
+	//The full burst of 60 plus one request for each whole second until the last request at 11.9s
+	assert.Equal(t, 71, allowed)
+}
+
+func TestLimiterConcurrent(t *testing.T) {
+	limiter := New(Rate{Limit: 100, Period: time.Hour}, NewMemoryStore())
+	var allowed int32
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				result, err := limiter.Allow("mock")
+				assert.Nil(t, err)
+				if result.Allowed {
+					atomic.AddInt32(&allowed, 1)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(100), allowed)
+}
+
+type mockStore struct {
+	getErr  error
+	swapErr error
+}
+
+func (s mockStore) Get(key string) (int64, error) {
+	return 0, s.getErr
+}
+
+func (s mockStore) CompareAndSwap(key string, old int64, new int64, ttl time.Duration) (bool, error) {
+	return false, s.swapErr
+}
+
+func TestLimiterErr(t *testing.T) {
+	mockErr := errors.New("MockErr")
+	for _, store := range []mockStore{{getErr: mockErr}, {swapErr: mockErr}} {
+		_, err := New(PerSecond(1), store).Allow("mock")
+		assert.Equal(t, mockErr, err)
+	}
+	_, err := New(PerSecond(1), mockStore{}).Allow("mock")
+	assert.Equal(t, ErrStoreConflict, err)
+}
+
+func TestMemoryStore(t *testing.T) {
+	sweepInterval := SweepInterval
+	SweepInterval = 0
+	defer func() { SweepInterval = sweepInterval }()
+
+	store := NewMemoryStoreShards(4)
+	value, err := store.Get("mock")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), value)
+
+	swapped, err := store.CompareAndSwap("mock", 1, 10, time.Minute)
+	assert.Nil(t, err)
+	assert.False(t, swapped)
+	swapped, err = store.CompareAndSwap("mock", 0, 10, time.Minute)
+	assert.Nil(t, err)
+	assert.True(t, swapped)
+	swapped, err = store.CompareAndSwap("mock", 0, 20, time.Minute)
+	assert.Nil(t, err)
+	assert.False(t, swapped)
+	value, err = store.Get("mock")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(10), value)
+
+	for i := 0; i < 10; i++ {
+		swapped, err = store.CompareAndSwap(fmt.Sprintf("expired%d", i), 0, 10, time.Nanosecond)
+		assert.Nil(t, err)
+		assert.True(t, swapped)
+	}
+	time.Sleep(time.Millisecond)
+	value, err = store.Get("expired0")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), value)
+	swapped, err = store.CompareAndSwap("expired0", 0, 20, time.Minute)
+	assert.Nil(t, err)
+	assert.True(t, swapped)
+
+	for i := 0; i < 4; i++ {
+		store.CompareAndSwap(fmt.Sprintf("sweep%d", i), 0, 10, time.Minute)
+	}
+	assert.True(t, store.Len() < 16, fmt.Sprint(store.Len()))
+}
+
+func BenchmarkLimiter(b *testing.B) {
+	limiter := New(PerSecond(1000000000), NewMemoryStore())
+	keys := make([]string, 1024)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("key%d", i)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		var i int
+		for pb.Next() {
+			if _, err := limiter.Allow(keys[i%len(keys)]); err != nil {
+				b.Fatal(err)
+			}
+			i++
+		}
+	})
+}
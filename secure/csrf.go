@@ -0,0 +1,153 @@
+package secure
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"github.com/rjansen/haki"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	//CSRFHeader is the default request header of the submitted token
+	CSRFHeader = "X-Csrf-Token"
+	//CSRFField is the default url encoded form field of the submitted token
+	CSRFField = "csrf_token"
+	//CSRFCookie is the default name of the token cookie
+	CSRFCookie = "csrf_token"
+
+	tokenSize = 32
+)
+
+var (
+	//ErrCSRFTokenMissing is returned when an unsafe request does not submit the token
+	ErrCSRFTokenMissing = haki.NewStatusError(http.StatusForbidden, "CSRF token missing. Send the token cookie value in the CSRF header or form field")
+	//ErrCSRFTokenInvalid is returned when the submitted token does not match the cookie token
+	ErrCSRFTokenInvalid = haki.NewStatusError(http.StatusForbidden, "CSRF token invalid")
+)
+
+//CSRFOptions holds the double submit cookie settings
+type CSRFOptions struct {
+	//Secret signs the tokens with the identity token of the request, so a token issued to another client, like one injected
+	//by a sibling subdomain, is not accepted. Empty means plain double submit, which does not bind the token to the identity
+	Secret []byte
+	//CookieName, CookieDomain and CookiePath are the token cookie attributes, like the security cookie_* keys of haki.yaml
+	CookieName   string
+	CookieDomain string
+	CookiePath   string
+	//Insecure omits the Secure cookie attribute, only for local plain http environments
+	Insecure bool
+	//MaxAge is the token cookie lifetime
+	MaxAge time.Duration
+	//HeaderName and FieldName are where the token is submitted, the header is checked first
+	HeaderName string
+	FieldName  string
+}
+
+//CSRF validates unsafe requests with the double submit cookie pattern:
+//the token set in a cookie must be sent back in a header or form field, which a cross site page cannot read to forge
+type CSRF struct {
+	options CSRFOptions
+}
+
+//NewCSRF creates a CSRF with the empty options set to the defaults
+func NewCSRF(options CSRFOptions) *CSRF {
+	if options.CookieName == "" {
+		options.CookieName = CSRFCookie
+	}
+	if options.CookiePath == "" {
+		options.CookiePath = "/"
+	}
+	if options.MaxAge <= 0 {
+		options.MaxAge = 12 * time.Hour
+	}
+	if options.HeaderName == "" {
+		options.HeaderName = CSRFHeader
+	}
+	if options.FieldName == "" {
+		options.FieldName = CSRFField
+	}
+	return &CSRF{options: options}
+}
+
+//Options returns the options with the defaults set
+func (c *CSRF) Options() CSRFOptions {
+	return c.options
+}
+
+//SafeMethod returns true for the methods that must not change state and are exempt from the check
+func SafeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	default:
+		return false
+	}
+}
+
+//NewToken creates a random token, signed with the identity token binding when the Secret is set
+func (c *CSRF) NewToken(binding string) (string, error) {
+	raw := make([]byte, tokenSize)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(raw)
+	if len(c.options.Secret) > 0 {
+		token += "." + c.sign(token, binding)
+	}
+	return token, nil
+}
+
+func (c *CSRF) sign(value string, binding string) string {
+	mac := hmac.New(sha256.New, c.options.Secret)
+	mac.Write([]byte(value))
+	mac.Write([]byte{0})
+	mac.Write([]byte(binding))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+//ValidToken returns true when the cookie token was created by NewToken with the same binding
+func (c *CSRF) ValidToken(token string, binding string) bool {
+	if token == "" {
+		return false
+	}
+	if len(c.options.Secret) == 0 {
+		return len(token) == base64.RawURLEncoding.EncodedLen(tokenSize)
+	}
+	i := strings.LastIndexByte(token, '.')
+	if i < 0 {
+		return false
+	}
+	return hmac.Equal([]byte(token[i+1:]), []byte(c.sign(token[:i], binding)))
+}
+
+//Check validates the token submitted in an unsafe request against the cookie token of the binding
+func (c *CSRF) Check(method string, cookieToken string, submitted string, binding string) error {
+	if SafeMethod(method) {
+		return nil
+	}
+	if submitted == "" {
+		return ErrCSRFTokenMissing
+	}
+	if !c.ValidToken(cookieToken, binding) || subtle.ConstantTimeCompare([]byte(cookieToken), []byte(submitted)) != 1 {
+		return ErrCSRFTokenInvalid
+	}
+	return nil
+}
+
+//Cookie creates the token cookie, readable by the page scripts to submit it in the header
+func (c *CSRF) Cookie(token string) *http.Cookie {
+	return &http.Cookie{
+		Name:     c.options.CookieName,
+		Value:    token,
+		Domain:   c.options.CookieDomain,
+		Path:     c.options.CookiePath,
+		MaxAge:   int(c.options.MaxAge / time.Second),
+		Secure:   !c.options.Insecure,
+		SameSite: http.SameSiteLaxMode,
+	}
+}
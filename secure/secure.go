@@ -0,0 +1,73 @@
+package secure
+
+import (
+	"strconv"
+	"time"
+)
+
+const (
+	StrictTransportSecurityHeader = "Strict-Transport-Security"
+	ContentSecurityPolicyHeader   = "Content-Security-Policy"
+	ContentTypeOptionsHeader      = "X-Content-Type-Options"
+	FrameOptionsHeader            = "X-Frame-Options"
+	ReferrerPolicyHeader          = "Referrer-Policy"
+)
+
+var (
+	//DefaultHeaders are the security headers written by the SecureHeaders wrappers
+	DefaultHeaders = Headers{
+		HSTSMaxAge:            365 * 24 * time.Hour,
+		HSTSIncludeSubdomains: true,
+		ContentSecurityPolicy: "default-src 'self'; frame-ancestors 'none'",
+		NoSniff:               true,
+		FrameOptions:          "DENY",
+		ReferrerPolicy:        "strict-origin-when-cross-origin",
+	}
+)
+
+//Header is the response header contract shared by the http.Header and the fasthttp.ResponseHeader
+type Header interface {
+	Set(key string, value string)
+}
+
+//Headers holds the security response headers values, the empty ones are not written
+type Headers struct {
+	//HSTSMaxAge is the Strict-Transport-Security max-age, zero omits the header
+	HSTSMaxAge            time.Duration
+	HSTSIncludeSubdomains bool
+	HSTSPreload           bool
+	//ContentSecurityPolicy is the Content-Security-Policy value
+	ContentSecurityPolicy string
+	//NoSniff writes the X-Content-Type-Options: nosniff header
+	NoSniff bool
+	//FrameOptions is the X-Frame-Options value, DENY or SAMEORIGIN
+	FrameOptions string
+	//ReferrerPolicy is the Referrer-Policy value
+	ReferrerPolicy string
+}
+
+//Write sets the security headers into the response header
+func (h Headers) Write(header Header) {
+	if h.HSTSMaxAge > 0 {
+		hsts := "max-age=" + strconv.FormatInt(int64(h.HSTSMaxAge/time.Second), 10)
+		if h.HSTSIncludeSubdomains {
+			hsts += "; includeSubDomains"
+		}
+		if h.HSTSPreload {
+			hsts += "; preload"
+		}
+		header.Set(StrictTransportSecurityHeader, hsts)
+	}
+	if h.ContentSecurityPolicy != "" {
+		header.Set(ContentSecurityPolicyHeader, h.ContentSecurityPolicy)
+	}
+	if h.NoSniff {
+		header.Set(ContentTypeOptionsHeader, "nosniff")
+	}
+	if h.FrameOptions != "" {
+		header.Set(FrameOptionsHeader, h.FrameOptions)
+	}
+	if h.ReferrerPolicy != "" {
+		header.Set(ReferrerPolicyHeader, h.ReferrerPolicy)
+	}
+}
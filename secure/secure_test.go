@@ -0,0 +1,95 @@
+package secure
+
+import (
+	"github.com/rjansen/l"
+	"github.com/rjansen/l/zap"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func init() {
+	if setupErr := zap.Setup(new(l.Configuration)); setupErr != nil {
+		panic(setupErr)
+	}
+	l.Info("context.secure_test.init")
+}
+
+func TestHeadersWrite(t *testing.T) {
+	header := make(http.Header)
+	DefaultHeaders.Write(header)
+	assert.Equal(t, "max-age=31536000; includeSubDomains", header.Get(StrictTransportSecurityHeader))
+	assert.Equal(t, "default-src 'self'; frame-ancestors 'none'", header.Get(ContentSecurityPolicyHeader))
+	assert.Equal(t, "nosniff", header.Get(ContentTypeOptionsHeader))
+	assert.Equal(t, "DENY", header.Get(FrameOptionsHeader))
+	assert.Equal(t, "strict-origin-when-cross-origin", header.Get(ReferrerPolicyHeader))
+
+	header = make(http.Header)
+	Headers{HSTSMaxAge: time.Hour, HSTSPreload: true, FrameOptions: "SAMEORIGIN"}.Write(header)
+	assert.Equal(t, "max-age=3600; preload", header.Get(StrictTransportSecurityHeader))
+	assert.Equal(t, "SAMEORIGIN", header.Get(FrameOptionsHeader))
+	assert.Len(t, header, 2)
+}
+
+func TestCSRFToken(t *testing.T) {
+	csrf := NewCSRF(CSRFOptions{})
+	token, err := csrf.NewToken("")
+	assert.Nil(t, err)
+	assert.True(t, csrf.ValidToken(token, ""))
+	assert.True(t, csrf.ValidToken(token, "user"), "Plain double submit ignores the binding")
+	assert.False(t, csrf.ValidToken("", ""))
+	assert.False(t, csrf.ValidToken("short", ""))
+	other, err := csrf.NewToken("")
+	assert.Nil(t, err)
+	assert.NotEqual(t, token, other)
+
+	signed := NewCSRF(CSRFOptions{Secret: []byte("secret")})
+	signedToken, err := signed.NewToken("user")
+	assert.Nil(t, err)
+	assert.True(t, signed.ValidToken(signedToken, "user"))
+	assert.False(t, signed.ValidToken(signedToken, "attacker"), "Token issued to other identity")
+	assert.False(t, signed.ValidToken(signedToken, ""), "Token issued to other identity")
+	assert.False(t, signed.ValidToken(token, ""), "Unsigned token")
+	forged := NewCSRF(CSRFOptions{Secret: []byte("forged")})
+	forgedToken, err := forged.NewToken("user")
+	assert.Nil(t, err)
+	assert.False(t, signed.ValidToken(forgedToken, "user"), "Token signed with other secret")
+}
+
+func TestCSRFCheck(t *testing.T) {
+	csrf := NewCSRF(CSRFOptions{})
+	token, err := csrf.NewToken("")
+	assert.Nil(t, err)
+	for _, method := range []string{"GET", "HEAD", "OPTIONS", "TRACE"} {
+		assert.Nil(t, csrf.Check(method, "", "", ""), method)
+	}
+	assert.Nil(t, csrf.Check("POST", token, token, ""))
+	assert.Equal(t, ErrCSRFTokenMissing, csrf.Check("POST", token, "", ""))
+	assert.Equal(t, ErrCSRFTokenInvalid, csrf.Check("DELETE", token, token+"x", ""))
+	assert.Equal(t, ErrCSRFTokenInvalid, csrf.Check("PUT", "", token, ""))
+	assert.Equal(t, ErrCSRFTokenInvalid, csrf.Check("PATCH", "invalid", "invalid", ""))
+
+	signed := NewCSRF(CSRFOptions{Secret: []byte("secret")})
+	planted, err := signed.NewToken("attacker")
+	assert.Nil(t, err)
+	assert.Nil(t, signed.Check("POST", planted, planted, "attacker"))
+	assert.Equal(t, ErrCSRFTokenInvalid, signed.Check("POST", planted, planted, "victim"), "Planted cookie of other identity")
+}
+
+func TestCSRFCookie(t *testing.T) {
+	csrf := NewCSRF(CSRFOptions{CookieDomain: "example.com", MaxAge: time.Hour})
+	assert.Equal(t, CSRFHeader, csrf.Options().HeaderName)
+	assert.Equal(t, CSRFField, csrf.Options().FieldName)
+	cookie := csrf.Cookie("token")
+	assert.Equal(t, CSRFCookie, cookie.Name)
+	assert.Equal(t, "token", cookie.Value)
+	assert.Equal(t, "example.com", cookie.Domain)
+	assert.Equal(t, "/", cookie.Path)
+	assert.Equal(t, 3600, cookie.MaxAge)
+	assert.True(t, cookie.Secure)
+	assert.False(t, cookie.HttpOnly)
+	assert.Equal(t, http.SameSiteLaxMode, cookie.SameSite)
+
+	assert.False(t, NewCSRF(CSRFOptions{Insecure: true}).Cookie("token").Secure)
+}
@@ -0,0 +1,132 @@
+package session
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"strings"
+)
+
+const minSignKeySize = 32
+
+var (
+	//ErrNoKeys is returned when a codec is created without keys
+	ErrNoKeys = errors.New("Session codec needs at least one key")
+	//ErrShortKey is returned when a signing key has less than 32 bytes
+	ErrShortKey = errors.New("Session signing keys need at least 32 bytes")
+	//ErrInvalidCookie is returned when a cookie value was not encoded by any of the codec keys
+	ErrInvalidCookie = errors.New("Invalid session cookie")
+)
+
+//Codec encodes the session cookie values.
+//The name, the cookie name, is authenticated with the value so a value is not accepted by another cookie
+type Codec interface {
+	Encode(name string, value []byte) (string, error)
+	Decode(name string, value string) ([]byte, error)
+}
+
+type signedCodec struct {
+	keys [][]byte
+}
+
+//NewSignedCodec creates a Codec that signs the values with HMAC-SHA256, the values are readable by the client.
+//The first key signs and all of them verify, so a new key is rotated in by prepending it
+func NewSignedCodec(keys ...[]byte) (Codec, error) {
+	if len(keys) == 0 {
+		return nil, ErrNoKeys
+	}
+	for _, key := range keys {
+		if len(key) < minSignKeySize {
+			return nil, ErrShortKey
+		}
+	}
+	return &signedCodec{keys: keys}, nil
+}
+
+func (c *signedCodec) sign(key []byte, name string, payload string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(name))
+	mac.Write([]byte{'|'})
+	mac.Write([]byte(payload))
+	return mac.Sum(nil)
+}
+
+func (c *signedCodec) Encode(name string, value []byte) (string, error) {
+	payload := base64.RawURLEncoding.EncodeToString(value)
+	return payload + "." + base64.RawURLEncoding.EncodeToString(c.sign(c.keys[0], name, payload)), nil
+}
+
+func (c *signedCodec) Decode(name string, value string) ([]byte, error) {
+	i := strings.LastIndexByte(value, '.')
+	if i < 0 {
+		return nil, ErrInvalidCookie
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(value[i+1:])
+	if err != nil {
+		return nil, ErrInvalidCookie
+	}
+	payload := value[:i]
+	for _, key := range c.keys {
+		if hmac.Equal(signature, c.sign(key, name, payload)) {
+			decoded, err := base64.RawURLEncoding.DecodeString(payload)
+			if err != nil {
+				return nil, ErrInvalidCookie
+			}
+			return decoded, nil
+		}
+	}
+	return nil, ErrInvalidCookie
+}
+
+type encryptedCodec struct {
+	aeads []cipher.AEAD
+}
+
+//NewEncryptedCodec creates a Codec that encrypts the values with AES-GCM using keys of 16, 24 or 32 bytes.
+//The first key encrypts and all of them decrypt, so a new key is rotated in by prepending it
+func NewEncryptedCodec(keys ...[]byte) (Codec, error) {
+	if len(keys) == 0 {
+		return nil, ErrNoKeys
+	}
+	c := &encryptedCodec{aeads: make([]cipher.AEAD, len(keys))}
+	for i, key := range keys {
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, err
+		}
+		if c.aeads[i], err = cipher.NewGCM(block); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+func (c *encryptedCodec) Encode(name string, value []byte) (string, error) {
+	aead := c.aeads[0]
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(value)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(aead.Seal(nonce, nonce, value, []byte(name))), nil
+}
+
+func (c *encryptedCodec) Decode(name string, value string) ([]byte, error) {
+	sealed, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, ErrInvalidCookie
+	}
+	for _, aead := range c.aeads {
+		if len(sealed) < aead.NonceSize() {
+			return nil, ErrInvalidCookie
+		}
+		nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+		if decoded, err := aead.Open(nil, nonce, ciphertext, []byte(name)); err == nil {
+			return decoded, nil
+		}
+	}
+	return nil, ErrInvalidCookie
+}
@@ -0,0 +1,203 @@
+package session
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/rjansen/haki"
+	"net/http"
+	"time"
+)
+
+var (
+	//DefaultCookieName is the session cookie name when Options.CookieName is empty
+	DefaultCookieName = "haki_session"
+	//DefaultIdleTimeout is the Options.IdleTimeout when zero
+	DefaultIdleTimeout = 30 * time.Minute
+	//DefaultAbsoluteTimeout is the Options.AbsoluteTimeout when zero
+	DefaultAbsoluteTimeout = 24 * time.Hour
+	//MaxCookieSize is the max size of an encoded session cookie value accepted by the browsers
+	MaxCookieSize = 4096
+	//ErrNoCodec is returned when a Manager is created without a Codec
+	ErrNoCodec = errors.New("Session manager needs a Codec")
+	//ErrNoSession is returned by the handlers that need a session when the Session wrapper is not in use
+	ErrNoSession = errors.New("No session in the request. Use the Session wrapper")
+	//ErrCookieTooLarge is returned when the encoded session does not fit a cookie, use a Store for large sessions
+	ErrCookieTooLarge = errors.New("Session cookie too large. Keep less values or use a server side Store")
+)
+
+//Configuration maps the security section of the haki.yaml file
+type Configuration struct {
+	CookieName   string `json:"cookie_name" yaml:"cookie_name" mapstructure:"cookie_name"`
+	CookieDomain string `json:"cookie_domain" yaml:"cookie_domain" mapstructure:"cookie_domain"`
+	CookiePath   string `json:"cookie_path" yaml:"cookie_path" mapstructure:"cookie_path"`
+}
+
+//Options holds the session settings
+type Options struct {
+	//CookieName, CookieDomain and CookiePath are the session cookie attributes
+	CookieName   string
+	CookieDomain string
+	CookiePath   string
+	//Insecure omits the Secure cookie attribute, only for local plain http environments
+	Insecure bool
+	//IdleTimeout expires the sessions not accessed for this duration
+	IdleTimeout time.Duration
+	//AbsoluteTimeout expires the sessions created before this duration, even when accessed
+	AbsoluteTimeout time.Duration
+	//Codec signs or encrypts the cookie value, see NewSignedCodec and NewEncryptedCodec
+	Codec Codec
+	//Store keeps the sessions server side, nil keeps the whole session in the cookie
+	Store Store
+}
+
+//Manager loads and saves the sessions of the requests
+type Manager struct {
+	options Options
+	now     func() time.Time
+}
+
+//New creates a Manager with the empty options set to the defaults
+func New(options Options) (*Manager, error) {
+	if options.Codec == nil {
+		return nil, ErrNoCodec
+	}
+	if options.CookieName == "" {
+		options.CookieName = DefaultCookieName
+	}
+	if options.CookiePath == "" {
+		options.CookiePath = "/"
+	}
+	if options.IdleTimeout <= 0 {
+		options.IdleTimeout = DefaultIdleTimeout
+	}
+	if options.AbsoluteTimeout <= 0 {
+		options.AbsoluteTimeout = DefaultAbsoluteTimeout
+	}
+	return &Manager{options: options, now: time.Now}, nil
+}
+
+//NewWithConfig creates a Manager with the cookie attributes of the haki.yaml security section
+func NewWithConfig(config Configuration, codec Codec, store Store) (*Manager, error) {
+	return New(Options{
+		CookieName:   config.CookieName,
+		CookieDomain: config.CookieDomain,
+		CookiePath:   config.CookiePath,
+		Codec:        codec,
+		Store:        store,
+	})
+}
+
+//Options returns the options with the defaults set
+func (m *Manager) Options() Options {
+	return m.options
+}
+
+func (m *Manager) expired(s *Session, now time.Time) bool {
+	return now.Sub(s.Accessed) >= m.options.IdleTimeout || now.Sub(s.Created) >= m.options.AbsoluteTimeout
+}
+
+//Load returns the session of the cookie value.
+//A new session is returned when the value is empty, invalid or expired, the error is only for the Store failures
+func (m *Manager) Load(value string) (*Session, error) {
+	now := m.now()
+	if value == "" {
+		return newSession(now)
+	}
+	data, err := m.options.Codec.Decode(m.options.CookieName, value)
+	if err != nil {
+		return newSession(now)
+	}
+	if m.options.Store != nil {
+		id := string(data)
+		if data, err = m.options.Store.Get(id); err != nil {
+			return nil, err
+		}
+		if data == nil {
+			return newSession(now)
+		}
+	}
+	var s Session
+	if err := json.Unmarshal(data, &s); err != nil || s.ID == "" {
+		return newSession(now)
+	}
+	if m.expired(&s, now) {
+		if m.options.Store != nil {
+			if err := m.options.Store.Delete(s.ID); err != nil {
+				return nil, err
+			}
+		}
+		return newSession(now)
+	}
+	//Refreshes the idle expiration only from time to time, to not write the cookie in every request
+	if now.Sub(s.Accessed) >= m.options.IdleTimeout/10 {
+		s.Accessed = now
+		s.changed = true
+	}
+	return &s, nil
+}
+
+//Save stores the changed session and returns the cookie to set in the response, nil when the session did not change
+func (m *Manager) Save(s *Session) (*http.Cookie, error) {
+	if s.destroyed {
+		if m.options.Store != nil {
+			for _, id := range []string{s.previousID, s.ID} {
+				if id == "" {
+					continue
+				}
+				if err := m.options.Store.Delete(id); err != nil {
+					return nil, err
+				}
+			}
+		}
+		cookie := m.cookie("")
+		cookie.MaxAge = -1
+		return cookie, nil
+	}
+	if !s.changed {
+		return nil, nil
+	}
+	now := m.now()
+	ttl := m.options.IdleTimeout
+	if remaining := s.Created.Add(m.options.AbsoluteTimeout).Sub(now); remaining < ttl {
+		ttl = remaining
+	}
+	data, err := json.Marshal(s)
+	if err != nil {
+		return nil, err
+	}
+	if m.options.Store != nil {
+		if s.previousID != "" {
+			if err := m.options.Store.Delete(s.previousID); err != nil {
+				return nil, err
+			}
+		}
+		if err := m.options.Store.Set(s.ID, data, ttl); err != nil {
+			return nil, err
+		}
+		data = []byte(s.ID)
+	}
+	value, err := m.options.Codec.Encode(m.options.CookieName, data)
+	if err != nil {
+		return nil, err
+	}
+	if len(value) > MaxCookieSize {
+		return nil, ErrCookieTooLarge
+	}
+	s.previousID = ""
+	s.changed = false
+	cookie := m.cookie(value)
+	cookie.MaxAge = int(haki.Seconds(ttl))
+	return cookie, nil
+}
+
+func (m *Manager) cookie(value string) *http.Cookie {
+	return &http.Cookie{
+		Name:     m.options.CookieName,
+		Value:    value,
+		Domain:   m.options.CookieDomain,
+		Path:     m.options.CookiePath,
+		Secure:   !m.options.Insecure,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	}
+}
@@ -0,0 +1,105 @@
+package session
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"time"
+)
+
+const idSize = 32
+
+//Session holds the identity and values of a client across requests.
+//The values are serialized as json, so numbers are read back as float64 and structs as maps
+type Session struct {
+	ID string `json:"id"`
+	//Token and Value are the identity of the session, copied into the Identity of the requests
+	Token    string                 `json:"token,omitempty"`
+	Value    interface{}            `json:"value,omitempty"`
+	Values   map[string]interface{} `json:"values,omitempty"`
+	Created  time.Time              `json:"created"`
+	Accessed time.Time              `json:"accessed"`
+
+	previousID string
+	changed    bool
+	destroyed  bool
+}
+
+func newID() (string, error) {
+	raw := make([]byte, idSize)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+func newSession(now time.Time) (*Session, error) {
+	id, err := newID()
+	if err != nil {
+		return nil, err
+	}
+	return &Session{ID: id, Created: now, Accessed: now}, nil
+}
+
+//Get returns the session value of the key, nil when not found
+func (s *Session) Get(key string) interface{} {
+	return s.Values[key]
+}
+
+//Set stores the value under the key
+func (s *Session) Set(key string, value interface{}) {
+	if s.Values == nil {
+		s.Values = make(map[string]interface{})
+	}
+	s.Values[key] = value
+	s.changed = true
+}
+
+//Delete removes the value of the key
+func (s *Session) Delete(key string) {
+	if _, found := s.Values[key]; found {
+		delete(s.Values, key)
+		s.changed = true
+	}
+}
+
+//SetIdentity sets the session identity, renewing the session id when the token changes to prevent fixation
+func (s *Session) SetIdentity(token string, value interface{}) error {
+	if token != s.Token {
+		if err := s.Renew(); err != nil {
+			return err
+		}
+	}
+	s.Token = token
+	s.Value = value
+	s.changed = true
+	return nil
+}
+
+//Authenticated returns true when the session has an identity
+func (s *Session) Authenticated() bool {
+	return s.Token != ""
+}
+
+//Renew replaces the session id keeping its values, the previous id is removed from the Store when saved
+func (s *Session) Renew() error {
+	id, err := newID()
+	if err != nil {
+		return err
+	}
+	if s.previousID == "" {
+		s.previousID = s.ID
+	}
+	s.ID = id
+	s.changed = true
+	return nil
+}
+
+//Destroy discards the session, its cookie is expired when saved
+func (s *Session) Destroy() {
+	s.destroyed = true
+}
+
+//Changed returns true when the session must be saved
+func (s *Session) Changed() bool {
+	return s.changed || s.destroyed
+}
@@ -0,0 +1,210 @@
+package session
+
+import (
+	"bytes"
+	"github.com/rjansen/l"
+	"github.com/rjansen/l/zap"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+	"time"
+)
+
+var (
+	signKey    = bytes.Repeat([]byte("s"), 32)
+	rotatedKey = bytes.Repeat([]byte("r"), 32)
+)
+
+func init() {
+	if setupErr := zap.Setup(new(l.Configuration)); setupErr != nil {
+		panic(setupErr)
+	}
+	l.Info("context.session_test.init")
+}
+
+type mockClock struct {
+	now time.Time
+}
+
+func (c *mockClock) Now() time.Time {
+	return c.now
+}
+
+func newManager(t *testing.T, options Options) (*Manager, *mockClock) {
+	manager, err := New(options)
+	assert.Nil(t, err)
+	clock := &mockClock{now: time.Unix(1500000000, 0)}
+	manager.now = clock.Now
+	return manager, clock
+}
+
+func TestSignedCodec(t *testing.T) {
+	_, err := NewSignedCodec()
+	assert.Equal(t, ErrNoKeys, err)
+	_, err = NewSignedCodec([]byte("short"))
+	assert.Equal(t, ErrShortKey, err)
+
+	codec, err := NewSignedCodec(signKey)
+	assert.Nil(t, err)
+	value, err := codec.Encode("cookie", []byte("payload"))
+	assert.Nil(t, err)
+	decoded, err := codec.Decode("cookie", value)
+	assert.Nil(t, err)
+	assert.Equal(t, "payload", string(decoded))
+
+	_, err = codec.Decode("other", value)
+	assert.Equal(t, ErrInvalidCookie, err, "Value of another cookie")
+	_, err = codec.Decode("cookie", "cGF5bG9hZA"+value[strings.LastIndexByte(value, '.'):])
+	assert.Nil(t, err)
+	_, err = codec.Decode("cookie", "dGFtcGVyZWQ"+value[strings.LastIndexByte(value, '.'):])
+	assert.Equal(t, ErrInvalidCookie, err, "Tampered payload")
+	_, err = codec.Decode("cookie", "payload")
+	assert.Equal(t, ErrInvalidCookie, err)
+
+	rotated, err := NewSignedCodec(rotatedKey, signKey)
+	assert.Nil(t, err)
+	decoded, err = rotated.Decode("cookie", value)
+	assert.Nil(t, err, "Previous key still verifies")
+	assert.Equal(t, "payload", string(decoded))
+	value, err = rotated.Encode("cookie", []byte("payload"))
+	assert.Nil(t, err)
+	_, err = codec.Decode("cookie", value)
+	assert.Equal(t, ErrInvalidCookie, err, "Signed with the new key")
+}
+
+func TestEncryptedCodec(t *testing.T) {
+	_, err := NewEncryptedCodec()
+	assert.Equal(t, ErrNoKeys, err)
+	_, err = NewEncryptedCodec([]byte("short"))
+	assert.NotNil(t, err)
+
+	key := bytes.Repeat([]byte("k"), 32)
+	codec, err := NewEncryptedCodec(key)
+	assert.Nil(t, err)
+	value, err := codec.Encode("cookie", []byte("payload"))
+	assert.Nil(t, err)
+	assert.NotContains(t, value, "cGF5bG9hZA")
+	other, err := codec.Encode("cookie", []byte("payload"))
+	assert.Nil(t, err)
+	assert.NotEqual(t, value, other, "Random nonce")
+	decoded, err := codec.Decode("cookie", value)
+	assert.Nil(t, err)
+	assert.Equal(t, "payload", string(decoded))
+	_, err = codec.Decode("other", value)
+	assert.Equal(t, ErrInvalidCookie, err)
+	_, err = codec.Decode("cookie", "AAAA")
+	assert.Equal(t, ErrInvalidCookie, err)
+
+	rotated, err := NewEncryptedCodec(bytes.Repeat([]byte("n"), 16), key)
+	assert.Nil(t, err)
+	decoded, err = rotated.Decode("cookie", value)
+	assert.Nil(t, err)
+	assert.Equal(t, "payload", string(decoded))
+}
+
+func TestManagerCookieStore(t *testing.T) {
+	_, err := New(Options{})
+	assert.Equal(t, ErrNoCodec, err)
+
+	codec, err := NewSignedCodec(signKey)
+	assert.Nil(t, err)
+	manager, clock := newManager(t, Options{Codec: codec, IdleTimeout: 10 * time.Minute, AbsoluteTimeout: time.Hour})
+	assert.Equal(t, DefaultCookieName, manager.Options().CookieName)
+
+	s, err := manager.Load("")
+	assert.Nil(t, err)
+	assert.False(t, s.Authenticated())
+	cookie, err := manager.Save(s)
+	assert.Nil(t, err)
+	assert.Nil(t, cookie, "Unchanged session")
+
+	id := s.ID
+	assert.Nil(t, s.SetIdentity("token", map[string]interface{}{"name": "user"}))
+	assert.NotEqual(t, id, s.ID, "Renewed on login")
+	s.Set("count", 1)
+	cookie, err = manager.Save(s)
+	assert.Nil(t, err)
+	assert.Equal(t, DefaultCookieName, cookie.Name)
+	assert.Equal(t, 600, cookie.MaxAge)
+	assert.True(t, cookie.HttpOnly)
+	assert.True(t, cookie.Secure)
+
+	clock.now = clock.now.Add(5 * time.Minute)
+	loaded, err := manager.Load(cookie.Value)
+	assert.Nil(t, err)
+	assert.Equal(t, s.ID, loaded.ID)
+	assert.Equal(t, "token", loaded.Token)
+	assert.Equal(t, map[string]interface{}{"name": "user"}, loaded.Value)
+	assert.Equal(t, float64(1), loaded.Get("count"))
+	assert.True(t, loaded.Changed(), "Idle expiration refreshed")
+	refreshed, err := manager.Save(loaded)
+	assert.Nil(t, err)
+
+	clock.now = clock.now.Add(9 * time.Minute)
+	expired, err := manager.Load(cookie.Value)
+	assert.Nil(t, err)
+	assert.NotEqual(t, s.ID, expired.ID, "Idle expired")
+	for i := 0; i < 9; i++ {
+		loaded, err = manager.Load(refreshed.Value)
+		assert.Nil(t, err)
+		assert.Equal(t, s.ID, loaded.ID)
+		refreshed, err = manager.Save(loaded)
+		assert.Nil(t, err)
+		clock.now = clock.now.Add(5 * time.Minute)
+	}
+	assert.Equal(t, 360, refreshed.MaxAge, "Capped by the absolute expiration")
+	clock.now = clock.now.Add(2 * time.Minute)
+	expired, err = manager.Load(refreshed.Value)
+	assert.Nil(t, err)
+	assert.NotEqual(t, s.ID, expired.ID, "Absolute expired")
+
+	invalid, err := manager.Load("invalid")
+	assert.Nil(t, err)
+	assert.False(t, invalid.Authenticated())
+
+	loaded.Destroy()
+	cookie, err = manager.Save(loaded)
+	assert.Nil(t, err)
+	assert.Equal(t, -1, cookie.MaxAge)
+	assert.Equal(t, "", cookie.Value)
+}
+
+func TestManagerStore(t *testing.T) {
+	codec, err := NewEncryptedCodec(bytes.Repeat([]byte("k"), 16))
+	assert.Nil(t, err)
+	store := NewMemoryStore()
+	manager, _ := newManager(t, Options{Codec: codec, Store: store, CookieName: "sid"})
+
+	s, err := manager.Load("")
+	assert.Nil(t, err)
+	s.Set("large", strings.Repeat("x", 2*MaxCookieSize))
+	cookie, err := manager.Save(s)
+	assert.Nil(t, err, "Large sessions fit the store")
+	assert.True(t, len(cookie.Value) < 100)
+	assert.Equal(t, 1, store.Len())
+
+	loaded, err := manager.Load(cookie.Value)
+	assert.Nil(t, err)
+	assert.Equal(t, s.ID, loaded.ID)
+	assert.Nil(t, loaded.SetIdentity("token", "user"))
+	renewed, err := manager.Save(loaded)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, store.Len(), "Previous id removed")
+	_, err = manager.Load(cookie.Value)
+	assert.Nil(t, err)
+
+	loaded, err = manager.Load(renewed.Value)
+	assert.Nil(t, err)
+	assert.Equal(t, "user", loaded.Value)
+	loaded.Destroy()
+	_, err = manager.Save(loaded)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, store.Len())
+
+	cookieManager, _ := newManager(t, Options{Codec: codec})
+	s, err = cookieManager.Load("")
+	assert.Nil(t, err)
+	s.Set("large", strings.Repeat("x", 2*MaxCookieSize))
+	_, err = cookieManager.Save(s)
+	assert.Equal(t, ErrCookieTooLarge, err)
+}
@@ -0,0 +1,78 @@
+package session
+
+import (
+	"sync"
+	"time"
+)
+
+var (
+	//SweepInterval is the min interval between the expired sessions cleanups of a MemoryStore
+	SweepInterval = time.Minute
+)
+
+//Store keeps the serialized sessions of a Manager server side, the cookie carries only the signed session id.
+//Get returns nil data when the session is not found or expired
+type Store interface {
+	Get(id string) ([]byte, error)
+	Set(id string, data []byte, ttl time.Duration) error
+	Delete(id string) error
+}
+
+//MemoryStore is an in memory Store, for tests and single instance deployments
+type MemoryStore struct {
+	sync.Mutex
+	values    map[string]entry
+	lastSweep int64
+}
+
+type entry struct {
+	data    []byte
+	expires int64
+}
+
+//NewMemoryStore creates an empty MemoryStore
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{values: make(map[string]entry), lastSweep: time.Now().UnixNano()}
+}
+
+//Get returns the session data, nil when the session is not found or expired
+func (s *MemoryStore) Get(id string) ([]byte, error) {
+	s.Lock()
+	defer s.Unlock()
+	if e, found := s.values[id]; found && e.expires > time.Now().UnixNano() {
+		return e.data, nil
+	}
+	return nil, nil
+}
+
+//Set stores the session data, expiring after ttl
+func (s *MemoryStore) Set(id string, data []byte, ttl time.Duration) error {
+	s.Lock()
+	defer s.Unlock()
+	now := time.Now().UnixNano()
+	s.values[id] = entry{data: data, expires: now + int64(ttl)}
+	if now-s.lastSweep > int64(SweepInterval) {
+		for k, e := range s.values {
+			if e.expires <= now {
+				delete(s.values, k)
+			}
+		}
+		s.lastSweep = now
+	}
+	return nil
+}
+
+//Delete removes the session data
+func (s *MemoryStore) Delete(id string) error {
+	s.Lock()
+	defer s.Unlock()
+	delete(s.values, id)
+	return nil
+}
+
+//Len returns the number of sessions kept by the store, including the expired ones not swept yet
+func (s *MemoryStore) Len() int {
+	s.Lock()
+	defer s.Unlock()
+	return len(s.values)
+}
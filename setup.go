@@ -0,0 +1,363 @@
+package haki
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/rjansen/l"
+	"reflect"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"time"
+)
+
+var (
+	//ErrSetupTimeout is the error of the step attempts that do not finish in the step Timeout
+	ErrSetupTimeout = errors.New("Setup step timeout")
+	//ErrSetupSkipped is the error of the steps not called because a dependency failed
+	ErrSetupSkipped = errors.New("Setup step skipped. A dependency failed")
+	//ErrSetupDuplicate is returned when two steps have the same name
+	ErrSetupDuplicate = errors.New("Setup step duplicated")
+	//ErrSetupDependency is returned when a step depends on a step not provided
+	ErrSetupDependency = errors.New("Setup step dependency not found")
+	//ErrSetupNoFunc is returned when a step has neither the Setup nor the SetupContext function
+	ErrSetupNoFunc = errors.New("Setup step without function")
+	//ErrSetupCycle is returned when the steps dependencies have a cycle
+	ErrSetupCycle = errors.New("Setup steps dependency cycle")
+)
+
+//Step is a named setup function called after the steps of the DependsOn names succeed
+type Step struct {
+	Name      string
+	DependsOn []string
+	Setup     SetupFunc
+	//SetupContext is called instead of the Setup when set, with a context done at the attempt Timeout or when the SetupSteps ctx is done
+	SetupContext SetupContextFunc
+	//Timeout is the max duration of each attempt, zero waits forever. The Setup can not be cancelled, so a timed out attempt is abandoned and a retry waits for it to return
+	Timeout time.Duration
+	//Retries is how many times a failed attempt is repeated, waiting RetryDelay doubled at each retry
+	Retries    int
+	RetryDelay time.Duration
+}
+
+//StepResult is the outcome of a step
+type StepResult struct {
+	Name     string
+	Duration time.Duration
+	Attempts int
+	Err      error
+}
+
+//SetupReport is the outcome of the SetupSteps, with the results in the steps order
+type SetupReport struct {
+	Duration time.Duration
+	Steps    []StepResult
+}
+
+//Err returns a SetupError with the failed steps or nil when all steps succeed
+func (r SetupReport) Err() error {
+	var setupErr SetupError
+	for _, result := range r.Steps {
+		if result.Err != nil {
+			setupErr.Steps = append(setupErr.Steps, &StepError{Step: result.Name, Err: result.Err})
+		}
+	}
+	if len(setupErr.Steps) == 0 {
+		return nil
+	}
+	return &setupErr
+}
+
+//StepError is the error of a named setup step
+type StepError struct {
+	Step string
+	Err  error
+}
+
+func (e *StepError) Error() string {
+	return e.Step + ": " + e.Err.Error()
+}
+
+//Unwrap returns the step error to the errors.Is and errors.As functions
+func (e *StepError) Unwrap() error {
+	return e.Err
+}
+
+//SetupError aggregates the errors of the failed setup steps, one step per line
+type SetupError struct {
+	Steps []*StepError
+}
+
+func (e *SetupError) Error() string {
+	messages := make([]string, len(e.Steps))
+	for i, err := range e.Steps {
+		messages[i] = err.Error()
+	}
+	return strings.Join(messages, "\n")
+}
+
+//Unwrap returns the step errors to the errors.Is and errors.As functions, so they match any collected cause
+func (e *SetupError) Unwrap() []error {
+	errs := make([]error, len(e.Steps))
+	for i, err := range e.Steps {
+		errs[i] = err
+	}
+	return errs
+}
+
+//Failed returns the names of the failed steps
+func (e *SetupError) Failed() []string {
+	names := make([]string, len(e.Steps))
+	for i, err := range e.Steps {
+		names[i] = err.Step
+	}
+	return names
+}
+
+//PanicError is the error of a setup function that panics, with the stack of the panic
+type PanicError struct {
+	Value interface{}
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("Setup panic: %v", e.Value)
+}
+
+//Unwrap returns the panic value when it is an error
+func (e *PanicError) Unwrap() error {
+	err, _ := e.Value.(error)
+	return err
+}
+
+//safeSetup calls the setup function and returns a PanicError when it panics
+func safeSetup(ctx context.Context, setup SetupContextFunc) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = &PanicError{Value: r, Stack: debug.Stack()}
+		}
+	}()
+	return setup(ctx)
+}
+
+//funcName returns the name of a func to identify it in the logs
+func funcName(f interface{}) string {
+	if fn := runtime.FuncForPC(reflect.ValueOf(f).Pointer()); fn != nil {
+		return fn.Name()
+	}
+	return "unknown"
+}
+
+//sortSteps validates the step names and dependencies and returns the dependents indexes and the dependencies count of each step
+func sortSteps(steps []Step) ([][]int, []int, error) {
+	indexes := make(map[string]int, len(steps))
+	for i, step := range steps {
+		if step.Setup == nil && step.SetupContext == nil {
+			return nil, nil, &StepError{Step: step.Name, Err: ErrSetupNoFunc}
+		}
+		if _, found := indexes[step.Name]; found {
+			return nil, nil, &StepError{Step: step.Name, Err: ErrSetupDuplicate}
+		}
+		indexes[step.Name] = i
+	}
+	dependents := make([][]int, len(steps))
+	pending := make([]int, len(steps))
+	for i, step := range steps {
+		for _, dependency := range step.DependsOn {
+			j, found := indexes[dependency]
+			if !found {
+				return nil, nil, &StepError{Step: step.Name, Err: ErrSetupDependency}
+			}
+			dependents[j] = append(dependents[j], i)
+			pending[i]++
+		}
+	}
+	remaining := append([]int(nil), pending...)
+	var queue []int
+	for i, count := range remaining {
+		if count == 0 {
+			queue = append(queue, i)
+		}
+	}
+	sorted := 0
+	for ; len(queue) > 0; queue = queue[1:] {
+		sorted++
+		for _, j := range dependents[queue[0]] {
+			if remaining[j]--; remaining[j] == 0 {
+				queue = append(queue, j)
+			}
+		}
+	}
+	if sorted < len(steps) {
+		for i, count := range remaining {
+			if count > 0 {
+				return nil, nil, &StepError{Step: steps[i].Name, Err: ErrSetupCycle}
+			}
+		}
+	}
+	return dependents, pending, nil
+}
+
+//callStep calls the step setup function once, bounded by the Timeout and the ctx.
+//When the attempt is abandoned by the Timeout or the ctx, it also returns the channel of the still running call result
+func callStep(ctx context.Context, step Step) (<-chan error, error) {
+	setup := step.SetupContext
+	if setup == nil {
+		setup = step.Setup.WithContext()
+	}
+	attemptCtx := stepContext(ctx, step.Name)
+	if step.Timeout > 0 {
+		var cancel context.CancelFunc
+		attemptCtx, cancel = context.WithTimeout(attemptCtx, step.Timeout)
+		defer cancel()
+	}
+	if attemptCtx.Done() == nil {
+		return nil, safeSetup(attemptCtx, setup)
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- safeSetup(attemptCtx, setup)
+	}()
+	select {
+	case err := <-done:
+		if err == nil || attemptCtx.Err() == nil {
+			return nil, err
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, ErrSetupTimeout
+	case <-attemptCtx.Done():
+	}
+	if ctx.Err() != nil {
+		return done, ctx.Err()
+	}
+	return done, ErrSetupTimeout
+}
+
+//runStep calls the step with its retry policy until it succeeds, the retries end or the ctx is done.
+//A timed out attempt is retried only after it returns, so the setup function never runs concurrently with itself
+func runStep(ctx context.Context, step Step) StepResult {
+	start := time.Now()
+	result := StepResult{Name: step.Name}
+	delay := step.RetryDelay
+	for {
+		var abandoned <-chan error
+		result.Attempts++
+		abandoned, result.Err = callStep(ctx, step)
+		if result.Err == nil || result.Attempts > step.Retries || ctx.Err() != nil {
+			break
+		}
+		if abandoned != nil {
+			select {
+			case err := <-abandoned:
+				if err == nil {
+					//The timed out attempt finished the setup, a retry would do it again
+					result.Err = nil
+					result.Duration = time.Since(start)
+					return result
+				}
+			case <-ctx.Done():
+				result.Err = ctx.Err()
+				result.Duration = time.Since(start)
+				return result
+			}
+		}
+		l.Warn("haki.SetupStepRetry",
+			l.String("step", step.Name),
+			l.Int("attempt", result.Attempts),
+			l.Err(result.Err),
+		)
+		if delay > 0 {
+			timer := time.NewTimer(delay)
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				timer.Stop()
+				result.Err = ctx.Err()
+				result.Duration = time.Since(start)
+				return result
+			}
+			delay *= 2
+		}
+	}
+	result.Duration = time.Since(start)
+	return result
+}
+
+type stepDone struct {
+	index  int
+	result StepResult
+}
+
+//SetupSteps calls the steps after their dependencies, running the independent steps in parallel.
+//A failed step skips its dependents with ErrSetupSkipped and a done ctx skips the steps not started yet.
+//It returns the report of all steps and the report Err, or the validation error of the steps names and dependencies
+func SetupSteps(ctx context.Context, steps ...Step) (SetupReport, error) {
+	start := time.Now()
+	dependents, pending, err := sortSteps(steps)
+	if err != nil {
+		l.Error("haki.SetupStepsErr", l.Err(err))
+		return SetupReport{}, err
+	}
+	report := SetupReport{Steps: make([]StepResult, len(steps))}
+	failed := make([]bool, len(steps))
+	done := make(chan stepDone, len(steps))
+	running := 0
+	launch := func(i int) {
+		running++
+		go func() {
+			done <- stepDone{index: i, result: runStep(ctx, steps[i])}
+		}()
+	}
+	var finished []stepDone
+	schedule := func(i int) {
+		switch {
+		case failed[i]:
+			finished = append(finished, stepDone{index: i, result: StepResult{Name: steps[i].Name, Err: ErrSetupSkipped}})
+		case ctx.Err() != nil:
+			finished = append(finished, stepDone{index: i, result: StepResult{Name: steps[i].Name, Err: ctx.Err()}})
+		default:
+			launch(i)
+		}
+	}
+	for i, count := range pending {
+		if count == 0 {
+			schedule(i)
+		}
+	}
+	for running > 0 || len(finished) > 0 {
+		if len(finished) == 0 {
+			finished = append(finished, <-done)
+			running--
+		}
+		d := finished[0]
+		finished = finished[1:]
+		report.Steps[d.index] = d.result
+		if d.result.Err != nil {
+			l.Error("haki.SetupStepErr",
+				l.String("step", d.result.Name),
+				l.Duration("duration", d.result.Duration),
+				l.Int("attempts", d.result.Attempts),
+				l.Err(d.result.Err),
+			)
+		} else {
+			l.Info("haki.SetupStep",
+				l.String("step", d.result.Name),
+				l.Duration("duration", d.result.Duration),
+				l.Int("attempts", d.result.Attempts),
+			)
+		}
+		for _, j := range dependents[d.index] {
+			if d.result.Err != nil {
+				failed[j] = true
+			}
+			if pending[j]--; pending[j] == 0 {
+				schedule(j)
+			}
+		}
+	}
+	report.Duration = time.Since(start)
+	return report, report.Err()
+}